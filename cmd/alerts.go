@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/j4ng5y/hvm/internal/slack"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+const (
+	// alertDrift means the destination drifted beyond the threshold.
+	alertDrift = "drift"
+	// alertDriftResolved means the destination is back within the threshold.
+	alertDriftResolved = "drift_resolved"
+	// alertSyncFailed means a sync run by the daemon failed.
+	alertSyncFailed = "sync_failed"
+)
+
+type (
+	// alert is the JSON body posted to the generic alerts webhook.
+	alert struct {
+		Kind    string      `json:"kind"`
+		Time    time.Time   `json:"time"`
+		Job     string      `json:"job,omitempty"`
+		Mount   string      `json:"mount"`
+		Path    string      `json:"path"`
+		Summary string      `json:"summary"`
+		Drift   *driftCount `json:"drift,omitempty"`
+		Run     *runInfo    `json:"run,omitempty"`
+		Error   string      `json:"error,omitempty"`
+	}
+
+	// driftCount is the outcome of a drift check.
+	driftCount struct {
+		Changed   int `json:"changed"`
+		Missing   int `json:"missing"`
+		Extra     int `json:"extra"`
+		Errors    int `json:"errors"`
+		Threshold int `json:"threshold"`
+	}
+)
+
+// sendAlert posts a to the configured Slack and generic webhooks. Failures
+// are logged, as there is nowhere else to report them.
+func sendAlert(ctx context.Context, cfg vaultsync.Alerts, a alert) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if cfg.SlackWebhookURL != "" {
+		icon := ":warning:"
+		switch a.Kind {
+		case alertDriftResolved:
+			icon = ":white_check_mark:"
+		case alertSyncFailed:
+			icon = ":x:"
+		}
+		if err := slack.PostWebhook(ctx, cfg.SlackWebhookURL, icon+" "+a.Summary); err != nil {
+			log.Error().Err(err).Str("alert", a.Kind).Msg("Failed to post alert to Slack")
+		}
+	}
+	if cfg.WebhookURL != "" {
+		if err := postJSON(ctx, cfg.WebhookURL, a); err != nil {
+			log.Error().Err(err).Str("alert", a.Kind).Msg("Failed to post alert to webhook")
+		}
+	}
+}
+
+// postJSON posts v as JSON to url.
+func postJSON(ctx context.Context, url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// watchDrift checks for drift every interval until the daemon stops.
+func (d *daemon) watchDrift(interval time.Duration) {
+	log.Info().Dur("interval", interval).Msg("Checking for drift periodically")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	drifted := false
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			drifted = d.checkDrift(drifted)
+		}
+	}
+}
+
+// checkDrift diffs the vaults, unless a sync is running, and alerts when
+// the drift crosses the threshold in either direction.
+//
+// Arguments:
+//
+//	wasDrifted: bool - Whether the last check found drift beyond the threshold.
+//
+// Returns:
+//
+//	bool - Whether the vaults have drifted beyond the threshold.
+func (d *daemon) checkDrift(wasDrifted bool) bool {
+	d.mu.Lock()
+	running := d.cancel != nil
+	d.mu.Unlock()
+	if running {
+		return wasDrifted
+	}
+
+	cfg, err := loadConfig(d.cmd)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load config for drift check")
+		return wasDrifted
+	}
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create syncer for drift check")
+		return wasDrifted
+	}
+	defer syncer.Close()
+	report, err := syncer.Diff(d.ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Drift check failed")
+		return wasDrifted
+	}
+
+	count := &driftCount{Changed: report.Changed, Missing: report.Missing, Extra: report.Extra, Errors: report.Errors, Threshold: cfg.Alerts.DriftThreshold}
+	drift := report.Changed + report.Missing + report.Extra
+	drifted := drift > cfg.Alerts.DriftThreshold
+	a := alert{Time: time.Now().UTC(), Job: cfg.Metrics.Job, Mount: report.Mount, Path: report.Path, Drift: count}
+	switch {
+	case drifted && !wasDrifted:
+		a.Kind = alertDrift
+		a.Summary = fmt.Sprintf("hvm: %s/%s on the target vault has drifted from the source: %d changed, %d missing, %d extra (threshold %d)",
+			report.Mount, report.Path, report.Changed, report.Missing, report.Extra, cfg.Alerts.DriftThreshold)
+	case !drifted && wasDrifted:
+		a.Kind = alertDriftResolved
+		a.Summary = fmt.Sprintf("hvm: %s/%s on the target vault is back within the drift threshold: %d changed, %d missing, %d extra (threshold %d)",
+			report.Mount, report.Path, report.Changed, report.Missing, report.Extra, cfg.Alerts.DriftThreshold)
+	default:
+		return drifted
+	}
+	log.Warn().Str("alert", a.Kind).Int("drift", drift).Int("threshold", cfg.Alerts.DriftThreshold).Msg("Drift threshold crossed")
+	sendAlert(d.ctx, cfg.Alerts, a)
+	return drifted
+}
+
+// alertSyncFailed alerts that a sync run by the daemon failed.
+func (d *daemon) alertSyncFailed(cfg *vaultsync.Config, report *vaultsync.Report, err error) {
+	a := alert{
+		Kind:  alertSyncFailed,
+		Time:  time.Now().UTC(),
+		Job:   cfg.Metrics.Job,
+		Mount: cfg.SourceVault.Mount,
+		Path:  cfg.SourceVault.Path,
+		Error: err.Error(),
+	}
+	a.Summary = fmt.Sprintf("hvm: sync of %s/%s failed: %v", a.Mount, a.Path, err)
+	if report != nil {
+		a.Run = newRunInfo(report)
+		a.Summary = fmt.Sprintf("hvm: sync %s of %s/%s failed: %d created, %d updated, %d failed: %v",
+			report.RunID, a.Mount, a.Path, report.Created, report.Updated, report.Failed, err)
+	}
+	sendAlert(d.ctx, cfg.Alerts, a)
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+// auditPollInterval is how often a followed audit file is checked for new
+// entries once its end is reached.
+const auditPollInterval = 500 * time.Millisecond
+
+var followAuditCmd = &cobra.Command{
+	Use:   "follow-audit",
+	Short: "Sync secrets as they are written, by following a Vault file or socket audit device",
+	RunE:  followAuditFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(followAuditCmd)
+
+	followAuditCmd.Flags().String("audit_file", "", "The log file of a file audit device to follow")
+	followAuditCmd.Flags().String("audit_socket", "", "The address a socket audit device sends to, e.g. tcp://:9000 or unix:///run/hvm/audit.sock")
+	followAuditCmd.Flags().Duration("debounce", vaultsync.DefaultAuditDebounce, "How long to collect writes before syncing them")
+	followAuditCmd.MarkFlagsOneRequired("audit_file", "audit_socket")
+	followAuditCmd.MarkFlagsMutuallyExclusive("audit_file", "audit_socket")
+}
+
+func followAuditFunc(cmd *cobra.Command, args []string) error {
+	debounce, err := cmd.Flags().GetDuration("debounce")
+	if err != nil {
+		return fmt.Errorf("failed to get debounce: %w", err)
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	opts, err := syncOptions(cfg)
+	if err != nil {
+		return err
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	entries := make(chan []byte, 1024)
+	errs := make(chan error, 1)
+	go func() {
+		if file := cmd.Flag("audit_file").Value.String(); file != "" {
+			errs <- tailAuditFile(ctx, file, entries)
+		} else {
+			errs <- listenAuditSocket(ctx, cmd.Flag("audit_socket").Value.String(), entries)
+		}
+		cancel()
+	}()
+
+	err = syncer.FollowAudit(ctx, entries, debounce, func(r *vaultsync.Report) {
+		if err := vaultsync.SaveRun(cfg.RunDir(), r); err != nil {
+			log.Error().Err(err).Msg("Failed to save run")
+		}
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// tailAuditFile sends every entry appended to an audit log file to entries,
+// starting at its current end, until ctx is done. A file that is rotated or
+// truncated is reopened from its start.
+func tailAuditFile(ctx context.Context, path string, entries chan<- []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer func() { f.Close() }()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek audit file: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			if !sendEntry(ctx, entries, append(partial, line...)) {
+				return ctx.Err()
+			}
+			partial = nil
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read audit file: %w", err)
+		}
+		partial = append(partial, line...)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(auditPollInterval):
+		}
+
+		// Reopen the file if it was replaced or truncated by log rotation.
+		cur, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat audit file: %w", err)
+		}
+		next, err := os.Stat(path)
+		if err != nil || (os.SameFile(cur, next) && next.Size() >= offset) {
+			continue
+		}
+		nf, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		log.Info().Str("file", path).Msg("Audit file rotated, reopening")
+		f.Close()
+		f, offset, partial = nf, 0, nil
+		r.Reset(f)
+	}
+}
+
+// listenAuditSocket accepts connections from a socket audit device on addr,
+// a tcp:// or unix:// URL, and sends every entry they carry to entries until
+// ctx is done.
+func listenAuditSocket(ctx context.Context, addr string, entries chan<- []byte) error {
+	network, address, ok := strings.Cut(addr, "://")
+	if !ok || (network != "tcp" && network != "unix") {
+		return fmt.Errorf("invalid audit socket %q: want tcp://HOST:PORT or unix://PATH", addr)
+	}
+
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for audit entries: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	log.Info().Str("addr", addr).Msg("Listening for audit entries")
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to accept audit connection: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+			sc := bufio.NewScanner(conn)
+			sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+			for sc.Scan() {
+				if !sendEntry(ctx, entries, append([]byte(nil), sc.Bytes()...)) {
+					return
+				}
+			}
+			if err := sc.Err(); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("Failed to read audit connection")
+			}
+		}()
+	}
+}
+
+// sendEntry sends an entry unless ctx is done first.
+func sendEntry(ctx context.Context, entries chan<- []byte, entry []byte) bool {
+	select {
+	case entries <- entry:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
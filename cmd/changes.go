@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var changesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "List source secrets changed since a given time as JSON lines",
+	RunE:  changesFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(changesCmd)
+
+	changesCmd.Flags().String("since", "", "An RFC 3339 timestamp, or a duration such as 24h meaning that long ago")
+	changesCmd.Flags().StringP("output", "o", "", "Write the changes to this file instead of stdout")
+	if err := changesCmd.MarkFlagRequired("since"); err != nil {
+		log.Fatal().Err(err).Msg("Failed to mark since flag required")
+	}
+}
+
+func changesFunc(cmd *cobra.Command, args []string) error {
+	since, err := parseSince(cmd.Flag("since").Value.String())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	changes, err := syncer.Changes(cmd.Context(), since)
+	if err != nil {
+		return fmt.Errorf("failed to list changes: %w", err)
+	}
+
+	var w io.Writer = cmd.OutOrStdout()
+	if output := cmd.Flag("output").Value.String(); output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	for _, c := range changes {
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
+	}
+	log.Info().Int("changed", len(changes)).Time("since", since).Msg("Listed changes")
+	return nil
+}
+
+// parseSince parses an RFC 3339 timestamp or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want an RFC 3339 timestamp or a duration", s)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var migrateClusterCmd = &cobra.Command{
+	Use:   "migrate-cluster",
+	Short: "Plan, or with --apply carry out, moving every KV mount, policy, and auth method to the target vault",
+	RunE:  migrateClusterFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(migrateClusterCmd)
+
+	migrateClusterCmd.Flags().Bool("apply", false, "Carry out the plan instead of only showing it")
+	migrateClusterCmd.Flags().Bool("yes", false, "Apply without asking for confirmation")
+	migrateClusterCmd.Flags().String("report_file", "", "Write a JSON report of the plan, or of the migration, to this file")
+}
+
+func migrateClusterFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	apply, err := cmd.Flags().GetBool("apply")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	opts, err := syncOptions(cfg)
+	if err != nil {
+		return err
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	// The plan is always shown before anything is written.
+	plan, planErr := syncer.MigrateCluster(cmd.Context(), false)
+	out := cmd.OutOrStdout()
+	if plan != nil {
+		printClusterReport(out, plan)
+	}
+	if planErr != nil {
+		if plan != nil {
+			writeClusterReport(cmd, plan)
+		}
+		return fmt.Errorf("failed to plan cluster migration: %w", planErr)
+	}
+	if !apply {
+		writeClusterReport(cmd, plan)
+		return nil
+	}
+
+	if !yes {
+		fmt.Fprint(cmd.ErrOrStderr(), "Apply this plan to the target vault? [y/N] ")
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			return fmt.Errorf("cluster migration not confirmed")
+		}
+	}
+
+	report, applyErr := syncer.MigrateCluster(cmd.Context(), true)
+	if report != nil {
+		fmt.Fprintln(out)
+		printClusterReport(out, report)
+		writeClusterReport(cmd, report)
+	}
+	if applyErr != nil {
+		return fmt.Errorf("failed to migrate cluster: %w", applyErr)
+	}
+	return nil
+}
+
+// writeClusterReport writes r to the --report_file, if one was given.
+func writeClusterReport(cmd *cobra.Command, r *vaultsync.ClusterReport) {
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, r); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+}
+
+// printClusterReport prints a plan or applied migration stage by stage.
+func printClusterReport(w io.Writer, r *vaultsync.ClusterReport) {
+	verb := "would be "
+	if r.Applied {
+		verb = ""
+	}
+
+	fmt.Fprintln(w, "KV mounts:")
+	for _, m := range r.Mounts {
+		fmt.Fprintf(w, "  %s (KV v%d): %s\n", m.Path, m.Version, m.Action)
+	}
+
+	if p := r.Policies; p != nil {
+		fmt.Fprintf(w, "Policies: %d %screated, %d %supdated, %d unchanged, %d skipped, %d failed\n",
+			p.Created, verb, p.Updated, verb, p.Unchanged, p.Skipped, p.Failed)
+	}
+
+	if a := r.Auth; a != nil {
+		fmt.Fprintln(w, "Auth methods:")
+		for _, m := range a.Mounts {
+			fmt.Fprintf(w, "  %s (%s): %s\n", m.Path, m.Type, m.Action)
+			if m.Error != "" {
+				fmt.Fprintf(w, "    error: %s\n", m.Error)
+			}
+			for _, n := range m.NotExported {
+				fmt.Fprintf(w, "    not exported, set by hand: %s\n", n)
+			}
+		}
+	}
+
+	if len(r.Diffs) > 0 {
+		fmt.Fprintln(w, "Secrets:")
+		for _, d := range r.Diffs {
+			fmt.Fprintf(w, "  %s: %d missing, %d changed, %d matched, %d extra, %d errors\n",
+				d.Mount, d.Missing, d.Changed, d.Matched, d.Extra, d.Errors)
+		}
+	}
+	if s := r.Sync; s != nil {
+		fmt.Fprintf(w, "Secrets: %d created, %d updated, %d unchanged, %d skipped, %d failed\n",
+			s.Created, s.Updated, s.Unchanged, s.Skipped, s.Failed)
+	}
+
+	for _, e := range r.Errors {
+		fmt.Fprintf(w, "Error: %s\n", e)
+	}
+}
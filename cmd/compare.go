@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Summarize how the source and target clusters differ: mounts, policies, and secret counts",
+	RunE:  compareFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringP("output", "o", outputTable, "Print the summary as: table, json, yaml, or markdown")
+	compareCmd.Flags().String("report_file", "", "Write a JSON report of the summary to this file")
+}
+
+func compareFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, compareErr := syncer.Compare(cmd.Context())
+	if report != nil {
+		if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+			if err := writeReport(reportFile, report); err != nil {
+				log.Error().Err(err).Msg("Failed to write report")
+			}
+		}
+		if err := renderCompare(cmd.OutOrStdout(), format, report); err != nil {
+			log.Error().Err(err).Msg("Failed to print summary")
+		}
+	}
+
+	if compareErr != nil {
+		return fmt.Errorf("failed to compare: %w", compareErr)
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("failed to count the secrets of %d mounts", len(report.Errors))
+	}
+	return nil
+}
+
+// renderCompare writes a cluster comparison in format.
+func renderCompare(w io.Writer, format string, r *vaultsync.CompareReport) error {
+	table := func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "MOUNT\tPRESENT ON\tSOURCE\tTARGET\tSOURCE SECRETS\tTARGET SECRETS\tERROR")
+		for _, m := range r.Mounts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Path, m.Presence,
+				engineName(m.SourceType, m.SourceVersion), engineName(m.DestinationType, m.DestinationVersion),
+				secretCount(m.SourceType, m.SourceSecrets), secretCount(m.DestinationType, m.DestinationSecrets), m.Error)
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "Policies on both:\t%d\n", r.Policies.Common)
+		fmt.Fprintf(tw, "Policies only on source:\t%s\n", strings.Join(r.Policies.SourceOnly, ", "))
+		fmt.Fprintf(tw, "Policies only on target:\t%s\n", strings.Join(r.Policies.DestinationOnly, ", "))
+		return tw.Flush()
+	}
+	markdown := func(w io.Writer) error {
+		fmt.Fprintln(w, "## Cluster comparison")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Compared %s in %s.\n\n", r.StartedAt.Format(time.RFC3339), r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+		fmt.Fprintln(w, "| Mount | Present on | Source | Target | Source secrets | Target secrets | Error |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | ---: | ---: | --- |")
+		for _, m := range r.Mounts {
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s |\n", mdCode(m.Path), m.Presence,
+				engineName(m.SourceType, m.SourceVersion), engineName(m.DestinationType, m.DestinationVersion),
+				secretCount(m.SourceType, m.SourceSecrets), secretCount(m.DestinationType, m.DestinationSecrets), mdText(m.Error))
+		}
+		fmt.Fprintf(w, "\n%d policies are on both vaults.\n", r.Policies.Common)
+		for _, side := range []struct {
+			name  string
+			names []string
+		}{{"source", r.Policies.SourceOnly}, {"target", r.Policies.DestinationOnly}} {
+			if len(side.names) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "\nPolicies only on the %s vault:\n\n", side.name)
+			for _, n := range side.names {
+				fmt.Fprintf(w, "- %s\n", mdCode(n))
+			}
+		}
+		return nil
+	}
+	return render(w, format, r, table, markdown)
+}
+
+// engineName names a secrets engine type, with its version for KV.
+func engineName(typ string, version int) string {
+	if typ == "kv" {
+		return "kv v" + strconv.Itoa(version)
+	}
+	return typ
+}
+
+// secretCount formats the secret count of a mount, which is only known for
+// KV mounts.
+func secretCount(typ string, n int) string {
+	if typ != "kv" {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
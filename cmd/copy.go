@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy SRC_PATH [DST_PATH]",
+	Short: "Copy a secret, or the secrets in a folder ending in /, to DST_PATH (SRC_PATH by default) on the target vault",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  copyFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+
+	copyCmd.Flags().String("report_file", "", "Write a JSON report of the copy to this file")
+}
+
+func copyFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := destinationOptions(cfg)
+	if err != nil {
+		return err
+	}
+	srcOpts, err := sourceOptions(cfg)
+	if err != nil {
+		return err
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, append(opts, srcOpts...)...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	dst := ""
+	if len(args) == 2 {
+		dst = args[1]
+	}
+	report, copyErr := syncer.Copy(cmd.Context(), args[0], dst)
+	if report == nil {
+		return fmt.Errorf("failed to copy: %w", copyErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, res := range report.Secrets {
+		fmt.Fprintf(out, "%s: %s\n", res.Path, res.Action)
+		if res.Error != "" {
+			fmt.Fprintf(out, "  %s\n", res.Error)
+		}
+	}
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if copyErr != nil {
+		return fmt.Errorf("failed to copy: %w", copyErr)
+	}
+	return nil
+}
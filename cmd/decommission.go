@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var decommissionCmd = &cobra.Command{
+	Use:   "decommission",
+	Short: "Delete source secrets that a verified run copied to the target vault",
+	RunE:  decommissionFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(decommissionCmd)
+
+	decommissionCmd.Flags().String("run_id", "", "The ID of the verified run whose source secrets should be deleted")
+	decommissionCmd.Flags().Bool("destroy", false, "Permanently destroy every version and the metadata instead of soft-deleting")
+	decommissionCmd.Flags().String("confirm", "", "Skip the interactive prompt by repeating the run ID")
+	decommissionCmd.Flags().String("confirm_destroy", "", "Skip the interactive destroy prompt by repeating the run ID; --confirm alone does not cover --destroy")
+	decommissionCmd.Flags().String("report_file", "", "Write a JSON report of the deletions to this file")
+	if err := decommissionCmd.MarkFlagRequired("run_id"); err != nil {
+		log.Fatal().Err(err).Msg("Failed to mark run_id flag required")
+	}
+}
+
+func decommissionFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	runID := cmd.Flag("run_id").Value.String()
+	run, err := vaultsync.LoadRun(cfg.RunDir(), runID)
+	if err != nil {
+		return err
+	}
+
+	destroy, err := cmd.Flags().GetBool("destroy")
+	if err != nil {
+		return err
+	}
+
+	// Both prompts read from one reader, which may buffer past the first line.
+	in := bufio.NewReader(cmd.InOrStdin())
+	confirm := cmd.Flag("confirm").Value.String()
+	if confirm == "" {
+		verb := "soft-delete"
+		if destroy {
+			verb = "PERMANENTLY DESTROY"
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "This will %s the source secrets under %s/%s copied by run %s.\nType the run ID to continue: ", verb, run.Mount, run.Path, run.RunID)
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+		confirm = strings.TrimSpace(line)
+	}
+	if confirm != run.RunID {
+		return fmt.Errorf("confirmation %q does not match run ID %q", confirm, run.RunID)
+	}
+	if destroy {
+		confirmDestroy := cmd.Flag("confirm_destroy").Value.String()
+		if confirmDestroy == "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Destroyed secrets cannot be recovered, not even by undeleting them.\nType the run ID again to destroy them: ")
+			line, err := in.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read destroy confirmation: %w", err)
+			}
+			confirmDestroy = strings.TrimSpace(line)
+		}
+		if confirmDestroy != run.RunID {
+			return fmt.Errorf("destroy confirmation %q does not match run ID %q", confirmDestroy, run.RunID)
+		}
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, decErr := syncer.Decommission(cmd.Context(), run, destroy)
+	if report != nil {
+		if err := vaultsync.SaveRun(cfg.RunDir(), report); err != nil {
+			log.Error().Err(err).Msg("Failed to save decommission run")
+		}
+		if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+			if err := writeReport(reportFile, report); err != nil {
+				log.Error().Err(err).Msg("Failed to write report")
+			}
+		}
+	}
+
+	if decErr != nil {
+		return fmt.Errorf("failed to decommission: %w", decErr)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/j4ng5y/hvm/internal/azure"
+	"github.com/j4ng5y/hvm/internal/kubernetes"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+// destinationOptions returns the Syncer option for the configured non-vault
+// destination, if any.
+func destinationOptions(cfg *vaultsync.Config) ([]vaultsync.Option, error) {
+	if cfg.AzureKeyVault.Enabled && cfg.Kubernetes.Enabled {
+		return nil, fmt.Errorf("only one of azureKeyVault and kubernetes may be enabled")
+	}
+
+	switch {
+	case cfg.AzureKeyVault.Enabled:
+		switch cfg.AzureKeyVault.Mode {
+		case "", azure.ModeBlob, azure.ModeField:
+		default:
+			return nil, fmt.Errorf("unknown azure key vault mode %q", cfg.AzureKeyVault.Mode)
+		}
+		if cfg.AzureKeyVault.VaultURL == "" {
+			return nil, fmt.Errorf("azure key vault requires a vault URL")
+		}
+
+		return []vaultsync.Option{vaultsync.WithDestination(&azure.KeyVault{
+			VaultURL:     cfg.AzureKeyVault.VaultURL,
+			TenantID:     cfg.AzureKeyVault.TenantID,
+			ClientID:     cfg.AzureKeyVault.ClientID,
+			ClientSecret: cfg.AzureKeyVault.ClientSecret,
+			Mode:         cfg.AzureKeyVault.Mode,
+		})}, nil
+
+	case cfg.Kubernetes.Enabled:
+		k := cfg.Kubernetes
+		kcfg := kubernetes.Config{
+			APIServer:   k.APIServer,
+			TokenFile:   k.TokenFile,
+			CAFile:      k.CAFile,
+			Namespace:   k.Namespace,
+			Labels:      k.Labels,
+			Annotations: k.Annotations,
+		}
+		for _, r := range k.NamespaceRules {
+			kcfg.NamespaceRules = append(kcfg.NamespaceRules, kubernetes.NamespaceRule{Match: r.Match, Namespace: r.Namespace})
+		}
+		for _, o := range k.OwnerReferences {
+			kcfg.OwnerReferences = append(kcfg.OwnerReferences, kubernetes.OwnerReference{
+				APIVersion: o.APIVersion,
+				Kind:       o.Kind,
+				Name:       o.Name,
+				UID:        o.UID,
+				Controller: o.Controller,
+			})
+		}
+
+		secrets, err := kubernetes.NewSecrets(kcfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes destination: %w", err)
+		}
+		return []vaultsync.Option{vaultsync.WithDestination(secrets)}, nil
+	}
+	return nil, nil
+}
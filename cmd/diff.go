@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the source and target vaults without writing anything",
+	RunE:  diffFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().String("report_file", "", "Write a JSON report of the comparison to this file")
+	diffCmd.Flags().StringP("output", "o", outputTable, "Print the comparison as: table, json, yaml, or markdown")
+}
+
+func diffFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, diffErr := syncer.Diff(cmd.Context())
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportFile, b, 0o600)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if report != nil {
+		if err := renderDiff(cmd.OutOrStdout(), format, report); err != nil {
+			log.Error().Err(err).Msg("Failed to print comparison")
+		}
+	}
+
+	switch {
+	case diffErr != nil:
+		return fmt.Errorf("failed to diff: %w", diffErr)
+	case report.Errors > 0:
+		return fmt.Errorf("failed to compare %d secrets", report.Errors)
+	case report.Drifted():
+		return fmt.Errorf("drift detected: %d changed, %d missing, %d extra", report.Changed, report.Missing, report.Extra)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/viper"
+)
+
+// envPrefix prefixes the environment variables that override config keys.
+const envPrefix = "HVM"
+
+// bindEnv lets every config key be set from the environment, as HVM_ and
+// the upper-cased key with dots replaced by underscores, e.g.
+// HVM_SRCVAULT_ADDR for srcVault.addr. Lists are comma separated; maps and
+// lists of rules can only be set in the config file.
+//
+// Arguments:
+//
+//	v: *viper.Viper - The viper instance to bind.
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	// AutomaticEnv only applies to keys viper already knows, so bind the
+	// keys the config file leaves out as well.
+	for _, key := range configKeys(reflect.TypeOf(vaultsync.Config{}), "") {
+		_ = v.BindEnv(key)
+	}
+}
+
+// configKeys returns the dotted mapstructure keys of the scalar and scalar
+// list fields of t.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Struct:
+			keys = append(keys, configKeys(ft, key+".")...)
+		case reflect.Map:
+		case reflect.Slice:
+			if ft.Elem().Kind() != reflect.Struct {
+				keys = append(keys, key)
+			}
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+const (
+	// ExitFailure is the exit code when a command fails outright, including
+	// when every secret in a sync failed.
+	ExitFailure = 1
+	// ExitPartialFailure is the exit code when a sync completed but some of
+	// its secrets failed.
+	ExitPartialFailure = 2
+	// ExitDeadline is the exit code when a sync stopped at its maximum
+	// duration before every secret was synced.
+	ExitDeadline = 3
+	// ExitCancelled is the exit code when a command was cancelled by
+	// SIGINT or SIGTERM, following the shell convention for SIGINT.
+	ExitCancelled = 130
+)
+
+// ExitCode returns the process exit code for an error returned by CLI.
+//
+// Arguments:
+//
+//	err: error - The error returned by CLI.
+//
+// Returns:
+//
+//	int - The exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ExitCancelled
+	}
+	if errors.Is(err, vaultsync.ErrMaxDuration) {
+		return ExitDeadline
+	}
+
+	var syncErr *vaultsync.SyncError
+	if errors.As(err, &syncErr) && syncErr.Partial() {
+		return ExitPartialFailure
+	}
+	return ExitFailure
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// exportArchive writes an encrypted archive for hvm import.
+	exportArchive = "archive"
+	// exportTerraform writes Terraform configuration for the Vault provider.
+	exportTerraform = "terraform"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the source secrets to an encrypted archive file, or as Terraform configuration",
+	RunE:  exportFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringP("output", "o", "", "The archive or Terraform file to write")
+	exportCmd.Flags().StringP("key_file", "k", "", "A file holding the 256-bit archive key, base64 or hex encoded; required for the archive format")
+	exportCmd.Flags().String("format", exportArchive, "Export as: archive, or terraform for vault_kv_secret_v2 and vault_policy resources with import blocks")
+	exportCmd.Flags().Bool("policies", true, "With the terraform format, also export the source vault's ACL policies")
+	if err := exportCmd.MarkFlagRequired("output"); err != nil {
+		log.Fatal().Err(err).Str("flag", "output").Msg("Failed to mark flag required")
+	}
+}
+
+func exportFunc(cmd *cobra.Command, args []string) error {
+	format := cmd.Flag("format").Value.String()
+	var key []byte
+	switch format {
+	case exportArchive:
+		keyFile := cmd.Flag("key_file").Value.String()
+		if keyFile == "" {
+			return fmt.Errorf("--key_file is required for the archive format")
+		}
+		var err error
+		if key, err = vaultsync.LoadArchiveKey(keyFile); err != nil {
+			return err
+		}
+	case exportTerraform:
+	default:
+		return fmt.Errorf("unknown export format %q, must be archive or terraform", format)
+	}
+	policies, err := cmd.Flags().GetBool("policies")
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := sourceOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	output := cmd.Flag("output").Value.String()
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s file: %w", format, err)
+	}
+
+	if format == exportTerraform {
+		// Only a source vault has policies.
+		if policies && len(opts) > 0 {
+			log.Info().Msg("Not exporting policies from a non-vault source")
+			policies = false
+		}
+		export, err := syncer.ExportTerraform(cmd.Context(), f, policies)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(output)
+			return fmt.Errorf("failed to export: %w", err)
+		}
+		log.Info().Str("file", output).Int("secrets", export.Secrets).Int("policies", export.Policies).Msg("Terraform configuration written; it holds secret values in plain text")
+		return nil
+	}
+
+	manifest, err := syncer.Export(cmd.Context(), f, key)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("failed to export: %w", err)
+	}
+
+	log.Info().Str("archive", output).Int("secrets", manifest.Secrets).Msg("Archive written")
+	return nil
+}
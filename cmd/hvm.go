@@ -1,10 +1,24 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/j4ng5y/hvm/internal/vaultsync"
+	"github.com/j4ng5y/hvm/internal/keyring"
+	"github.com/j4ng5y/hvm/internal/slack"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
 	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -15,6 +29,12 @@ var (
 		Use:     "hvm",
 		Short:   "Hashicorp Vault Migrator",
 		Version: version,
+		// Errors are logged by main, which also picks the exit code.
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogging(cmd)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := cmd.Help(); err != nil {
 				log.Error().Err(err).Msg("Failed to show help")
@@ -29,9 +49,9 @@ var (
 	runCmd = &cobra.Command{
 		Use:   "run",
 		Short: "Run the Hashicorp Vault Migrator",
-		Run:   runFunc,
+		RunE:  runFunc,
 	}
-	log = zerolog.New(os.Stderr).With().Timestamp().Caller().Logger()
+	log = zerolog.New(vaultsync.NewRedactWriter(os.Stderr)).With().Timestamp().Caller().Logger()
 	v   = viper.New()
 )
 
@@ -41,20 +61,102 @@ func init() {
 	initCmd.Flags().IntP("batch_size", "b", 100, "The batch size")
 
 	initCmd.Flags().StringP("source_vault_addr", "a", "http://localhost:8200", "The source vault address")
+	initCmd.Flags().StringSlice("source_fallback_addrs", nil, "Source vault addresses to fail over to when the source vault address is unreachable")
 	initCmd.Flags().StringP("target_vault_addr", "A", "http://localhost:8201", "The target vault address")
 	initCmd.Flags().StringP("source_token", "t", "", "The source vault token")
 	initCmd.Flags().String("source_token_command", "", "The source vault token command")
-	initCmd.MarkFlagsMutuallyExclusive("source_token", "source_token_command")
+	initCmd.Flags().String("source_token_file", "", "A file holding the source vault token, e.g. ~/.vault-token or a Vault Agent sink")
+	initCmd.Flags().String("source_token_keyring", "", "The name of an OS keyring entry holding the source vault token")
+	initCmd.MarkFlagsMutuallyExclusive("source_token", "source_token_command", "source_token_file", "source_token_keyring")
+	initCmd.Flags().Bool("source_wrapped_token", false, "The source vault token is a response-wrapping token to unwrap")
 	initCmd.Flags().StringP("target_token", "T", "", "The target vault token")
 	initCmd.Flags().String("target_token_command", "", "The target vault token command")
-	initCmd.MarkFlagsMutuallyExclusive("target_token", "target_token_command")
+	initCmd.Flags().String("target_token_file", "", "A file holding the target vault token, e.g. ~/.vault-token or a Vault Agent sink")
+	initCmd.Flags().String("target_token_keyring", "", "The name of an OS keyring entry holding the target vault token")
+	initCmd.MarkFlagsMutuallyExclusive("target_token", "target_token_command", "target_token_file", "target_token_keyring")
+	initCmd.Flags().Bool("keyring", false, "Store --source_token and --target_token in the OS keyring, keyed by vault address, instead of the config file")
+	initCmd.Flags().Bool("target_wrapped_token", false, "The target vault token is a response-wrapping token to unwrap")
 	initCmd.Flags().StringP("source_secret_path", "p", "path/to/my/secret", "The source vault secret path")
 	initCmd.Flags().StringP("target_secret_path", "P", "", "The target vault secret path if you wish to override it")
 	initCmd.Flags().StringP("source_secret_mount", "m", "secret", "The source vault secret mount")
 	initCmd.Flags().StringP("target_secret_mount", "M", "", "The target vault secret mount if you with to override it")
 
+	initCmd.Flags().Bool("source_replica", false, "The source vault is a performance secondary or read replica")
+	initCmd.Flags().String("source_forwarding", "", "Request forwarding on source performance standbys: none, always, or inconsistent")
+	initCmd.Flags().String("source_proxy", "", "An http, https, or socks5 proxy URL to reach the source vault through")
+	initCmd.Flags().String("target_proxy", "", "An http, https, or socks5 proxy URL to reach the target vault through")
+	initCmd.Flags().Bool("target_batch_token", false, "Exchange the target vault token for a batch token before writing")
+	initCmd.Flags().String("target_batch_token_ttl", "", "The TTL of the target vault batch token")
+
+	initCmd.Flags().Int("retry_max_attempts", 3, "The maximum number of attempts for a transient read/write error")
+	initCmd.Flags().Duration("retry_base_delay", 250*time.Millisecond, "The initial delay between retries")
+	initCmd.Flags().Duration("retry_max_delay", 30*time.Second, "The maximum delay between retries")
+	initCmd.Flags().Bool("retry_jitter", true, "Apply random jitter to retry delays")
+
+	initCmd.Flags().Duration("source_request_timeout", 0, "The timeout of each request to the source vault (0 for 60s)")
+	initCmd.Flags().Duration("target_request_timeout", 0, "The timeout of each request to the target vault (0 for 60s)")
+
+	initCmd.Flags().Float64("read_qps", 0, "The maximum requests per second against the source vault (0 for no limit)")
+	initCmd.Flags().Int("read_burst", 1, "The maximum burst of requests against the source vault")
+	initCmd.Flags().Float64("write_qps", 0, "The maximum requests per second against the target vault (0 for no limit)")
+	initCmd.Flags().Int("write_burst", 1, "The maximum burst of requests against the target vault")
+
+	initCmd.Flags().Int("list_workers", 0, "The number of folders listed concurrently during a recursive listing (0 for the batch size)")
+	initCmd.Flags().Int("read_workers", 0, "The maximum number of concurrent secret reads from the source vault (0 for the batch size)")
+	initCmd.Flags().Int("write_workers", 0, "The maximum number of concurrent secret writes to the target vault (0 for the batch size)")
+
+	initCmd.Flags().Int("max_procs", 0, "The maximum number of CPUs to use (0 for the runtime default)")
+	initCmd.Flags().String("memory_limit", "", "The soft memory limit, e.g. 512MiB; the batch size shrinks as usage approaches it")
+
+	initCmd.Flags().Bool("folder_checksums", false, "Maintain per-folder rollup checksums in the target vault")
+	initCmd.Flags().Bool("history", false, "Replay every retained version of each secret instead of only the current one")
+	initCmd.Flags().Int("chunk_max_bytes", 0, "Split secrets larger than this many bytes into chunks (0 to disable)")
+
+	initCmd.Flags().Int("diff_workers", 0, "The number of concurrent comparisons during a diff (0 for the batch size)")
+	initCmd.Flags().Float64("diff_source_qps", 0, "The maximum requests per second against the source vault during a diff (0 for no limit)")
+	initCmd.Flags().Float64("diff_target_qps", 0, "The maximum requests per second against the target vault during a diff (0 for no limit)")
+
+	initCmd.Flags().Duration("discovery_timeout", 0, "The maximum duration of the discovery stage (0 for no limit)")
+	initCmd.Flags().Duration("copy_timeout", 0, "The maximum duration of the copy stage (0 for no limit)")
+	initCmd.Flags().Duration("verify_timeout", 0, "The maximum duration of the verification stage (0 for no limit)")
+
+	initCmd.Flags().Bool("from_replication", false, "Generate one config file per KV v2 mount that the source performance primary replicates to each secondary")
+	initCmd.Flags().String("output_dir", ".", "The directory to write generated config files to when using --from_replication")
+
+	initCmd.Flags().String("metrics_addr", "", "Serve Prometheus metrics on this address, e.g. :9090")
+	initCmd.Flags().StringSlice("metrics_labels", nil, "The labels to attach to per-secret metrics: job, mount, folder")
+
+	initCmd.Flags().String("state_dir", vaultsync.DefaultStateDir, "The directory run reports are kept in")
+	initCmd.Flags().Bool("resume", false, "Resume the last interrupted run of the same path instead of starting over")
+	initCmd.Flags().Bool("all_kv_mounts", false, "Sync every KV v2 mount on the source vault to the mount of the same name on the target vault")
+	initCmd.Flags().Bool("create_missing_mounts", false, "Create target vault mounts that do not exist")
+	initCmd.Flags().String("on_replicated", "", "What to do with mounts Vault replication already copies to the target vault: warn or skip (no detection by default)")
+
+	runCmd.Flags().String("report_file", "", "Write a JSON report of the sync to this file")
+	runCmd.Flags().StringP("output", "o", "", "Print the report of the sync and its verification as: table, json, yaml, or markdown")
+	runCmd.Flags().Bool("all_kv_mounts", false, "Sync every KV v2 mount on the source vault instead of the configured mount and path")
+	runCmd.Flags().Bool("create_missing_mounts", false, "Create target vault mounts that do not exist, like the source mount")
+	runCmd.Flags().Duration("max_duration", 0, "Stop the sync cleanly, finishing in-flight secrets and saving a partial report, after this long (0 for no limit)")
+	runCmd.Flags().Bool("fail_fast", false, "Stop the whole sync at the first secret that fails, cancelling those in flight")
+	runCmd.Flags().String("max_errors", "", "Stop the sync once more secrets have failed than this count, or percentage such as 5%, of the secrets found")
+	runCmd.Flags().Bool("metadata_only", false, "Sync only the KV metadata of secrets that already exist on the target vault, not their data")
+	runCmd.Flags().Bool("ordered", false, "Sync secrets one at a time in lexicographic order, so runs are reproducible")
+	runCmd.Flags().Int("shard_index", 0, "The slice of the secrets this instance syncs, from 0 to --shard_total-1 (JOB_COMPLETION_INDEX by default)")
+	runCmd.Flags().Int("shard_total", 0, "Split the secrets between this many instances by a hash of their path, each run with its own --shard_index")
+	runCmd.Flags().Bool("circuit_breaker", false, "Pause writes while the target vault keeps failing, e.g. sealed, and resume once it is healthy")
+	runCmd.Flags().String("audit_log", "", "Append a JSON line to this file for every write and delete made, separate from the logs")
+	runCmd.Flags().Int("slowest", 0, "Also list the N secrets that took longest to sync, with the time spent reading, writing, and verifying each")
+	runCmd.Flags().BoolP("quiet", "q", false, "Log only errors, and print only the summary and the secrets that failed")
+	runCmd.Flags().String("termination_file", "", "Write a JSON summary of the outcome to this file however the run ends, e.g. /dev/termination-log")
+
 	rootCmd.PersistentFlags().StringP("config_file", "f", "./config.yaml", "The config file")
 	rootCmd.PersistentFlags().String("log_level", "info", "The log level")
+	rootCmd.PersistentFlags().String("log_format", logFormatJSON, "The log format: json, or console for human-readable lines")
+	rootCmd.PersistentFlags().String("log_file", "", "Write logs to this file, rotated by size and age, instead of stderr")
+	rootCmd.PersistentFlags().Int64("log_max_size", 100, "Rotate the log file once it reaches this many megabytes (0 for no limit)")
+	rootCmd.PersistentFlags().Duration("log_max_age", 0, "Rotate the log file after writing to it this long, e.g. 24h (0 for no limit)")
+	rootCmd.PersistentFlags().Int("log_max_backups", 5, "Keep this many rotated log files (0 to keep them all)")
+	rootCmd.PersistentFlags().Bool("log_stderr", false, "With --log_file, also write logs to stderr")
 }
 
 func initFunc(cmd *cobra.Command, args []string) {
@@ -77,13 +179,25 @@ func initFunc(cmd *cobra.Command, args []string) {
 	if cmd.Flag("source_vault_addr").Value.String() != "" {
 		v.Set("srcVault.addr", cmd.Flag("source_vault_addr").Value.String())
 	}
+	if addrs, err := cmd.Flags().GetStringSlice("source_fallback_addrs"); err != nil {
+		log.Error().Err(err).Msg("Failed to get source fallback addresses")
+	} else if len(addrs) > 0 {
+		v.Set("srcVault.fallbackAddrs", addrs)
+	}
 	switch {
 	case cmd.Flag("source_token").Value.String() != "":
-		v.Set("srcVault.token", cmd.Flag("source_token").Value.String())
+		setToken(cmd, "srcVault", cmd.Flag("source_vault_addr").Value.String(), cmd.Flag("source_token").Value.String())
 	case cmd.Flag("source_token_command").Value.String() != "":
 		v.Set("srcVault.tokenCmd", cmd.Flag("source_token_command").Value.String())
-	default:
-		log.Fatal().Msg("You must specify either a token or a token command")
+	case cmd.Flag("source_token_file").Value.String() != "":
+		v.Set("srcVault.tokenFile", cmd.Flag("source_token_file").Value.String())
+	case cmd.Flag("source_token_keyring").Value.String() != "":
+		v.Set("srcVault.tokenKeyring", cmd.Flag("source_token_keyring").Value.String())
+	case os.Getenv("SRC_VAULT_TOKEN") == "" && os.Getenv("VAULT_TOKEN") == "":
+		log.Fatal().Msg("You must specify a token, token command, token file, or keyring entry, or set SRC_VAULT_TOKEN or VAULT_TOKEN")
+	}
+	if cmd.Flag("source_wrapped_token").Value.String() == "true" {
+		v.Set("srcVault.wrappedToken", true)
 	}
 	if cmd.Flag("source_secret_path").Value.String() != "" {
 		v.Set("srcVault.path", cmd.Flag("source_secret_path").Value.String())
@@ -96,11 +210,18 @@ func initFunc(cmd *cobra.Command, args []string) {
 	}
 	switch {
 	case cmd.Flag("target_token").Value.String() != "":
-		v.Set("destVault.token", cmd.Flag("target_token").Value.String())
+		setToken(cmd, "destVault", cmd.Flag("target_vault_addr").Value.String(), cmd.Flag("target_token").Value.String())
 	case cmd.Flag("target_token_command").Value.String() != "":
 		v.Set("destVault.tokenCmd", cmd.Flag("target_token_command").Value.String())
-	default:
-		log.Fatal().Msg("You must specify either a token or a token command")
+	case cmd.Flag("target_token_file").Value.String() != "":
+		v.Set("destVault.tokenFile", cmd.Flag("target_token_file").Value.String())
+	case cmd.Flag("target_token_keyring").Value.String() != "":
+		v.Set("destVault.tokenKeyring", cmd.Flag("target_token_keyring").Value.String())
+	case os.Getenv("DST_VAULT_TOKEN") == "" && os.Getenv("VAULT_TOKEN") == "":
+		log.Fatal().Msg("You must specify a token, token command, token file, or keyring entry, or set DST_VAULT_TOKEN or VAULT_TOKEN")
+	}
+	if cmd.Flag("target_wrapped_token").Value.String() == "true" {
+		v.Set("destVault.wrappedToken", true)
 	}
 	if cmd.Flag("target_secret_path").Value.String() != "" {
 		v.Set("destVault.path", cmd.Flag("target_secret_path").Value.String())
@@ -108,16 +229,374 @@ func initFunc(cmd *cobra.Command, args []string) {
 	if cmd.Flag("target_secret_mount").Value.String() != "" {
 		v.Set("destVault.mount", cmd.Flag("target_secret_mount").Value.String())
 	}
+	if cmd.Flag("source_replica").Value.String() == "true" {
+		v.Set("srcVault.replica", true)
+	}
+	if cmd.Flag("source_forwarding").Value.String() != "" {
+		v.Set("srcVault.forwarding", cmd.Flag("source_forwarding").Value.String())
+	}
+	if cmd.Flag("source_proxy").Value.String() != "" {
+		v.Set("srcVault.proxy", cmd.Flag("source_proxy").Value.String())
+	}
+	if cmd.Flag("target_proxy").Value.String() != "" {
+		v.Set("destVault.proxy", cmd.Flag("target_proxy").Value.String())
+	}
+	if cmd.Flag("target_batch_token").Value.String() == "true" {
+		v.Set("destVault.batchToken", true)
+	}
+	if cmd.Flag("target_batch_token_ttl").Value.String() != "" {
+		v.Set("destVault.batchTokenTTL", cmd.Flag("target_batch_token_ttl").Value.String())
+	}
+	if maxAttempts, err := cmd.Flags().GetInt("retry_max_attempts"); err != nil {
+		log.Error().Err(err).Msg("Failed to get retry max attempts")
+	} else {
+		v.Set("retry.maxAttempts", maxAttempts)
+	}
+	if jitter, err := cmd.Flags().GetBool("retry_jitter"); err != nil {
+		log.Error().Err(err).Msg("Failed to get retry jitter")
+	} else {
+		v.Set("retry.jitter", jitter)
+	}
+	if cmd.Flag("folder_checksums").Value.String() == "true" {
+		v.Set("checksums.enabled", true)
+	}
+	if cmd.Flag("history").Value.String() == "true" {
+		v.Set("history.enabled", true)
+	}
+	if chunkMaxBytes, err := cmd.Flags().GetInt("chunk_max_bytes"); err != nil {
+		log.Error().Err(err).Msg("Failed to get chunk max bytes")
+	} else if chunkMaxBytes > 0 {
+		v.Set("chunking.enabled", true)
+		v.Set("chunking.maxBytes", chunkMaxBytes)
+	}
+	if maxProcs, err := cmd.Flags().GetInt("max_procs"); err != nil {
+		log.Error().Err(err).Msg("Failed to get max procs")
+	} else if maxProcs != 0 {
+		v.Set("resources.maxProcs", maxProcs)
+	}
+	if cmd.Flag("metrics_addr").Value.String() != "" {
+		v.Set("metrics.listenAddr", cmd.Flag("metrics_addr").Value.String())
+	}
+	if labels, err := cmd.Flags().GetStringSlice("metrics_labels"); err != nil {
+		log.Error().Err(err).Msg("Failed to get metrics labels")
+	} else if len(labels) > 0 {
+		v.Set("metrics.labels", labels)
+	}
+	if cmd.Flag("all_kv_mounts").Value.String() == "true" {
+		v.Set("allKVMounts", true)
+	}
+	if cmd.Flag("create_missing_mounts").Value.String() == "true" {
+		v.Set("createMissingMounts", true)
+	}
+	if cmd.Flag("on_replicated").Value.String() != "" {
+		v.Set("onReplicated", cmd.Flag("on_replicated").Value.String())
+	}
+	if cmd.Flag("resume").Value.String() == "true" {
+		v.Set("resume", true)
+	}
+	if cmd.Flag("state_dir").Value.String() != "" {
+		v.Set("stateDir", cmd.Flag("state_dir").Value.String())
+	}
+	if cmd.Flag("memory_limit").Value.String() != "" {
+		v.Set("resources.memoryLimit", cmd.Flag("memory_limit").Value.String())
+	}
+	if workers, err := cmd.Flags().GetInt("diff_workers"); err != nil {
+		log.Error().Err(err).Msg("Failed to get diff workers")
+	} else if workers > 0 {
+		v.Set("diff.workers", workers)
+	}
+	for flag, key := range map[string]string{
+		"list_workers":  "concurrency.listWorkers",
+		"read_workers":  "concurrency.readWorkers",
+		"write_workers": "concurrency.writeWorkers",
+	} {
+		workers, err := cmd.Flags().GetInt(flag)
+		if err != nil {
+			log.Error().Err(err).Str("flag", flag).Msg("Failed to get worker count")
+			continue
+		}
+		if workers > 0 {
+			v.Set(key, workers)
+		}
+	}
+	for flag, key := range map[string]string{
+		"read_qps":        "rateLimit.readQPS",
+		"write_qps":       "rateLimit.writeQPS",
+		"diff_source_qps": "diff.sourceQPS",
+		"diff_target_qps": "diff.destinationQPS",
+	} {
+		qps, err := cmd.Flags().GetFloat64(flag)
+		if err != nil {
+			log.Error().Err(err).Str("flag", flag).Msg("Failed to get rate limit")
+			continue
+		}
+		if qps != 0 {
+			v.Set(key, qps)
+		}
+	}
+	for flag, key := range map[string]string{
+		"read_burst":  "rateLimit.readBurst",
+		"write_burst": "rateLimit.writeBurst",
+	} {
+		burst, err := cmd.Flags().GetInt(flag)
+		if err != nil {
+			log.Error().Err(err).Str("flag", flag).Msg("Failed to get rate limit burst")
+			continue
+		}
+		v.Set(key, burst)
+	}
+	for flag, key := range map[string]string{
+		"retry_base_delay":       "retry.baseDelay",
+		"retry_max_delay":        "retry.maxDelay",
+		"discovery_timeout":      "timeouts.discovery",
+		"copy_timeout":           "timeouts.copy",
+		"verify_timeout":         "timeouts.verify",
+		"source_request_timeout": "srcVault.requestTimeout",
+		"target_request_timeout": "destVault.requestTimeout",
+	} {
+		d, err := cmd.Flags().GetDuration(flag)
+		if err != nil {
+			log.Error().Err(err).Str("flag", flag).Msg("Failed to get duration")
+			continue
+		}
+		if d != 0 {
+			v.Set(key, d.String())
+		}
+	}
+	if cmd.Flag("from_replication").Value.String() == "true" {
+		writeReplicationConfigs(cmd)
+		return
+	}
 	if err := v.WriteConfig(); err != nil {
 		log.Error().Err(err).Msg("Failed to write config")
 	}
 }
 
-func runFunc(cmd *cobra.Command, args []string) {
+// writeReplicationConfigs inspects the source vault's performance replication
+// filters and writes one config file per replicated KV v2 mount and
+// secondary, each based on the settings already collected in v.
+func writeReplicationConfigs(cmd *cobra.Command) {
+	cfg, err := vaultsync.NewConfig(v)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create config")
+	}
+
+	jobs, err := vaultsync.ReplicationJobs(cmd.Context(), cfg.SourceVault)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to inspect replication")
+	}
+	if len(jobs) == 0 {
+		log.Warn().Msg("No replicated KV v2 mounts found")
+		return
+	}
+
+	outDir := cmd.Flag("output_dir").Value.String()
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		log.Fatal().Err(err).Msg("Failed to create output directory")
+	}
+	for _, job := range jobs {
+		v.Set("srcVault.mount", job.Mount)
+		v.Set("srcVault.path", "")
+		v.Set("destVault.mount", job.Mount)
+		v.Set("destVault.path", "")
+
+		name := filepath.Join(outDir, job.Secondary+"-"+strings.ReplaceAll(job.Mount, "/", "_")+".yaml")
+		if err := v.WriteConfigAs(name); err != nil {
+			log.Error().Err(err).Str("file", name).Msg("Failed to write config")
+			continue
+		}
+		log.Info().Str("secondary", job.Secondary).Str("mount", job.Mount).Str("file", name).Msg("Wrote config")
+	}
+}
+
+func runFunc(cmd *cobra.Command, args []string) (err error) {
+	var report *vaultsync.Report
+	if path := cmd.Flag("termination_file").Value.String(); path != "" {
+		defer func() {
+			if r := recover(); r != nil {
+				writeTermination(path, report, fmt.Errorf("panic: %v", r))
+				panic(r)
+			}
+			writeTermination(path, report, err)
+		}()
+	}
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	quiet, err := cmd.Flags().GetBool("quiet")
+	if err != nil {
+		return err
+	}
+	slowest, err := cmd.Flags().GetInt("slowest")
+	if err != nil {
+		return err
+	}
+	if quiet {
+		// Per-secret lines cost more than they are worth on large trees.
+		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+		// With the logs silenced the summary is all that is left to print.
+		if format == "" {
+			format = outputTable
+		}
+	}
+	if cmd.Flag("all_kv_mounts").Value.String() == "true" {
+		cfg.AllKVMounts = true
+	}
+	if cmd.Flag("create_missing_mounts").Value.String() == "true" {
+		cfg.CreateMissingMounts = true
+	}
+	if d, err := cmd.Flags().GetDuration("max_duration"); err != nil {
+		return err
+	} else if d != 0 {
+		cfg.MaxDuration = d
+	}
+	if cmd.Flag("fail_fast").Value.String() == "true" {
+		cfg.FailFast = true
+	}
+	if maxErrors := cmd.Flag("max_errors").Value.String(); maxErrors != "" {
+		cfg.MaxErrors = maxErrors
+	}
+	if cmd.Flag("metadata_only").Value.String() == "true" {
+		cfg.MetadataOnly = true
+	}
+	if cmd.Flag("ordered").Value.String() == "true" {
+		cfg.Ordered = true
+	}
+	if err := applyShard(cmd, cfg); err != nil {
+		return err
+	}
+	if cmd.Flag("circuit_breaker").Value.String() == "true" {
+		cfg.CircuitBreaker.Enabled = true
+	}
+	if path := cmd.Flag("audit_log").Value.String(); path != "" {
+		cfg.AuditLog.Path = path
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.Resources.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.Resources.MaxProcs)
+	}
+	memLimit, err := cfg.Resources.MemoryLimitBytes()
+	if err != nil {
+		return err
+	}
+	if memLimit > 0 {
+		debug.SetMemoryLimit(memLimit)
+	}
+
+	shutdownTracing, err := setupTracing(cmd.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up tracing")
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
+
+	opts, err := syncOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Metrics.ListenAddr != "" {
+		metrics, err := vaultsync.NewMetrics(cfg.Metrics)
+		if err != nil {
+			return fmt.Errorf("failed to create metrics: %w", err)
+		}
+		serveMetrics(cfg.Metrics.ListenAddr, metrics)
+		opts = append(opts, vaultsync.WithMetrics(metrics))
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	var syncErr error
+	report, syncErr = syncer.Sync(cmd.Context())
+
+	log.Info().Str("run", report.RunID).Msg("Run finished")
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+	if err := renderReport(cmd.OutOrStdout(), format, report, quiet); err != nil {
+		log.Error().Err(err).Msg("Failed to print report")
+	}
+	if slowest > 0 {
+		if err := renderSlowest(cmd.OutOrStdout(), format, report, slowest); err != nil {
+			log.Error().Err(err).Msg("Failed to print slowest secrets")
+		}
+	}
+	notifyRun(cmd.Context(), cfg, report, syncErr)
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync: %w", syncErr)
+	}
+	return nil
+}
+
+// setToken sets the token of the vault at key in the config or, with
+// --keyring, stores it in the OS keyring under the vault's address and
+// references the entry from the config instead.
+func setToken(cmd *cobra.Command, key, addr, token string) {
+	if cmd.Flag("keyring").Value.String() != "true" {
+		v.Set(key+".token", token)
+		return
+	}
+	if err := keyring.Set(addr, token); err != nil {
+		log.Fatal().Err(err).Str("vault", addr).Msg("Failed to store token in the OS keyring")
+	}
+	v.Set(key+".tokenKeyring", addr)
+	log.Info().Str("vault", addr).Msg("Stored token in the OS keyring")
+}
+
+// syncOptions returns the Syncer options for the destination, source, and
+// approval settings in cfg.
+func syncOptions(cfg *vaultsync.Config) ([]vaultsync.Option, error) {
+	opts, err := destinationOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srcOpts, err := sourceOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, srcOpts...)
+	if cfg.SlackApproval.Enabled {
+		opts = append(opts, vaultsync.WithApprover(&slack.Approver{
+			BotToken:      cfg.SlackApproval.BotToken,
+			Channel:       cfg.SlackApproval.Channel,
+			SigningSecret: cfg.SlackApproval.SigningSecret,
+			ListenAddr:    cfg.SlackApproval.ListenAddr,
+			Approvers:     cfg.SlackApproval.Approvers,
+			Timeout:       cfg.SlackApproval.Timeout,
+		}))
+	}
+	return opts, nil
+}
+
+// loadConfig reads the config file, with HVM_ environment variables
+// overriding it, and sets the log level from the flags of cmd.
+func loadConfig(cmd *cobra.Command) (*vaultsync.Config, error) {
 	v.SetConfigFile(cmd.Flag("config_file").Value.String())
 	if err := v.ReadInConfig(); err != nil {
-		log.Error().Err(err).Msg("Failed to read config")
+		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
+	bindEnv(v)
 
 	var lvl zerolog.Level
 	lvl, err := zerolog.ParseLevel(cmd.Flag("log_level").Value.String())
@@ -129,19 +608,43 @@ func runFunc(cmd *cobra.Command, args []string) {
 
 	cfg, err := vaultsync.NewConfig(v)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create config")
+		return nil, fmt.Errorf("failed to create config: %w", err)
 	}
+	return cfg, nil
+}
 
-	syncer, err := vaultsync.NewSyncer(cfg)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create syncer")
-	}
+// serveMetrics serves m on addr at /metrics in the background.
+func serveMetrics(addr string, m http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("Metrics server stopped")
+		}
+	}()
+	log.Info().Str("addr", addr).Msg("Serving metrics")
+}
 
-	if err := syncer.Sync(); err != nil {
-		log.Error().Err(err).Msg("Failed to sync")
+func writeReport(path string, report interface{}) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(path, b, 0o600)
 }
 
+// CLI runs the hvm command line. The first SIGINT or SIGTERM cancels the
+// command's context so it can stop cleanly; a second one kills the process.
 func CLI() error {
-	return rootCmd.Execute()
+	// The Syncer and the integrations log through the global logger.
+	zlog.Logger = zlog.Output(vaultsync.NewRedactWriter(os.Stderr))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return rootCmd.ExecuteContext(ctx)
 }
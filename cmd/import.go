@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import secrets from an encrypted archive into the target vault",
+	RunE:  importFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringP("input", "i", "", "The archive file written by export")
+	importCmd.Flags().StringP("key_file", "k", "", "A file holding the 256-bit archive key, base64 or hex encoded")
+	importCmd.Flags().String("report_file", "", "Write a JSON report of the import to this file")
+	for _, flag := range []string{"input", "key_file"} {
+		if err := importCmd.MarkFlagRequired(flag); err != nil {
+			log.Fatal().Err(err).Str("flag", flag).Msg("Failed to mark flag required")
+		}
+	}
+}
+
+func importFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	key, err := vaultsync.LoadArchiveKey(cmd.Flag("key_file").Value.String())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(cmd.Flag("input").Value.String())
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	opts, err := destinationOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg, append(opts, vaultsync.DestinationOnly())...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, importErr := syncer.Import(cmd.Context(), f, key)
+	if report != nil {
+		if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+			if err := writeReport(reportFile, report); err != nil {
+				log.Error().Err(err).Msg("Failed to write report")
+			}
+		}
+	}
+
+	if importErr != nil {
+		return fmt.Errorf("failed to import: %w", importErr)
+	}
+	return nil
+}
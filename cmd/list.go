@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list [PATH]",
+	Short: "List the secrets at PATH (the configured source path by default) on the source or target vault",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  listFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().String("vault", "source", "Which vault to list: source or dest")
+	listCmd.Flags().BoolP("recursive", "r", false, "List every secret below the path instead of only the keys directly under it")
+	listCmd.Flags().String("format", "table", "The output format: table or json")
+}
+
+func listFunc(cmd *cobra.Command, args []string) error {
+	side, err := vaultSide(cmd)
+	if err != nil {
+		return err
+	}
+	format := cmd.Flag("format").Value.String()
+	if format != "table" && format != "json" {
+		return fmt.Errorf("invalid --format %q: want table or json", format)
+	}
+	recursive, err := cmd.Flags().GetBool("recursive")
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	var opts []vaultsync.Option
+	if side == vaultsync.ListSource {
+		if opts, err = sourceOptions(cfg); err != nil {
+			return err
+		}
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	secrets, err := syncer.List(cmd.Context(), side, path, recursive)
+	if err != nil {
+		return fmt.Errorf("failed to list: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(secrets)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tTYPE")
+	for _, s := range secrets {
+		typ := "secret"
+		switch {
+		case s.Denied:
+			typ = "denied"
+		case s.Folder:
+			typ = "folder"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", s.Path, typ)
+	}
+	return tw.Flush()
+}
+
+// vaultSide returns the side of the sync named by the --vault flag.
+func vaultSide(cmd *cobra.Command) (string, error) {
+	switch side := cmd.Flag("vault").Value.String(); side {
+	case "source", "src":
+		return vaultsync.ListSource, nil
+	case "dest", "destination", "target":
+		return vaultsync.ListDestination, nil
+	default:
+		return "", fmt.Errorf("invalid --vault %q: want source or dest", side)
+	}
+}
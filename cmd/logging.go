@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/j4ng5y/hvm/internal/logfile"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// logFormatJSON writes one JSON object per line, for machines.
+	logFormatJSON = "json"
+	// logFormatConsole writes colored, human-readable lines, for
+	// interactive use.
+	logFormatConsole = "console"
+)
+
+// logOutput is where logs go in the chosen format, before redaction.
+var logOutput io.Writer = os.Stderr
+
+// setupLogging points the CLI's and the Syncer's loggers at stderr, or at
+// the rotated --log_file, in the --log_format of cmd, redacting secrets
+// before they are formatted.
+func setupLogging(cmd *cobra.Command) error {
+	format := cmd.Flag("log_format").Value.String()
+	switch format {
+	case logFormatJSON, logFormatConsole:
+	default:
+		return fmt.Errorf("unknown log format %q, must be json or console", format)
+	}
+	output := func(f *os.File, out io.Writer) io.Writer {
+		if format == logFormatConsole {
+			return zerolog.ConsoleWriter{Out: out, TimeFormat: time.TimeOnly, NoColor: f == nil || !colorable(f)}
+		}
+		return out
+	}
+
+	w := output(os.Stderr, os.Stderr)
+	if path := cmd.Flag("log_file").Value.String(); path != "" {
+		flags := cmd.Flags()
+		maxSize, err := flags.GetInt64("log_max_size")
+		if err != nil {
+			return err
+		}
+		maxAge, err := flags.GetDuration("log_max_age")
+		if err != nil {
+			return err
+		}
+		maxBackups, err := flags.GetInt("log_max_backups")
+		if err != nil {
+			return err
+		}
+		mirror, err := flags.GetBool("log_stderr")
+		if err != nil {
+			return err
+		}
+		if maxSize < 0 || maxAge < 0 || maxBackups < 0 {
+			return fmt.Errorf("--log_max_size, --log_max_age, and --log_max_backups must not be negative")
+		}
+
+		lf := &logfile.Writer{Path: path, MaxSize: maxSize << 20, MaxAge: maxAge, MaxBackups: maxBackups}
+		if err := lf.Open(); err != nil {
+			return err
+		}
+		if mirror {
+			w = io.MultiWriter(output(nil, lf), w)
+		} else {
+			w = output(nil, lf)
+		}
+	}
+
+	logOutput = w
+	w = vaultsync.NewRedactWriter(w)
+	log = zerolog.New(w).With().Timestamp().Caller().Logger()
+	zlog.Logger = zlog.Output(w)
+	return nil
+}
+
+// colorable reports whether f is a terminal that should get colored output,
+// which NO_COLOR turns off.
+func colorable(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest [PATH]",
+	Short: "Write the checksum of every secret below PATH (the configured source path by default), or compare a vault against such a manifest",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  manifestFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+
+	manifestCmd.Flags().String("vault", "source", "Which vault to read: source or dest")
+	manifestCmd.Flags().StringP("output", "o", "", "The manifest file to write (stdout by default)")
+	manifestCmd.Flags().String("compare", "", "Compare the vault against this previously written manifest instead of writing one")
+	manifestCmd.Flags().String("report_file", "", "Write a JSON report of the comparison to this file when using --compare")
+}
+
+func manifestFunc(cmd *cobra.Command, args []string) error {
+	side, err := vaultSide(cmd)
+	if err != nil {
+		return err
+	}
+	compare := cmd.Flag("compare").Value.String()
+	if compare != "" && len(args) == 1 {
+		return fmt.Errorf("PATH cannot be used with --compare, which compares the manifest's path")
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	var opts []vaultsync.Option
+	if side == vaultsync.ListSource {
+		if opts, err = sourceOptions(cfg); err != nil {
+			return err
+		}
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	if compare != "" {
+		return compareManifest(cmd, syncer, side, compare)
+	}
+
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	manifest, err := syncer.Manifest(cmd.Context(), side, path)
+	if err != nil {
+		return fmt.Errorf("failed to generate manifest: %w", err)
+	}
+
+	output := cmd.Flag("output").Value.String()
+	if output == "" {
+		return vaultsync.WriteManifest(cmd.OutOrStdout(), manifest)
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	err = vaultsync.WriteManifest(f, manifest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("manifest", output).Int("secrets", manifest.Secrets).Msg("Manifest written")
+	return nil
+}
+
+// compareManifest compares the live vault with the manifest file and fails
+// unless every secret matches.
+func compareManifest(cmd *cobra.Command, syncer *vaultsync.Syncer, side, file string) error {
+	manifest, err := vaultsync.LoadManifest(file)
+	if err != nil {
+		return err
+	}
+
+	report, err := syncer.CompareManifest(cmd.Context(), side, manifest)
+	if err != nil {
+		return fmt.Errorf("failed to compare manifest: %w", err)
+	}
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportFile, b, 0o600)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	for _, res := range report.Secrets {
+		if res.Status != vaultsync.DiffMatch {
+			log.Warn().Str("secret", res.Path).Str("status", string(res.Status)).Str("error", res.Error).Msg("Secret does not match manifest")
+		}
+	}
+
+	switch {
+	case report.Errors > 0:
+		return fmt.Errorf("failed to compare %d secrets", report.Errors)
+	case report.Drifted():
+		return fmt.Errorf("vault does not match manifest: %d changed, %d missing, %d extra", report.Changed, report.Missing, report.Extra)
+	}
+	log.Info().Int("secrets", report.Matched).Time("manifestCreatedAt", manifest.CreatedAt).Msg("Vault matches manifest")
+	return nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/hvm/internal/notify"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+// runNotification is the JSON body posted to notification webhooks, and the
+// details attached to PagerDuty events, when a run completes.
+type runNotification struct {
+	Job     string    `json:"job,omitempty"`
+	Time    time.Time `json:"time"`
+	Mount   string    `json:"mount"`
+	Path    string    `json:"path"`
+	Summary string    `json:"summary"`
+	runSummary
+}
+
+// notifyRun sends the summary of a completed run to every configured
+// notification that wants its outcome. Failures are logged, as the run
+// itself is already over.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the notifications.
+//	cfg: *vaultsync.Config - The config of the run.
+//	report: *vaultsync.Report - The sync report, if any.
+//	err: error - The error the run ended with, if any.
+//
+// Returns: nothing
+func notifyRun(ctx context.Context, cfg *vaultsync.Config, report *vaultsync.Report, err error) {
+	if len(cfg.Notifications) == 0 {
+		return
+	}
+	// A cancelled run still notifies, so do not inherit its cancellation.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+
+	n := newRunNotification(cfg, report, err)
+	for _, nc := range cfg.Notifications {
+		if !nc.Wants(report, err != nil) {
+			continue
+		}
+		if err := sendNotification(ctx, nc, n); err != nil {
+			log.Error().Err(err).Str("notification", nc.Type).Str("outcome", n.Outcome).Msg("Failed to send run notification")
+			continue
+		}
+		log.Debug().Str("notification", nc.Type).Str("outcome", n.Outcome).Msg("Sent run notification")
+	}
+}
+
+// newRunNotification describes a completed run for notifications.
+func newRunNotification(cfg *vaultsync.Config, report *vaultsync.Report, err error) runNotification {
+	n := runNotification{Job: cfg.Metrics.Job, Time: time.Now().UTC(), runSummary: newRunSummary(report, err)}
+	if cfg.SourceVault != nil {
+		n.Mount, n.Path = cfg.SourceVault.Mount, cfg.SourceVault.Path
+	}
+	if report != nil {
+		n.Mount, n.Path = report.Mount, report.Path
+	}
+
+	name := "sync"
+	if n.Job != "" {
+		name = "job " + n.Job
+	}
+	n.Summary = fmt.Sprintf("hvm: %s of %s/%s: %s", name, n.Mount, n.Path, strings.ReplaceAll(n.Outcome, "_", " "))
+	if report != nil {
+		n.Summary += fmt.Sprintf(" in %s, %d created, %d updated, %d unchanged, %d skipped, %d failed",
+			time.Duration(n.Duration).Round(time.Millisecond), n.Created, n.Updated, n.Unchanged, n.Skipped, n.Failed)
+	}
+	if n.Error != "" {
+		n.Summary += ": " + n.Error
+	}
+	return n
+}
+
+// sendNotification sends n to a single notification channel.
+func sendNotification(ctx context.Context, nc vaultsync.Notification, n runNotification) error {
+	switch nc.Type {
+	case vaultsync.NotifyEmail:
+		e := &notify.Email{
+			Host:     nc.Email.Host,
+			Port:     nc.Email.Port,
+			Username: nc.Email.Username,
+			Password: nc.Email.Password,
+			From:     nc.Email.From,
+			To:       nc.Email.To,
+		}
+		return e.Send(ctx, fmt.Sprintf("hvm %s: %s/%s", n.Outcome, n.Mount, n.Path), emailBody(n))
+	case vaultsync.NotifyPagerDuty:
+		p := &notify.PagerDuty{RoutingKey: nc.PagerDuty.RoutingKey, Severity: nc.PagerDuty.Severity}
+		action := notify.PagerDutyTrigger
+		if n.ExitCode == 0 {
+			action = notify.PagerDutyResolve
+		}
+		return p.Send(ctx, action, fmt.Sprintf("hvm/%s/%s/%s", n.Job, n.Mount, n.Path), n.Summary, n)
+	case vaultsync.NotifyWebhook:
+		return postJSON(ctx, nc.Webhook.URL, n)
+	}
+	return fmt.Errorf("unknown notification type %q", nc.Type)
+}
+
+// emailBody formats n as the plain text body of a notification email.
+func emailBody(n runNotification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", n.Summary)
+	if n.Job != "" {
+		fmt.Fprintf(&b, "Job:       %s\n", n.Job)
+	}
+	fmt.Fprintf(&b, "Outcome:   %s\n", n.Outcome)
+	fmt.Fprintf(&b, "Path:      %s/%s\n", n.Mount, n.Path)
+	if n.RunID != "" {
+		fmt.Fprintf(&b, "Run:       %s\n", n.RunID)
+		fmt.Fprintf(&b, "Duration:  %s\n", time.Duration(n.Duration).Round(time.Millisecond))
+		fmt.Fprintf(&b, "Verified:  %t\n", n.Verified)
+		fmt.Fprintf(&b, "Created:   %d\n", n.Created)
+		fmt.Fprintf(&b, "Updated:   %d\n", n.Updated)
+		fmt.Fprintf(&b, "Unchanged: %d\n", n.Unchanged)
+		fmt.Fprintf(&b, "Skipped:   %d\n", n.Skipped)
+		fmt.Fprintf(&b, "Failed:    %d\n", n.Failed)
+		if n.Deleted+n.Destroyed > 0 {
+			fmt.Fprintf(&b, "Deleted:   %d\n", n.Deleted)
+			fmt.Fprintf(&b, "Destroyed: %d\n", n.Destroyed)
+		}
+	}
+	if n.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s\n", n.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputMarkdown = "markdown"
+)
+
+// outputFormat returns the format named by the --output flag, which may be
+// empty to render nothing.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	switch format := cmd.Flag("output").Value.String(); format {
+	case "", outputTable, outputJSON, outputYAML, outputMarkdown:
+		return format, nil
+	case "yml":
+		return outputYAML, nil
+	case "md":
+		return outputMarkdown, nil
+	default:
+		return "", fmt.Errorf("invalid --output %q: want table, json, yaml, or markdown", format)
+	}
+}
+
+// render writes v to w in format. JSON and YAML hold every field of v, with
+// the same names; table and markdown are written by the given functions.
+//
+// Arguments:
+//
+//	w: io.Writer - Where to write.
+//	format: string - The output format, or empty to write nothing.
+//	v: interface{} - The report to render.
+//	table: func(io.Writer) error - Writes v as a terminal table.
+//	markdown: func(io.Writer) error - Writes v as Markdown.
+//
+// Returns:
+//
+//	error - An error if v could not be encoded or written.
+func render(w io.Writer, format string, v interface{}, table, markdown func(io.Writer) error) error {
+	switch format {
+	case outputTable:
+		return table(w)
+	case outputMarkdown:
+		return markdown(w)
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		// Going through JSON keeps the field names and encodings, such as
+		// durations, of the JSON output, and its field order.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(b, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return nil
+}
+
+// blockStyle clears the JSON flow and quoting styles from a parsed document
+// so it is written as block YAML, quoting only where YAML requires it.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// renderDiff writes a diff report in format. Tables list only the secrets
+// that do not match.
+func renderDiff(w io.Writer, format string, r *vaultsync.DiffReport) error {
+	drifted := make([]vaultsync.DiffResult, 0, len(r.Secrets))
+	for _, res := range r.Secrets {
+		if res.Status != vaultsync.DiffMatch {
+			drifted = append(drifted, res)
+		}
+	}
+
+	table := func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Path:\t%s/%s\n", r.Mount, r.Path)
+		fmt.Fprintf(tw, "Matched:\t%d\n", r.Matched)
+		fmt.Fprintf(tw, "Changed:\t%d\n", r.Changed)
+		fmt.Fprintf(tw, "Missing:\t%d\n", r.Missing)
+		fmt.Fprintf(tw, "Extra:\t%d\n", r.Extra)
+		fmt.Fprintf(tw, "Errors:\t%d\n", r.Errors)
+		if len(drifted) > 0 {
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "PATH\tDESTINATION\tSTATUS\tERROR")
+			for _, res := range drifted {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Path, res.Destination, res.Status, res.Error)
+			}
+		}
+		return tw.Flush()
+	}
+	markdown := func(w io.Writer) error {
+		fmt.Fprintf(w, "## Diff of `%s/%s`\n\n", r.Mount, r.Path)
+		fmt.Fprintf(w, "Compared %s in %s.\n\n", r.StartedAt.Format(time.RFC3339), time.Duration(r.Duration))
+		fmt.Fprintln(w, "| Matched | Changed | Missing | Extra | Errors |")
+		fmt.Fprintln(w, "| ---: | ---: | ---: | ---: | ---: |")
+		fmt.Fprintf(w, "| %d | %d | %d | %d | %d |\n", r.Matched, r.Changed, r.Missing, r.Extra, r.Errors)
+		if len(drifted) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Path | Destination | Status | Error |")
+			fmt.Fprintln(w, "| --- | --- | --- | --- |")
+			for _, res := range drifted {
+				fmt.Fprintf(w, "| %s | %s | %s | %s |\n", mdCode(res.Path), mdCode(res.Destination), res.Status, mdText(res.Error))
+			}
+		}
+		return nil
+	}
+	return render(w, format, r, table, markdown)
+}
+
+// renderReport writes a sync report, including its verification, in format.
+// Tables list only the secrets that were written, deleted, or failed, or
+// for a multi-mount sync, each mount. With errorsOnly they list only the
+// secrets that failed or were denied.
+func renderReport(w io.Writer, format string, r *vaultsync.Report, errorsOnly bool) error {
+	changed := make([]vaultsync.SecretResult, 0, len(r.Secrets))
+	for _, res := range r.Secrets {
+		if errorsOnly && res.Action != vaultsync.ActionFailed && res.Action != vaultsync.ActionDenied {
+			continue
+		}
+		if res.Action != vaultsync.ActionUnchanged {
+			changed = append(changed, res)
+		}
+	}
+	verified := "no"
+	if r.Verified {
+		verified = "yes"
+	}
+
+	table := func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Run:\t%s\n", r.RunID)
+		fmt.Fprintf(tw, "Path:\t%s/%s\n", r.Mount, r.Path)
+		if r.Shard != "" {
+			fmt.Fprintf(tw, "Shard:\t%s\n", r.Shard)
+		}
+		fmt.Fprintf(tw, "Verified:\t%s\n", verified)
+		fmt.Fprintf(tw, "Duration:\t%s\n", time.Duration(r.Durations.Total))
+		fmt.Fprintf(tw, "Discovered:\t%d\n", r.Discovered)
+		fmt.Fprintf(tw, "Created:\t%d\n", r.Created)
+		fmt.Fprintf(tw, "Updated:\t%d\n", r.Updated)
+		fmt.Fprintf(tw, "Unchanged:\t%d\n", r.Unchanged)
+		fmt.Fprintf(tw, "Skipped:\t%d\n", r.Skipped)
+		fmt.Fprintf(tw, "Failed:\t%d\n", r.Failed)
+		fmt.Fprintf(tw, "Pruned:\t%d\n", r.Deleted+r.Destroyed)
+		fmt.Fprintf(tw, "Transferred:\t%s\n", formatBytes(float64(r.Bytes)))
+		fmt.Fprintf(tw, "Throughput:\t%s\n", throughput(r))
+		if r.Denied > 0 {
+			fmt.Fprintf(tw, "Permission denied:\t%d\n", r.Denied)
+		}
+		for i, group := range r.Duplicates {
+			fmt.Fprintf(tw, "Duplicates %d:\t%s\n", i+1, strings.Join(group, ", "))
+		}
+		if l := r.Latency; l != nil {
+			for _, st := range latencyStages(l) {
+				if st.p.Count > 0 {
+					fmt.Fprintf(tw, "%s latency:\tp50 %s, p95 %s, p99 %s, max %s\n", st.name, roundDuration(st.p.P50), roundDuration(st.p.P95), roundDuration(st.p.P99), roundDuration(st.p.Max))
+				}
+			}
+		}
+		switch {
+		case len(r.Mounts) > 0:
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "MOUNT\tVERIFIED\tCREATED\tUPDATED\tUNCHANGED\tFAILED")
+			for _, m := range r.Mounts {
+				fmt.Fprintf(tw, "%s\t%t\t%d\t%d\t%d\t%d\n", m.Mount, m.Verified, m.Created, m.Updated, m.Unchanged, m.Failed)
+			}
+		case len(changed) > 0:
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "PATH\tACTION\tERROR")
+			for _, res := range changed {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Path, res.Action, res.Error)
+			}
+		}
+		return tw.Flush()
+	}
+	markdown := func(w io.Writer) error {
+		fmt.Fprintf(w, "## Sync run `%s`\n\n", r.RunID)
+		fmt.Fprintf(w, "Synced `%s/%s` at %s in %s. Verified: %s.\n\n", r.Mount, r.Path, r.StartedAt.Format(time.RFC3339), time.Duration(r.Durations.Total), verified)
+		fmt.Fprintln(w, "| Discovered | Created | Updated | Unchanged | Skipped | Failed | Pruned |")
+		fmt.Fprintln(w, "| ---: | ---: | ---: | ---: | ---: | ---: | ---: |")
+		fmt.Fprintf(w, "| %d | %d | %d | %d | %d | %d | %d |\n", r.Discovered, r.Created, r.Updated, r.Unchanged, r.Skipped, r.Failed, r.Deleted+r.Destroyed)
+		fmt.Fprintf(w, "\nTransferred %s at %s.\n", formatBytes(float64(r.Bytes)), throughput(r))
+		if r.Denied > 0 {
+			fmt.Fprintf(w, "\nPermission denied on %d paths:\n\n", r.Denied)
+			for _, p := range r.PermissionDenied {
+				fmt.Fprintf(w, "- %s\n", mdCode(p))
+			}
+		}
+		if l := r.Latency; l != nil {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Stage | p50 | p95 | p99 | Max |")
+			fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: |")
+			for _, st := range latencyStages(l) {
+				if st.p.Count > 0 {
+					fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", st.name, roundDuration(st.p.P50), roundDuration(st.p.P95), roundDuration(st.p.P99), roundDuration(st.p.Max))
+				}
+			}
+		}
+		if len(r.Duplicates) > 0 {
+			fmt.Fprintf(w, "\nIdentical data in %d groups of secrets:\n\n", len(r.Duplicates))
+			for _, group := range r.Duplicates {
+				codes := make([]string, len(group))
+				for i, p := range group {
+					codes[i] = mdCode(p)
+				}
+				fmt.Fprintf(w, "- %s\n", strings.Join(codes, ", "))
+			}
+		}
+		switch {
+		case len(r.Mounts) > 0:
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Mount | Verified | Created | Updated | Unchanged | Failed |")
+			fmt.Fprintln(w, "| --- | --- | ---: | ---: | ---: | ---: |")
+			for _, m := range r.Mounts {
+				fmt.Fprintf(w, "| %s | %t | %d | %d | %d | %d |\n", mdCode(m.Mount), m.Verified, m.Created, m.Updated, m.Unchanged, m.Failed)
+			}
+		case len(changed) > 0:
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Path | Action | Error |")
+			fmt.Fprintln(w, "| --- | --- | --- |")
+			for _, res := range changed {
+				fmt.Fprintf(w, "| %s | %s | %s |\n", mdCode(res.Path), res.Action, mdText(res.Error))
+			}
+		}
+		return nil
+	}
+	return render(w, format, r, table, markdown)
+}
+
+// renderSlowest writes the n secrets of a sync report that took longest,
+// with how long each stage took, as a table or in Markdown. The JSON and
+// YAML reports already hold every secret's timings.
+func renderSlowest(w io.Writer, format string, r *vaultsync.Report, n int) error {
+	slowest := append([]vaultsync.SecretResult(nil), r.Secrets...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+	if len(slowest) > n {
+		slowest = slowest[:n]
+	}
+
+	switch format {
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "SLOWEST\tTOTAL\tREAD\tWRITE\tVERIFY\tACTION")
+		for _, res := range slowest {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", res.Path, roundDuration(res.Duration), roundDuration(res.Read), roundDuration(res.Write), roundDuration(res.Verify), res.Action)
+		}
+		return tw.Flush()
+	case outputMarkdown:
+		fmt.Fprintf(w, "\n### %d slowest secrets\n\n", len(slowest))
+		fmt.Fprintln(w, "| Path | Total | Read | Write | Verify | Action |")
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | --- |")
+		for _, res := range slowest {
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n", mdCode(res.Path), roundDuration(res.Duration), roundDuration(res.Read), roundDuration(res.Write), roundDuration(res.Verify), res.Action)
+		}
+	}
+	return nil
+}
+
+// latencyStage is one stage of a Latency, named for display.
+type latencyStage struct {
+	name string
+	p    vaultsync.Percentiles
+}
+
+// latencyStages lists the stages of l in the order they run.
+func latencyStages(l *vaultsync.Latency) []latencyStage {
+	return []latencyStage{{"Read", l.Read}, {"Write", l.Write}, {"Verify", l.Verify}, {"Total", l.Total}}
+}
+
+// roundDuration formats d to a precision that suits its size.
+func roundDuration(d vaultsync.Duration) string {
+	switch td := time.Duration(d); {
+	case td == 0:
+		return "-"
+	case td < time.Millisecond:
+		return td.Round(time.Microsecond).String()
+	case td < time.Second:
+		return td.Round(100 * time.Microsecond).String()
+	default:
+		return td.Round(time.Millisecond).String()
+	}
+}
+
+// mdCode formats s as inline code in a Markdown table cell.
+func mdCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", "\\|") + "`"
+}
+
+// mdText escapes s for a Markdown table cell.
+func mdText(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// throughput formats the rate at which the run processed secrets and
+// wrote secret data.
+func throughput(r *vaultsync.Report) string {
+	secrets, bytes := r.Throughput()
+	return fmt.Sprintf("%.1f secrets/s, %s/s", secrets, formatBytes(bytes))
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 KiB.
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
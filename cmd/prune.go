@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete target secrets under the configured path that do not exist on the source",
+	RunE:  pruneFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().Bool("dry_run", false, "Only show which secrets would be deleted")
+	pruneCmd.Flags().Bool("destroy", false, "Permanently destroy every version and the metadata instead of soft-deleting")
+	pruneCmd.Flags().String("confirm", "", "Skip the interactive prompt by giving the number of secrets to delete")
+	pruneCmd.Flags().String("report_file", "", "Write a JSON report of the deletions to this file")
+}
+
+func pruneFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+	destroy, err := cmd.Flags().GetBool("destroy")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	// The plan is always shown before anything is deleted.
+	paths, err := syncer.PrunePlan(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to plan prune: %w", err)
+	}
+	out := cmd.OutOrStdout()
+	for _, p := range paths {
+		fmt.Fprintf(out, "%s/%s\n", cfg.SourceVault.Mount, p)
+	}
+	fmt.Fprintf(out, "%d target secrets do not exist on the source\n", len(paths))
+	if dryRun || len(paths) == 0 {
+		return nil
+	}
+
+	count := strconv.Itoa(len(paths))
+	confirm := cmd.Flag("confirm").Value.String()
+	if confirm == "" {
+		verb := "soft-delete"
+		if destroy {
+			verb = "PERMANENTLY DESTROY"
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "This will %s the %s target secrets listed above.\nType the number of secrets to continue: ", verb, count)
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+		confirm = strings.TrimSpace(line)
+	}
+	if confirm != count {
+		return fmt.Errorf("confirmation %q does not match the %s secrets to delete", confirm, count)
+	}
+
+	report, pruneErr := syncer.Prune(cmd.Context(), paths, destroy)
+	if report != nil {
+		if err := vaultsync.SaveRun(cfg.RunDir(), report); err != nil {
+			log.Error().Err(err).Msg("Failed to save prune run")
+		}
+		if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+			if err := writeReport(reportFile, report); err != nil {
+				log.Error().Err(err).Msg("Failed to write report")
+			}
+		}
+	}
+
+	if pruneErr != nil {
+		return fmt.Errorf("failed to prune: %w", pruneErr)
+	}
+	return nil
+}
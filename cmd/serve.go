@@ -0,0 +1,537 @@
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as a service with an HTTP API to trigger syncs, query runs, and stream logs",
+	RunE:  serveFunc,
+}
+
+type (
+	// daemon runs syncs on request and serves the control API.
+	daemon struct {
+		cmd           *cobra.Command
+		ctx           context.Context
+		token         string
+		webhookSecret string
+		logs          *logHub
+		metrics       *vaultsync.Metrics
+
+		mu        sync.Mutex
+		cancel    context.CancelFunc
+		startedAt time.Time
+		paths     []string
+		lastRun   *runInfo
+		lastError string
+	}
+
+	// runInfo summarizes a run for the API, without its per-secret results.
+	runInfo struct {
+		RunID      string    `json:"runId"`
+		Mount      string    `json:"mount"`
+		Path       string    `json:"path"`
+		StartedAt  time.Time `json:"startedAt"`
+		FinishedAt time.Time `json:"finishedAt,omitempty"`
+		Verified   bool      `json:"verified"`
+		Cancelled  bool      `json:"cancelled,omitempty"`
+		Created    int       `json:"created"`
+		Updated    int       `json:"updated"`
+		Unchanged  int       `json:"unchanged"`
+		Skipped    int       `json:"skipped"`
+		Failed     int       `json:"failed"`
+	}
+
+	// webhookRequest is the body of POST /v1/webhook. Job, if set, must name
+	// the configured job (metrics.job). Paths limits the sync to those
+	// secrets, and to everything below those ending in "/"; each must lie
+	// below sourceVault.path, without ".." segments. Without paths the whole
+	// job is synced.
+	webhookRequest struct {
+		Job   string   `json:"job"`
+		Paths []string `json:"paths"`
+	}
+
+	// daemonStatus is the response of GET /v1/status.
+	daemonStatus struct {
+		Running   bool       `json:"running"`
+		StartedAt *time.Time `json:"startedAt,omitempty"`
+		Paths     []string   `json:"paths,omitempty"`
+		LastRun   *runInfo   `json:"lastRun,omitempty"`
+		LastError string     `json:"lastError,omitempty"`
+	}
+
+	// logHub fans log lines out to every connected log stream.
+	logHub struct {
+		mu   sync.Mutex
+		subs map[chan []byte]struct{}
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("listen_addr", ":8080", "The address to serve the API on")
+	serveCmd.Flags().String("api_token", "", "The bearer token API requests must present (defaults to HVM_API_TOKEN)")
+	serveCmd.Flags().String("webhook_secret", "", "The secret webhooks sign their body with, in an X-Hvm-Signature: sha256=<hex HMAC> header (defaults to HVM_WEBHOOK_SECRET); without one webhooks use the API token")
+}
+
+func serveFunc(cmd *cobra.Command, args []string) error {
+	token := cmd.Flag("api_token").Value.String()
+	if token == "" {
+		token = os.Getenv("HVM_API_TOKEN")
+	}
+	if token == "" {
+		return fmt.Errorf("serve requires --api_token or HVM_API_TOKEN")
+	}
+
+	// Check the config up front; it is read again for every sync so edits
+	// take effect without a restart.
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	webhookSecret := cmd.Flag("webhook_secret").Value.String()
+	if webhookSecret == "" {
+		webhookSecret = os.Getenv("HVM_WEBHOOK_SECRET")
+	}
+
+	d := &daemon{
+		cmd:           cmd,
+		ctx:           cmd.Context(),
+		token:         token,
+		webhookSecret: webhookSecret,
+		logs:          &logHub{subs: make(map[chan []byte]struct{})},
+	}
+	if cfg.Metrics.ListenAddr != "" {
+		d.metrics, err = vaultsync.NewMetrics(cfg.Metrics)
+		if err != nil {
+			return fmt.Errorf("failed to create metrics: %w", err)
+		}
+		serveMetrics(cfg.Metrics.ListenAddr, d.metrics)
+	}
+	if cfg.Alerts.DriftCheckInterval > 0 {
+		go d.watchDrift(cfg.Alerts.DriftCheckInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("POST /v1/sync", d.auth(d.startSync))
+	mux.Handle("DELETE /v1/sync", d.auth(d.cancelSync))
+	mux.Handle("GET /v1/status", d.auth(d.status))
+	mux.Handle("GET /v1/runs", d.auth(d.runs))
+	mux.Handle("GET /v1/runs/{id}", d.auth(d.run))
+	mux.Handle("GET /v1/logs", d.auth(d.streamLogs))
+	if d.webhookSecret != "" {
+		mux.HandleFunc("POST /v1/webhook", d.webhook)
+	} else {
+		mux.Handle("POST /v1/webhook", d.auth(d.webhook))
+	}
+
+	addr := cmd.Flag("listen_addr").Value.String()
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-d.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to shut down API server")
+		}
+	}()
+
+	log.Info().Str("addr", addr).Msg("Serving API")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve API: %w", err)
+	}
+	return nil
+}
+
+// auth rejects requests without the API token.
+func (d *daemon) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(d.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// startSync starts a sync of the configured job in the background.
+func (d *daemon) startSync(w http.ResponseWriter, r *http.Request) {
+	d.trigger(w, "", nil)
+}
+
+// webhook starts a sync of the job, or of the paths named in the request,
+// for callers such as CI pipelines or audit log forwarders. If a webhook
+// secret is set the body must be signed with it.
+func (d *daemon) webhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if d.webhookSecret != "" && !validSignature(d.webhookSecret, body, r.Header.Get("X-Hvm-Signature")) {
+		writeError(w, http.StatusUnauthorized, "missing or invalid signature")
+		return
+	}
+
+	var req webhookRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to decode body: %v", err))
+			return
+		}
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = strings.TrimPrefix(p, "/")
+		if req.Paths[i] == "" {
+			writeError(w, http.StatusBadRequest, "paths must not be empty")
+			return
+		}
+		if slices.Contains(strings.Split(req.Paths[i], "/"), "..") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("path %q must not contain .. segments", p))
+			return
+		}
+	}
+	d.trigger(w, req.Job, req.Paths)
+}
+
+// validSignature reports whether sig is "sha256=" followed by the hex HMAC
+// of body under secret.
+func validSignature(secret string, body []byte, sig string) bool {
+	got, ok := strings.CutPrefix(sig, "sha256=")
+	if !ok {
+		return false
+	}
+	want, err := hex.DecodeString(got)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(want, mac.Sum(nil))
+}
+
+// trigger starts a sync in the background, of the whole job or only of
+// paths. Only one sync runs at a time.
+//
+// Arguments:
+//
+//	w: http.ResponseWriter - The response to write the daemon's status or an error to.
+//	job: string - The job the caller asked for, or empty for the configured job.
+//	paths: []string - The secrets and folders to sync, or nil for the whole job.
+func (d *daemon) trigger(w http.ResponseWriter, job string, paths []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		writeError(w, http.StatusConflict, "a sync is already running")
+		return
+	}
+
+	cfg, err := loadConfig(d.cmd)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job != "" && job != cfg.Metrics.Job {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no job named %q", job))
+		return
+	}
+	// Like the audit follower, a caller may only sync below the job's path.
+	root := strings.TrimPrefix(cfg.SourceVault.Path, "/")
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, root) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("path %q is outside the job's path %q", p, root))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	d.cancel, d.startedAt, d.paths = cancel, time.Now().UTC(), paths
+	go d.sync(ctx, cfg, paths)
+
+	writeJSON(w, http.StatusAccepted, d.statusLocked())
+}
+
+// sync runs one sync, of the whole job or only of paths, and records its
+// outcome.
+func (d *daemon) sync(ctx context.Context, cfg *vaultsync.Config, paths []string) {
+	var (
+		report *vaultsync.Report
+		err    error
+	)
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.cancel()
+		d.cancel, d.paths = nil, nil
+		d.lastError = ""
+		if err != nil {
+			d.lastError = err.Error()
+		}
+		if report != nil {
+			d.lastRun = newRunInfo(report)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			go d.alertSyncFailed(cfg, report, err)
+		}
+		go notifyRun(d.ctx, cfg, report, err)
+	}()
+
+	opts, err := syncOptions(cfg)
+	if err != nil {
+		return
+	}
+	opts = append(opts, vaultsync.WithLogger(log.Output(vaultsync.NewRedactWriter(io.MultiWriter(logOutput, d.logs)))))
+	if d.metrics != nil {
+		opts = append(opts, vaultsync.WithMetrics(d.metrics))
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, opts...)
+	if err != nil {
+		err = fmt.Errorf("failed to create syncer: %w", err)
+		return
+	}
+	defer syncer.Close()
+	if len(paths) == 0 {
+		report, err = syncer.Sync(ctx)
+		return
+	}
+
+	secrets, err := expandPaths(ctx, syncer, paths)
+	if err != nil {
+		return
+	}
+	report, err = syncer.SyncPaths(ctx, secrets)
+	if report != nil {
+		if err := vaultsync.SaveRun(cfg.RunDir(), report); err != nil {
+			log.Error().Err(err).Msg("Failed to save run")
+		}
+	}
+}
+
+// expandPaths replaces every folder in paths, i.e. every path ending in
+// "/", with the secrets below it on the source.
+func expandPaths(ctx context.Context, syncer *vaultsync.Syncer, paths []string) ([]string, error) {
+	var secrets []string
+	for _, p := range paths {
+		if !strings.HasSuffix(p, "/") {
+			secrets = append(secrets, p)
+			continue
+		}
+		listed, err := syncer.List(ctx, vaultsync.ListSource, p, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", p, err)
+		}
+		for _, s := range listed {
+			secrets = append(secrets, s.Path)
+		}
+	}
+	return secrets, nil
+}
+
+// cancelSync cancels the running sync.
+func (d *daemon) cancelSync(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel == nil {
+		writeError(w, http.StatusNotFound, "no sync is running")
+		return
+	}
+	d.cancel()
+	writeJSON(w, http.StatusAccepted, d.statusLocked())
+}
+
+func (d *daemon) status(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	writeJSON(w, http.StatusOK, d.statusLocked())
+}
+
+// statusLocked returns the daemon's status. The caller must hold d.mu.
+func (d *daemon) statusLocked() daemonStatus {
+	st := daemonStatus{Running: d.cancel != nil, Paths: d.paths, LastRun: d.lastRun, LastError: d.lastError}
+	if st.Running {
+		t := d.startedAt
+		st.StartedAt = &t
+	}
+	return st
+}
+
+// runs lists the most recent runs in the state directory, newest first.
+func (d *daemon) runs(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	dir, err := d.runDir()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reports, err := vaultsync.RecentRuns(dir, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	infos := make([]*runInfo, 0, len(reports))
+	for _, report := range reports {
+		infos = append(infos, newRunInfo(report))
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// run returns the full report of a run.
+func (d *daemon) run(w http.ResponseWriter, r *http.Request) {
+	dir, err := d.runDir()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	report, err := vaultsync.LoadRun(dir, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// runDir returns the state directory of the current config.
+func (d *daemon) runDir() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cfg, err := loadConfig(d.cmd)
+	if err != nil {
+		return "", err
+	}
+	return cfg.RunDir(), nil
+}
+
+// streamLogs streams the logs of every sync as JSON lines until the client
+// disconnects.
+func (d *daemon) streamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lines, unsubscribe := d.logs.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-lines:
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Write sends a copy of p to every subscriber, dropping it for subscribers
+// that are falling behind rather than slowing down the sync.
+func (h *logHub) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		select {
+		case sub <- line:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns a channel of log lines and a function to stop them.
+func (h *logHub) subscribe() (<-chan []byte, func()) {
+	sub := make(chan []byte, 256)
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub, func() {
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+	}
+}
+
+// newRunInfo summarizes a report.
+func newRunInfo(r *vaultsync.Report) *runInfo {
+	return &runInfo{
+		RunID:      r.RunID,
+		Mount:      r.Mount,
+		Path:       r.Path,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Verified:   r.Verified,
+		Cancelled:  r.Cancelled,
+		Created:    r.Created,
+		Updated:    r.Updated,
+		Unchanged:  r.Unchanged,
+		Skipped:    r.Skipped,
+		Failed:     r.Failed,
+	}
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to write API response")
+	}
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
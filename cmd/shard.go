@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+// jobCompletionIndexEnv is set by Kubernetes on every pod of an Indexed Job,
+// so a Job with parallelism can shard without templating each pod's flags.
+const jobCompletionIndexEnv = "JOB_COMPLETION_INDEX"
+
+// applyShard applies --shard_total and --shard_index to cfg. Without an
+// explicit --shard_index or config shard.index, the index is taken from
+// JOB_COMPLETION_INDEX if it is set.
+//
+// Arguments:
+//
+//	cmd: *cobra.Command - The command with the shard flags.
+//	cfg: *vaultsync.Config - The config to update.
+//
+// Returns:
+//
+//	error - An error if a flag or JOB_COMPLETION_INDEX is not a number.
+func applyShard(cmd *cobra.Command, cfg *vaultsync.Config) error {
+	if cmd.Flags().Changed("shard_total") {
+		total, err := cmd.Flags().GetInt("shard_total")
+		if err != nil {
+			return err
+		}
+		cfg.Shard.Total = total
+	}
+	switch {
+	case cmd.Flags().Changed("shard_index"):
+		index, err := cmd.Flags().GetInt("shard_index")
+		if err != nil {
+			return err
+		}
+		cfg.Shard.Index = index
+	case cfg.Shard.Total > 1 && !v.IsSet("shard.index") && os.Getenv(jobCompletionIndexEnv) != "":
+		index, err := strconv.Atoi(os.Getenv(jobCompletionIndexEnv))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", jobCompletionIndexEnv, err)
+		}
+		cfg.Shard.Index = index
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var migrateSnapshotCmd = &cobra.Command{
+	Use:   "migrate-snapshot",
+	Short: "Check, or with --apply carry out, replacing the target vault with a raft snapshot of the source vault",
+	RunE:  migrateSnapshotFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(migrateSnapshotCmd)
+
+	migrateSnapshotCmd.Flags().Bool("apply", false, "Take and restore the snapshot instead of only running the pre-flight checks")
+	migrateSnapshotCmd.Flags().Bool("yes", false, "Apply without asking for confirmation")
+	migrateSnapshotCmd.Flags().String("snapshot_file", "", "Keep the snapshot in this file instead of a temporary one")
+	migrateSnapshotCmd.Flags().String("report_file", "", "Write a JSON report of the checks, or of the migration, to this file")
+}
+
+func migrateSnapshotFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	apply, err := cmd.Flags().GetBool("apply")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	// The checks always run, and are shown, before anything is written.
+	out := cmd.OutOrStdout()
+	checks, checkErr := syncer.MigrateSnapshot(cmd.Context(), false, "")
+	if checks != nil {
+		printSnapshotReport(out, checks)
+	}
+	if checkErr != nil || !apply {
+		if checks != nil {
+			writeSnapshotReport(cmd, checks)
+		}
+		return checkErr
+	}
+
+	if !yes {
+		fmt.Fprint(cmd.ErrOrStderr(), "This REPLACES all data on the target vault, which must then be unsealed with the source vault's keys. Continue? [y/N] ")
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			return fmt.Errorf("snapshot migration not confirmed")
+		}
+	}
+
+	report, applyErr := syncer.MigrateSnapshot(cmd.Context(), true, cmd.Flag("snapshot_file").Value.String())
+	if report != nil {
+		fmt.Fprintln(out)
+		printSnapshotReport(out, report)
+		writeSnapshotReport(cmd, report)
+	}
+	if applyErr != nil {
+		return fmt.Errorf("failed to migrate snapshot: %w", applyErr)
+	}
+	return nil
+}
+
+// writeSnapshotReport writes r to the --report_file, if one was given.
+func writeSnapshotReport(cmd *cobra.Command, r *vaultsync.SnapshotReport) {
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, r); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+}
+
+// printSnapshotReport prints the pre-flight checks and the restored
+// snapshot, if any.
+func printSnapshotReport(w io.Writer, r *vaultsync.SnapshotReport) {
+	fmt.Fprintf(w, "Source vault: %s\n", r.SourceVersion)
+	fmt.Fprintf(w, "Target vault: %s\n", r.DestinationVersion)
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(w, "Pre-flight checks: passed")
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "Problem: %s\n", p)
+	}
+	if r.Bytes > 0 {
+		fmt.Fprintf(w, "Snapshot: %d bytes, sha256 %s\n", r.Bytes, r.SHA256)
+	}
+	if r.File != "" {
+		fmt.Fprintf(w, "Snapshot file: %s\n", r.File)
+	}
+	if r.Restored {
+		fmt.Fprintln(w, "Restored. Unseal the target vault with the source vault's keys.")
+	}
+}
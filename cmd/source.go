@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/j4ng5y/hvm/internal/consul"
+	"github.com/j4ng5y/hvm/internal/etcd"
+	"github.com/j4ng5y/hvm/internal/gitops"
+	"github.com/j4ng5y/hvm/internal/passwordmanager"
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+// sourceOptions returns the Syncer option for the configured non-vault
+// source, if any.
+func sourceOptions(cfg *vaultsync.Config) ([]vaultsync.Option, error) {
+	enabled := 0
+	for _, on := range []bool{cfg.Consul.Enabled, cfg.Etcd.Enabled, cfg.OnePassword.Enabled, cfg.Bitwarden.Enabled, cfg.GitOps.Enabled} {
+		if on {
+			enabled++
+		}
+	}
+	if enabled > 1 {
+		return nil, fmt.Errorf("only one of consul, etcd, onePassword, bitwarden, and gitOps may be enabled")
+	}
+
+	switch {
+	case cfg.Consul.Enabled:
+		c := cfg.Consul
+		switch c.Mode {
+		case "", consul.ModeFolder, consul.ModeKey:
+		default:
+			return nil, fmt.Errorf("unknown consul mode %q", c.Mode)
+		}
+		return []vaultsync.Option{vaultsync.WithSource(&consul.KV{
+			Address:         c.Address,
+			Token:           c.Token,
+			Datacenter:      c.Datacenter,
+			Prefix:          c.Prefix,
+			ExcludePrefixes: c.ExcludePrefixes,
+			Mode:            c.Mode,
+			ValueField:      c.ValueField,
+		})}, nil
+
+	case cfg.Etcd.Enabled:
+		e := cfg.Etcd
+		switch e.Mode {
+		case "", etcd.ModeFolder, etcd.ModeKey:
+		default:
+			return nil, fmt.Errorf("unknown etcd mode %q", e.Mode)
+		}
+		return []vaultsync.Option{vaultsync.WithSource(&etcd.KV{
+			Endpoints:  e.Endpoints,
+			Username:   e.Username,
+			Password:   e.Password,
+			CAFile:     e.CAFile,
+			CertFile:   e.CertFile,
+			KeyFile:    e.KeyFile,
+			Prefix:     e.Prefix,
+			Separator:  e.Separator,
+			Mode:       e.Mode,
+			ValueField: e.ValueField,
+		})}, nil
+
+	case cfg.OnePassword.Enabled:
+		o := cfg.OnePassword
+		return []vaultsync.Option{vaultsync.WithSource(passwordmanager.NewOnePassword(o.ConnectHost, o.Token, o.FieldMap))}, nil
+
+	case cfg.Bitwarden.Enabled:
+		b := cfg.Bitwarden
+		return []vaultsync.Option{vaultsync.WithSource(passwordmanager.NewBitwarden(b.ServeURL, b.FieldMap))}, nil
+
+	case cfg.GitOps.Enabled:
+		g := cfg.GitOps
+		return []vaultsync.Option{vaultsync.WithSource(&gitops.Dir{
+			Root:       g.Dir,
+			SopsPath:   g.SopsPath,
+			AgeKeyFile: g.AgeKeyFile,
+		})}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Summarize how far the target vault has drifted from the source, without writing anything",
+	RunE:  statusFunc,
+}
+
+type (
+	// jobStatus is the drift summary printed by status.
+	jobStatus struct {
+		Mount       string      `json:"mount"`
+		Path        string      `json:"path"`
+		Source      string      `json:"source"`
+		Destination string      `json:"destination"`
+		InSync      int         `json:"inSync"`
+		OutOfDate   int         `json:"outOfDate"`
+		Missing     int         `json:"missing"`
+		Orphaned    int         `json:"orphaned"`
+		Errors      int         `json:"errors"`
+		LastRun     *lastRunRef `json:"lastRun,omitempty"`
+	}
+
+	// lastRunRef summarizes the most recent run of the job.
+	lastRunRef struct {
+		RunID      string    `json:"runId"`
+		FinishedAt time.Time `json:"finishedAt,omitempty"`
+		Verified   bool      `json:"verified"`
+		Failed     int       `json:"failed"`
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().String("format", "table", "The output format: table or json")
+}
+
+func statusFunc(cmd *cobra.Command, args []string) error {
+	format := cmd.Flag("format").Value.String()
+	if format != "table" && format != "json" {
+		return fmt.Errorf("invalid --format %q: want table or json", format)
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	diff, err := syncer.Diff(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to compare vaults: %w", err)
+	}
+
+	st := jobStatus{
+		Mount:       diff.Mount,
+		Path:        diff.Path,
+		Source:      cfg.SourceVault.Address,
+		Destination: cfg.DestinationVault.Address,
+		InSync:      diff.Matched,
+		OutOfDate:   diff.Changed,
+		Missing:     diff.Missing,
+		Orphaned:    diff.Extra,
+		Errors:      diff.Errors,
+	}
+	runs, err := vaultsync.RecentRuns(cfg.RunDir(), 0)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read previous runs")
+	}
+	for _, r := range runs {
+		if r.Mount == diff.Mount && r.Path == diff.Path {
+			st.LastRun = &lastRunRef{RunID: r.RunID, FinishedAt: r.FinishedAt, Verified: r.Verified, Failed: r.Failed}
+			break
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Job:\t%s/%s (%s -> %s)\n", st.Mount, st.Path, st.Source, st.Destination)
+	switch {
+	case st.LastRun == nil:
+		fmt.Fprintln(tw, "Last run:\tnone")
+	case st.LastRun.FinishedAt.IsZero():
+		fmt.Fprintf(tw, "Last run:\t%s, unfinished\n", st.LastRun.RunID)
+	default:
+		verified := "not verified"
+		if st.LastRun.Verified {
+			verified = "verified"
+		}
+		fmt.Fprintf(tw, "Last run:\t%s, finished %s, %s, %d failed\n", st.LastRun.RunID, st.LastRun.FinishedAt.Local().Format(time.RFC3339), verified, st.LastRun.Failed)
+	}
+	fmt.Fprintf(tw, "In sync:\t%d\n", st.InSync)
+	fmt.Fprintf(tw, "Out of date:\t%d\n", st.OutOfDate)
+	fmt.Fprintf(tw, "Missing on target:\t%d\n", st.Missing)
+	fmt.Fprintf(tw, "Orphaned on target:\t%d\n", st.Orphaned)
+	if st.Errors > 0 {
+		fmt.Fprintf(tw, "Could not compare:\t%d\n", st.Errors)
+	}
+	return tw.Flush()
+}
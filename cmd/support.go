@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	redacted = "[REDACTED]"
+
+	// maxBundleLogBytes is how much of the end of each log file is kept.
+	maxBundleLogBytes = 10 << 20
+)
+
+var (
+	supportBundleCmd = &cobra.Command{
+		Use:   "support-bundle",
+		Short: "Collect the sanitized config, recent run reports, environment, and redacted logs for a bug report",
+		RunE:  supportBundleFunc,
+	}
+
+	// sensitiveName matches config keys and environment variables whose
+	// values are credentials.
+	sensitiveName = regexp.MustCompile(`(?i)(token|secret|password|passwd|credential|key$|keyfile|signing|auth)`)
+	// sensitiveValue matches credentials that can turn up anywhere in a log
+	// line or error message: vault tokens, bearer tokens, and Slack tokens.
+	sensitiveValue = regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]+|\bs\.[A-Za-z0-9]{24}\b|(?i:bearer\s+)[A-Za-z0-9._~+/=-]+|\bxox[abpr]-[A-Za-z0-9-]+`)
+	// envPrefixes are the environment variables that affect hvm.
+	envPrefixes = []string{"HVM_", "VAULT_", "CONSUL_", "AZURE_", "KUBERNETES_", "OTEL_", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "GOMAXPROCS", "GOMEMLIMIT"}
+)
+
+type (
+	// supportEnvironment describes where hvm is running.
+	supportEnvironment struct {
+		Version   string            `json:"version"`
+		Revision  string            `json:"revision,omitempty"`
+		GoVersion string            `json:"goVersion"`
+		OS        string            `json:"os"`
+		Arch      string            `json:"arch"`
+		NumCPU    int               `json:"numCPU"`
+		Collected time.Time         `json:"collected"`
+		Env       map[string]string `json:"env"`
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+
+	supportBundleCmd.Flags().StringP("output", "o", "", "The bundle to write (defaults to hvm-support-<timestamp>.tar.gz)")
+	supportBundleCmd.Flags().Int("runs", 5, "The number of recent run reports to include")
+	supportBundleCmd.Flags().StringSlice("log_file", nil, "Log files to include after redaction")
+}
+
+func supportBundleFunc(cmd *cobra.Command, args []string) (err error) {
+	output := cmd.Flag("output").Value.String()
+	if output == "" {
+		output = fmt.Sprintf("hvm-support-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	runs, err := cmd.Flags().GetInt("runs")
+	if err != nil {
+		return err
+	}
+	logFiles, err := cmd.Flags().GetStringSlice("log_file")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create support bundle: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	b := &bundle{tw: tw}
+
+	// A broken config is often the bug being reported, so problems reading
+	// it are recorded in the bundle instead of failing the command.
+	stateDir := vaultsync.DefaultStateDir
+	settings, err := sanitizedConfig(cmd.Flag("config_file").Value.String())
+	if err != nil {
+		b.note("config: %v", err)
+	} else {
+		b.addJSON("config.json", settings)
+		if dir, ok := settings["statedir"].(string); ok && dir != "" {
+			stateDir = dir
+		}
+	}
+
+	b.addJSON("environment.json", environment())
+
+	reports, err := vaultsync.RecentRuns(stateDir, runs)
+	if err != nil {
+		b.note("runs: %v", err)
+	}
+	for _, r := range reports {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			b.note("run %s: %v", r.RunID, err)
+			continue
+		}
+		b.add("runs/"+r.RunID+".json", sensitiveValue.ReplaceAll(data, []byte(redacted)))
+	}
+
+	for i, path := range logFiles {
+		data, err := redactLog(path)
+		if err != nil {
+			b.note("log %s: %v", path, err)
+			continue
+		}
+		b.add(fmt.Sprintf("logs/%d-%s", i, sanitizeFileName(path)), data)
+	}
+
+	if len(b.notes) > 0 {
+		b.add("NOTES.txt", []byte(strings.Join(b.notes, "\n")+"\n"))
+	}
+	if b.err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", b.err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+
+	log.Info().Str("file", output).Int("runs", len(reports)).Int("logs", len(logFiles)).Int("notes", len(b.notes)).Msg("Wrote support bundle")
+	return nil
+}
+
+// bundle writes files to a support bundle, keeping the first error.
+type bundle struct {
+	tw    *tar.Writer
+	err   error
+	notes []string
+}
+
+func (b *bundle) add(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}
+	if b.err = b.tw.WriteHeader(hdr); b.err == nil {
+		_, b.err = b.tw.Write(data)
+	}
+}
+
+func (b *bundle) addJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.note("%s: %v", name, err)
+		return
+	}
+	b.add(name, data)
+}
+
+// note records a problem collecting part of the bundle.
+func (b *bundle) note(format string, args ...interface{}) {
+	b.notes = append(b.notes, fmt.Sprintf(format, args...))
+}
+
+// sanitizedConfig reads the config file with every credential redacted.
+func sanitizedConfig(path string) (map[string]interface{}, error) {
+	r := viper.New()
+	r.SetConfigFile(path)
+	if err := r.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	settings := r.AllSettings()
+	redactMap(settings)
+	return settings, nil
+}
+
+// redactMap replaces, in place, the values of sensitive keys and any
+// credentials embedded in other string values.
+func redactMap(m map[string]interface{}) {
+	for k, val := range m {
+		if str, ok := val.(string); ok && str != "" && sensitiveName.MatchString(k) {
+			m[k] = redacted
+			continue
+		}
+		m[k] = redactValue(val)
+	}
+}
+
+func redactValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		redactMap(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	case string:
+		return sensitiveValue.ReplaceAllString(v, redacted)
+	}
+	return val
+}
+
+// environment describes the build and host, including which relevant
+// environment variables are set, with sensitive values redacted.
+func environment() supportEnvironment {
+	env := supportEnvironment{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Collected: time.Now().UTC(),
+		Env:       make(map[string]string),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				env.Revision = s.Value
+			}
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		name, val, _ := strings.Cut(kv, "=")
+		for _, p := range envPrefixes {
+			if !strings.HasPrefix(name, p) {
+				continue
+			}
+			if sensitiveName.MatchString(name) {
+				val = redacted
+			}
+			env.Env[name] = sensitiveValue.ReplaceAllString(val, redacted)
+			break
+		}
+	}
+	return env
+}
+
+// redactLog returns the end of a log file with credentials removed. JSON
+// log lines have sensitive fields redacted by name; every line has
+// credential-looking values replaced.
+func redactLog(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxBundleLogBytes {
+		if _, err := f.Seek(-maxBundleLogBytes, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxBundleLogBytes)
+	for sc.Scan() {
+		line := sc.Bytes()
+		var fields map[string]interface{}
+		if json.Unmarshal(line, &fields) == nil {
+			redactMap(fields)
+			if b, err := json.Marshal(fields); err == nil {
+				line = b
+			}
+		}
+		out.Write(sensitiveValue.ReplaceAll(line, []byte(redacted)))
+		out.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// sanitizeFileName turns a path into a flat file name for the bundle.
+func sanitizeFileName(path string) string {
+	return strings.Trim(strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(path), "_")
+}
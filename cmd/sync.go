@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Migrate vault configuration other than secrets",
+	}
+	syncPoliciesCmd = &cobra.Command{
+		Use:   "policies",
+		Short: "Copy ACL policies from the source vault to the target vault",
+		RunE:  syncPoliciesFunc,
+	}
+	syncIdentityCmd = &cobra.Command{
+		Use:   "identity",
+		Short: "Copy identity entities, groups, and their aliases to the target vault, remapping auth mount accessors",
+		RunE:  syncIdentityFunc,
+	}
+	syncAuthCmd = &cobra.Command{
+		Use:   "auth",
+		Short: "Enable the source vault's auth methods on the target vault and copy their config and roles",
+		RunE:  syncAuthFunc,
+	}
+	syncTransitCmd = &cobra.Command{
+		Use:   "transit",
+		Short: "Move transit keys to the target vault with backup and restore or BYOK import, reporting keys that cannot be moved",
+		RunE:  syncTransitFunc,
+	}
+	syncPKICmd = &cobra.Command{
+		Use:   "pki",
+		Short: "Copy PKI roles, URL and CRL config, and optionally issuer certificates to the target vault",
+		RunE:  syncPKIFunc,
+	}
+	syncTOTPCmd = &cobra.Command{
+		Use:   "totp",
+		Short: "Import TOTP keys on the target vault from their seeds, flagging keys whose seeds are not retrievable",
+		RunE:  syncTOTPFunc,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.AddCommand(syncPoliciesCmd, syncAuthCmd, syncIdentityCmd, syncTransitCmd, syncPKICmd, syncTOTPCmd)
+
+	syncPoliciesCmd.Flags().String("filter", "", "Only sync policies whose names match this glob, e.g. team-*")
+	syncPoliciesCmd.Flags().Bool("dry_run", false, "Show what would change without writing anything")
+	syncPoliciesCmd.Flags().String("report_file", "", "Write a JSON report of the policy sync to this file")
+
+	syncAuthCmd.Flags().String("filter", "", "Only sync auth mounts whose paths match this glob, e.g. approle*")
+	syncAuthCmd.Flags().Bool("dry_run", false, "Show what would be copied without writing anything")
+	syncAuthCmd.Flags().String("report_file", "", "Write a JSON report of the auth sync to this file")
+
+	syncIdentityCmd.Flags().Bool("dry_run", false, "Show what would be copied without writing anything")
+	syncIdentityCmd.Flags().String("report_file", "", "Write a JSON report of the identity sync to this file")
+
+	syncTransitCmd.Flags().String("mount", "transit", "The transit mount on both vaults")
+	syncTransitCmd.Flags().String("filter", "", "Only move keys whose names match this glob, e.g. app-*")
+	syncTransitCmd.Flags().Bool("dry_run", false, "Show what would be moved without writing anything")
+	syncTransitCmd.Flags().String("report_file", "", "Write a JSON report of the transit sync to this file")
+
+	syncPKICmd.Flags().String("mount", "pki", "The PKI mount on both vaults")
+	syncPKICmd.Flags().String("filter", "", "Only copy roles whose names match this glob, e.g. web-*")
+	syncPKICmd.Flags().Bool("include_ca", false, "Also import the issuer certificates and CA chains, without their private keys")
+	syncPKICmd.Flags().Bool("dry_run", false, "Show what would be copied without writing anything")
+	syncPKICmd.Flags().String("report_file", "", "Write a JSON report of the PKI sync to this file")
+
+	syncTOTPCmd.Flags().String("mount", "totp", "The TOTP mount on both vaults")
+	syncTOTPCmd.Flags().String("filter", "", "Only copy keys whose names match this glob, e.g. svc-*")
+	syncTOTPCmd.Flags().String("seeds_file", "", "A JSON object of key names to otpauth URLs or base32 keys, as vault never returns seeds")
+	syncTOTPCmd.Flags().Bool("dry_run", false, "Show what would be copied without writing anything")
+	syncTOTPCmd.Flags().String("report_file", "", "Write a JSON report of the TOTP sync to this file")
+}
+
+func syncPoliciesFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncPolicies(cmd.Context(), cmd.Flag("filter").Value.String(), dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync policies: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, p := range report.Policies {
+		if p.Action == vaultsync.PolicyUnchanged {
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", p.Name, p.Action)
+		if p.Error != "" {
+			fmt.Fprintf(out, "  %s\n", p.Error)
+		}
+		fmt.Fprint(out, p.Diff)
+	}
+	verb := ""
+	if dryRun {
+		verb = "would be "
+	}
+	fmt.Fprintf(out, "%d %screated, %d %supdated, %d unchanged, %d skipped, %d failed\n",
+		report.Created, verb, report.Updated, verb, report.Unchanged, report.Skipped, report.Failed)
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync policies: %w", syncErr)
+	}
+	return nil
+}
+
+func syncAuthFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncAuth(cmd.Context(), cmd.Flag("filter").Value.String(), dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync auth methods: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, m := range report.Mounts {
+		fmt.Fprintf(out, "%s (%s): %s\n", m.Path, m.Type, m.Action)
+		if m.Error != "" {
+			fmt.Fprintf(out, "  error: %s\n", m.Error)
+			continue
+		}
+		if m.Config {
+			fmt.Fprintln(out, "  config")
+		}
+		for _, r := range m.Roles {
+			fmt.Fprintf(out, "  role %s\n", r)
+		}
+		for _, n := range m.NotExported {
+			fmt.Fprintf(out, "  not exported, set by hand: %s\n", n)
+		}
+	}
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync auth methods: %w", syncErr)
+	}
+	return nil
+}
+
+func syncIdentityFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncIdentity(cmd.Context(), dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync identity: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "%d entities, %d entity aliases, %d groups, %d group aliases\n",
+		report.Entities, report.Aliases, report.Groups, report.GroupAliases)
+	for _, u := range report.Unmapped {
+		fmt.Fprintf(out, "not copied, no matching auth mount on the target: %s\n", u)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintf(out, "error: %s\n", e)
+	}
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync identity: %w", syncErr)
+	}
+	return nil
+}
+
+func syncTransitFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncTransit(cmd.Context(), cmd.Flag("mount").Value.String(), cmd.Flag("filter").Value.String(), dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync transit keys: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, k := range report.Keys {
+		fmt.Fprintf(out, "%s (%s): %s\n", k.Name, k.Type, k.Action)
+		switch {
+		case k.Reason != "":
+			fmt.Fprintf(out, "  %s\n", k.Reason)
+		case k.Error != "":
+			fmt.Fprintf(out, "  error: %s\n", k.Error)
+		case k.Action == vaultsync.TransitImported:
+			fmt.Fprintln(out, "  HMAC key not carried over, HMACs will differ")
+		}
+	}
+	verb := ""
+	if dryRun {
+		verb = "would be "
+	}
+	fmt.Fprintf(out, "%d %smoved, %d already on the target, %d cannot be moved, %d failed\n",
+		report.Moved, verb, report.Exists, report.Unmovable, report.Failed)
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync transit keys: %w", syncErr)
+	}
+	return nil
+}
+
+func syncPKIFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+	includeCA, err := cmd.Flags().GetBool("include_ca")
+	if err != nil {
+		return err
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncPKI(cmd.Context(), cmd.Flag("mount").Value.String(), cmd.Flag("filter").Value.String(), includeCA, dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync PKI mount: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, c := range report.Config {
+		fmt.Fprintf(out, "%s\n", c)
+	}
+	for _, i := range report.Issuers {
+		name := i.ID
+		if i.Name != "" {
+			name = i.Name + " (" + i.ID + ")"
+		}
+		fmt.Fprintf(out, "issuer %s: %s\n", name, i.Action)
+	}
+	for _, r := range report.Roles {
+		fmt.Fprintf(out, "role %s\n", r)
+	}
+	for _, n := range report.NotExported {
+		fmt.Fprintf(out, "not exported, set by hand: %s\n", n)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintf(out, "error: %s\n", e)
+	}
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync PKI mount: %w", syncErr)
+	}
+	return nil
+}
+
+func syncTOTPFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry_run")
+	if err != nil {
+		return err
+	}
+
+	var seeds map[string]string
+	if seedsFile := cmd.Flag("seeds_file").Value.String(); seedsFile != "" {
+		if seeds, err = vaultsync.LoadTOTPSeeds(seedsFile); err != nil {
+			return err
+		}
+	}
+
+	syncer, err := vaultsync.NewSyncer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	report, syncErr := syncer.SyncTOTP(cmd.Context(), cmd.Flag("mount").Value.String(), cmd.Flag("filter").Value.String(), seeds, dryRun)
+	if report == nil {
+		return fmt.Errorf("failed to sync TOTP keys: %w", syncErr)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, k := range report.Keys {
+		fmt.Fprintf(out, "%s: %s\n", k.Name, k.Action)
+		if k.Error != "" {
+			fmt.Fprintf(out, "  error: %s\n", k.Error)
+		}
+	}
+	verb := ""
+	if dryRun {
+		verb = "would be "
+	}
+	fmt.Fprintf(out, "%d %simported, %d already on the target, %d not exportable, %d failed\n",
+		report.Imported, verb, report.Exists, report.NotExportable, report.Failed)
+
+	if reportFile := cmd.Flag("report_file").Value.String(); reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Error().Err(err).Msg("Failed to write report")
+		}
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync TOTP keys: %w", syncErr)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+)
+
+// maxTerminationError keeps the summary well inside Kubernetes' 4KiB
+// termination message limit.
+const maxTerminationError = 1024
+
+type (
+	// runSummary is the compact outcome of a run written to the termination file.
+	runSummary struct {
+		Outcome   string             `json:"outcome"`
+		ExitCode  int                `json:"exitCode"`
+		Error     string             `json:"error,omitempty"`
+		RunID     string             `json:"runId,omitempty"`
+		Verified  bool               `json:"verified"`
+		Created   int                `json:"created"`
+		Updated   int                `json:"updated"`
+		Unchanged int                `json:"unchanged"`
+		Skipped   int                `json:"skipped"`
+		Failed    int                `json:"failed"`
+		Denied    int                `json:"denied,omitempty"`
+		Deleted   int                `json:"deleted,omitempty"`
+		Destroyed int                `json:"destroyed,omitempty"`
+		Duration  vaultsync.Duration `json:"duration"`
+	}
+)
+
+// newRunSummary summarizes how a run ended. report may be nil if the run
+// never started syncing.
+//
+// Arguments:
+//
+//	report: *vaultsync.Report - The sync report, if any.
+//	err: error - The error the run ended with, if any.
+//
+// Returns:
+//
+//	runSummary - The outcome of the run.
+func newRunSummary(report *vaultsync.Report, err error) runSummary {
+	sum := runSummary{ExitCode: ExitCode(err)}
+	switch sum.ExitCode {
+	case 0:
+		sum.Outcome = "success"
+	case ExitPartialFailure:
+		sum.Outcome = "partial_failure"
+	case ExitCancelled:
+		sum.Outcome = "cancelled"
+	case ExitDeadline:
+		sum.Outcome = "deadline_exceeded"
+	default:
+		sum.Outcome = "failure"
+	}
+	if err != nil {
+		sum.Error = err.Error()
+		if len(sum.Error) > maxTerminationError {
+			sum.Error = sum.Error[:maxTerminationError] + "..."
+		}
+	}
+	if report != nil {
+		sum.RunID = report.RunID
+		sum.Verified = report.Verified
+		sum.Created, sum.Updated, sum.Unchanged = report.Created, report.Updated, report.Unchanged
+		sum.Skipped, sum.Failed, sum.Denied = report.Skipped, report.Failed, report.Denied
+		sum.Deleted, sum.Destroyed = report.Deleted, report.Destroyed
+		sum.Duration = report.Durations.Total
+	}
+	return sum
+}
+
+// writeTermination writes a compact JSON summary of a run to path, such as a
+// Kubernetes terminationMessagePath. report may be nil if the run never
+// started syncing.
+//
+// Arguments:
+//
+//	path: string - The termination file.
+//	report: *vaultsync.Report - The sync report, if any.
+//	err: error - The error the run ended with, if any.
+//
+// Returns: nothing
+func writeTermination(path string, report *vaultsync.Report, err error) {
+	b, mErr := json.Marshal(newRunSummary(report, err))
+	if mErr != nil {
+		log.Error().Err(mErr).Msg("Failed to encode termination summary")
+		return
+	}
+	if wErr := os.WriteFile(path, b, 0o644); wErr != nil {
+		log.Error().Err(wErr).Str("file", path).Msg("Failed to write termination summary")
+	}
+}
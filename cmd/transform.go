@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type (
+	// transformSample is a single secret fed through `hvm transform test`.
+	transformSample struct {
+		Path string                 `json:"path"`
+		Data map[string]interface{} `json:"data"`
+	}
+)
+
+var (
+	transformCmd = &cobra.Command{
+		Use:   "transform",
+		Short: "Work with path/key/value transform rules",
+	}
+	transformTestCmd = &cobra.Command{
+		Use:   "test",
+		Short: "Apply transform rules to sample secrets without touching any vault",
+		RunE:  transformTestFunc,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(transformCmd)
+	transformCmd.AddCommand(transformTestCmd)
+
+	transformTestCmd.Flags().StringP("rules", "r", "", "The transform rules file (defaults to the transforms in the config file)")
+	transformTestCmd.Flags().StringP("input", "i", "", "A JSON file holding a sample {\"path\", \"data\"} object or a list of them")
+	if err := transformTestCmd.MarkFlagRequired("input"); err != nil {
+		log.Fatal().Err(err).Msg("Failed to mark input flag required")
+	}
+}
+
+func transformTestFunc(cmd *cobra.Command, args []string) error {
+	rules, err := loadTransforms(cmd)
+	if err != nil {
+		return err
+	}
+
+	t, err := vaultsync.NewTransformer(rules)
+	if err != nil {
+		return err
+	}
+
+	samples, err := readTransformSamples(cmd.Flag("input").Value.String())
+	if err != nil {
+		return err
+	}
+
+	results := make([]transformSample, 0, len(samples))
+	for _, sample := range samples {
+		p, data, err := t.Transform(sample.Path, sample.Data)
+		if err != nil {
+			return fmt.Errorf("failed to transform %q: %w", sample.Path, err)
+		}
+		results = append(results, transformSample{Path: p, Data: data})
+	}
+
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// loadTransforms reads transform rules from the --rules file, or from the
+// transforms section of the config file when no rules file is given.
+func loadTransforms(cmd *cobra.Command) (vaultsync.Transforms, error) {
+	var t vaultsync.Transforms
+
+	r := viper.New()
+	if rulesFile := cmd.Flag("rules").Value.String(); rulesFile != "" {
+		r.SetConfigFile(rulesFile)
+		if err := r.ReadInConfig(); err != nil {
+			return t, fmt.Errorf("failed to read rules: %w", err)
+		}
+		return t, r.Unmarshal(&t)
+	}
+
+	r.SetConfigFile(cmd.Flag("config_file").Value.String())
+	if err := r.ReadInConfig(); err != nil {
+		return t, fmt.Errorf("failed to read config: %w", err)
+	}
+	return t, r.UnmarshalKey("transforms", &t)
+}
+
+// readTransformSamples reads a single sample object or a list of them.
+func readTransformSamples(path string) ([]transformSample, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	var samples []transformSample
+	if err := json.Unmarshal(b, &samples); err == nil {
+		return samples, nil
+	}
+
+	var sample transformSample
+	if err := json.Unmarshal(b, &sample); err != nil {
+		return nil, fmt.Errorf("failed to parse input: %w", err)
+	}
+	return []transformSample{sample}, nil
+}
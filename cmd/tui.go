@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [PATH]",
+	Short: "Browse the source tree, pick secrets and folders, preview diffs, and sync the selection",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  tuiFunc,
+}
+
+const tuiHelp = `Commands:
+  N [N...]   check or uncheck entries; a checked folder selects everything below it
+  o N        open or close folder N
+  d N        preview what a sync would change in secret N
+  a / c      check or clear everything
+  r          sync the selection
+  q          quit
+`
+
+type (
+	// tuiNode is a secret or folder in the browsed source tree.
+	tuiNode struct {
+		path     string
+		folder   bool
+		open     bool
+		checked  bool
+		loaded   bool
+		parent   *tuiNode
+		children []*tuiNode
+	}
+
+	// tui is an interactive session of the tui command.
+	tui struct {
+		ctx    context.Context
+		syncer *vaultsync.Syncer
+		in     *bufio.Scanner
+		out    io.Writer
+		root   *tuiNode
+		// visible is the flattened tree as last printed, numbered from 1.
+		visible []*tuiNode
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
+
+func tuiFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := destinationOptions(cfg)
+	if err != nil {
+		return err
+	}
+	srcOpts, err := sourceOptions(cfg)
+	if err != nil {
+		return err
+	}
+	syncer, err := vaultsync.NewSyncer(cfg, append(opts, srcOpts...)...)
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+	defer syncer.Close()
+
+	root := cfg.SourceVault.Path
+	if len(args) == 1 {
+		root = args[0]
+	}
+	root = strings.TrimPrefix(root, "/")
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+
+	t := &tui{
+		ctx:    cmd.Context(),
+		syncer: syncer,
+		in:     bufio.NewScanner(cmd.InOrStdin()),
+		out:    cmd.OutOrStdout(),
+		root:   &tuiNode{path: root, folder: true, open: true},
+	}
+	if err := t.load(t.root); err != nil {
+		return err
+	}
+	return t.run()
+}
+
+// run prints the tree and handles commands until the user quits or syncs.
+func (t *tui) run() error {
+	fmt.Fprint(t.out, tuiHelp)
+	for {
+		t.render()
+		fmt.Fprint(t.out, "> ")
+		if !t.in.Scan() {
+			return t.in.Err()
+		}
+		fields := strings.Fields(t.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "q", "quit":
+			return nil
+		case "?", "h", "help":
+			fmt.Fprint(t.out, tuiHelp)
+		case "a":
+			t.root.checked = true
+			clearChecks(t.root)
+		case "c":
+			t.root.checked = false
+			clearChecks(t.root)
+		case "o":
+			if n := t.node(fields[1:]); n != nil {
+				if !n.folder {
+					fmt.Fprintf(t.out, "%s is not a folder\n", n.path)
+					continue
+				}
+				n.open = !n.open
+				if err := t.load(n); err != nil {
+					fmt.Fprintln(t.out, err)
+				}
+			}
+		case "d":
+			if n := t.node(fields[1:]); n != nil {
+				t.preview(n)
+			}
+		case "r":
+			done, err := t.sync()
+			if done || err != nil {
+				return err
+			}
+		default:
+			for _, f := range fields {
+				if n := t.node([]string{f}); n != nil {
+					t.toggle(n)
+				}
+			}
+		}
+	}
+}
+
+// node returns the visible node numbered by the first argument.
+func (t *tui) node(args []string) *tuiNode {
+	if len(args) == 0 {
+		fmt.Fprintln(t.out, "Which entry?")
+		return nil
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil || i < 1 || i > len(t.visible) {
+		fmt.Fprintf(t.out, "No entry %q\n", args[0])
+		return nil
+	}
+	return t.visible[i-1]
+}
+
+// load lists a folder's children the first time it is opened.
+func (t *tui) load(n *tuiNode) error {
+	if n.loaded {
+		return nil
+	}
+	secrets, err := t.syncer.List(t.ctx, vaultsync.ListSource, n.path, false)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", n.path, err)
+	}
+	for _, s := range secrets {
+		n.children = append(n.children, &tuiNode{path: s.Path, folder: s.Folder, parent: n})
+	}
+	n.loaded = true
+	return nil
+}
+
+// render prints the open part of the tree and renumbers it.
+func (t *tui) render() {
+	t.visible = t.visible[:0]
+	var walk func(n *tuiNode, depth int)
+	walk = func(n *tuiNode, depth int) {
+		for _, c := range n.children {
+			t.visible = append(t.visible, c)
+			mark := "[ ]"
+			if selected(c) {
+				mark = "[x]"
+			}
+			name := strings.TrimPrefix(c.path, n.path)
+			fmt.Fprintf(t.out, "%4d %s %s%s\n", len(t.visible), mark, strings.Repeat("  ", depth), name)
+			if c.folder && c.open {
+				walk(c, depth+1)
+			}
+		}
+	}
+	fmt.Fprintf(t.out, "\n%s\n", t.root.path)
+	walk(t.root, 0)
+}
+
+// selected reports whether n or any folder above it is checked.
+func selected(n *tuiNode) bool {
+	for ; n != nil; n = n.parent {
+		if n.checked {
+			return true
+		}
+	}
+	return false
+}
+
+// clearChecks unchecks everything below n.
+func clearChecks(n *tuiNode) {
+	for _, c := range n.children {
+		c.checked = false
+		clearChecks(c)
+	}
+}
+
+// toggle checks or unchecks n. Unchecking an entry inside a checked folder
+// checks its siblings instead, so the rest of the folder stays selected.
+func (t *tui) toggle(n *tuiNode) {
+	if !selected(n) {
+		n.checked = true
+		clearChecks(n)
+		return
+	}
+	if n.checked {
+		n.checked = false
+		return
+	}
+
+	// Split the checked ancestor into its children, down to n.
+	var chain []*tuiNode
+	for a := n; !a.checked; a = a.parent {
+		chain = append(chain, a)
+	}
+	top := chain[len(chain)-1].parent
+	top.checked = false
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, sib := range chain[i].parent.children {
+			sib.checked = sib != chain[i]
+		}
+	}
+}
+
+// preview prints the keys a sync would change in a secret.
+func (t *tui) preview(n *tuiNode) {
+	if n.folder {
+		fmt.Fprintf(t.out, "%s is a folder\n", n.path)
+		return
+	}
+	d, err := t.syncer.DiffSecret(t.ctx, n.path)
+	if err != nil {
+		fmt.Fprintf(t.out, "Failed to compare %s: %v\n", n.path, err)
+		return
+	}
+
+	fmt.Fprintf(t.out, "%s -> %s: %s\n", d.Path, d.Destination, d.Status)
+	for _, k := range d.Added {
+		fmt.Fprintf(t.out, "  + %s\n", k)
+	}
+	for _, k := range d.Changed {
+		fmt.Fprintf(t.out, "  ~ %s\n", k)
+	}
+	for _, k := range d.Removed {
+		fmt.Fprintf(t.out, "  - %s\n", k)
+	}
+}
+
+// selection returns the source path of every selected secret, listing
+// checked folders recursively.
+func (t *tui) selection() ([]string, error) {
+	var paths []string
+	var walk func(n *tuiNode) error
+	walk = func(n *tuiNode) error {
+		switch {
+		case n.checked && n.folder:
+			secrets, err := t.syncer.List(t.ctx, vaultsync.ListSource, n.path, true)
+			if err != nil {
+				return fmt.Errorf("failed to list %s: %w", n.path, err)
+			}
+			for _, s := range secrets {
+				paths = append(paths, s.Path)
+			}
+		case n.checked:
+			paths = append(paths, n.path)
+		default:
+			for _, c := range n.children {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return paths, walk(t.root)
+}
+
+// sync confirms and syncs the selection.
+//
+// Returns:
+//
+//	bool - Whether the selection was synced and the session should end.
+//	error - An error if the sync failed.
+func (t *tui) sync() (bool, error) {
+	paths, err := t.selection()
+	if err != nil {
+		fmt.Fprintln(t.out, err)
+		return false, nil
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(t.out, "Nothing is selected")
+		return false, nil
+	}
+
+	fmt.Fprintf(t.out, "Sync %d secrets? [y/N] ", len(paths))
+	if !t.in.Scan() {
+		return false, t.in.Err()
+	}
+	if answer := strings.ToLower(strings.TrimSpace(t.in.Text())); answer != "y" && answer != "yes" {
+		return false, nil
+	}
+
+	report, syncErr := t.syncer.SyncPaths(t.ctx, paths)
+	if report != nil {
+		for _, res := range report.Secrets {
+			fmt.Fprintf(t.out, "%s: %s\n", res.Path, res.Action)
+			if res.Error != "" {
+				fmt.Fprintf(t.out, "  %s\n", res.Error)
+			}
+		}
+		fmt.Fprintf(t.out, "%d created, %d updated, %d unchanged, %d skipped, %d failed\n",
+			report.Created, report.Updated, report.Unchanged, report.Skipped, report.Failed)
+	}
+	if syncErr != nil {
+		return true, fmt.Errorf("failed to sync selection: %w", syncErr)
+	}
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file, resolve token commands and files, and optionally connect to each vault",
+	RunE:  validateFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().Bool("connect", false, "Also check each vault is reachable, unsealed, accepts its token, and has its KV v2 mount")
+}
+
+func validateFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	connect, err := cmd.Flags().GetBool("connect")
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	var cfgErr *vaultsync.ConfigError
+	if err := cfg.Validate(); errors.As(err, &cfgErr) {
+		problems = append(problems, cfgErr.Problems...)
+	} else if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	vaults := cfg.Vaults()
+	names := make([]string, 0, len(vaults))
+	for name := range vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		vlt := vaults[name]
+		switch {
+		case connect && vlt.Address != "":
+			if err := vlt.CheckConnection(cmd.Context()); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		case vlt.TokenCmd != "" || vlt.TokenFile != "" || vlt.TokenKeyring != "":
+			if _, err := vlt.ResolveToken(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintf(out, "  - %s\n", p)
+		}
+		return fmt.Errorf("%s is invalid: %d problems", cmd.Flag("config_file").Value.String(), len(problems))
+	}
+	fmt.Fprintf(out, "%s is valid\n", cmd.Flag("config_file").Value.String())
+	return nil
+}
@@ -0,0 +1,389 @@
+// Package azure integrates hvm with Azure.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiVersion = "7.4"
+	scope      = "https://vault.azure.net/.default"
+	loginURL   = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+
+	// ModeBlob stores each vault secret as one Key Vault secret holding its
+	// data as a JSON object.
+	ModeBlob = "blob"
+	// ModeField stores each field of a vault secret as its own Key Vault secret.
+	ModeField = "field"
+
+	// pathTag and fieldTag record where a Key Vault secret came from, since
+	// sanitized names cannot be mapped back.
+	pathTag  = "hvm-path"
+	fieldTag = "hvm-field"
+
+	maxNameLength = 127
+	// hashSuffixLength is the number of hex characters of the path hash kept
+	// when a name has to be shortened.
+	hashSuffixLength = 8
+)
+
+// invalidNameChars matches everything Key Vault does not allow in a secret name.
+var invalidNameChars = regexp.MustCompile(`[^0-9A-Za-z-]+`)
+
+type (
+	// KeyVault is a vaultsync.Destination that writes secrets to an Azure Key
+	// Vault using a service principal's client credentials. Vault paths are
+	// sanitized into Key Vault's restricted name charset; the original path
+	// and field are kept in tags, which are also used to detect two paths
+	// that sanitize to the same name. Secrets without those tags were not
+	// written by hvm and are never overwritten.
+	KeyVault struct {
+		// VaultURL is the vault's URL, e.g. https://myvault.vault.azure.net.
+		VaultURL string
+		// TenantID, ClientID, and ClientSecret identify the service
+		// principal. They default to AZURE_TENANT_ID, AZURE_CLIENT_ID, and
+		// AZURE_CLIENT_SECRET.
+		TenantID     string
+		ClientID     string
+		ClientSecret string
+		// Mode is either ModeBlob (the default) or ModeField.
+		Mode string
+
+		client *http.Client
+
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+		// fields remembers the fields written for each path in ModeField,
+		// so Read can reassemble them.
+		fields map[string][]string
+	}
+
+	// statusError is a Key Vault or Azure AD error response.
+	statusError struct {
+		status int
+		body   string
+	}
+
+	// secretBundle is the subset of a Key Vault secret used here.
+	secretBundle struct {
+		Value       string            `json:"value"`
+		ContentType string            `json:"contentType,omitempty"`
+		Tags        map[string]string `json:"tags,omitempty"`
+	}
+)
+
+// Name describes the destination.
+func (k *KeyVault) Name() string {
+	return k.VaultURL
+}
+
+// Write stores data at path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The destination path of the secret.
+//	data: map[string]interface{} - The secret data.
+//
+// Returns:
+//
+//	bool - Whether the Key Vault secret (or, in ModeField, any of them) was newly created.
+//	error - An error if a secret could not be written or its name is taken by another path.
+func (k *KeyVault) Write(ctx context.Context, path string, data map[string]interface{}) (bool, error) {
+	if k.mode() == ModeBlob {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return false, err
+		}
+		return k.put(ctx, SecretName(path, ""), secretBundle{
+			Value:       string(b),
+			ContentType: "application/json",
+			Tags:        map[string]string{pathTag: path},
+		})
+	}
+
+	fields := make([]string, 0, len(data))
+	for f := range data {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var created bool
+	for _, f := range fields {
+		bundle := secretBundle{Tags: map[string]string{pathTag: path, fieldTag: f}}
+		if str, ok := data[f].(string); ok {
+			bundle.Value, bundle.ContentType = str, "text/plain"
+		} else {
+			b, err := json.Marshal(data[f])
+			if err != nil {
+				return false, err
+			}
+			bundle.Value, bundle.ContentType = string(b), "application/json"
+		}
+
+		c, err := k.put(ctx, SecretName(path, f), bundle)
+		if err != nil {
+			return false, fmt.Errorf("field %q: %w", f, err)
+		}
+		created = created || c
+	}
+
+	k.mu.Lock()
+	if k.fields == nil {
+		k.fields = make(map[string][]string)
+	}
+	k.fields[path] = fields
+	k.mu.Unlock()
+	return created, nil
+}
+
+// Read returns the data stored at path. In ModeField only paths written by
+// this KeyVault can be read, since the fields of a path are not listed.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The destination path of the secret.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the secret could not be read.
+func (k *KeyVault) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	if k.mode() == ModeBlob {
+		bundle, err := k.get(ctx, SecretName(path, ""))
+		if err != nil {
+			return nil, err
+		}
+		if bundle == nil {
+			return nil, fmt.Errorf("secret %q not found", path)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(bundle.Value), &data); err != nil {
+			return nil, fmt.Errorf("failed to decode secret %q: %w", path, err)
+		}
+		return data, nil
+	}
+
+	k.mu.Lock()
+	fields, ok := k.fields[path]
+	k.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("fields of secret %q are unknown", path)
+	}
+
+	data := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		bundle, err := k.get(ctx, SecretName(path, f))
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", f, err)
+		}
+		if bundle == nil {
+			return nil, fmt.Errorf("field %q of secret %q not found", f, path)
+		}
+		if bundle.ContentType != "application/json" {
+			data[f] = bundle.Value
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(bundle.Value), &v); err != nil {
+			return nil, fmt.Errorf("failed to decode field %q: %w", f, err)
+		}
+		data[f] = v
+	}
+	return data, nil
+}
+
+// SecretName maps a vault path, and optionally a field, onto a Key Vault
+// secret name. Runs of characters Key Vault does not allow become a single
+// dash, and the path and field are joined with a double dash. Names longer
+// than Key Vault's limit are truncated and suffixed with a hash of the
+// original path and field.
+//
+// Arguments:
+//
+//	path: string - The vault path.
+//	field: string - The field, or "" in ModeBlob.
+//
+// Returns:
+//
+//	string - The Key Vault secret name.
+func SecretName(path, field string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(path, "-"), "-")
+	if field != "" {
+		name += "--" + strings.Trim(invalidNameChars.ReplaceAllString(field, "-"), "-")
+	}
+	if len(name) <= maxNameLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(path + "\x00" + field))
+	return name[:maxNameLength-hashSuffixLength-1] + "-" + hex.EncodeToString(sum[:])[:hashSuffixLength]
+}
+
+func (k *KeyVault) mode() string {
+	if k.Mode == "" {
+		return ModeBlob
+	}
+	return k.Mode
+}
+
+// put writes a new version of the named secret, refusing to overwrite a
+// secret that was written for a different path or field.
+func (k *KeyVault) put(ctx context.Context, name string, bundle secretBundle) (bool, error) {
+	existing, err := k.get(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil && (existing.Tags[pathTag] != bundle.Tags[pathTag] || existing.Tags[fieldTag] != bundle.Tags[fieldTag]) {
+		return false, fmt.Errorf("key vault secret %q already holds %q, not %q", name, existing.Tags[pathTag], bundle.Tags[pathTag])
+	}
+
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		return false, err
+	}
+	resp, err := k.do(ctx, http.MethodPut, name, body)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return existing == nil, nil
+}
+
+// get reads the latest version of the named secret, or nil if it does not exist.
+func (k *KeyVault) get(ctx context.Context, name string) (*secretBundle, error) {
+	resp, err := k.do(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) && se.status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bundle := new(secretBundle)
+	if err := json.NewDecoder(resp.Body).Decode(bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode key vault secret: %w", err)
+	}
+	return bundle, nil
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("azure responded %d: %s", e.status, e.body)
+}
+
+// Transient reports whether the request is worth retrying.
+func (e *statusError) Transient() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// do sends an authenticated request for the named secret and returns the
+// response if it succeeded.
+func (k *KeyVault) do(ctx context.Context, method, name string, body []byte) (*http.Response, error) {
+	token, err := k.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u := strings.TrimSuffix(k.VaultURL, "/") + "/secrets/" + url.PathEscape(name) + "?api-version=" + apiVersion
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := k.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &statusError{status: resp.StatusCode, body: string(b)}
+	}
+	return resp, nil
+}
+
+// accessToken returns a cached Azure AD access token for Key Vault,
+// requesting a new one shortly before the cached one expires.
+func (k *KeyVault) accessToken(ctx context.Context) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.token != "" && time.Until(k.expires) > time.Minute {
+		return k.token, nil
+	}
+
+	tenant, clientID, secret := orEnv(k.TenantID, "AZURE_TENANT_ID"), orEnv(k.ClientID, "AZURE_CLIENT_ID"), orEnv(k.ClientSecret, "AZURE_CLIENT_SECRET")
+	if tenant == "" || clientID == "" || secret == "" {
+		return "", fmt.Errorf("azure key vault requires a tenant ID, client ID, and client secret")
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"scope":         {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(loginURL, url.PathEscape(tenant)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := k.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request azure access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("failed to request azure access token: %w", &statusError{status: resp.StatusCode, body: string(b)})
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to decode azure access token: %w", err)
+	}
+
+	k.token = tok.AccessToken
+	k.expires = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return k.token, nil
+}
+
+func (k *KeyVault) httpClient() *http.Client {
+	if k.client == nil {
+		k.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return k.client
+}
+
+// orEnv returns v, or the named environment variable if v is empty.
+func orEnv(v, env string) string {
+	if v != "" {
+		return v
+	}
+	return os.Getenv(env)
+}
@@ -0,0 +1,293 @@
+// Package consul integrates hvm with Consul.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ModeFolder maps the flat keys directly under a Consul folder to the
+	// fields of one secret at the folder's path.
+	ModeFolder = "folder"
+	// ModeKey maps each Consul key to its own secret.
+	ModeKey = "key"
+
+	defaultAddress    = "http://127.0.0.1:8500"
+	defaultValueField = "value"
+)
+
+type (
+	// KV is a vaultsync.Source that reads secrets from Consul KV. Paths are
+	// relative to Prefix. In ModeFolder, a/b/c=v is read as the secret a/b
+	// with field c; in ModeKey it is the secret a/b/c, holding the value's
+	// JSON object if it is one, or the raw value under ValueField.
+	KV struct {
+		// Address is the Consul HTTP address. It defaults to
+		// CONSUL_HTTP_ADDR, then http://127.0.0.1:8500.
+		Address string
+		// Token is the ACL token. It defaults to CONSUL_HTTP_TOKEN.
+		Token string
+		// Datacenter is the datacenter to read from, or the agent's own.
+		Datacenter string
+		// Prefix is the key prefix that maps to the root of the vault mount.
+		Prefix string
+		// ExcludePrefixes are skipped, relative to Prefix.
+		ExcludePrefixes []string
+		// Mode is either ModeFolder (the default) or ModeKey.
+		Mode string
+		// ValueField is the field raw values are stored under in ModeKey.
+		ValueField string
+
+		once   sync.Once
+		client *http.Client
+	}
+
+	// pair is a Consul KV entry.
+	pair struct {
+		Key   string `json:"Key"`
+		Value []byte `json:"Value"`
+	}
+
+	// statusError is a non-success Consul response.
+	statusError struct {
+		status int
+		body   string
+	}
+)
+
+// errNotFound is returned by get when Consul has no keys for a request.
+var errNotFound = errors.New("not found")
+
+// Name describes the source.
+func (k *KV) Name() string {
+	return "consul " + k.address() + "/" + k.key("")
+}
+
+// List returns the keys directly under path, relative to path. In
+// ModeFolder only folders can hold secrets, so they are returned without
+// a trailing slash; in ModeKey folders keep their trailing slash.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The path to list, relative to Prefix.
+//
+// Returns:
+//
+//	[]string - The keys under path.
+//	error - An error if the path could not be listed.
+func (k *KV) List(ctx context.Context, path string) ([]string, error) {
+	dir := k.key(folder(path))
+
+	var keys []string
+	err := k.get(ctx, dir, url.Values{"keys": {""}, "separator": {"/"}}, &keys)
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("no keys under %q", dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, key := range keys {
+		rel := strings.TrimPrefix(key, dir)
+		if rel == "" || k.excluded(strings.TrimPrefix(key, k.key(""))) {
+			continue
+		}
+		isFolder := strings.HasSuffix(rel, "/")
+		switch {
+		case k.mode() == ModeKey:
+			ret = append(ret, rel)
+		case isFolder:
+			ret = append(ret, strings.TrimSuffix(rel, "/"))
+		}
+	}
+	return ret, nil
+}
+
+// Read returns the data of the secret at path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The path of the secret, relative to Prefix.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the keys could not be read or none exist.
+func (k *KV) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	if k.mode() == ModeKey {
+		var pairs []pair
+		if err := k.get(ctx, k.key(path), nil, &pairs); err != nil {
+			return nil, err
+		}
+		if len(pairs) == 0 {
+			return nil, fmt.Errorf("key %q has no value", k.key(path))
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(pairs[0].Value, &obj); err == nil && obj != nil {
+			return obj, nil
+		}
+		return map[string]interface{}{k.valueField(): string(pairs[0].Value)}, nil
+	}
+
+	dir := k.key(folder(path))
+	var pairs []pair
+	if err := k.get(ctx, dir, url.Values{"recurse": {""}}, &pairs); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	for _, p := range pairs {
+		field := strings.TrimPrefix(p.Key, dir)
+		// Deeper keys belong to other secrets, and folder entries hold no data.
+		if field == "" || strings.Contains(field, "/") || k.excluded(strings.TrimPrefix(p.Key, k.key(""))) {
+			continue
+		}
+		data[field] = string(p.Value)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no keys directly under %q", dir)
+	}
+	return data, nil
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("consul responded %d: %s", e.status, e.body)
+}
+
+// Transient reports whether the request is worth retrying.
+func (e *statusError) Transient() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// get reads /v1/kv/key with the given query and decodes the response into
+// out. It returns errNotFound if Consul has no matching keys.
+func (k *KV) get(ctx context.Context, key string, query url.Values, out interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if k.Datacenter != "" {
+		query.Set("dc", k.Datacenter)
+	}
+
+	u := strings.TrimSuffix(k.address(), "/") + "/v1/kv/" + escapeKey(key)
+	if q := query.Encode(); q != "" {
+		u += "?" + q
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if token := orEnv(k.Token, "CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	resp, err := k.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &statusError{status: resp.StatusCode, body: string(b)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode consul response: %w", err)
+	}
+	return nil
+}
+
+// key returns the full Consul key for a path relative to Prefix.
+func (k *KV) key(path string) string {
+	prefix := strings.Trim(k.Prefix, "/")
+	path = strings.TrimPrefix(path, "/")
+	if prefix == "" {
+		return path
+	}
+	return prefix + "/" + path
+}
+
+// excluded reports whether rel, a key relative to Prefix, is under one of
+// ExcludePrefixes.
+func (k *KV) excluded(rel string) bool {
+	for _, p := range k.ExcludePrefixes {
+		if p = strings.TrimPrefix(p, "/"); p != "" && strings.HasPrefix(rel, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *KV) mode() string {
+	if k.Mode == "" {
+		return ModeFolder
+	}
+	return k.Mode
+}
+
+func (k *KV) valueField() string {
+	if k.ValueField == "" {
+		return defaultValueField
+	}
+	return k.ValueField
+}
+
+func (k *KV) address() string {
+	if addr := orEnv(k.Address, "CONSUL_HTTP_ADDR"); addr != "" {
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		return addr
+	}
+	return defaultAddress
+}
+
+func (k *KV) httpClient() *http.Client {
+	k.once.Do(func() {
+		k.client = &http.Client{Timeout: 30 * time.Second}
+	})
+	return k.client
+}
+
+// folder returns path with a trailing slash, or "" for the root.
+func folder(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return path + "/"
+}
+
+// escapeKey escapes each segment of a key for use in a URL path.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// orEnv returns v, or the named environment variable if v is empty.
+func orEnv(v, env string) string {
+	if v != "" {
+		return v
+	}
+	return os.Getenv(env)
+}
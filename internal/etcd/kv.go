@@ -0,0 +1,407 @@
+// Package etcd integrates hvm with etcd.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ModeFolder maps the keys directly under a folder to the fields of one
+	// secret at the folder's path.
+	ModeFolder = "folder"
+	// ModeKey maps each key to its own secret.
+	ModeKey = "key"
+
+	defaultEndpoint   = "http://127.0.0.1:2379"
+	defaultSeparator  = "/"
+	defaultValueField = "value"
+)
+
+type (
+	// KV is a vaultsync.Source that reads secrets from etcd v3 through its
+	// JSON gateway, using prefix range reads. Paths are relative to Prefix,
+	// and each "/" in a path stands for Separator in the etcd key, so keys
+	// such as app.db.password map to the path app/db/password with a
+	// Separator of ".". In ModeFolder, app/db/password is read as the secret
+	// app/db with field password; in ModeKey it is the secret
+	// app/db/password, holding the value's JSON object if it is one, or the
+	// raw value under ValueField.
+	KV struct {
+		// Endpoints are tried in order until one responds. They default to
+		// ETCD_ENDPOINTS (comma separated), then http://127.0.0.1:2379.
+		Endpoints []string
+		// Username and Password enable etcd authentication. They default to
+		// ETCD_USERNAME and ETCD_PASSWORD.
+		Username string
+		Password string
+		// CAFile, CertFile, and KeyFile configure TLS and client certificates.
+		CAFile   string
+		CertFile string
+		KeyFile  string
+		// Prefix is the key prefix that maps to the root of the vault mount.
+		// It is used verbatim, so it usually ends with Separator.
+		Prefix string
+		// Separator separates the segments of a key, "/" by default.
+		Separator string
+		// Mode is either ModeFolder (the default) or ModeKey.
+		Mode string
+		// ValueField is the field raw values are stored under in ModeKey.
+		ValueField string
+
+		once      sync.Once
+		client    *http.Client
+		clientErr error
+
+		mu    sync.Mutex
+		token string
+	}
+
+	// rangeRequest and rangeResponse are the gateway's /v3/kv/range
+	// messages; keys and values are base64 encoded by encoding/json.
+	rangeRequest struct {
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end,omitempty"`
+		KeysOnly bool   `json:"keys_only,omitempty"`
+	}
+	rangeResponse struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+
+	// statusError is a non-success gateway response.
+	statusError struct {
+		status int
+		body   string
+	}
+)
+
+// Name describes the source.
+func (k *KV) Name() string {
+	return "etcd " + k.endpoints()[0] + " " + k.Prefix
+}
+
+// List returns the keys directly under path, relative to path. In
+// ModeFolder only folders can hold secrets, so they are returned without
+// a trailing slash; in ModeKey folders keep their trailing slash.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The path to list, relative to Prefix.
+//
+// Returns:
+//
+//	[]string - The keys under path.
+//	error - An error if the range could not be read.
+func (k *KV) List(ctx context.Context, path string) ([]string, error) {
+	dir := k.folder(path)
+	resp, err := k.rangePrefix(ctx, dir, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("no keys under %q", dir)
+	}
+
+	seen := make(map[string]bool)
+	var ret []string
+	for _, kv := range resp.Kvs {
+		rel := strings.TrimPrefix(string(kv.Key), dir)
+		if rel == "" {
+			continue
+		}
+
+		name := rel
+		if i := strings.Index(rel, k.separator()); i >= 0 {
+			name = rel[:i] + "/"
+		} else if k.mode() == ModeFolder {
+			// Keys directly under dir are fields of dir itself.
+			continue
+		}
+		if k.mode() == ModeFolder {
+			name = strings.TrimSuffix(name, "/")
+		}
+		if !seen[name] {
+			seen[name] = true
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Read returns the data of the secret at path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The path of the secret, relative to Prefix.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the range could not be read or no keys exist.
+func (k *KV) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	if k.mode() == ModeKey {
+		key := k.key(path)
+		resp, err := k.rangeRequest(ctx, rangeRequest{Key: []byte(key)})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil, fmt.Errorf("key %q does not exist", key)
+		}
+
+		value := resp.Kvs[0].Value
+		var obj map[string]interface{}
+		if err := json.Unmarshal(value, &obj); err == nil && obj != nil {
+			return obj, nil
+		}
+		return map[string]interface{}{k.valueField(): string(value)}, nil
+	}
+
+	dir := k.folder(path)
+	resp, err := k.rangePrefix(ctx, dir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	for _, kv := range resp.Kvs {
+		field := strings.TrimPrefix(string(kv.Key), dir)
+		// Deeper keys belong to other secrets.
+		if field == "" || strings.Contains(field, k.separator()) {
+			continue
+		}
+		data[field] = string(kv.Value)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no keys directly under %q", dir)
+	}
+	return data, nil
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("etcd responded %d: %s", e.status, e.body)
+}
+
+// Transient reports whether the request is worth retrying.
+func (e *statusError) Transient() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// rangePrefix reads every key beginning with prefix.
+func (k *KV) rangePrefix(ctx context.Context, prefix string, keysOnly bool) (*rangeResponse, error) {
+	req := rangeRequest{Key: []byte(prefix), RangeEnd: prefixEnd([]byte(prefix)), KeysOnly: keysOnly}
+	if prefix == "" {
+		// The whole keyspace.
+		req.Key, req.RangeEnd = []byte{0}, []byte{0}
+	}
+	return k.rangeRequest(ctx, req)
+}
+
+// rangeRequest sends a range request, authenticating first if a username
+// is configured and again if the cached token has expired.
+func (k *KV) rangeRequest(ctx context.Context, req rangeRequest) (*rangeResponse, error) {
+	resp := new(rangeResponse)
+	err := k.post(ctx, "/v3/kv/range", req, resp, true)
+	var se *statusError
+	if errors.As(err, &se) && se.status == http.StatusUnauthorized && k.username() != "" {
+		k.mu.Lock()
+		k.token = ""
+		k.mu.Unlock()
+		err = k.post(ctx, "/v3/kv/range", req, resp, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// post sends a JSON request to the first endpoint that responds.
+func (k *KV) post(ctx context.Context, path string, in, out interface{}, auth bool) error {
+	client, err := k.httpClient()
+	if err != nil {
+		return err
+	}
+
+	var token string
+	if auth && k.username() != "" {
+		if token, err = k.authToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range k.endpoints() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return &statusError{status: resp.StatusCode, body: string(b)}
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode etcd response: %w", err)
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// authToken returns a cached etcd auth token, authenticating if needed.
+func (k *KV) authToken(ctx context.Context) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.token != "" {
+		return k.token, nil
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	in := map[string]string{"name": k.username(), "password": orEnv(k.Password, "ETCD_PASSWORD")}
+	if err := k.post(ctx, "/v3/auth/authenticate", in, &resp, false); err != nil {
+		return "", fmt.Errorf("failed to authenticate to etcd: %w", err)
+	}
+	k.token = resp.Token
+	return k.token, nil
+}
+
+func (k *KV) httpClient() (*http.Client, error) {
+	k.once.Do(func() {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if k.CAFile != "" {
+			ca, err := os.ReadFile(k.CAFile)
+			if err != nil {
+				k.clientErr = fmt.Errorf("failed to read CA file: %w", err)
+				return
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				k.clientErr = fmt.Errorf("no certificates found in CA file %s", k.CAFile)
+				return
+			}
+		}
+		if k.CertFile != "" || k.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(k.CertFile, k.KeyFile)
+			if err != nil {
+				k.clientErr = fmt.Errorf("failed to load client certificate: %w", err)
+				return
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		k.client = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		}
+	})
+	return k.client, k.clientErr
+}
+
+// key returns the etcd key for a path relative to Prefix.
+func (k *KV) key(path string) string {
+	return k.Prefix + strings.ReplaceAll(strings.Trim(path, "/"), "/", k.separator())
+}
+
+// folder returns the etcd key prefix of the keys under path.
+func (k *KV) folder(path string) string {
+	if strings.Trim(path, "/") == "" {
+		return k.Prefix
+	}
+	return k.key(path) + k.separator()
+}
+
+func (k *KV) endpoints() []string {
+	if len(k.Endpoints) > 0 {
+		return k.Endpoints
+	}
+	if env := os.Getenv("ETCD_ENDPOINTS"); env != "" {
+		return strings.Split(env, ",")
+	}
+	return []string{defaultEndpoint}
+}
+
+func (k *KV) username() string {
+	return orEnv(k.Username, "ETCD_USERNAME")
+}
+
+func (k *KV) separator() string {
+	if k.Separator == "" {
+		return defaultSeparator
+	}
+	return k.Separator
+}
+
+func (k *KV) mode() string {
+	if k.Mode == "" {
+		return ModeFolder
+	}
+	return k.Mode
+}
+
+func (k *KV) valueField() string {
+	if k.ValueField == "" {
+		return defaultValueField
+	}
+	return k.ValueField
+}
+
+// prefixEnd returns the range end that selects every key beginning with
+// prefix: the prefix with its last byte below 0xff incremented.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every byte is 0xff, so read to the end of the keyspace.
+	return []byte{0}
+}
+
+// orEnv returns v, or the named environment variable if v is empty.
+func orEnv(v, env string) string {
+	if v != "" {
+		return v
+	}
+	return os.Getenv(env)
+}
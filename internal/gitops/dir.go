@@ -0,0 +1,162 @@
+// Package gitops reads a directory of SOPS-encrypted YAML files, such as a
+// git checkout, as an hvm source.
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const defaultSopsPath = "sops"
+
+// extensions are the file extensions read as secrets, in order of
+// precedence.
+var extensions = []string{".yaml", ".yml"}
+
+// Dir is a vaultsync.Source that reads secrets from SOPS-encrypted YAML
+// files under a directory. The file a/b.yaml is the secret a/b, holding the
+// file's decrypted top-level keys. Hidden files and directories, such as
+// .git and .sops.yaml, are ignored. It is safe for concurrent use.
+type Dir struct {
+	// Root is the directory to read.
+	Root string
+	// SopsPath is the sops binary, "sops" on the PATH by default.
+	SopsPath string
+	// AgeKeyFile is the age identity file sops decrypts with. If empty,
+	// sops finds its keys itself, e.g. from SOPS_AGE_KEY_FILE.
+	AgeKeyFile string
+}
+
+// Name describes the source.
+func (d *Dir) Name() string {
+	return "gitops " + d.Root
+}
+
+// List returns the secrets and subdirectories directly under path.
+// Subdirectories are returned with a trailing slash.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The directory relative to Root, or "" for Root.
+//
+// Returns:
+//
+//	[]string - The secret names and subdirectories, sorted.
+//	error - An error if the directory could not be read, or two files map to the same secret.
+func (d *Dir) List(ctx context.Context, path string) ([]string, error) {
+	dir, err := d.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string)
+	var keys []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if e.IsDir() {
+			keys = append(keys, name+"/")
+			continue
+		}
+		ext := filepath.Ext(name)
+		if !isSecretFile(ext) {
+			continue
+		}
+		key := strings.TrimSuffix(name, ext)
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s and %s are both the secret %s", other, name, strings.TrimPrefix(path+key, "/"))
+		}
+		seen[key] = name
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Read decrypts the file of the secret at path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The secret path relative to Root, without an extension.
+//
+// Returns:
+//
+//	map[string]interface{} - The decrypted top-level keys of the file.
+//	error - An error if the file does not exist or could not be decrypted.
+func (d *Dir) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	base, err := d.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	var file string
+	for _, ext := range extensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			file = base + ext
+			break
+		}
+	}
+	if file == "" {
+		return nil, fmt.Errorf("no .yaml or .yml file for secret %s", path)
+	}
+
+	sops := d.SopsPath
+	if sops == "" {
+		sops = defaultSopsPath
+	}
+	cmd := exec.CommandContext(ctx, sops, "--decrypt", "--output-type", "json", file)
+	if d.AgeKeyFile != "" {
+		cmd.Env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+d.AgeKeyFile)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to decrypt %s: %s", file, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("failed to run sops: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return nil, fmt.Errorf("%s is not a YAML mapping: %w", file, err)
+	}
+	return data, nil
+}
+
+// resolve returns the file system path of path under Root, refusing any
+// that would escape it.
+func (d *Dir) resolve(path string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(path))
+	if clean != "/"+filepath.FromSlash(strings.TrimSuffix(path, "/")) {
+		return "", fmt.Errorf("invalid secret path %q", path)
+	}
+	return filepath.Join(d.Root, clean), nil
+}
+
+// isSecretFile reports whether a file with extension ext holds a secret.
+func isSecretFile(ext string) bool {
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+// Package keyring stores secrets, such as vault tokens, in the operating
+// system's credential store: the login keychain on macOS, the Secret
+// Service (GNOME Keyring, KWallet) on Linux, and the Credential Manager on
+// Windows.
+package keyring
+
+import "errors"
+
+// Service is the service every hvm entry is stored under.
+const Service = "hvm"
+
+var (
+	// ErrNotFound is returned by Get when there is no entry of that name.
+	ErrNotFound = errors.New("keyring entry not found")
+	// ErrUnsupported is returned on platforms without a supported keyring.
+	ErrUnsupported = errors.New("no OS keyring is supported on this platform")
+)
@@ -0,0 +1,60 @@
+//go:build darwin
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Get reads the secret stored under name from the login keychain.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//
+// Returns:
+//
+//	string - The secret.
+//	error - ErrNotFound if there is no such entry, or an error if the keychain could not be read.
+func Get(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", name, "-w").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read keychain: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Set stores secret under name in the login keychain, replacing any secret
+// already stored there. The secret is passed on stdin, not the command line.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//	secret: string - The secret to store.
+//
+// Returns:
+//
+//	error - An error if the keychain could not be written.
+func Set(name, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(Service), quote(name), quote(secret)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write keychain: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// quote quotes s as one argument of an interactive security command.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
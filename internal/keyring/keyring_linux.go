@@ -0,0 +1,60 @@
+//go:build linux
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Get reads the secret stored under name from the Secret Service, using
+// secret-tool.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//
+// Returns:
+//
+//	string - The secret.
+//	error - ErrNotFound if there is no such entry, or an error if the keyring could not be read.
+func Get(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", Service, "account", name).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+		// secret-tool exits non-zero without a message when nothing matches.
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring: %w", err)
+	}
+	if len(out) == 0 {
+		return "", ErrNotFound
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Set stores secret under name in the Secret Service, replacing any secret
+// already stored there. The secret is passed on stdin, not the command line.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//	secret: string - The secret to store.
+//
+// Returns:
+//
+//	error - An error if the keyring could not be written.
+func Set(name, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", Service+": "+name, "service", Service, "account", name)
+	cmd.Stdin = strings.NewReader(secret)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !windows
+
+package keyring
+
+// Get always fails with ErrUnsupported.
+func Get(name string) (string, error) {
+	return "", ErrUnsupported
+}
+
+// Set always fails with ErrUnsupported.
+func Set(name, secret string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,107 @@
+//go:build windows
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+var (
+	advapi32      = windows.NewLazySystemDLL("advapi32.dll")
+	procCredRead  = advapi32.NewProc("CredReadW")
+	procCredWrite = advapi32.NewProc("CredWriteW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+// credential mirrors the CREDENTIALW structure of the Credential Manager.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// Get reads the secret stored under name from the Credential Manager.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//
+// Returns:
+//
+//	string - The secret.
+//	error - ErrNotFound if there is no such entry, or an error if the credential could not be read.
+func Get(name string) (string, error) {
+	target, err := windows.UTF16PtrFromString(Service + ":" + name)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ret, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read credential: %w", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// Set stores secret under name in the Credential Manager, replacing any
+// secret already stored there.
+//
+// Arguments:
+//
+//	name: string - The name of the entry.
+//	secret: string - The secret to store.
+//
+// Returns:
+//
+//	error - An error if the credential could not be written.
+func Set(name, secret string) error {
+	target, err := windows.UTF16PtrFromString(Service + ":" + name)
+	if err != nil {
+		return err
+	}
+	user, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("refusing to store an empty secret")
+	}
+
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if ret, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return fmt.Errorf("failed to write credential: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+// Package kubernetes integrates hvm with Kubernetes.
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// pathAnnotation records the vault path a Secret was written for.
+	pathAnnotation = "hvm/path"
+	// jsonKeysAnnotation lists the keys whose values are JSON encoded
+	// because they were not strings in vault.
+	jsonKeysAnnotation = "hvm/json-keys"
+
+	maxNameLength = 253
+)
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+	validKey         = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+type (
+	// Secrets is a vaultsync.Destination that writes each vault secret as a
+	// Kubernetes Secret. The Secret's namespace comes from the first
+	// matching namespace rule, and its name is the vault path lowercased
+	// with unsupported characters replaced by dashes. Labels and annotations
+	// are rendered from text/template strings with .Path, .Namespace, and
+	// .Name available.
+	Secrets struct {
+		apiServer   string
+		tokenFile   string
+		client      *http.Client
+		namespace   string
+		rules       []namespaceRule
+		labels      map[string]*template.Template
+		annotations map[string]*template.Template
+		owners      []OwnerReference
+	}
+
+	// Config configures Secrets.
+	Config struct {
+		// APIServer is the API server URL. In a pod it defaults to the
+		// in-cluster address.
+		APIServer string
+		// TokenFile and CAFile default to the pod's service account.
+		TokenFile string
+		CAFile    string
+		// Namespace is used when no namespace rule matches.
+		Namespace string
+		// NamespaceRules map vault paths to namespaces; the first match wins.
+		NamespaceRules []NamespaceRule
+		// Labels and Annotations are templates keyed by label or annotation name.
+		Labels      map[string]string
+		Annotations map[string]string
+		// OwnerReferences are set on every Secret written.
+		OwnerReferences []OwnerReference
+	}
+
+	// NamespaceRule sends paths matching the Match regular expression to
+	// Namespace, which may reference capture groups ($1).
+	NamespaceRule struct {
+		Match     string
+		Namespace string
+	}
+
+	// OwnerReference is a Kubernetes owner reference.
+	OwnerReference struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+		UID        string `json:"uid"`
+		Controller bool   `json:"controller,omitempty"`
+	}
+
+	namespaceRule struct {
+		match     *regexp.Regexp
+		namespace string
+	}
+
+	// secret is the subset of a Kubernetes Secret used here.
+	secret struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Metadata   objectMeta        `json:"metadata"`
+		Type       string            `json:"type,omitempty"`
+		Data       map[string]string `json:"data"`
+	}
+
+	objectMeta struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+		OwnerReferences []OwnerReference  `json:"ownerReferences,omitempty"`
+	}
+
+	// statusError is a non-success API server response.
+	statusError struct {
+		status int
+		body   string
+	}
+
+	// templateData is what label and annotation templates are rendered with.
+	templateData struct {
+		Path      string
+		Namespace string
+		Name      string
+	}
+)
+
+// NewSecrets returns a Secrets destination for cfg.
+//
+// Arguments:
+//
+//	cfg: Config - The configuration.
+//
+// Returns:
+//
+//	*Secrets - The destination.
+//	error - An error if a rule or template is invalid, or the CA could not be loaded.
+func NewSecrets(cfg Config) (*Secrets, error) {
+	s := &Secrets{
+		apiServer:   cfg.APIServer,
+		tokenFile:   cfg.TokenFile,
+		namespace:   cfg.Namespace,
+		labels:      make(map[string]*template.Template),
+		annotations: make(map[string]*template.Template),
+		owners:      cfg.OwnerReferences,
+	}
+	if s.apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("no API server configured and not running in a pod")
+		}
+		s.apiServer = "https://" + strings.TrimSuffix(host+":"+port, ":")
+	}
+	if s.tokenFile == "" {
+		s.tokenFile = serviceAccountDir + "/token"
+	}
+	if s.namespace == "" {
+		s.namespace = "default"
+	}
+
+	caFile := cfg.CAFile
+	if caFile == "" && cfg.APIServer == "" {
+		caFile = serviceAccountDir + "/ca.crt"
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+	}
+	s.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+
+	for _, r := range cfg.NamespaceRules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace rule %q: %w", r.Match, err)
+		}
+		s.rules = append(s.rules, namespaceRule{match: re, namespace: r.Namespace})
+	}
+	for kind, src := range map[string]map[string]string{"label": cfg.Labels, "annotation": cfg.Annotations} {
+		dst := s.labels
+		if kind == "annotation" {
+			dst = s.annotations
+		}
+		for k, v := range src {
+			t, err := template.New(k).Option("missingkey=error").Parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s template %q: %w", kind, k, err)
+			}
+			dst[k] = t
+		}
+	}
+	return s, nil
+}
+
+// Name describes the destination.
+func (s *Secrets) Name() string {
+	return s.apiServer
+}
+
+// Write creates or replaces the Secret for path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The destination path of the secret.
+//	data: map[string]interface{} - The secret data.
+//
+// Returns:
+//
+//	bool - Whether the Secret was newly created.
+//	error - An error if the Secret could not be written or belongs to another path.
+func (s *Secrets) Write(ctx context.Context, path string, data map[string]interface{}) (bool, error) {
+	ns, name := s.locate(path)
+	obj := &secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Type:       "Opaque",
+		Metadata: objectMeta{
+			Name:            name,
+			Namespace:       ns,
+			Labels:          map[string]string{},
+			Annotations:     map[string]string{pathAnnotation: path},
+			OwnerReferences: s.owners,
+		},
+		Data: make(map[string]string, len(data)),
+	}
+
+	var jsonKeys []string
+	for k, v := range data {
+		if !validKey.MatchString(k) {
+			return false, fmt.Errorf("key %q is not a valid Kubernetes Secret key", k)
+		}
+		str, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return false, err
+			}
+			str = string(b)
+			jsonKeys = append(jsonKeys, k)
+		}
+		obj.Data[k] = base64.StdEncoding.EncodeToString([]byte(str))
+	}
+	if len(jsonKeys) > 0 {
+		sort.Strings(jsonKeys)
+		obj.Metadata.Annotations[jsonKeysAnnotation] = strings.Join(jsonKeys, ",")
+	}
+
+	td := templateData{Path: path, Namespace: ns, Name: name}
+	if err := render(s.labels, td, obj.Metadata.Labels); err != nil {
+		return false, err
+	}
+	if err := render(s.annotations, td, obj.Metadata.Annotations); err != nil {
+		return false, err
+	}
+
+	existing, err := s.get(ctx, ns, name)
+	if err != nil {
+		return false, err
+	}
+	if existing == nil {
+		return true, s.do(ctx, http.MethodPost, "/api/v1/namespaces/"+url.PathEscape(ns)+"/secrets", obj, nil)
+	}
+	if owner := existing.Metadata.Annotations[pathAnnotation]; owner != path {
+		return false, fmt.Errorf("secret %s/%s already holds %q, not %q", ns, name, owner, path)
+	}
+	obj.Metadata.ResourceVersion = existing.Metadata.ResourceVersion
+	return false, s.do(ctx, http.MethodPut, secretURL(ns, name), obj, nil)
+}
+
+// Read returns the data of the Secret for path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The destination path of the secret.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the Secret could not be read.
+func (s *Secrets) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	ns, name := s.locate(path)
+	obj, err := s.get(ctx, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("secret %s/%s not found", ns, name)
+	}
+
+	jsonKeys := make(map[string]bool)
+	for _, k := range strings.Split(obj.Metadata.Annotations[jsonKeysAnnotation], ",") {
+		jsonKeys[k] = true
+	}
+
+	data := make(map[string]interface{}, len(obj.Data))
+	for k, v := range obj.Data {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", k, err)
+		}
+		if !jsonKeys[k] {
+			data[k] = string(b)
+			continue
+		}
+		var val interface{}
+		if err := json.Unmarshal(b, &val); err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", k, err)
+		}
+		data[k] = val
+	}
+	return data, nil
+}
+
+// locate returns the namespace and name of the Secret for path.
+func (s *Secrets) locate(path string) (string, string) {
+	ns := s.namespace
+	for _, r := range s.rules {
+		if m := r.match.FindStringSubmatchIndex(path); m != nil {
+			ns = string(r.match.ExpandString(nil, r.namespace, path, m))
+			break
+		}
+	}
+
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(path), "-"), "-.")
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength], "-.")
+	}
+	return ns, name
+}
+
+// render executes each template with td into dst.
+func render(templates map[string]*template.Template, td templateData, dst map[string]string) error {
+	for k, t := range templates {
+		var b bytes.Buffer
+		if err := t.Execute(&b, td); err != nil {
+			return fmt.Errorf("failed to render %q: %w", k, err)
+		}
+		dst[k] = b.String()
+	}
+	return nil
+}
+
+func secretURL(ns, name string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(ns) + "/secrets/" + url.PathEscape(name)
+}
+
+// get reads a Secret, or returns nil if it does not exist.
+func (s *Secrets) get(ctx context.Context, ns, name string) (*secret, error) {
+	obj := new(secret)
+	err := s.do(ctx, http.MethodGet, secretURL(ns, name), nil, obj)
+	var se *statusError
+	if errors.As(err, &se) && se.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// do sends a request to the API server, encoding in as the body and
+// decoding the response into out, if given.
+func (s *Secrets) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := os.ReadFile(s.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.apiServer, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &statusError{status: resp.StatusCode, body: string(b)}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("kubernetes API server responded %d: %s", e.status, e.body)
+}
+
+// Transient reports whether the request is worth retrying. Conflicts are
+// retried since the Secret is re-read before each write.
+func (e *statusError) Transient() bool {
+	return e.status == http.StatusConflict || e.status == http.StatusTooManyRequests || e.status >= 500
+}
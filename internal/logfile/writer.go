@@ -0,0 +1,143 @@
+// Package logfile writes logs to a file that is rotated by size and age.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files, sorting them oldest first.
+const backupTimeFormat = "20060102T150405.000Z"
+
+// Writer is an io.Writer appending to a log file. Once the file would grow
+// past MaxSize bytes, or was opened more than MaxAge ago, it is renamed to
+// the file name with the UTC time appended and a new file is started. Only
+// the MaxBackups newest rotated files are kept. It is safe for concurrent
+// use.
+type Writer struct {
+	// Path is the log file.
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated, or 0 for
+	// no limit.
+	MaxSize int64
+	// MaxAge is how long a file is written to before it is rotated, or 0
+	// for no limit.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept, or 0 to keep them all.
+	MaxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Open opens, or creates, the log file for appending.
+//
+// Returns:
+//
+//	error - An error if the file could not be opened.
+func (w *Writer) Open() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.open()
+}
+
+// Write appends p to the log file, rotating it first if needed. A single
+// write is never split between files.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.size > 0 && (w.MaxSize > 0 && w.size+int64(len(p)) > w.MaxSize || w.MaxAge > 0 && time.Since(w.openedAt) >= w.MaxAge) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens the log file, keeping its current size. The caller must hold
+// w.mu.
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	w.file, w.size, w.openedAt = f, fi.Size(), time.Now()
+	return nil
+}
+
+// rotate renames the current file aside, opens a new one, and removes the
+// oldest backups. The caller must hold w.mu.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	w.file = nil
+	backup := w.Path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(w.Path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// prune removes all but the MaxBackups newest rotated files. Failures are
+// ignored, as they only leave extra files behind.
+func (w *Writer) prune() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.Path + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, w.Path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > w.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,93 @@
+// Package notify sends hvm run notifications by email and to PagerDuty.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSMTPPort = 587
+
+// Email is an SMTP server to mail notifications through.
+type Email struct {
+	Host string
+	// Port is the SMTP port, 587 by default. STARTTLS is used whenever
+	// the server offers it.
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send mails a plain text message.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the connection.
+//	subject: string - The subject of the message.
+//	body: string - The plain text body of the message.
+//
+// Returns:
+//
+//	error - An error if the message could not be sent.
+func (e *Email) Send(ctx context.Context, subject, body string) error {
+	port := e.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(port))
+
+	conn, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(nil); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := c.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		e.From, strings.Join(e.To, ", "), subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	if _, err := w.Write([]byte(msg)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
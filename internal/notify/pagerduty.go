@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// PagerDutyTrigger opens, or adds to, the incident of a dedup key.
+	PagerDutyTrigger = "trigger"
+	// PagerDutyResolve resolves the incident of a dedup key.
+	PagerDutyResolve = "resolve"
+
+	pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+type (
+	// PagerDuty is a service on the PagerDuty Events API v2.
+	PagerDuty struct {
+		RoutingKey string
+		// Severity is critical, error, warning, or info, error by default.
+		Severity string
+	}
+
+	// pagerDutyEvent is the body of an Events API v2 request.
+	pagerDutyEvent struct {
+		RoutingKey  string            `json:"routing_key"`
+		EventAction string            `json:"event_action"`
+		DedupKey    string            `json:"dedup_key"`
+		Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	}
+
+	pagerDutyPayload struct {
+		Summary       string      `json:"summary"`
+		Source        string      `json:"source"`
+		Severity      string      `json:"severity"`
+		Timestamp     string      `json:"timestamp"`
+		Component     string      `json:"component,omitempty"`
+		CustomDetails interface{} `json:"custom_details,omitempty"`
+	}
+)
+
+// Send sends an event. Triggers and resolves with the same dedupKey open
+// and close the same incident.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the request.
+//	action: string - PagerDutyTrigger or PagerDutyResolve.
+//	dedupKey: string - The key of the incident.
+//	summary: string - A one-line summary of the event.
+//	details: interface{} - Details to attach to the event, marshalled as JSON.
+//
+// Returns:
+//
+//	error - An error if the event was not accepted.
+func (p *PagerDuty) Send(ctx context.Context, action, dedupKey, summary string, details interface{}) error {
+	severity := p.Severity
+	if severity == "" {
+		severity = "error"
+	}
+	// Summaries longer than 1024 characters are rejected.
+	if len(summary) > 1024 {
+		summary = summary[:1021] + "..."
+	}
+	event := pagerDutyEvent{RoutingKey: p.RoutingKey, EventAction: action, DedupKey: dedupKey}
+	if action == PagerDutyTrigger {
+		event.Payload = &pagerDutyPayload{
+			Summary:       summary,
+			Source:        "hvm",
+			Severity:      severity,
+			Timestamp:     time.Now().UTC().Format(time.RFC3339),
+			Component:     "vault",
+			CustomDetails: details,
+		}
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pagerDutyURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
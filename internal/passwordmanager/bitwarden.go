@@ -0,0 +1,154 @@
+package passwordmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultBitwardenURL = "http://localhost:8087"
+
+	// noFolder names the items that are not in any folder.
+	noFolder = "No Folder"
+)
+
+type (
+	// bitwarden reads items through the Vault Management API served by
+	// `bw serve`, which decrypts items locally. The CLI works with both
+	// Bitwarden and Vaultwarden servers and must be logged in and unlocked.
+	bitwarden struct {
+		url    string
+		client *http.Client
+	}
+
+	// bitwardenResponse wraps every `bw serve` response.
+	bitwardenResponse[T any] struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    T      `json:"data"`
+	}
+
+	bitwardenList[T any] struct {
+		Data []T `json:"data"`
+	}
+
+	bitwardenObject struct {
+		ID   *string `json:"id"`
+		Name string  `json:"name"`
+	}
+
+	bitwardenItem struct {
+		Notes string `json:"notes"`
+		Login *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	}
+)
+
+// NewBitwarden returns a Source reading from the Bitwarden CLI's `bw serve`
+// API, for Bitwarden and Vaultwarden vaults. Items outside any folder are
+// under "No Folder". Login fields are named username, password, totp, and
+// url (the first URI), the item's notes are named notes, and custom fields
+// are named by their name.
+//
+// Arguments:
+//
+//	serveURL: string - The `bw serve` URL, http://localhost:8087 by default.
+//	fieldMap: FieldMap - How fields are renamed to secret keys.
+//
+// Returns:
+//
+//	*Source - The source.
+func NewBitwarden(serveURL string, fieldMap FieldMap) *Source {
+	if serveURL == "" {
+		serveURL = defaultBitwardenURL
+	}
+	return &Source{
+		name:     "bitwarden " + serveURL,
+		backend:  &bitwarden{url: strings.TrimSuffix(serveURL, "/"), client: newHTTPClient()},
+		fieldMap: fieldMap,
+	}
+}
+
+func (b *bitwarden) groups(ctx context.Context) ([]ref, error) {
+	var resp bitwardenResponse[bitwardenList[bitwardenObject]]
+	if err := b.get(ctx, "/list/object/folders", &resp); err != nil {
+		return nil, err
+	}
+
+	refs := []ref{{id: "null", name: noFolder}}
+	for _, f := range resp.Data.Data {
+		// The CLI lists a "No Folder" folder without an ID itself.
+		if f.ID != nil {
+			refs = append(refs, ref{id: *f.ID, name: f.Name})
+		}
+	}
+	return refs, nil
+}
+
+func (b *bitwarden) items(ctx context.Context, folderID string) ([]ref, error) {
+	var resp bitwardenResponse[bitwardenList[bitwardenObject]]
+	if err := b.get(ctx, "/list/object/items?folderid="+url.QueryEscape(folderID), &resp); err != nil {
+		return nil, err
+	}
+
+	refs := make([]ref, 0, len(resp.Data.Data))
+	for _, item := range resp.Data.Data {
+		if item.ID != nil {
+			refs = append(refs, ref{id: *item.ID, name: item.Name})
+		}
+	}
+	return refs, nil
+}
+
+func (b *bitwarden) fields(ctx context.Context, folderID, itemID string) ([]field, error) {
+	var resp bitwardenResponse[bitwardenItem]
+	if err := b.get(ctx, "/object/item/"+url.PathEscape(itemID), &resp); err != nil {
+		return nil, err
+	}
+
+	item := resp.Data
+	var fields []field
+	if l := item.Login; l != nil {
+		fields = append(fields,
+			field{name: "username", value: l.Username},
+			field{name: "password", value: l.Password},
+			field{name: "totp", value: l.TOTP},
+		)
+		if len(l.URIs) > 0 {
+			fields = append(fields, field{name: "url", value: l.URIs[0].URI})
+		}
+	}
+	fields = append(fields, field{name: "notes", value: item.Notes})
+	for _, f := range item.Fields {
+		fields = append(fields, field{name: f.Name, value: f.Value})
+	}
+	return fields, nil
+}
+
+// get reads a `bw serve` endpoint, which reports failures in the body.
+func (b *bitwarden) get(ctx context.Context, path string, out interface{ ok() error }) error {
+	if err := getJSON(ctx, b.client, "bitwarden", b.url+path, nil, out); err != nil {
+		return err
+	}
+	return out.ok()
+}
+
+func (r *bitwardenResponse[T]) ok() error {
+	if !r.Success {
+		return fmt.Errorf("bitwarden request failed: %s", r.Message)
+	}
+	return nil
+}
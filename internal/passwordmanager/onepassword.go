@@ -0,0 +1,115 @@
+package passwordmanager
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type (
+	// onePassword reads items through a 1Password Connect server.
+	onePassword struct {
+		host   string
+		token  string
+		client *http.Client
+	}
+
+	onePasswordItem struct {
+		Fields []struct {
+			Purpose string `json:"purpose"`
+			Label   string `json:"label"`
+			Value   string `json:"value"`
+		} `json:"fields"`
+		URLs []struct {
+			Primary bool   `json:"primary"`
+			Href    string `json:"href"`
+		} `json:"urls"`
+	}
+)
+
+// NewOnePassword returns a Source reading from a 1Password Connect server.
+// Fields with a purpose are named username, password, and notes, the primary
+// URL is named url, and other fields are named by their label.
+//
+// Arguments:
+//
+//	host: string - The Connect server URL. It defaults to OP_CONNECT_HOST.
+//	token: string - The Connect access token. It defaults to OP_CONNECT_TOKEN.
+//	fieldMap: FieldMap - How fields are renamed to secret keys.
+//
+// Returns:
+//
+//	*Source - The source.
+func NewOnePassword(host, token string, fieldMap FieldMap) *Source {
+	if host == "" {
+		host = os.Getenv("OP_CONNECT_HOST")
+	}
+	if token == "" {
+		token = os.Getenv("OP_CONNECT_TOKEN")
+	}
+	return &Source{
+		name:     "1password " + host,
+		backend:  &onePassword{host: strings.TrimSuffix(host, "/"), token: token, client: newHTTPClient()},
+		fieldMap: fieldMap,
+	}
+}
+
+func (o *onePassword) groups(ctx context.Context) ([]ref, error) {
+	return o.list(ctx, "/v1/vaults")
+}
+
+func (o *onePassword) items(ctx context.Context, vaultID string) ([]ref, error) {
+	return o.list(ctx, "/v1/vaults/"+url.PathEscape(vaultID)+"/items")
+}
+
+func (o *onePassword) fields(ctx context.Context, vaultID, itemID string) ([]field, error) {
+	var item onePasswordItem
+	if err := o.get(ctx, "/v1/vaults/"+url.PathEscape(vaultID)+"/items/"+url.PathEscape(itemID), &item); err != nil {
+		return nil, err
+	}
+
+	fields := make([]field, 0, len(item.Fields)+1)
+	for _, f := range item.Fields {
+		name := f.Label
+		if f.Purpose != "" {
+			name = strings.ToLower(f.Purpose)
+		}
+		fields = append(fields, field{name: name, value: f.Value})
+	}
+	for _, u := range item.URLs {
+		if u.Primary {
+			fields = append(fields, field{name: "url", value: u.Href})
+		}
+	}
+	return fields, nil
+}
+
+// list reads a list of vaults or items, which both have an id and a title
+// or name.
+func (o *onePassword) list(ctx context.Context, path string) ([]ref, error) {
+	var objs []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	}
+	if err := o.get(ctx, path, &objs); err != nil {
+		return nil, err
+	}
+
+	refs := make([]ref, 0, len(objs))
+	for _, obj := range objs {
+		name := obj.Title
+		if name == "" {
+			name = obj.Name
+		}
+		refs = append(refs, ref{id: obj.ID, name: name})
+	}
+	return refs, nil
+}
+
+func (o *onePassword) get(ctx context.Context, path string, out interface{}) error {
+	header := http.Header{"Authorization": {"Bearer " + o.token}}
+	return getJSON(ctx, o.client, "1password connect", o.host+path, header, out)
+}
@@ -0,0 +1,280 @@
+// Package passwordmanager reads password-manager items as hvm sources.
+//
+// Items are organised in two levels: the first level of a path is a vault
+// (1Password) or folder (Bitwarden), and the second is the item's title, so
+// the source path Engineering/ syncs every item in the Engineering vault.
+// Each item becomes one secret whose keys come from its fields, mapped by a
+// FieldMap.
+package passwordmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// FieldMap renames item fields to secret keys. Keys are the canonical
+	// field names (username, password, notes, totp, url) or custom field
+	// labels, matched case-insensitively. Mapping a field to "" or "-" drops
+	// it. Unmapped fields keep their name.
+	FieldMap map[string]string
+
+	// Source is a vaultsync.Source that reads items from a password
+	// manager. It is safe for concurrent use.
+	Source struct {
+		name     string
+		backend  backend
+		fieldMap FieldMap
+
+		mu     sync.Mutex
+		groups map[string]string
+		items  map[string]map[string]string
+	}
+
+	// backend is a password manager API.
+	backend interface {
+		// groups returns the vaults or folders.
+		groups(ctx context.Context) ([]ref, error)
+		// items returns the items in a group.
+		items(ctx context.Context, groupID string) ([]ref, error)
+		// fields returns an item's fields under their canonical names.
+		fields(ctx context.Context, groupID, itemID string) ([]field, error)
+	}
+
+	ref struct {
+		id   string
+		name string
+	}
+
+	field struct {
+		name  string
+		value string
+	}
+
+	// statusError is a non-success API response.
+	statusError struct {
+		api    string
+		status int
+		body   string
+	}
+)
+
+// Name describes the source.
+func (s *Source) Name() string {
+	return s.name
+}
+
+// List returns the vaults or folders, with a trailing slash, when path is
+// empty, or the items of the vault or folder named by path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - "" or the name of a vault or folder.
+//
+// Returns:
+//
+//	[]string - The names under path.
+//	error - An error if the password manager could not be read.
+func (s *Source) List(ctx context.Context, path string) ([]string, error) {
+	group := strings.Trim(path, "/")
+	if group == "" {
+		groups, err := s.loadGroups(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name+"/")
+		}
+		return names, nil
+	}
+	if strings.Contains(group, "/") {
+		return nil, fmt.Errorf("%s has no folders below %q", s.name, group)
+	}
+
+	items, err := s.loadItems(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Read returns the mapped fields of the item at path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The vault or folder name and the item title, joined by a slash.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the item does not exist or could not be read.
+func (s *Source) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	group, item, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || strings.Contains(item, "/") {
+		return nil, fmt.Errorf("%q is not a vault or folder and item title", path)
+	}
+
+	groups, err := s.loadGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.loadItems(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := items[item]
+	if !ok {
+		return nil, fmt.Errorf("no item %q in %q", item, group)
+	}
+
+	fields, err := s.backend.fields(ctx, groups[group], id)
+	if err != nil {
+		return nil, err
+	}
+	return s.fieldMap.apply(fields), nil
+}
+
+// loadGroups returns the vaults or folders by name, reading them once.
+func (s *Source) loadGroups(ctx context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.groups != nil {
+		return s.groups, nil
+	}
+	refs, err := s.backend.groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.groups = byName(refs)
+	s.items = make(map[string]map[string]string)
+	return s.groups, nil
+}
+
+// loadItems returns the items of a group by title, reading them once.
+func (s *Source) loadItems(ctx context.Context, group string) (map[string]string, error) {
+	groups, err := s.loadGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := groups[group]
+	if !ok {
+		return nil, fmt.Errorf("%s has no vault or folder %q", s.name, group)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if items, ok := s.items[group]; ok {
+		return items, nil
+	}
+	refs, err := s.backend.items(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.items[group] = byName(refs)
+	return s.items[group], nil
+}
+
+// byName indexes refs by name, with slashes replaced so every name is a
+// single path segment. Names used more than once get their ID appended so
+// each stays addressable.
+func byName(refs []ref) map[string]string {
+	count := make(map[string]int)
+	for i := range refs {
+		refs[i].name = strings.ReplaceAll(strings.TrimSpace(refs[i].name), "/", "-")
+		count[refs[i].name]++
+	}
+
+	m := make(map[string]string, len(refs))
+	for _, r := range refs {
+		name := r.name
+		if count[name] > 1 || name == "" {
+			name = strings.TrimPrefix(name+"-"+r.id, "-")
+		}
+		m[name] = r.id
+	}
+	return m
+}
+
+// apply renames fields by the map and drops empty ones. When two fields map
+// to the same key, the first one wins.
+func (m FieldMap) apply(fields []field) map[string]interface{} {
+	lower := make(map[string]string, len(m))
+	for k, v := range m {
+		lower[strings.ToLower(k)] = v
+	}
+
+	data := make(map[string]interface{})
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		key := f.name
+		if mapped, ok := lower[strings.ToLower(f.name)]; ok {
+			key = mapped
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+		if _, taken := data[key]; !taken {
+			data[key] = f.value
+		}
+	}
+	return data
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s responded %d: %s", e.api, e.status, e.body)
+}
+
+// Transient reports whether the request is worth retrying.
+func (e *statusError) Transient() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// newHTTPClient returns the client used for password manager APIs.
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// getJSON sends a GET request with the given headers and decodes the
+// response into out.
+func getJSON(ctx context.Context, client *http.Client, api, url string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &statusError{api: api, status: resp.StatusCode, body: string(b)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", api, err)
+	}
+	return nil
+}
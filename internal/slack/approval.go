@@ -0,0 +1,318 @@
+// Package slack integrates hvm with Slack.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/j4ng5y/hvm/pkg/vaultsync"
+	"github.com/rs/zerolog"
+)
+
+const (
+	postMessageURL = "https://slack.com/api/chat.postMessage"
+
+	actionApprove = "hvm_approve"
+	actionReject  = "hvm_reject"
+
+	// maxSignatureAge is how old a signed Slack request may be before it is
+	// rejected as a possible replay.
+	maxSignatureAge = 5 * time.Minute
+)
+
+type (
+	// Approver asks for approval of a sync plan in a Slack channel using an
+	// interactive message with approve and reject buttons. Slack delivers
+	// button clicks to an HTTP endpoint served by the Approver, which must be
+	// configured as the Slack app's interactivity request URL.
+	Approver struct {
+		// BotToken is the Slack bot token used to post the message.
+		BotToken string
+		// Channel is the channel ID or name to post the plan to.
+		Channel string
+		// SigningSecret verifies that interactivity requests come from Slack.
+		SigningSecret string
+		// ListenAddr is the address to serve the interactivity endpoint on.
+		ListenAddr string
+		// Approvers, if set, limits who may approve or reject to these Slack user IDs.
+		Approvers []string
+		// Timeout bounds how long to wait for a decision. Zero waits until ctx is done.
+		Timeout time.Duration
+
+		client *http.Client
+	}
+
+	// interaction is the subset of a Slack block_actions payload used here.
+	interaction struct {
+		Type string `json:"type"`
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		Actions []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+		ResponseURL string `json:"response_url"`
+	}
+)
+
+// Approve posts the plan to Slack and blocks until someone approves or
+// rejects it, or ctx is done. It logs to the logger of ctx, which the
+// Syncer sets to its own.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation; its deadline bounds the wait.
+//	plan: vaultsync.Plan - The plan to approve.
+//
+// Returns:
+//
+//	*vaultsync.Approval - Who approved the plan, and when.
+//	error - vaultsync.ErrRejected if the plan was rejected, or another error.
+func (a *Approver) Approve(ctx context.Context, plan vaultsync.Plan) (*vaultsync.Approval, error) {
+	if a.BotToken == "" || a.Channel == "" || a.SigningSecret == "" || a.ListenAddr == "" {
+		return nil, fmt.Errorf("slack approval requires a bot token, channel, signing secret, and listen address")
+	}
+	if a.client == nil {
+		a.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+
+	l := zerolog.Ctx(ctx)
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	decisions := make(chan *interaction, 1)
+
+	srv := &http.Server{
+		Addr:              a.ListenAddr,
+		Handler:           a.handler(l, id, decisions),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := a.postPlan(ctx, id, plan); err != nil {
+		return nil, fmt.Errorf("failed to post plan to slack: %w", err)
+	}
+	l.Info().Str("channel", a.Channel).Msg("Waiting for approval in Slack")
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out waiting for approval: %w", ctx.Err())
+	case err := <-errCh:
+		return nil, fmt.Errorf("failed to serve slack interactivity endpoint: %w", err)
+	case in := <-decisions:
+		approval := &vaultsync.Approval{
+			By:     in.User.Username,
+			UserID: in.User.ID,
+			At:     time.Now().UTC(),
+		}
+		approved := in.Actions[0].ActionID == actionApprove
+		a.respond(l, in.ResponseURL, approval, approved)
+		if !approved {
+			return approval, vaultsync.ErrRejected
+		}
+		return approval, nil
+	}
+}
+
+// handler serves Slack interactivity requests for the plan with the given ID
+// and sends the first valid decision on decisions, logging to l.
+func (a *Approver) handler(l *zerolog.Logger, id string, decisions chan<- *interaction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		if err := a.verify(r.Header, body); err != nil {
+			l.Warn().Err(err).Msg("Rejected unsigned Slack request")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		in := new(interaction)
+		if err := json.Unmarshal([]byte(form.Get("payload")), in); err != nil || len(in.Actions) == 0 {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if in.Actions[0].Value != id {
+			// A click on a message from an earlier run.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if !a.allowed(in.User.ID) {
+			l.Warn().Str("user", in.User.Username).Msg("Ignoring decision from a user who is not an approver")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		select {
+		case decisions <- in:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// verify checks the Slack request signature as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func (a *Approver) verify(h http.Header, body []byte) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sig := h.Get("X-Slack-Signature")
+	if ts == "" || sig == "" {
+		return fmt.Errorf("missing signature headers")
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("stale request timestamp")
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.SigningSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func (a *Approver) allowed(userID string) bool {
+	if len(a.Approvers) == 0 {
+		return true
+	}
+	for _, id := range a.Approvers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// postPlan posts the plan summary with approve and reject buttons.
+func (a *Approver) postPlan(ctx context.Context, id string, plan vaultsync.Plan) error {
+	summary := fmt.Sprintf("*hvm sync awaiting approval*\n%d secrets will be synced from `%s/%s` (%s) to %s",
+		len(plan.Secrets), plan.Mount, plan.Path, plan.SourceAddress, plan.DestinationAddress)
+
+	msg := map[string]interface{}{
+		"channel": a.Channel,
+		"text":    "hvm sync awaiting approval",
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": summary},
+			},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					button("Approve", actionApprove, id, "primary"),
+					button("Reject", actionReject, id, "danger"),
+				},
+			},
+		},
+	}
+
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := a.call(ctx, postMessageURL, msg, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("slack returned error: %s", resp.Error)
+	}
+	return nil
+}
+
+// respond replaces the interactive message with the decision so the buttons
+// cannot be clicked again, logging to l if that fails.
+func (a *Approver) respond(l *zerolog.Logger, responseURL string, approval *vaultsync.Approval, approved bool) {
+	verb := "rejected"
+	if approved {
+		verb = "approved"
+	}
+	msg := map[string]interface{}{
+		"replace_original": true,
+		"text":             fmt.Sprintf("hvm sync %s by <@%s> at %s", verb, approval.UserID, approval.At.Format(time.RFC3339)),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.call(ctx, responseURL, msg, nil); err != nil {
+		l.Warn().Err(err).Msg("Failed to update Slack approval message")
+	}
+}
+
+func (a *Approver) call(ctx context.Context, endpoint string, body, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+a.BotToken)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func button(text, actionID, value, style string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "button",
+		"text":      map[string]interface{}{"type": "plain_text", "text": text},
+		"action_id": actionID,
+		"value":     value,
+		"style":     style,
+	}
+}
@@ -0,0 +1,45 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PostWebhook posts a plain text message to a Slack incoming webhook.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the request.
+//	url: string - The incoming webhook URL.
+//	text: string - The message, in Slack mrkdwn.
+//
+// Returns:
+//
+//	error - An error if the message could not be posted.
+func PostWebhook(ctx context.Context, url, text string) error {
+	b, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -4,13 +4,13 @@ import (
 	"os"
 
 	"github.com/j4ng5y/hvm/cmd"
-	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
-var log = zerolog.New(os.Stderr).With().Timestamp().Caller().Logger()
-
 func main() {
 	if err := cmd.CLI(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to run CLI")
+		// The CLI points the global logger at stderr, in the chosen format.
+		log.Error().Err(err).Msg("Failed to run CLI")
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,88 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRejected is returned by an Approver when the plan was rejected.
+var ErrRejected = errors.New("sync plan was rejected")
+
+type (
+	// Approver gates a sync on approval of its plan. Approve is called once,
+	// after discovery and before any secret is written, with the Syncer's
+	// logger in ctx for zerolog.Ctx.
+	Approver interface {
+		Approve(ctx context.Context, plan Plan) (*Approval, error)
+	}
+
+	// Plan summarizes what a sync is about to do.
+	Plan struct {
+		SourceAddress      string   `json:"sourceAddress"`
+		DestinationAddress string   `json:"destinationAddress"`
+		Mount              string   `json:"mount"`
+		Path               string   `json:"path"`
+		Secrets            []string `json:"secrets"`
+	}
+
+	// Approval records who approved a plan, and when.
+	Approval struct {
+		By     string    `json:"by"`
+		UserID string    `json:"userId,omitempty"`
+		At     time.Time `json:"at"`
+	}
+)
+
+// WithApprover requires the given Approver to approve each sync's plan before
+// anything is written to the destination.
+//
+// Arguments:
+//
+//	a: Approver - The approver to ask.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithApprover(a Approver) Option {
+	return func(s *Syncer) {
+		s.approver = a
+	}
+}
+
+// awaitApproval asks the configured Approver, if any, to approve the plan for
+// the discovered secrets and records the decision in the report.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	secrets: []string - The discovered secret keys.
+//
+// Returns:
+//
+//	error - An error if the plan was rejected or approval could not be obtained.
+func (s *Syncer) awaitApproval(ctx context.Context, secrets []string) error {
+	if s.approver == nil {
+		return nil
+	}
+
+	plan := Plan{
+		SourceAddress:      s.sourceName(),
+		DestinationAddress: s.destinationName(),
+		Mount:              s.cfg.SourceVault.Mount,
+		Path:               s.cfg.SourceVault.Path,
+		Secrets:            secrets,
+	}
+
+	approval, err := s.approver.Approve(s.log.WithContext(ctx), plan)
+	s.report.Approval = approval
+	if err != nil {
+		if approval != nil {
+			s.log.Warn().Str("by", approval.By).Msg("Sync plan rejected")
+		}
+		return err
+	}
+
+	s.log.Info().Str("by", approval.By).Time("at", approval.At).Msg("Sync plan approved")
+	return nil
+}
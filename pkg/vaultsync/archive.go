@@ -0,0 +1,359 @@
+package vaultsync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// archiveMagic starts every archive file and identifies its format version.
+const archiveMagic = "HVMARCHIVE1\n"
+
+type (
+	// ArchiveManifest describes the contents of an export archive.
+	ArchiveManifest struct {
+		Version   int               `json:"version"`
+		CreatedAt time.Time         `json:"createdAt"`
+		Source    string            `json:"source"`
+		Mount     string            `json:"mount"`
+		Path      string            `json:"path"`
+		Secrets   int               `json:"secrets"`
+		Checksums map[string]string `json:"checksums"`
+	}
+
+	// ArchiveSecret is a single secret stored in an export archive.
+	ArchiveSecret struct {
+		Path string                 `json:"path"`
+		Data map[string]interface{} `json:"data"`
+	}
+
+	// archive is the plaintext payload of an archive file.
+	archive struct {
+		Manifest ArchiveManifest `json:"manifest"`
+		Secrets  []ArchiveSecret `json:"secrets"`
+	}
+)
+
+// LoadArchiveKey reads a 256-bit archive key from a file holding it in
+// base64 or hex encoding.
+//
+// Arguments:
+//
+//	path: string - The key file.
+//
+// Returns:
+//
+//	[]byte - The 32-byte key.
+//	error - An error if the file could not be read or does not hold a 256-bit key.
+func LoadArchiveKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive key: %w", err)
+	}
+	b = bytes.TrimSpace(b)
+
+	if key, err := hex.DecodeString(string(b)); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(string(b)); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("archive key must be 32 bytes encoded as base64 or hex")
+}
+
+// Export reads every secret directly under the configured source path and
+// writes them, with a manifest of their checksums, to w as a single gzip
+// compressed archive sealed with AES-256-GCM. Secrets are read on a worker
+// pool of BatchSize workers under the source rate limit. Nothing is written
+// if any secret cannot be read.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	w: io.Writer - Where to write the archive.
+//	key: []byte - The 32-byte archive key.
+//
+// Returns:
+//
+//	*ArchiveManifest - The manifest of the written archive.
+//	error - An error if the source could not be read or the archive could not be written.
+func (s *Syncer) Export(ctx context.Context, w io.Writer, key []byte) (*ArchiveManifest, error) {
+	ctx, span := s.tracer.Start(ctx, "export")
+	defer span.End()
+
+	mount, root := s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path
+	secrets, err := s.readSourceSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archive{
+		Manifest: ArchiveManifest{
+			Version:   1,
+			CreatedAt: time.Now().UTC(),
+			Source:    s.sourceName(),
+			Mount:     mount,
+			Path:      root,
+			Secrets:   len(secrets),
+			Checksums: make(map[string]string, len(secrets)),
+		},
+		Secrets: secrets,
+	}
+	for _, secret := range secrets {
+		sum, err := s.checksum(secret.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %q: %w", secret.Path, err)
+		}
+		a.Manifest.Checksums[secret.Path] = hex.EncodeToString(sum[:])
+	}
+
+	if err := writeArchive(w, key, a); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Int("secrets", len(secrets)).Msg("Export complete")
+	return &a.Manifest, nil
+}
+
+// readSourceSecrets reads every secret directly under the configured source
+// path on a worker pool of BatchSize workers under the source rate limit.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	[]ArchiveSecret - The secrets, sorted by path.
+//	error - An error if the source could not be listed or any secret could not be read.
+func (s *Syncer) readSourceSecrets(ctx context.Context) ([]ArchiveSecret, error) {
+	mount, root := s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path
+	srcList, err := s.listSourcePath(ctx, mount, root)
+	if err != nil {
+		return nil, err
+	}
+	keys := secretKeys(srcList)
+
+	s.log.Info().Str("mount", mount).Str("path", root).Int("secrets", len(keys)).Msg("Starting export")
+
+	var (
+		mu      sync.Mutex
+		secrets []ArchiveSecret
+		errs    []*SecretError
+	)
+	runPool(ctx, s.cfg.BatchSize, keys, func(ctx context.Context, key string) {
+		data, err := s.readSource(ctx, mount, root+key, 0)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, &SecretError{Path: root + key, Err: err})
+			return
+		}
+		secrets = append(secrets, ArchiveSecret{Path: root + key, Data: data})
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("export aborted: %w", err)
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+		return nil, &SyncError{Total: len(keys), Errors: errs}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Path < secrets[j].Path })
+	return secrets, nil
+}
+
+// DestinationOnly skips connecting to the source vault, for operations such
+// as Import that never read from it. Methods that read from the source must
+// not be called on such a Syncer.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func DestinationOnly() Option {
+	return func(s *Syncer) {
+		s.destinationOnly = true
+	}
+}
+
+// Import writes every secret in an archive created by Export to the
+// destination vault, applying the same transforms and schema validation as
+// a sync, and then verifies them like the verification stage of a sync.
+// Secrets are written to the mount they were exported from.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	r: io.Reader - The archive.
+//	key: []byte - The 32-byte archive key.
+//
+// Returns:
+//
+//	*Report - A structured report of what happened, or nil if the archive could not be opened.
+//	error - An error if the archive could not be opened or any secret failed.
+func (s *Syncer) Import(ctx context.Context, r io.Reader, key []byte) (*Report, error) {
+	ctx, span := s.tracer.Start(ctx, "import")
+	defer span.End()
+
+	a, err := readArchive(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := a.Manifest.Mount
+	s.report = newReport(mount, a.Manifest.Path)
+	s.resetSynced()
+	s.log.Info().Str("mount", mount).Str("path", a.Manifest.Path).Int("secrets", len(a.Secrets)).Time("exportedAt", a.Manifest.CreatedAt).Msg("Starting import")
+
+	secrets := make(map[string]map[string]interface{}, len(a.Secrets))
+	paths := make([]string, 0, len(a.Secrets))
+	for _, secret := range a.Secrets {
+		secrets[secret.Path] = secret.Data
+		paths = append(paths, secret.Path)
+	}
+
+	runPool(ctx, s.cfg.BatchSize, paths, func(ctx context.Context, path string) {
+		start := time.Now()
+		action, err := s.importSecret(ctx, mount, path, secrets[path])
+		action, err = s.outcomeHooks(ctx, mount, path, action, err)
+		s.report.record(path, action, err, time.Since(start))
+	})
+	if err := ctx.Err(); err != nil {
+		s.report.finish()
+		return s.report, fmt.Errorf("import aborted: %w", err)
+	}
+
+	if err := s.verify(ctx, mount); err != nil {
+		s.report.finish()
+		return s.report, fmt.Errorf("verification aborted: %w", err)
+	}
+	s.report.Verified = true
+
+	s.report.finish()
+	if err := s.report.err(); err != nil {
+		return s.report, err
+	}
+
+	s.log.Info().Int("created", s.report.Created).Int("updated", s.report.Updated).Msg("Import complete")
+	return s.report, nil
+}
+
+// importSecret writes a single archived secret to the destination vault.
+func (s *Syncer) importSecret(ctx context.Context, mount, path string, data map[string]interface{}) (Action, error) {
+	destPath, destData, destVersion, err := s.writeDestination(ctx, mount, path, data, 0)
+	if err != nil {
+		return ActionFailed, err
+	}
+	if err := s.recordSynced(path, destPath, destData); err != nil {
+		return ActionFailed, err
+	}
+
+	if destVersion == 1 {
+		return ActionCreated, nil
+	}
+	return ActionUpdated, nil
+}
+
+// writeArchive gzips the JSON encoding of a, seals it with AES-256-GCM, and
+// writes it to w after the archive magic and nonce.
+func writeArchive(w io.Writer, key []byte, a *archive) error {
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if err := json.NewEncoder(zw).Encode(a); err != nil {
+		return fmt.Errorf("failed to encode archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	gcm, err := newArchiveCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte(archiveMagic), nonce...)
+	out = gcm.Seal(out, nonce, plain.Bytes(), []byte(archiveMagic))
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// readArchive opens an archive written by writeArchive and checks every
+// secret against the manifest checksums.
+func readArchive(r io.Reader, key []byte) (*archive, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if !bytes.HasPrefix(b, []byte(archiveMagic)) {
+		return nil, fmt.Errorf("not an hvm archive")
+	}
+	b = b[len(archiveMagic):]
+
+	gcm, err := newArchiveCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, fmt.Errorf("archive is truncated")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], []byte(archiveMagic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt archive, is the key correct? %w", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	// Numbers stay as written, so 1.50 or an integer beyond float64
+	// precision still match their manifest checksum and import unchanged.
+	dec := json.NewDecoder(zr)
+	dec.UseNumber()
+	a := new(archive)
+	if err := dec.Decode(a); err != nil {
+		return nil, fmt.Errorf("failed to decode archive: %w", err)
+	}
+
+	for _, secret := range a.Secrets {
+		b, err := json.Marshal(secret.Data)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		if a.Manifest.Checksums[secret.Path] != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("secret %q does not match the archive manifest", secret.Path)
+		}
+	}
+	return a, nil
+}
+
+// newArchiveCipher returns the AES-256-GCM AEAD for the given key.
+func newArchiveCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("archive key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
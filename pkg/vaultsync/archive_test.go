@@ -0,0 +1,62 @@
+package vaultsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestArchiveRoundTripKeepsNumbers(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	var data map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(`{"price": 1.50, "id": 12345678901234567891, "name": "x"}`)))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+
+	a := &archive{
+		Manifest: ArchiveManifest{Version: 1, Secrets: 1, Checksums: map[string]string{"app/db": hex.EncodeToString(sum[:])}},
+		Secrets:  []ArchiveSecret{{Path: "app/db", Data: data}},
+	}
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, key, a); err != nil {
+		t.Fatalf("writeArchive: %v", err)
+	}
+
+	got, err := readArchive(&buf, key)
+	if err != nil {
+		t.Fatalf("readArchive: %v", err)
+	}
+	if len(got.Secrets) != 1 {
+		t.Fatalf("got %d secrets, want 1", len(got.Secrets))
+	}
+	for k, want := range map[string]string{"price": "1.50", "id": "12345678901234567891"} {
+		n, ok := got.Secrets[0].Data[k].(json.Number)
+		if !ok {
+			t.Fatalf("%s: got %T, want json.Number", k, got.Secrets[0].Data[k])
+		}
+		if n.String() != want {
+			t.Errorf("%s: got %s, want %s", k, n, want)
+		}
+	}
+}
+
+func TestReadArchiveWrongKey(t *testing.T) {
+	a := &archive{Manifest: ArchiveManifest{Version: 1, Checksums: map[string]string{}}}
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, bytes.Repeat([]byte{1}, 32), a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readArchive(&buf, bytes.Repeat([]byte{2}, 32)); err == nil {
+		t.Fatal("readArchive with the wrong key succeeded")
+	}
+}
@@ -0,0 +1,143 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultAuditDebounce is how long FollowAudit collects writes before
+// syncing them, so a burst of writes is synced as one batch.
+const DefaultAuditDebounce = 2 * time.Second
+
+type (
+	// auditEntry is the part of a Vault audit log entry FollowAudit needs.
+	auditEntry struct {
+		Type    string `json:"type"`
+		Error   string `json:"error"`
+		Request struct {
+			Operation string `json:"operation"`
+			Path      string `json:"path"`
+		} `json:"request"`
+	}
+)
+
+// auditPath returns the path, relative to mount, of the secret written by an
+// audit log entry, if the entry records a successful KV write below root
+// on mount. Only response entries are used, so a write is seen once and only
+// after Vault has applied it.
+//
+// Arguments:
+//
+//	line: []byte - The JSON audit log entry.
+//	prefix: string - The API path of secrets on the source mount, such as "secret/data/".
+//	root: string - The configured source path.
+//
+// Returns:
+//
+//	string - The path of the written secret.
+//	bool - Whether the entry is such a write.
+func auditPath(line []byte, prefix, root string) (string, bool) {
+	var e auditEntry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return "", false
+	}
+	if e.Type != "response" || e.Error != "" {
+		return "", false
+	}
+	switch e.Request.Operation {
+	case "create", "update", "patch":
+	default:
+		return "", false
+	}
+
+	path, ok := strings.CutPrefix(e.Request.Path, prefix)
+	if !ok || path == "" || strings.HasSuffix(path, "/") || !strings.HasPrefix(path, root) {
+		return "", false
+	}
+	return path, true
+}
+
+// FollowAudit syncs secrets as they are written, by reading the entries of a
+// Vault audit device (file or socket) from entries until ctx is done or
+// entries is closed. Successful KV writes below the configured source
+// path are collected for debounce and then synced together with SyncPaths,
+// giving low-latency replication without the events API. Each batch
+// verifies only its own secrets, so following keeps no state between
+// batches. Deletes are not propagated. A failed batch is logged and
+// following continues.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	entries: <-chan []byte - The audit log entries, one JSON object each.
+//	debounce: time.Duration - How long to collect writes before syncing them, DefaultAuditDebounce if zero.
+//	onReport: func(*Report) - Called with the report of every batch, or nil.
+//
+// Returns:
+//
+//	error - An error if the source is not a vault or the syncer cannot follow writes.
+func (s *Syncer) FollowAudit(ctx context.Context, entries <-chan []byte, debounce time.Duration, onReport func(*Report)) error {
+	if err := s.requireVaultSource("following the audit log"); err != nil {
+		return err
+	}
+	if debounce <= 0 {
+		debounce = DefaultAuditDebounce
+	}
+
+	go s.watchTokens(ctx)
+
+	mount, root := s.cfg.SourceVault.Mount, strings.TrimPrefix(s.cfg.SourceVault.Path, "/")
+	prefix := s.kvPath(ctx, s.sourceVault, mount, "data", "")
+	s.log.Info().Str("mount", mount).Str("path", root).Dur("debounce", debounce).Msg("Following audit log")
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		paths := make([]string, 0, len(pending))
+		for p := range pending {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		pending = make(map[string]bool)
+
+		report, err := s.SyncPaths(ctx, paths)
+		if err != nil {
+			s.log.Error().Err(err).Int("secrets", len(paths)).Msg("Failed to sync secrets written in the audit log")
+		}
+		if report != nil && onReport != nil {
+			onReport(report)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			flush()
+		case line, ok := <-entries:
+			if !ok {
+				flush()
+				return nil
+			}
+			path, ok := auditPath(line, prefix, root)
+			if !ok {
+				continue
+			}
+			s.log.Debug().Str("secret", path).Msg("Secret written")
+			if len(pending) == 0 {
+				timer.Reset(debounce)
+			}
+			pending[path] = true
+		}
+	}
+}
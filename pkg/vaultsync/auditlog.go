@@ -0,0 +1,109 @@
+package vaultsync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// AuditWrite records a secret, or a version of one, being written.
+	AuditWrite = "write"
+	// AuditDelete records a secret, or versions of one, being soft-deleted.
+	AuditDelete = "delete"
+	// AuditDestroy records a secret, or versions of one, being destroyed.
+	AuditDestroy = "destroy"
+	// AuditMetadata records the KV metadata of a secret being written.
+	AuditMetadata = "metadata"
+
+	// AuditSource is the Target of a change made to the source vault.
+	AuditSource = "source"
+	// AuditDestination is the Target of a change made to the destination vault.
+	AuditDestination = "destination"
+)
+
+// AuditRecord is one line of the audit log: a single write or delete made
+// by hvm. It never holds secret data, only its checksum.
+type AuditRecord struct {
+	Time  time.Time `json:"time"`
+	RunID string    `json:"runId,omitempty"`
+	// Operation is AuditWrite, AuditDelete, AuditDestroy, or AuditMetadata.
+	Operation string `json:"operation"`
+	// Target is AuditSource, AuditDestination, or the name of an external
+	// Destination.
+	Target string `json:"target"`
+	Mount  string `json:"mount,omitempty"`
+	Path   string `json:"path"`
+	// SourcePath is the source path of a secret written elsewhere on the
+	// destination.
+	SourcePath         string `json:"sourcePath,omitempty"`
+	SourceVersion      int64  `json:"sourceVersion,omitempty"`
+	DestinationVersion int64  `json:"destinationVersion,omitempty"`
+	// Checksum is the SHA-256 of the JSON encoding of the data written.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// audit appends r to the audit log, if one is configured, stamped with the
+// time, the current run, and the checksum of data. The file is opened for
+// each record, so it may be rotated between them; records are never
+// rewritten. Failures are logged, since the change has already been made.
+//
+// Arguments:
+//
+//	r: AuditRecord - The change to record.
+//	data: map[string]interface{} - The data written, or nil for deletes and placeholders.
+//
+// Returns: nothing
+func (s *Syncer) audit(r AuditRecord, data map[string]interface{}) {
+	if s.cfg.AuditLog.Path == "" {
+		return
+	}
+
+	r.Time = time.Now().UTC()
+	if s.report != nil {
+		r.RunID = s.report.RunID
+	}
+	if data != nil {
+		sum, err := s.checksum(data)
+		if err != nil {
+			s.log.Error().Err(err).Str("secret", r.Path).Msg("Failed to checksum secret for the audit log")
+		} else {
+			r.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	if err := s.appendAudit(r); err != nil {
+		s.log.Error().Err(err).Str("secret", r.Path).Str("operation", r.Operation).Msg("Failed to write audit log")
+	}
+}
+
+// appendAudit writes r as a single line at the end of the audit log.
+func (s *Syncer) appendAudit(r AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	b = append(b, '\n')
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	f, err := os.OpenFile(s.cfg.AuditLog.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append to audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// auditOperation returns the audit operation of a delete.
+func auditOperation(destroy bool) string {
+	if destroy {
+		return AuditDestroy
+	}
+	return AuditDelete
+}
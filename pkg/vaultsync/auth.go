@@ -0,0 +1,334 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/hashicorp/vault-client-go/schema"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// AuthMountCreated means the auth method was enabled on the destination.
+	AuthMountCreated AuthMountAction = "created"
+	// AuthMountExists means the auth method was already enabled on the
+	// destination, and only its config and roles were copied.
+	AuthMountExists AuthMountAction = "exists"
+	// AuthMountSkipped means the auth method cannot be migrated, like token.
+	AuthMountSkipped AuthMountAction = "skipped"
+	// AuthMountFailed means the auth method could not be migrated; see
+	// AuthMountResult.Error.
+	AuthMountFailed AuthMountAction = "failed"
+)
+
+type (
+	// AuthMountAction is what happened, or in a dry run would happen, to a
+	// single auth mount.
+	AuthMountAction string
+
+	// AuthReport is the structured result of SyncAuth.
+	AuthReport struct {
+		DryRun     bool              `json:"dryRun"`
+		Filter     string            `json:"filter,omitempty"`
+		StartedAt  time.Time         `json:"startedAt"`
+		FinishedAt time.Time         `json:"finishedAt"`
+		Failed     int               `json:"failed"`
+		Mounts     []AuthMountResult `json:"mounts"`
+	}
+
+	// AuthMountResult is the outcome for a single auth mount. NotExported
+	// lists the credentials vault never returns, which have to be set on
+	// the destination by hand.
+	AuthMountResult struct {
+		Path        string          `json:"path"`
+		Type        string          `json:"type"`
+		Action      AuthMountAction `json:"action"`
+		Config      bool            `json:"config"`
+		Roles       []string        `json:"roles,omitempty"`
+		NotExported []string        `json:"notExported,omitempty"`
+		Error       string          `json:"error,omitempty"`
+	}
+
+	// authKind describes what can be copied for one auth method type.
+	authKind struct {
+		// config is the config endpoint under the mount, if any.
+		config string
+		// roles is the role endpoint under the mount, if any.
+		roles string
+		// roleID copies each approle role's role ID.
+		roleID bool
+		// notExported are the credentials vault never returns.
+		notExported []string
+	}
+)
+
+// authKinds are the auth method types whose config and roles are copied.
+// Other types are enabled with their mount config only.
+var authKinds = map[string]authKind{
+	"approle":    {roles: "role", roleID: true, notExported: []string{"secret IDs"}},
+	"kubernetes": {config: "config", roles: "role", notExported: []string{"config token_reviewer_jwt"}},
+	"jwt":        {config: "config", roles: "role", notExported: []string{"config oidc_client_secret"}},
+	"oidc":       {config: "config", roles: "role", notExported: []string{"config oidc_client_secret"}},
+}
+
+// SyncAuth enables the auth methods of the source vault whose mount paths
+// match filter on the destination vault, with the same mount config, and
+// copies the config and roles of approle, kubernetes, jwt, and oidc
+// methods. Credentials vault never returns, like approle secret IDs, are
+// listed in the report instead. The token auth method is always skipped.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	filter: string - A path.Match glob on mount paths (without the trailing slash), or "" for every mount.
+//	dryRun: bool - Only report what would be copied instead of writing it.
+//
+// Returns:
+//
+//	*AuthReport - The result for every matching auth mount.
+//	error - An error if the auth methods could not be listed, or any mount failed.
+func (s *Syncer) SyncAuth(ctx context.Context, filter string, dryRun bool) (*AuthReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("auth sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("auth sync"); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid auth filter %q: %w", filter, err)
+		}
+	}
+
+	report := &AuthReport{DryRun: dryRun, Filter: filter, StartedAt: time.Now().UTC()}
+
+	src, err := s.authMounts(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source auth methods: %w", err)
+	}
+	dst, err := s.authMounts(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destination auth methods: %w", err)
+	}
+
+	paths := make([]string, 0, len(src))
+	for p := range src {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if filter != "" {
+			if ok, _ := path.Match(filter, strings.TrimSuffix(p, "/")); !ok {
+				continue
+			}
+		}
+
+		res := s.syncAuthMount(ctx, p, src[p], dst[p], dryRun)
+		if res.Action == AuthMountFailed {
+			s.log.Error().Str("mount", p).Str("error", res.Error).Msg("Failed to sync auth method")
+			report.Failed++
+		}
+		report.Mounts = append(report.Mounts, res)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d auth methods failed", report.Failed, len(report.Mounts))
+	}
+	return report, nil
+}
+
+// syncAuthMount enables one auth method if needed and copies its config
+// and roles.
+func (s *Syncer) syncAuthMount(ctx context.Context, mountPath string, src, dst map[string]interface{}, dryRun bool) AuthMountResult {
+	typ, _ := src["type"].(string)
+	res := AuthMountResult{Path: mountPath, Type: typ}
+	if typ == "token" {
+		res.Action = AuthMountSkipped
+		return res
+	}
+	fail := func(err error) AuthMountResult {
+		res.Action = AuthMountFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	if dst == nil {
+		res.Action = AuthMountCreated
+		if !dryRun {
+			req := schema.AuthEnableMethodRequest{Type: typ}
+			req.Description, _ = src["description"].(string)
+			req.Local, _ = src["local"].(bool)
+			req.SealWrap, _ = src["seal_wrap"].(bool)
+			req.Config, _ = src["config"].(map[string]interface{})
+			req.Options, _ = src["options"].(map[string]interface{})
+			err := s.withRetry(ctx, "enable auth", func() error {
+				if err := s.writeLimiter.Wait(ctx); err != nil {
+					return err
+				}
+				_, err := s.destinationVault.System.AuthEnableMethod(ctx, strings.TrimSuffix(mountPath, "/"), req)
+				return err
+			})
+			if err != nil {
+				return fail(fmt.Errorf("failed to enable auth method: %w", err))
+			}
+		}
+	} else {
+		res.Action = AuthMountExists
+		if dstType, _ := dst["type"].(string); dstType != typ {
+			return fail(fmt.Errorf("destination mount is a %s auth method, not %s", dstType, typ))
+		}
+	}
+
+	kind, ok := authKinds[typ]
+	if !ok {
+		res.NotExported = []string{"roles and config of " + typ + " auth methods"}
+		return res
+	}
+	res.NotExported = kind.notExported
+	base := "auth/" + mountPath
+
+	if kind.config != "" {
+		data, err := s.readSourceData(ctx, base+kind.config)
+		if err != nil {
+			return fail(fmt.Errorf("failed to read config: %w", err))
+		}
+		if data != nil {
+			res.Config = true
+			if !dryRun {
+				if err := s.writeDestinationData(ctx, base+kind.config, data); err != nil {
+					return fail(fmt.Errorf("failed to write config: %w", err))
+				}
+			}
+		}
+	}
+
+	if kind.roles == "" {
+		return res
+	}
+	roles, err := s.listSourceKeys(ctx, base+kind.roles)
+	if err != nil {
+		return fail(fmt.Errorf("failed to list roles: %w", err))
+	}
+
+	for _, role := range roles {
+		rolePath := base + kind.roles + "/" + role
+		data, err := s.readSourceData(ctx, rolePath)
+		if err != nil {
+			return fail(fmt.Errorf("failed to read role %q: %w", role, err))
+		}
+		if data == nil {
+			continue
+		}
+		if !dryRun {
+			if err := s.writeDestinationData(ctx, rolePath, data); err != nil {
+				return fail(fmt.Errorf("failed to write role %q: %w", role, err))
+			}
+		}
+
+		if kind.roleID {
+			id, err := s.readSourceData(ctx, rolePath+"/role-id")
+			if err != nil {
+				return fail(fmt.Errorf("failed to read role ID of %q: %w", role, err))
+			}
+			if id != nil && !dryRun {
+				if err := s.writeDestinationData(ctx, rolePath+"/role-id", id); err != nil {
+					return fail(fmt.Errorf("failed to write role ID of %q: %w", role, err))
+				}
+			}
+		}
+		res.Roles = append(res.Roles, role)
+	}
+
+	if !dryRun {
+		s.log.Info().Str("mount", mountPath).Str("type", typ).Int("roles", len(res.Roles)).Msg("Auth method synced")
+	}
+	return res
+}
+
+// authMounts returns the enabled auth methods of a vault by mount path.
+func (s *Syncer) authMounts(ctx context.Context, client *vault.Client, limiter *rate.Limiter) (map[string]map[string]interface{}, error) {
+	var mounts map[string]map[string]interface{}
+	err := s.withRetry(ctx, "list auth methods", func() error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := client.System.AuthListEnabledMethods(ctx)
+		if err != nil {
+			return err
+		}
+		mounts = make(map[string]map[string]interface{})
+		for p, m := range resp.Data {
+			if mount, ok := m.(map[string]interface{}); ok && strings.HasSuffix(p, "/") {
+				mounts[p] = mount
+			}
+		}
+		return nil
+	})
+	return mounts, err
+}
+
+// listSourceKeys lists a raw path on the source vault, returning nil if it
+// does not exist.
+func (s *Syncer) listSourceKeys(ctx context.Context, p string) ([]string, error) {
+	var keys []string
+	err := s.withRetry(ctx, "list", func() error {
+		if err := s.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.sourceVault.List(ctx, p)
+		if vault.IsErrorStatus(err, 404) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		keys = nil
+		v, _ := resp.Data["keys"].([]interface{})
+		for _, k := range v {
+			if key, ok := k.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// readSourceData reads a raw path from the source vault, returning nil if
+// it does not exist.
+func (s *Syncer) readSourceData(ctx context.Context, p string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := s.withRetry(ctx, "read", func() error {
+		if err := s.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.sourceVault.Read(ctx, p)
+		if vault.IsErrorStatus(err, 404) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = resp.Data
+		return nil
+	})
+	return data, err
+}
+
+// writeDestinationData writes a raw path to the destination vault.
+func (s *Syncer) writeDestinationData(ctx context.Context, p string, data map[string]interface{}) error {
+	return s.withRetry(ctx, "write", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.Write(ctx, p, data)
+		return err
+	})
+}
@@ -0,0 +1,285 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+// bidirectionalStateFile is the file in the state directory that holds the
+// versions each secret had on both sides when they last converged.
+const bidirectionalStateFile = "bidirectional.json"
+
+type (
+	// syncedVersions are the versions of a secret on both sides when they
+	// last held the same data.
+	syncedVersions struct {
+		Source      int64 `json:"source"`
+		Destination int64 `json:"destination"`
+	}
+
+	// versionedSecret is the current version of a KV v2 secret.
+	versionedSecret struct {
+		data    map[string]interface{}
+		version int64
+		created time.Time
+	}
+)
+
+// loadBidirectionalState reads the versions recorded by the last
+// bidirectional run, or starts empty if there was none.
+func (s *Syncer) loadBidirectionalState() error {
+	s.bidiMu.Lock()
+	defer s.bidiMu.Unlock()
+
+	s.bidiState = make(map[string]syncedVersions)
+	b, err := os.ReadFile(filepath.Join(s.cfg.RunDir(), bidirectionalStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read bidirectional state: %w", err)
+	}
+	if err := json.Unmarshal(b, &s.bidiState); err != nil {
+		return fmt.Errorf("failed to decode bidirectional state: %w", err)
+	}
+	return nil
+}
+
+// saveBidirectionalState writes the versions of every converged secret to
+// the state directory for the next run.
+func (s *Syncer) saveBidirectionalState() error {
+	s.bidiMu.Lock()
+	defer s.bidiMu.Unlock()
+
+	if err := os.MkdirAll(s.cfg.RunDir(), 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	b, err := json.MarshalIndent(s.bidiState, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.cfg.RunDir(), bidirectionalStateFile), b, 0o600)
+}
+
+// converged records that the secret at path holds the same data on both
+// sides at the given versions.
+func (s *Syncer) converged(mount, path string, src, dst int64) {
+	s.bidiMu.Lock()
+	s.bidiState[mount+"/"+path] = syncedVersions{Source: src, Destination: dst}
+	s.bidiMu.Unlock()
+}
+
+// listBothPaths lists the keys under path on both vaults, so secrets that
+// only exist on the destination are synced back too.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of both vaults.
+//	path: string - The path to list.
+//	srcList: []string - The keys already listed on the source vault.
+//
+// Returns:
+//
+//	[]string - The sorted union of the keys on both vaults.
+//	error - An error if the destination could not be listed.
+func (s *Syncer) listBothPaths(ctx context.Context, mount, path string, srcList []string) ([]string, error) {
+	dstList, err := s.listPath(ctx, s.destinationVault, s.writeLimiter, mount, path)
+	if err != nil && !vault.IsErrorStatus(err, 404) {
+		return nil, fmt.Errorf("failed to list destination path: %w", err)
+	}
+
+	seen := make(map[string]bool, len(srcList)+len(dstList))
+	keys := make([]string, 0, len(srcList)+len(dstList))
+	for _, k := range append(srcList, dstList...) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// syncBidirectional copies a secret from whichever vault changed it since
+// the two last converged. A secret missing on one side is copied to it,
+// unless the other side is unchanged since the last run, which means it
+// was deleted; deletions are not propagated and the secret is skipped.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of both vaults.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	Action - ActionCreated or ActionUpdated if the source was copied to the destination, ActionPulled if the destination was copied to the source, or ActionSkipped.
+//	error - An error if the secret could not be synced or conflicts under the "fail" policy.
+func (s *Syncer) syncBidirectional(ctx context.Context, mount, path string) (Action, error) {
+	src, err := s.readVersioned(ctx, s.sourceVault, s.readLimiter, mount, path)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to get secret from source vault")
+		return ActionFailed, fmt.Errorf("failed to read secret from source vault: %w", err)
+	}
+	dst, err := s.readVersioned(ctx, s.destinationVault, s.writeLimiter, mount, path)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to get secret from destination vault")
+		return ActionFailed, fmt.Errorf("failed to read secret from destination vault: %w", err)
+	}
+
+	s.bidiMu.Lock()
+	base, known := s.bidiState[mount+"/"+path]
+	s.bidiMu.Unlock()
+
+	switch {
+	case src == nil && dst == nil:
+		return ActionSkipped, nil
+	case dst == nil:
+		if known && src.version == base.Source {
+			s.log.Warn().Str("secret", path).Msg("Secret was deleted from the destination vault, not syncing it")
+			return ActionSkipped, nil
+		}
+		return s.push(ctx, mount, path, src)
+	case src == nil:
+		if known && dst.version == base.Destination {
+			s.log.Warn().Str("secret", path).Msg("Secret was deleted from the source vault, not syncing it")
+			return ActionSkipped, nil
+		}
+		return s.pull(ctx, mount, path, dst)
+	}
+
+	srcSum, err := s.checksum(src.data)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to checksum source secret: %w", err)
+	}
+	dstSum, err := s.checksum(dst.data)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to checksum destination secret: %w", err)
+	}
+	if srcSum == dstSum {
+		s.converged(mount, path, src.version, dst.version)
+		s.log.Debug().Str("secret", path).Msg("Secret is the same in both vaults")
+		return ActionSkipped, nil
+	}
+
+	srcChanged := !known || src.version != base.Source
+	dstChanged := !known || dst.version != base.Destination
+	switch {
+	case srcChanged && !dstChanged:
+		return s.push(ctx, mount, path, src)
+	case dstChanged && !srcChanged:
+		return s.pull(ctx, mount, path, dst)
+	}
+
+	policy := s.cfg.Bidirectional.Conflict
+	if policy == "" {
+		policy = ConflictNewer
+	}
+	s.log.Warn().Str("secret", path).Str("policy", policy).Msg("Secret changed in both vaults")
+	s.report.conflict(path, policy)
+	switch policy {
+	case ConflictSource:
+		return s.push(ctx, mount, path, src)
+	case ConflictDestination:
+		return s.pull(ctx, mount, path, dst)
+	case ConflictSkip:
+		return ActionSkipped, nil
+	case ConflictFail:
+		return ActionFailed, fmt.Errorf("secret changed in both vaults since the last sync")
+	}
+	if dst.created.After(src.created) {
+		return s.pull(ctx, mount, path, dst)
+	}
+	return s.push(ctx, mount, path, src)
+}
+
+// push copies the source secret to the destination vault.
+func (s *Syncer) push(ctx context.Context, mount, path string, src *versionedSecret) (Action, error) {
+	destPath, destData, destVersion, err := s.writeDestination(ctx, mount, path, src.data, src.version)
+	if err != nil {
+		return ActionFailed, err
+	}
+	if err := s.recordSynced(path, destPath, destData); err != nil {
+		return ActionFailed, err
+	}
+	s.converged(mount, path, src.version, destVersion)
+
+	if destVersion == 1 {
+		return ActionCreated, nil
+	}
+	return ActionUpdated, nil
+}
+
+// pull copies the destination secret back to the source vault.
+func (s *Syncer) pull(ctx context.Context, mount, path string, dst *versionedSecret) (Action, error) {
+	var resp *vault.Response[map[string]interface{}]
+	writeCtx, span := s.startSpan(ctx, "write source", mount, path)
+	err := s.withRetry(writeCtx, "write", func() (err error) {
+		if err := s.readLimiter.Wait(writeCtx); err != nil {
+			return err
+		}
+		resp, err = s.sourceVault.Write(writeCtx, mount+"/data/"+path, map[string]interface{}{"data": dst.data}, vault.WithMountPath(mount))
+		return err
+	})
+	endSpan(span, err)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to write secret to source vault")
+		return ActionFailed, fmt.Errorf("failed to write secret to source vault: %w", err)
+	}
+	s.converged(mount, path, version(resp.Data), dst.version)
+	s.audit(AuditRecord{Operation: AuditWrite, Target: AuditSource, Mount: mount, Path: path, SourceVersion: version(resp.Data), DestinationVersion: dst.version}, dst.data)
+
+	s.log.Debug().Str("secret", path).Msg("Secret copied back to source vault")
+	return ActionPulled, nil
+}
+
+// readVersioned reads the current version of a KV v2 secret with its
+// version number and creation time.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to read from.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The mount path.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	*versionedSecret - The secret, or nil if it does not exist or its current version is deleted.
+//	error - An error if the secret could not be read.
+func (s *Syncer) readVersioned(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount, path string) (*versionedSecret, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "read", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, s.kvPath(ctx, client, mount, "data", path), vault.WithMountPath(mount))
+		return err
+	})
+	if vault.IsErrorStatus(err, 404) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, meta := s.kvData(ctx, client, mount, resp.Data)
+	if data == nil {
+		return nil, nil
+	}
+	s.secrets.addData(data)
+	created, _ := meta["created_time"].(string)
+	t, _ := time.Parse(time.RFC3339Nano, created)
+	return &versionedSecret{data: data, version: version(meta), created: t}, nil
+}
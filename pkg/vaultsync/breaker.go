@@ -0,0 +1,140 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultBreakerThreshold = 5
+
+type (
+	// circuitBreaker counts the destination vault's consecutive transient
+	// failures and, once it is open, holds back writes until the vault is
+	// healthy again.
+	circuitBreaker struct {
+		mu       sync.Mutex
+		failures int
+		// closed is closed once the open circuit closes again, and is nil
+		// while the circuit is closed.
+		closed chan struct{}
+		// probing is set while a worker health checks the destination.
+		probing bool
+	}
+)
+
+// breakerEnabled reports whether the circuit breaker guards writes, which
+// it only does for a destination vault.
+func (s *Syncer) breakerEnabled() bool {
+	return s.cfg.CircuitBreaker.Enabled && s.destination == nil && s.destinationVault != nil
+}
+
+// destinationResult feeds the outcome of a request to the destination vault
+// to the circuit breaker, opening the circuit after the configured number
+// of transient failures in a row. Safe for concurrent use.
+//
+// Arguments:
+//
+//	err: error - The error of the request, or nil if it succeeded.
+//
+// Returns: nothing
+func (s *Syncer) destinationResult(err error) {
+	if !s.breakerEnabled() {
+		return
+	}
+
+	b := &s.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	if !isTransient(err) {
+		return
+	}
+	b.failures++
+
+	threshold := s.cfg.CircuitBreaker.Threshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if b.failures >= threshold && b.closed == nil {
+		b.closed = make(chan struct{})
+		s.log.Warn().Err(err).Int("failures", b.failures).Msg("Destination vault is failing, pausing writes until it is healthy")
+	}
+}
+
+// awaitDestination blocks while the circuit is open. One waiting worker at
+// a time checks the destination's health every CheckInterval and closes
+// the circuit once it is unsealed, releasing the others.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	error - The context error if ctx was done before the circuit closed.
+func (s *Syncer) awaitDestination(ctx context.Context) error {
+	if !s.breakerEnabled() {
+		return nil
+	}
+
+	interval := s.cfg.CircuitBreaker.CheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	b := &s.breaker
+	for {
+		b.mu.Lock()
+		closed, probe := b.closed, b.closed != nil && !b.probing
+		if probe {
+			b.probing = true
+		}
+		b.mu.Unlock()
+		if closed == nil {
+			return nil
+		}
+
+		if probe {
+			err := s.checkDestinationHealth(ctx)
+			b.mu.Lock()
+			b.probing = false
+			if err == nil {
+				b.failures = 0
+				close(b.closed)
+				b.closed = nil
+				s.log.Info().Msg("Destination vault is healthy, resuming writes")
+			}
+			b.mu.Unlock()
+			if err == nil {
+				return nil
+			}
+			s.log.Debug().Err(err).Msg("Destination vault is still unhealthy")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checkDestinationHealth fails unless the destination vault answers its
+// health check unsealed.
+func (s *Syncer) checkDestinationHealth(ctx context.Context) error {
+	h, err := readHealth(ctx, s.destinationVault)
+	if err != nil {
+		return err
+	}
+	if h.Sealed {
+		return fmt.Errorf("destination vault is sealed")
+	}
+	return nil
+}
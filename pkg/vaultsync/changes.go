@@ -0,0 +1,104 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// Change is a source secret that changed after a given time.
+	Change struct {
+		Path           string    `json:"path"`
+		CurrentVersion int64     `json:"currentVersion"`
+		ChangedAt      time.Time `json:"changedAt"`
+		// Deleted is set if the current version is deleted or destroyed.
+		Deleted bool `json:"deleted,omitempty"`
+	}
+)
+
+// Changes lists the secrets directly under the configured source path that
+// changed after since, using only their KV v2 metadata: a secret changed if
+// any version was created or deleted, or its metadata was updated, after
+// since. Metadata is read on a worker pool of BatchSize workers under the
+// source rate limit.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	since: time.Time - Only changes after this time are returned.
+//
+// Returns:
+//
+//	[]Change - The changed secrets, oldest change first.
+//	error - An error if the path could not be listed or any metadata could not be read.
+func (s *Syncer) Changes(ctx context.Context, since time.Time) ([]Change, error) {
+	if err := s.requireVaultSource("changes"); err != nil {
+		return nil, err
+	}
+
+	mount, root := s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path
+	srcList, err := s.listSourcePath(ctx, mount, root)
+	if err != nil {
+		return nil, err
+	}
+	keys := secretKeys(srcList)
+
+	var (
+		mu      sync.Mutex
+		changes []Change
+		errs    []*SecretError
+	)
+	runPool(ctx, s.cfg.BatchSize, keys, func(ctx context.Context, key string) {
+		meta, err := s.readMetadata(ctx, mount, root+key)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, &SecretError{Path: root + key, Err: err})
+			return
+		}
+		if c := meta.change(root + key); c.ChangedAt.After(since) {
+			changes = append(changes, c)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listing changes aborted: %w", err)
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+		return nil, &SyncError{Total: len(keys), Errors: errs}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].ChangedAt.Equal(changes[j].ChangedAt) {
+			return changes[i].ChangedAt.Before(changes[j].ChangedAt)
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// change summarizes the most recent change recorded in the metadata.
+func (m *secretMetadata) change(path string) Change {
+	c := Change{Path: path, CurrentVersion: m.CurrentVersion}
+
+	latest := func(ts string) {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil && t.After(c.ChangedAt) {
+			c.ChangedAt = t
+		}
+	}
+	latest(m.UpdatedTime)
+	for _, v := range m.Versions {
+		latest(v.CreatedTime)
+		latest(v.DeletionTime)
+	}
+
+	if cur, ok := m.Versions[strconv.FormatInt(m.CurrentVersion, 10)]; ok {
+		c.Deleted = cur.Destroyed || cur.DeletionTime != ""
+	}
+	return c
+}
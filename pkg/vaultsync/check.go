@@ -0,0 +1,207 @@
+package vaultsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/hashicorp/vault-client-go/schema"
+	"github.com/j4ng5y/hvm/internal/keyring"
+)
+
+// ResolveToken returns the configured token, reading TokenKeyring or
+// TokenFile, or running TokenCmd, if set. The token is redacted from logs
+// written through NewRedactWriter from then on.
+//
+// Returns:
+//
+//	string - The vault token.
+//	error - An error if no token is configured, the keyring entry or token file could not be read, or the token command failed or returned something other than a vault token.
+func (v *Vault) ResolveToken() (string, error) {
+	tkn, err := v.resolveToken()
+	if err != nil {
+		return "", err
+	}
+	credentials.add(tkn)
+	return tkn, nil
+}
+
+// resolveToken returns the configured token for ResolveToken.
+func (v *Vault) resolveToken() (string, error) {
+	switch {
+	case v.TokenKeyring != "":
+		tkn, err := keyring.Get(v.TokenKeyring)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token from keyring entry %q: %w", v.TokenKeyring, err)
+		}
+		return tkn, nil
+	case v.TokenFile != "":
+		return readTokenFile(v.TokenFile)
+	case v.TokenCmd != "":
+		cmd := strings.Split(v.TokenCmd, " ")
+		b, err := exec.Command(cmd[0], cmd[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to execute token command: %w", err)
+		}
+		if !bytes.HasPrefix(b, []byte("hvs.")) && !bytes.HasPrefix(b, []byte("hvb.")) {
+			return "", fmt.Errorf("token command did not return a vault token")
+		}
+		return string(bytes.TrimSpace(b)), nil
+	case v.Token != "":
+		return v.Token, nil
+	}
+	return "", fmt.Errorf("no token provided")
+}
+
+// readTokenFile reads a token from a file, expanding a leading ~/ to the
+// home directory. Any token format is accepted, including legacy s. tokens.
+func readTokenFile(file string) (string, error) {
+	if rest, ok := strings.CutPrefix(file, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand token file path: %w", err)
+		}
+		file = filepath.Join(home, rest)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	tkn := strings.TrimSpace(string(b))
+	if tkn == "" {
+		return "", fmt.Errorf("token file %s is empty", file)
+	}
+	return tkn, nil
+}
+
+// CheckConnection checks that the vault is reachable, unsealed, and accepts
+// the token, and that the mount and every mount in Mounts exist and are KV
+// v2 mounts. Fallback addresses, batch tokens, and forwarding are not used.
+// A wrapped token is only looked up, since unwrapping it would use it up,
+// so the mounts are not checked.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	error - An error describing the first check that failed.
+func (v *Vault) CheckConnection(ctx context.Context) error {
+	tkn, err := v.ResolveToken()
+	if err != nil {
+		return err
+	}
+	hc, err := v.httpClient()
+	if err != nil {
+		return err
+	}
+	client, err := vault.New(vault.WithAddress(v.clientAddress()), vault.WithHTTPClient(hc))
+	if err != nil {
+		return fmt.Errorf("failed to create vault client: %w", err)
+	}
+	if err := client.SetToken(tkn); err != nil {
+		return fmt.Errorf("failed to set vault token: %w", err)
+	}
+	if v.Namespace != "" {
+		if err := client.SetNamespace(v.Namespace); err != nil {
+			return fmt.Errorf("failed to set vault namespace: %w", err)
+		}
+	}
+
+	// Standbys answer for the active node, so only sealed and
+	// uninitialised vaults fail.
+	_, err = client.Read(ctx, "sys/health", vault.WithQueryParameters(url.Values{
+		"standbyok":     {"true"},
+		"perfstandbyok": {"true"},
+	}))
+	switch {
+	case vault.IsErrorStatus(err, 503):
+		return fmt.Errorf("%s is sealed", v.Address)
+	case vault.IsErrorStatus(err, 501):
+		return fmt.Errorf("%s is not initialized", v.Address)
+	case err != nil:
+		return fmt.Errorf("failed to reach %s: %w", v.Address, err)
+	}
+
+	if v.WrappedToken {
+		if _, err := client.System.ReadWrappingProperties(ctx, schema.ReadWrappingPropertiesRequest{Token: tkn}); err != nil {
+			return fmt.Errorf("%s does not know the wrapping token, or it was already unwrapped: %w", v.Address, err)
+		}
+		return nil
+	}
+
+	if _, err := client.Auth.TokenLookUpSelf(ctx); err != nil {
+		if vault.IsErrorStatus(err, 403) {
+			return fmt.Errorf("%s rejected the token: %w", v.Address, ErrTokenExpired)
+		}
+		return fmt.Errorf("failed to look up the token: %w", err)
+	}
+
+	mounts := []string{v.Mount}
+	for _, m := range v.Mounts {
+		mounts = append(mounts, m.Mount)
+	}
+	for _, m := range mounts {
+		if m == "" {
+			continue
+		}
+		if err := checkMount(ctx, client, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMount checks that mount exists and is a KV v2 mount.
+func checkMount(ctx context.Context, client *vault.Client, mount string) error {
+	resp, err := client.Read(ctx, "sys/internal/ui/mounts/"+strings.Trim(mount, "/"))
+	switch {
+	case vault.IsErrorStatus(err, 400), vault.IsErrorStatus(err, 403), vault.IsErrorStatus(err, 404):
+		return fmt.Errorf("mount %q does not exist or the token cannot access it", mount)
+	case err != nil:
+		return fmt.Errorf("failed to read mount %q: %w", mount, err)
+	}
+	typ, _ := resp.Data["type"].(string)
+	opts, _ := resp.Data["options"].(map[string]interface{})
+	if ver, _ := opts["version"].(string); typ != "kv" || ver != "2" {
+		return fmt.Errorf("mount %q is a %s mount, not KV v2", mount, describeMount(typ, ver))
+	}
+	return nil
+}
+
+// describeMount names a mount type, with its version for KV mounts.
+func describeMount(typ, ver string) string {
+	if typ == "kv" {
+		if ver == "" {
+			ver = "1"
+		}
+		return "KV v" + ver
+	}
+	return typ
+}
+
+// Vaults returns the vaults a sync with this config connects to, by their
+// config key: srcVault unless an external source is enabled, and destVault
+// unless an external destination is.
+//
+// Returns:
+//
+//	map[string]*Vault - The vaults in use.
+func (c *Config) Vaults() map[string]*Vault {
+	vaults := make(map[string]*Vault)
+	if len(c.enabledSources()) == 0 && c.SourceVault != nil {
+		vaults["srcVault"] = c.SourceVault
+	}
+	if !c.AzureKeyVault.Enabled && !c.Kubernetes.Enabled && c.DestinationVault != nil {
+		vaults["destVault"] = c.DestinationVault
+	}
+	return vaults
+}
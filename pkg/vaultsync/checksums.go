@@ -0,0 +1,146 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const defaultChecksumsPath = ".hvm/checksums"
+
+// folderChecksums computes a rollup hash for every folder containing a synced
+// secret, and for each of its ancestors. A folder's hash covers the checksums
+// of the secrets directly inside it and the rollup hashes of its subfolders,
+// so two folders with equal hashes hold identical subtrees.
+//
+// Arguments:
+//
+//	synced: map[string][32]byte - The checksum of every synced secret, keyed by path.
+//
+// Returns:
+//
+//	map[string]string - The hex encoded rollup hash of every folder, keyed by folder path.
+func folderChecksums(synced map[string][32]byte) map[string]string {
+	// entries maps a folder to its direct children (secret name or
+	// subfolder name with a trailing slash) and their hashes.
+	entries := make(map[string]map[string]string)
+	add := func(folder, name, sum string) {
+		if entries[folder] == nil {
+			entries[folder] = make(map[string]string)
+		}
+		entries[folder][name] = sum
+	}
+
+	for p, sum := range synced {
+		add(folderOf(p), path.Base(p), hex.EncodeToString(sum[:]))
+		for dir := folderOf(p); dir != ""; dir = folderOf(dir) {
+			if _, ok := entries[folderOf(dir)]; !ok {
+				entries[folderOf(dir)] = make(map[string]string)
+			}
+		}
+	}
+
+	// Process the deepest folders first so their rollups are known before
+	// their parents are hashed.
+	folders := make([]string, 0, len(entries))
+	for f := range entries {
+		folders = append(folders, f)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folderDepth(folders[i]) > folderDepth(folders[j])
+	})
+
+	retVal := make(map[string]string, len(folders))
+	for _, f := range folders {
+		names := make([]string, 0, len(entries[f]))
+		for name := range entries[f] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		h := sha256.New()
+		for _, name := range names {
+			fmt.Fprintf(h, "%s:%s\n", name, entries[f][name])
+		}
+		retVal[f] = hex.EncodeToString(h.Sum(nil))
+
+		if f != "" {
+			add(folderOf(f), path.Base(f)+"/", retVal[f])
+		}
+	}
+	return retVal
+}
+
+// folderOf returns the folder containing p, or "" for the root of the mount.
+func folderOf(p string) string {
+	dir := path.Dir(strings.TrimSuffix(p, "/"))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// folderDepth returns how deeply nested folder is, with the root at 0.
+func folderDepth(folder string) int {
+	if folder == "" {
+		return 0
+	}
+	return strings.Count(folder, "/") + 1
+}
+
+// writeFolderChecksums writes the rollup hash of every folder touched by this
+// run to the destination vault, under the configured checksums path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//
+// Returns:
+//
+//	error - An error if any checksum could not be written.
+func (s *Syncer) writeFolderChecksums(ctx context.Context, mount string) error {
+	prefix := s.cfg.Checksums.Path
+	if prefix == "" {
+		prefix = defaultChecksumsPath
+	}
+
+	s.syncedMu.Lock()
+	secretSums := make(map[string][32]byte, len(s.synced))
+	for p, synced := range s.synced {
+		secretSums[p] = synced.sum
+	}
+	s.syncedMu.Unlock()
+
+	sums := folderChecksums(secretSums)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for folder, sum := range sums {
+		p := strings.TrimSuffix(prefix+"/"+folder, "/")
+		data := s.kvBody(ctx, s.destinationVault, s.destMount(mount), map[string]interface{}{
+			"folder":   folder,
+			"checksum": sum,
+			"updated":  now,
+		})
+
+		err := s.withRetry(ctx, "write checksum", func() error {
+			if err := s.writeLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			_, err := s.destinationVault.Write(ctx, s.kvPath(ctx, s.destinationVault, s.destMount(mount), "data", p), data, vault.WithMountPath(s.destMount(mount)))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write checksum for folder %q: %w", folder, err)
+		}
+		s.log.Debug().Str("folder", folder).Str("checksum", sum).Msg("Folder checksum written")
+	}
+	return nil
+}
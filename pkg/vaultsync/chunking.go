@@ -0,0 +1,229 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// chunkManifestKey is the only key of a secret that was split into
+	// chunks. Its value is the JSON encoded chunkManifest.
+	chunkManifestKey = "__hvm_chunk_manifest"
+	// chunkDataKey holds a base64 encoded slice of the original secret in
+	// each chunk secret.
+	chunkDataKey = "chunk"
+	// chunkKeyPrefix starts the key of every chunk secret, below the path
+	// of the secret it was split from.
+	chunkKeyPrefix = ".hvm-chunk-"
+	// defaultChunkMaxBytes keeps each chunk under Consul's 512KiB value limit
+	// once base64 and KV overheads are added.
+	defaultChunkMaxBytes = 256 * 1024
+)
+
+type (
+	// chunkManifest describes how a secret was split into chunks.
+	chunkManifest struct {
+		Version int    `json:"version"`
+		Chunks  int    `json:"chunks"`
+		Size    int    `json:"size"`
+		SHA256  string `json:"sha256"`
+	}
+)
+
+// chunkPath returns the path of the n-th chunk of the secret at p.
+func chunkPath(p string, n int) string {
+	return p + "/" + chunkKeyPrefix + strconv.Itoa(n)
+}
+
+// splitChunks splits data into chunks if its JSON encoding exceeds the
+// configured maximum size.
+//
+// Arguments:
+//
+//	data: map[string]interface{} - The secret data.
+//
+// Returns:
+//
+//	map[string]interface{} - The manifest to write in place of data, or nil if data does not need chunking.
+//	[]map[string]interface{} - The chunk secrets, in order.
+//	error - An error if data could not be encoded.
+func (s *Syncer) splitChunks(data map[string]interface{}) (map[string]interface{}, []map[string]interface{}, error) {
+	if !s.cfg.Chunking.Enabled {
+		return nil, nil, nil
+	}
+	maxBytes := s.cfg.Chunking.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultChunkMaxBytes
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) <= maxBytes {
+		return nil, nil, nil
+	}
+
+	var chunks []map[string]interface{}
+	for i := 0; i < len(b); i += maxBytes {
+		end := i + maxBytes
+		if end > len(b) {
+			end = len(b)
+		}
+		chunks = append(chunks, map[string]interface{}{
+			chunkDataKey: base64.StdEncoding.EncodeToString(b[i:end]),
+		})
+	}
+
+	sum := sha256.Sum256(b)
+	manifest, err := json.Marshal(chunkManifest{
+		Version: 1,
+		Chunks:  len(chunks),
+		Size:    len(b),
+		SHA256:  hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return map[string]interface{}{chunkManifestKey: string(manifest)}, chunks, nil
+}
+
+// writeChunks writes the chunk secrets of the secret at p to the destination.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	p: string - The destination path of the chunked secret.
+//	chunks: []map[string]interface{} - The chunk secrets, in order.
+//
+// Returns:
+//
+//	error - An error if any chunk could not be written.
+func (s *Syncer) writeChunks(ctx context.Context, mount, p string, chunks []map[string]interface{}) error {
+	for i, chunk := range chunks {
+		err := s.withRetry(ctx, "write chunk", func() error {
+			if err := s.writeLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			_, err := s.destinationVault.Write(ctx, s.kvPath(ctx, s.destinationVault, mount, "data", chunkPath(p, i)), s.kvBody(ctx, s.destinationVault, mount, chunk), vault.WithMountPath(mount))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// pruneChunks removes the chunk secrets of the secret at p from n on, left
+// over from an earlier write that needed more chunks, or chunks at all.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	p: string - The destination path of the chunked secret.
+//	n: int - The number of chunks the secret has now.
+//
+// Returns:
+//
+//	error - An error if the chunks could not be listed or deleted.
+func (s *Syncer) pruneChunks(ctx context.Context, mount, p string, n int) error {
+	keys, err := s.listPath(ctx, s.destinationVault, s.writeLimiter, mount, p+"/")
+	if vault.IsErrorStatus(err, 404) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	for _, key := range keys {
+		i, err := strconv.Atoi(strings.TrimPrefix(key, chunkKeyPrefix))
+		if !strings.HasPrefix(key, chunkKeyPrefix) || err != nil || i < n {
+			continue
+		}
+		err = s.withRetry(ctx, "delete chunk", func() error {
+			if err := s.writeLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			_, err := s.destinationVault.Delete(ctx, s.kvPath(ctx, s.destinationVault, mount, "metadata", chunkPath(p, i)), vault.WithMountPath(mount))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// reassemble returns the original data of a chunked secret read from the
+// destination vault. Data without a chunk manifest is returned unchanged.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	limiter: *rate.Limiter - The rate limiter for destination reads.
+//	mount: string - The mount path of the destination vault.
+//	p: string - The destination path of the secret.
+//	data: map[string]interface{} - The secret data as read.
+//
+// Returns:
+//
+//	map[string]interface{} - The reassembled secret data.
+//	error - An error if a chunk is missing or the checksum does not match.
+func (s *Syncer) reassemble(ctx context.Context, limiter *rate.Limiter, mount, p string, data map[string]interface{}) (map[string]interface{}, error) {
+	raw, ok := data[chunkManifestKey].(string)
+	if !ok || len(data) != 1 {
+		return data, nil
+	}
+
+	var m chunkManifest
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("invalid chunk manifest: %w", err)
+	}
+
+	b := make([]byte, 0, m.Size)
+	for i := 0; i < m.Chunks; i++ {
+		var resp *vault.Response[map[string]interface{}]
+		err := s.withRetry(ctx, "read chunk", func() (err error) {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			resp, err = s.destinationVault.Read(ctx, s.kvPath(ctx, s.destinationVault, mount, "data", chunkPath(p, i)), vault.WithMountPath(mount))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk %d: %w", i, err)
+		}
+
+		chunk, _ := s.kvData(ctx, s.destinationVault, mount, resp.Data)
+		enc, _ := chunk[chunkDataKey].(string)
+		dec, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chunk %d: %w", i, err)
+		}
+		b = append(b, dec...)
+	}
+
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != m.SHA256 {
+		return nil, fmt.Errorf("reassembled secret does not match its manifest checksum")
+	}
+
+	var retVal map[string]interface{}
+	if err := json.Unmarshal(b, &retVal); err != nil {
+		return nil, fmt.Errorf("failed to decode reassembled secret: %w", err)
+	}
+	return retVal, nil
+}
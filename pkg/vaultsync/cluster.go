@@ -0,0 +1,143 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ClusterMountExists means the KV mount already exists on the destination.
+	ClusterMountExists ClusterMountAction = "exists"
+	// ClusterMountCreate means the KV mount is, or in a plan would be, created on the destination.
+	ClusterMountCreate ClusterMountAction = "create"
+	// ClusterMountSkipped means the KV mount is not migrated, e.g. because it is KV v1.
+	ClusterMountSkipped ClusterMountAction = "skipped"
+)
+
+type (
+	// ClusterMountAction is what a cluster migration does with a KV mount.
+	ClusterMountAction string
+
+	// ClusterMount is a source KV mount and what the migration does with it.
+	ClusterMount struct {
+		KVMount
+		Action ClusterMountAction `json:"action"`
+	}
+
+	// ClusterReport is the consolidated result of MigrateCluster. A plan
+	// holds dry runs of the policy and auth syncs and a diff of every KV
+	// mount in Diffs; an applied migration holds the real policy and auth
+	// syncs and the KV sync report in Sync.
+	ClusterReport struct {
+		Applied    bool           `json:"applied"`
+		StartedAt  time.Time      `json:"startedAt"`
+		FinishedAt time.Time      `json:"finishedAt"`
+		Mounts     []ClusterMount `json:"mounts"`
+		Policies   *PolicyReport  `json:"policies,omitempty"`
+		Auth       *AuthReport    `json:"auth,omitempty"`
+		Diffs      []*DiffReport  `json:"diffs,omitempty"`
+		Sync       *Report        `json:"sync,omitempty"`
+		Errors     []string       `json:"errors,omitempty"`
+	}
+)
+
+// MigrateCluster moves everything hvm can move from the source vault to the
+// destination: it creates every missing KV v2 mount, syncs ACL policies and
+// auth methods, and then syncs the data of every KV v2 mount. Without apply
+// nothing is written, and the report is the plan: the mounts that would be
+// created, what the policy and auth syncs would change, and a diff of each
+// KV mount. A stage that fails does not stop the stages after it.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	apply: bool - Carry out the migration instead of planning it.
+//
+// Returns:
+//
+//	*ClusterReport - The plan, or the outcome of every stage.
+//	error - An error if the mounts could not be discovered, or any stage failed.
+func (s *Syncer) MigrateCluster(ctx context.Context, apply bool) (*ClusterReport, error) {
+	ctx, span := s.tracer.Start(ctx, "migrate cluster")
+	defer span.End()
+
+	if s.destination != nil {
+		return nil, fmt.Errorf("cluster migration requires a vault destination")
+	}
+	if s.cfg.Bidirectional.Enabled {
+		return nil, fmt.Errorf("cluster migration cannot be used with bidirectional sync")
+	}
+
+	report := &ClusterReport{Applied: apply, StartedAt: time.Now().UTC()}
+	defer func() { report.FinishedAt = time.Now().UTC() }()
+
+	discovered, err := s.DiscoverKVMounts(ctx)
+	if err != nil {
+		return report, err
+	}
+	existing, err := s.readKVMounts(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		return report, fmt.Errorf("failed to read destination mounts: %w", err)
+	}
+	for _, m := range discovered {
+		action := ClusterMountCreate
+		switch _, ok := existing[m.Path]; {
+		case m.Version != 2:
+			action = ClusterMountSkipped
+		case ok:
+			action = ClusterMountExists
+		}
+		report.Mounts = append(report.Mounts, ClusterMount{KVMount: m, Action: action})
+	}
+
+	var errs []error
+	fail := func(stage string, err error) {
+		err = fmt.Errorf("%s: %w", stage, err)
+		errs = append(errs, err)
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	s.log.Info().Bool("apply", apply).Msg("Migrating policies")
+	if report.Policies, err = s.SyncPolicies(ctx, "", !apply); err != nil {
+		fail("policies", err)
+	}
+	s.log.Info().Bool("apply", apply).Msg("Migrating auth methods")
+	if report.Auth, err = s.SyncAuth(ctx, "", !apply); err != nil {
+		fail("auth methods", err)
+	}
+
+	if apply {
+		cfg := s.cfg
+		all := *cfg
+		all.CreateMissingMounts = true
+		s.cfg = &all
+		report.Sync, err = s.syncAllMounts(ctx)
+		s.cfg = cfg
+		if err != nil {
+			fail("secrets", err)
+		}
+		return report, errors.Join(errs...)
+	}
+
+	for _, m := range report.Mounts {
+		if m.Action == ClusterMountSkipped {
+			continue
+		}
+		restore, err := s.useMount(MountPath{Mount: m.Path})
+		if err != nil {
+			fail("secrets", fmt.Errorf("%s: %w", m.Path, err))
+			continue
+		}
+		diff, err := s.Diff(ctx)
+		restore()
+		if diff != nil {
+			report.Diffs = append(report.Diffs, diff)
+		}
+		if err != nil {
+			fail("secrets", fmt.Errorf("%s: %w", m.Path, err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
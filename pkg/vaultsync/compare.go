@@ -0,0 +1,343 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// CompareBoth means a mount exists on both vaults.
+	CompareBoth = "both"
+	// CompareSourceOnly means a mount exists only on the source vault.
+	CompareSourceOnly = "source"
+	// CompareDestinationOnly means a mount exists only on the destination vault.
+	CompareDestinationOnly = "destination"
+)
+
+type (
+	// CompareReport is a high-level summary of how two clusters differ, for
+	// planning a migration: which secrets engines and ACL policies each
+	// holds, and how many secrets are in each KV mount. Secrets are counted
+	// by listing and never read.
+	CompareReport struct {
+		StartedAt  time.Time         `json:"startedAt"`
+		FinishedAt time.Time         `json:"finishedAt"`
+		Mounts     []MountComparison `json:"mounts"`
+		Policies   PolicyComparison  `json:"policies"`
+		Errors     []string          `json:"errors,omitempty"`
+	}
+
+	// MountComparison is one secrets engine mount on either vault. Types
+	// and versions are empty on the side the mount is missing from, and
+	// secrets are only counted for KV mounts.
+	MountComparison struct {
+		Path string `json:"path"`
+		// Presence is CompareBoth, CompareSourceOnly, or CompareDestinationOnly.
+		Presence           string `json:"presence"`
+		SourceType         string `json:"sourceType,omitempty"`
+		SourceVersion      int    `json:"sourceVersion,omitempty"`
+		SourceSecrets      int    `json:"sourceSecrets"`
+		DestinationType    string `json:"destinationType,omitempty"`
+		DestinationVersion int    `json:"destinationVersion,omitempty"`
+		DestinationSecrets int    `json:"destinationSecrets"`
+		// Error says why the secrets of the mount could not be counted.
+		Error string `json:"error,omitempty"`
+	}
+
+	// PolicyComparison counts the ACL policies on both vaults and lists the
+	// names found on only one.
+	PolicyComparison struct {
+		Common          int      `json:"common"`
+		SourceOnly      []string `json:"sourceOnly,omitempty"`
+		DestinationOnly []string `json:"destinationOnly,omitempty"`
+	}
+
+	// mountInfo is the type and KV version of a mount from sys/mounts.
+	mountInfo struct {
+		Type    string
+		Version int
+	}
+)
+
+// Drifted reports whether the vaults hold different mounts, policies, or
+// numbers of secrets.
+func (r *CompareReport) Drifted() bool {
+	if len(r.Policies.SourceOnly) > 0 || len(r.Policies.DestinationOnly) > 0 {
+		return true
+	}
+	for _, m := range r.Mounts {
+		if m.Presence != CompareBoth || m.SourceType != m.DestinationType || m.SourceVersion != m.DestinationVersion || m.SourceSecrets != m.DestinationSecrets {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare summarizes the drift between the source and destination clusters
+// without reading or writing any secret: the secrets engines mounted on
+// each, the ACL policies each has, and the number of secrets in every KV
+// mount. The system, identity, and cubbyhole mounts every vault has are
+// left out. A mount whose secrets cannot be counted is reported with its
+// error, and does not stop the comparison.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	*CompareReport - The summary of both clusters.
+//	error - An error if either vault's mounts or policies could not be listed.
+func (s *Syncer) Compare(ctx context.Context) (*CompareReport, error) {
+	ctx, span := s.tracer.Start(ctx, "compare")
+	defer span.End()
+
+	if err := s.requireVaultSource("cluster comparison"); err != nil {
+		return nil, err
+	}
+	if s.destination != nil {
+		return nil, fmt.Errorf("cluster comparison requires a vault destination")
+	}
+
+	report := &CompareReport{StartedAt: time.Now().UTC()}
+	defer func() { report.FinishedAt = time.Now().UTC() }()
+
+	srcMounts, err := s.readMounts(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return report, fmt.Errorf("failed to read source mounts: %w", err)
+	}
+	dstMounts, err := s.readMounts(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		return report, fmt.Errorf("failed to read destination mounts: %w", err)
+	}
+
+	paths := make([]string, 0, len(srcMounts)+len(dstMounts))
+	for p := range srcMounts {
+		paths = append(paths, p)
+	}
+	for p := range dstMounts {
+		if _, ok := srcMounts[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		src, inSrc := srcMounts[p]
+		dst, inDst := dstMounts[p]
+		m := MountComparison{Path: p, Presence: CompareBoth}
+		switch {
+		case !inDst:
+			m.Presence = CompareSourceOnly
+		case !inSrc:
+			m.Presence = CompareDestinationOnly
+		}
+
+		var errs []string
+		if inSrc {
+			m.SourceType, m.SourceVersion = src.Type, src.Version
+			if src.Type == "kv" {
+				if m.SourceSecrets, err = s.countSecrets(ctx, s.sourceVault, s.readLimiter, p, src.Version); err != nil {
+					errs = append(errs, fmt.Sprintf("source: %v", err))
+				}
+			}
+		}
+		if inDst {
+			m.DestinationType, m.DestinationVersion = dst.Type, dst.Version
+			if dst.Type == "kv" {
+				if m.DestinationSecrets, err = s.countSecrets(ctx, s.destinationVault, s.writeLimiter, p, dst.Version); err != nil {
+					errs = append(errs, fmt.Sprintf("destination: %v", err))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			m.Error = strings.Join(errs, "; ")
+			report.Errors = append(report.Errors, p+": "+m.Error)
+		}
+		report.Mounts = append(report.Mounts, m)
+
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+	}
+
+	srcPolicies, err := s.listPolicies(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return report, fmt.Errorf("failed to list source policies: %w", err)
+	}
+	dstPolicies, err := s.listPolicies(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		return report, fmt.Errorf("failed to list destination policies: %w", err)
+	}
+	inDst := make(map[string]bool, len(dstPolicies))
+	for _, name := range dstPolicies {
+		inDst[name] = true
+	}
+	for _, name := range srcPolicies {
+		if inDst[name] {
+			report.Policies.Common++
+			delete(inDst, name)
+			continue
+		}
+		report.Policies.SourceOnly = append(report.Policies.SourceOnly, name)
+	}
+	for name := range inDst {
+		report.Policies.DestinationOnly = append(report.Policies.DestinationOnly, name)
+	}
+	sort.Strings(report.Policies.SourceOnly)
+	sort.Strings(report.Policies.DestinationOnly)
+
+	s.log.Info().
+		Int("mounts", len(report.Mounts)).
+		Int("commonPolicies", report.Policies.Common).
+		Int("sourceOnlyPolicies", len(report.Policies.SourceOnly)).
+		Int("destinationOnlyPolicies", len(report.Policies.DestinationOnly)).
+		Msg("Comparison complete")
+	return report, nil
+}
+
+// readMounts reads the secrets engine mounts of a vault, keyed by path
+// without slashes, leaving out the system, identity, and cubbyhole mounts.
+func (s *Syncer) readMounts(ctx context.Context, client *vault.Client, limiter *rate.Limiter) (map[string]mountInfo, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "list mounts", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, "sys/mounts")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := make(map[string]mountInfo)
+	for p, m := range resp.Data {
+		m, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		info := mountInfo{}
+		info.Type, _ = m["type"].(string)
+		switch info.Type {
+		case "system", "identity", "cubbyhole", "":
+			continue
+		case "kv":
+			info.Version = 1
+			if opts, _ := m["options"].(map[string]interface{}); opts["version"] == "2" {
+				info.Version = 2
+			}
+		}
+		mounts[strings.Trim(p, "/")] = info
+	}
+	return mounts, nil
+}
+
+// countSecrets counts every secret in a KV mount by listing it, a level of
+// folders at a time on a pool of Concurrency.ListWorkers workers.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to list.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The KV mount path.
+//	version: int - The KV version of the mount.
+//
+// Returns:
+//
+//	int - The number of secrets in the mount.
+//	error - An error if a folder could not be listed.
+func (s *Syncer) countSecrets(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount string, version int) (int, error) {
+	prefix := mount + "/metadata/"
+	if version == 1 {
+		prefix = mount + "/"
+	}
+	workers := s.cfg.Concurrency.ListWorkers
+	if workers < 1 {
+		workers = s.cfg.BatchSize
+	}
+
+	total := 0
+	pending := []string{""}
+	for len(pending) > 0 {
+		var (
+			mu       sync.Mutex
+			next     []string
+			firstErr error
+		)
+		runPool(ctx, workers, pending, func(ctx context.Context, p string) {
+			var keys []interface{}
+			err := s.withRetry(ctx, "list", func() error {
+				if err := limiter.Wait(ctx); err != nil {
+					return err
+				}
+				l, err := client.List(ctx, prefix+p, vault.WithMountPath(mount))
+				if err != nil {
+					return err
+				}
+				keys, _ = l.Data["keys"].([]interface{})
+				return nil
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if vault.IsErrorStatus(err, 404) {
+				return
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to list %s: %w", mount+"/"+p, err)
+				}
+				return
+			}
+			for _, k := range keys {
+				k, _ := k.(string)
+				if strings.HasSuffix(k, "/") {
+					next = append(next, p+k)
+					continue
+				}
+				total++
+			}
+		})
+		if firstErr != nil {
+			return total, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		pending = next
+	}
+	return total, nil
+}
+
+// listPolicies lists the ACL policy names of a vault, sorted.
+func (s *Syncer) listPolicies(ctx context.Context, client *vault.Client, limiter *rate.Limiter) ([]string, error) {
+	var names []string
+	err := s.withRetry(ctx, "list policies", func() error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := client.System.PoliciesListAclPolicies(ctx)
+		if err != nil {
+			return err
+		}
+		names = resp.Data.Keys
+		if len(names) == 0 {
+			names = resp.Data.Policies
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,656 @@
+package vaultsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type (
+	// Config is the sync configuration. Its mapstructure tags match the hvm
+	// config file, so NewConfig can load it from viper; library users may
+	// also fill it in directly and check it with Validate.
+	Config struct {
+		BatchSize        int              `mapstructure:"batchSize"`
+		StateDir         string           `mapstructure:"stateDir"`
+		Resume           bool             `mapstructure:"resume"`
+		SourceVault      *Vault           `mapstructure:"srcVault"`
+		DestinationVault *Vault           `mapstructure:"destVault"`
+		Timeouts         Timeouts         `mapstructure:"timeouts"`
+		Retry            Retry            `mapstructure:"retry"`
+		CircuitBreaker   CircuitBreaker   `mapstructure:"circuitBreaker"`
+		RateLimit        RateLimit        `mapstructure:"rateLimit"`
+		Concurrency      Concurrency      `mapstructure:"concurrency"`
+		Resources        Resources        `mapstructure:"resources"`
+		SchemaValidation SchemaValidation `mapstructure:"schemaValidation"`
+		Checksums        Checksums        `mapstructure:"checksums"`
+		Transforms       Transforms       `mapstructure:"transforms"`
+		SlackApproval    SlackApproval    `mapstructure:"slackApproval"`
+		Alerts           Alerts           `mapstructure:"alerts"`
+		Notifications    []Notification   `mapstructure:"notifications"`
+		Chunking         Chunking         `mapstructure:"chunking"`
+		History          History          `mapstructure:"history"`
+		Bidirectional    Bidirectional    `mapstructure:"bidirectional"`
+		Diff             Diff             `mapstructure:"diff"`
+		Metrics          MetricsConfig    `mapstructure:"metrics"`
+		Tokens           Tokens           `mapstructure:"tokens"`
+		AzureKeyVault    AzureKeyVault    `mapstructure:"azureKeyVault"`
+		Kubernetes       Kubernetes       `mapstructure:"kubernetes"`
+		Consul           Consul           `mapstructure:"consul"`
+		Etcd             Etcd             `mapstructure:"etcd"`
+		OnePassword      OnePassword      `mapstructure:"onePassword"`
+		Bitwarden        Bitwarden        `mapstructure:"bitwarden"`
+		GitOps           GitOps           `mapstructure:"gitOps"`
+
+		// OnConflict decides what happens when a destination secret already
+		// exists and differs from the source: "overwrite" (the default)
+		// writes a new version, "skip" leaves it, "fail" fails the secret,
+		// and "newer" only overwrites it if the source was updated more
+		// recently.
+		OnConflict string `mapstructure:"onConflict"`
+		// OnReplicated detects mounts that Vault performance replication
+		// already copies from the source to the destination vault and
+		// either "warn"s and syncs them anyway or "skip"s them. Empty
+		// disables detection.
+		OnReplicated string `mapstructure:"onReplicated"`
+		// ForceWrite writes every secret to the destination vault, even one
+		// that already holds the same data. By default each destination
+		// secret is read first and identical ones are left unchanged, so
+		// re-runs do not add versions.
+		ForceWrite bool `mapstructure:"forceWrite"`
+		// MetadataOnly syncs only the KV metadata of each secret, its
+		// custom_metadata, max_versions, cas_required, and
+		// delete_version_after, to destination secrets that already exist,
+		// such as after the data was migrated by other means. Secrets
+		// missing on the destination are skipped. Both vaults must be KV v2.
+		MetadataOnly bool `mapstructure:"metadataOnly"`
+
+		// AllKVMounts syncs every KV v2 mount on the source vault to the
+		// mount of the same name on the destination, instead of the
+		// configured mount and path.
+		AllKVMounts bool `mapstructure:"allKVMounts"`
+		// CreateMissingMounts creates destination mounts that do not exist
+		// before syncing to them, with the source mount's type, version,
+		// and description. Without it a missing mount stops the run.
+		CreateMissingMounts bool `mapstructure:"createMissingMounts"`
+		// MaxDuration bounds the whole run, e.g. to a maintenance window.
+		// Once it has passed no more secrets are started, those in flight
+		// are finished, and the sync stops with ErrMaxDuration and a
+		// partial report. Zero means no limit.
+		MaxDuration time.Duration `mapstructure:"maxDuration"`
+		// FailFast stops the whole run at the first secret that fails,
+		// cancelling those in flight, and returns ErrFailFast. The partial
+		// run is saved so it can be resumed once the failure is fixed.
+		FailFast bool `mapstructure:"failFast"`
+		// MaxErrors stops the run, like FailFast, once more secrets have
+		// failed than it allows: a count such as "50", or a percentage of
+		// the secrets found such as "5%". Empty means no limit.
+		MaxErrors string `mapstructure:"maxErrors"`
+		// Ordered syncs the secrets of each path one at a time in
+		// lexicographic order, each batch only after the one before it, so
+		// runs are reproducible and their logs and resume points line up.
+		// It trades the concurrency of BatchSize for that.
+		Ordered bool `mapstructure:"ordered"`
+		// MetadataFilter syncs only the secrets whose custom_metadata
+		// matches, so owners can opt secrets in or out in Vault itself.
+		MetadataFilter MetadataFilter `mapstructure:"metadataFilter"`
+		// Shard has this instance sync only its slice of the secrets, so a
+		// huge migration can be split between several instances.
+		Shard Shard `mapstructure:"shard"`
+		// Prune makes the destination match the source after a sync.
+		Prune SyncPrune `mapstructure:"prune"`
+
+		// AuditLog appends a JSON line for every secret hvm writes or
+		// deletes to a file, for compliance evidence.
+		AuditLog AuditLog `mapstructure:"auditLog"`
+	}
+
+	// MetadataFilter selects source secrets by their KV v2 custom_metadata,
+	// e.g. only those with team=payments, or none with migrate=false. A
+	// secret is synced if it matches every Include rule and no Exclude
+	// rule. Secrets filtered out are skipped and left alone on the
+	// destination, even by prune. Filtering reads each secret's metadata,
+	// one more request per secret, and requires a KV v2 source vault.
+	MetadataFilter struct {
+		Include []MetadataRule `mapstructure:"include"`
+		Exclude []MetadataRule `mapstructure:"exclude"`
+	}
+
+	// MetadataRule matches a secret whose custom_metadata has Key set to
+	// Value, or set at all if Value is empty.
+	MetadataRule struct {
+		Key   string `mapstructure:"key"`
+		Value string `mapstructure:"value"`
+	}
+
+	// Shard splits the secrets of every path between Total instances by a
+	// hash of their source path; the instance with Index, from 0 to
+	// Total-1, syncs only the secrets that hash to it. Every instance must
+	// use the same Total. A Total of 0 or 1 disables sharding.
+	Shard struct {
+		Index int `mapstructure:"index"`
+		Total int `mapstructure:"total"`
+	}
+
+	// SyncPrune deletes the destination secrets that no source secret maps
+	// to once a sync has finished, below the destination folders the
+	// synced secrets were written to, so the destination ends up holding
+	// exactly what the source does. Nothing is
+	// deleted if any secret failed or the source has no secrets at all.
+	// With Destroy the metadata and every version are removed instead of
+	// soft-deleting the current version.
+	SyncPrune struct {
+		Enabled bool `mapstructure:"enabled"`
+		Destroy bool `mapstructure:"destroy"`
+	}
+
+	// GitOps reads secrets from a directory of SOPS-encrypted YAML files,
+	// such as a git checkout, instead of the source vault, making hvm the
+	// write path for a git-managed vault. Each file is one secret at its
+	// path relative to Dir without the .yaml or .yml extension, holding the
+	// file's decrypted top-level keys. Files are decrypted with the sops
+	// binary at SopsPath ("sops" on the PATH by default), using the age key
+	// in AgeKeyFile if set, or whatever keys sops finds itself. Unencrypted
+	// files are rejected. Pair it with prune to delete secrets whose files
+	// were removed.
+	GitOps struct {
+		Enabled    bool   `mapstructure:"enabled"`
+		Dir        string `mapstructure:"dir"`
+		SopsPath   string `mapstructure:"sopsPath"`
+		AgeKeyFile string `mapstructure:"ageKeyFile"`
+	}
+
+	// OnePassword reads items from a 1Password Connect server instead of the
+	// source vault. The first level of the source path is a vault name and
+	// the second an item title, and FieldMap renames item fields (username,
+	// password, notes, url, or a field label) to secret keys. The host and
+	// token default to OP_CONNECT_HOST and OP_CONNECT_TOKEN.
+	OnePassword struct {
+		Enabled     bool              `mapstructure:"enabled"`
+		ConnectHost string            `mapstructure:"connectHost"`
+		Token       string            `mapstructure:"token"`
+		FieldMap    map[string]string `mapstructure:"fieldMap"`
+	}
+
+	// Bitwarden reads items from a Bitwarden or Vaultwarden vault through
+	// `bw serve`, which must be logged in and unlocked. The first level of
+	// the source path is a folder name ("No Folder" for unfiled items) and
+	// the second an item name; FieldMap works as it does for OnePassword.
+	Bitwarden struct {
+		Enabled  bool              `mapstructure:"enabled"`
+		ServeURL string            `mapstructure:"serveURL"`
+		FieldMap map[string]string `mapstructure:"fieldMap"`
+	}
+
+	// Etcd reads secrets from etcd v3 instead of the source vault, through
+	// its JSON gateway. Keys beginning with Prefix map to vault paths
+	// relative to the source mount, with each Separator in a key becoming a
+	// "/" in the path; the transforms can rewrite paths further. Mode and
+	// ValueField work as they do for Consul.
+	Etcd struct {
+		Enabled    bool     `mapstructure:"enabled"`
+		Endpoints  []string `mapstructure:"endpoints"`
+		Username   string   `mapstructure:"username"`
+		Password   string   `mapstructure:"password"`
+		CAFile     string   `mapstructure:"caFile"`
+		CertFile   string   `mapstructure:"certFile"`
+		KeyFile    string   `mapstructure:"keyFile"`
+		Prefix     string   `mapstructure:"prefix"`
+		Separator  string   `mapstructure:"separator"`
+		Mode       string   `mapstructure:"mode"`
+		ValueField string   `mapstructure:"valueField"`
+	}
+
+	// Consul reads secrets from Consul KV instead of the source vault. Keys
+	// under Prefix map to vault paths relative to the source mount, and the
+	// source path selects the folder beneath Prefix to sync. In "folder" mode
+	// (the default) the flat keys directly under a folder become the fields of
+	// one secret at the folder's path; in "key" mode each key becomes its own
+	// secret, holding the key's JSON object value or its raw value under
+	// ValueField. Keys under any of ExcludePrefixes are skipped. The token
+	// defaults to the CONSUL_HTTP_TOKEN environment variable.
+	Consul struct {
+		Enabled         bool     `mapstructure:"enabled"`
+		Address         string   `mapstructure:"addr"`
+		Token           string   `mapstructure:"token"`
+		Datacenter      string   `mapstructure:"datacenter"`
+		Prefix          string   `mapstructure:"prefix"`
+		ExcludePrefixes []string `mapstructure:"excludePrefixes"`
+		Mode            string   `mapstructure:"mode"`
+		ValueField      string   `mapstructure:"valueField"`
+	}
+
+	// Kubernetes writes secrets as Kubernetes Secrets instead of to the
+	// destination vault. Inside a pod the API server, token, and CA default
+	// to the pod's service account. Each secret goes to the namespace of the
+	// first matching NamespaceRule, or to Namespace. Labels and Annotations
+	// are text/template strings rendered with .Path, .Namespace, and .Name.
+	Kubernetes struct {
+		Enabled         bool                 `mapstructure:"enabled"`
+		APIServer       string               `mapstructure:"apiServer"`
+		TokenFile       string               `mapstructure:"tokenFile"`
+		CAFile          string               `mapstructure:"caFile"`
+		Namespace       string               `mapstructure:"namespace"`
+		NamespaceRules  []NamespaceRule      `mapstructure:"namespaceRules"`
+		Labels          map[string]string    `mapstructure:"labels"`
+		Annotations     map[string]string    `mapstructure:"annotations"`
+		OwnerReferences []KubernetesOwnerRef `mapstructure:"ownerReferences"`
+	}
+
+	// NamespaceRule sends secrets whose destination path matches the Match
+	// regular expression to Namespace, which may reference capture groups ($1).
+	NamespaceRule struct {
+		Match     string `mapstructure:"match"`
+		Namespace string `mapstructure:"namespace"`
+	}
+
+	// KubernetesOwnerRef is an owner reference set on every Secret written,
+	// so the Secrets are garbage collected with their owner.
+	KubernetesOwnerRef struct {
+		APIVersion string `mapstructure:"apiVersion"`
+		Kind       string `mapstructure:"kind"`
+		Name       string `mapstructure:"name"`
+		UID        string `mapstructure:"uid"`
+		Controller bool   `mapstructure:"controller"`
+	}
+
+	// AzureKeyVault writes secrets to an Azure Key Vault instead of the
+	// destination vault. Mode is "blob" (the default) to store each secret
+	// as a JSON object, or "field" to store each field as its own Key Vault
+	// secret. Credentials default to the AZURE_TENANT_ID, AZURE_CLIENT_ID,
+	// and AZURE_CLIENT_SECRET environment variables.
+	AzureKeyVault struct {
+		Enabled      bool   `mapstructure:"enabled"`
+		VaultURL     string `mapstructure:"vaultURL"`
+		TenantID     string `mapstructure:"tenantID"`
+		ClientID     string `mapstructure:"clientID"`
+		ClientSecret string `mapstructure:"clientSecret"`
+		Mode         string `mapstructure:"mode"`
+	}
+
+	// Tokens configures token validation and renewal. Both vault tokens are
+	// looked up at startup and every CheckInterval (5m by default) during a
+	// sync. A renewable token whose TTL would run out before the next check
+	// but one is renewed by RenewIncrement (the token's own default if
+	// zero), and a token from tokenCmd or tokenFile that cannot be renewed
+	// is fetched again, unless DisableRenewal is set.
+	Tokens struct {
+		CheckInterval  time.Duration `mapstructure:"checkInterval"`
+		DisableRenewal bool          `mapstructure:"disableRenewal"`
+		RenewIncrement time.Duration `mapstructure:"renewIncrement"`
+	}
+
+	// MetricsConfig serves Prometheus metrics on ListenAddr. Labels picks
+	// which of "job", "mount", and "folder" are attached to per-secret
+	// metrics; none are by default. The folder label holds the first
+	// FolderDepth folders below the sync path (1 by default), and folders
+	// beyond the first MaxFolders (100 by default) are reported as "other"
+	// to bound the number of series.
+	MetricsConfig struct {
+		ListenAddr  string   `mapstructure:"listenAddr"`
+		Job         string   `mapstructure:"job"`
+		Labels      []string `mapstructure:"labels"`
+		FolderDepth int      `mapstructure:"folderDepth"`
+		MaxFolders  int      `mapstructure:"maxFolders"`
+	}
+
+	// Diff configures the read-only comparison engine used by drift checks.
+	// It has its own worker count and rate limits so a diff can run
+	// alongside, or far faster than, a sync. Workers defaults to BatchSize
+	// and a QPS of zero means unlimited.
+	Diff struct {
+		Workers          int     `mapstructure:"workers"`
+		SourceQPS        float64 `mapstructure:"sourceQPS"`
+		SourceBurst      int     `mapstructure:"sourceBurst"`
+		DestinationQPS   float64 `mapstructure:"destinationQPS"`
+		DestinationBurst int     `mapstructure:"destinationBurst"`
+	}
+
+	// Bidirectional syncs in both directions between two vaults that are
+	// both written to. Each secret is copied from whichever vault changed
+	// it since they last held the same data, judged by comparing KV v2
+	// versions with those recorded in the state directory. When both
+	// changed, or the secret differs on its first run, Conflict decides:
+	// "newer" (the default) keeps the most recently written side, "source"
+	// or "destination" always keeps that side, "skip" leaves both alone,
+	// and "fail" fails the secret. Deletions are not propagated.
+	Bidirectional struct {
+		Enabled  bool   `mapstructure:"enabled"`
+		Conflict string `mapstructure:"conflict"`
+	}
+
+	// History replays every retained version of each KV v2 secret, oldest
+	// first, instead of copying only the current version. Deleted and
+	// destroyed source versions are deleted or destroyed on the destination.
+	History struct {
+		Enabled bool `mapstructure:"enabled"`
+	}
+
+	// Chunking splits secrets whose JSON encoding exceeds MaxBytes into
+	// several chunk secrets, leaving a manifest at the original path.
+	Chunking struct {
+		Enabled  bool `mapstructure:"enabled"`
+		MaxBytes int  `mapstructure:"maxBytes"`
+	}
+
+	// SlackApproval posts the sync plan to a Slack channel and waits for
+	// someone to approve or reject it before writing anything. ListenAddr
+	// serves the Slack app's interactivity request URL.
+	SlackApproval struct {
+		Enabled       bool          `mapstructure:"enabled"`
+		BotToken      string        `mapstructure:"botToken"`
+		Channel       string        `mapstructure:"channel"`
+		SigningSecret string        `mapstructure:"signingSecret"`
+		ListenAddr    string        `mapstructure:"listenAddr"`
+		Approvers     []string      `mapstructure:"approvers"`
+		Timeout       time.Duration `mapstructure:"timeout"`
+	}
+
+	// Transforms rewrites secrets between the source and the destination.
+	// Rules of each kind are applied in order: paths, then path templates,
+	// keys, KeyCase, values, and finally Inject.
+	Transforms struct {
+		Paths         []PathRule     `mapstructure:"paths"`
+		PathTemplates []PathTemplate `mapstructure:"pathTemplates"`
+		Keys          []KeyRule      `mapstructure:"keys"`
+		Values        []ValueRule    `mapstructure:"values"`
+		// KeyCase converts every key to "upper" or "lower" case after the
+		// key rules. Empty leaves keys as they are.
+		KeyCase string `mapstructure:"keyCase"`
+		// Inject adds static fields to every secret, replacing keys of the
+		// same name, e.g. migrated_by.
+		Inject []InjectRule `mapstructure:"inject"`
+	}
+
+	// InjectRule adds the field Key with the string Value. It is a list
+	// rather than a map because config file map keys are case-insensitive.
+	InjectRule struct {
+		Key   string `mapstructure:"key"`
+		Value string `mapstructure:"value"`
+	}
+
+	// PathRule replaces matches of the Match regular expression in the
+	// secret path with Replace, which may reference capture groups ($1).
+	PathRule struct {
+		Match   string `mapstructure:"match"`
+		Replace string `mapstructure:"replace"`
+	}
+
+	// PathTemplate rewrites secret paths matching the optional Match regular
+	// expression with the Go text/template Template, e.g.
+	// "{{ .Env }}/{{ .Rest }}". The template sees the named groups of Match,
+	// like (?P<Env>[^/]+), alongside Mount, Path, Dir, Base, and Segments,
+	// and can use the lower, upper, replace, trimPrefix, trimSuffix, and join
+	// functions. Empty segments in the result are dropped.
+	PathTemplate struct {
+		Match    string `mapstructure:"match"`
+		Template string `mapstructure:"template"`
+	}
+
+	// KeyRule renames secret keys matching the Match regular expression to
+	// Rename (which may reference capture groups), or drops them.
+	KeyRule struct {
+		Match  string `mapstructure:"match"`
+		Rename string `mapstructure:"rename"`
+		Drop   bool   `mapstructure:"drop"`
+	}
+
+	// ValueRule replaces matches of Match with Replace in the string values
+	// of keys matching the Key regular expression.
+	ValueRule struct {
+		Key     string `mapstructure:"key"`
+		Match   string `mapstructure:"match"`
+		Replace string `mapstructure:"replace"`
+	}
+
+	// Checksums maintains per-folder rollup hashes in the destination vault
+	// under Path (".hvm/checksums" by default), so drift detection can
+	// compare folder hashes instead of every secret.
+	Checksums struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Path    string `mapstructure:"path"`
+	}
+
+	// SchemaValidation validates secret data against JSON Schemas before it
+	// is written to the destination. Mode is either "warn" (the default) or
+	// "enforce".
+	SchemaValidation struct {
+		Mode  string       `mapstructure:"mode"`
+		Rules []SchemaRule `mapstructure:"rules"`
+	}
+
+	// SchemaRule attaches a JSON Schema file to every secret whose path
+	// matches Pattern (see path.Match).
+	SchemaRule struct {
+		Pattern string `mapstructure:"pattern"`
+		Schema  string `mapstructure:"schema"`
+	}
+
+	// Resources constrains the process running the sync. When a memory limit
+	// is set the Syncer shrinks its batch size as usage approaches it.
+	Resources struct {
+		MaxProcs    int    `mapstructure:"maxProcs"`
+		MemoryLimit string `mapstructure:"memoryLimit"`
+	}
+
+	// RateLimit caps the request rate against each vault independently.
+	// ReadQPS applies to the source vault and WriteQPS to the destination
+	// vault, including read-back verification. Zero means unlimited.
+	RateLimit struct {
+		ReadQPS    float64 `mapstructure:"readQPS"`
+		ReadBurst  int     `mapstructure:"readBurst"`
+		WriteQPS   float64 `mapstructure:"writeQPS"`
+		WriteBurst int     `mapstructure:"writeBurst"`
+	}
+
+	// AuditLog is where the record of every write and delete is appended.
+	// An empty Path disables it.
+	AuditLog struct {
+		Path string `mapstructure:"path"`
+	}
+
+	// Concurrency caps the number of concurrent requests of each kind,
+	// independently of BatchSize, the number of secrets in flight.
+	// ListWorkers lists folders in parallel when listing recursively,
+	// ReadWorkers caps concurrent reads of source secrets, and WriteWorkers
+	// caps concurrent writes of destination secrets. Zero means BatchSize.
+	Concurrency struct {
+		ListWorkers  int `mapstructure:"listWorkers"`
+		ReadWorkers  int `mapstructure:"readWorkers"`
+		WriteWorkers int `mapstructure:"writeWorkers"`
+	}
+
+	// Retry configures how transient read/write errors are retried.
+	// A MaxAttempts of 0 or 1 disables retries.
+	Retry struct {
+		MaxAttempts int           `mapstructure:"maxAttempts"`
+		BaseDelay   time.Duration `mapstructure:"baseDelay"`
+		MaxDelay    time.Duration `mapstructure:"maxDelay"`
+		Jitter      bool          `mapstructure:"jitter"`
+	}
+
+	// Alerts posts to a Slack incoming webhook, a generic webhook taking a
+	// JSON body, or both, when hvm serve finds the destination drifted by
+	// more than DriftThreshold secrets (changed, missing, or extra) and
+	// again once it is back within it, and when a sync it runs fails. The
+	// drift check runs every DriftCheckInterval; zero disables it.
+	Alerts struct {
+		SlackWebhookURL    string        `mapstructure:"slackWebhookURL"`
+		WebhookURL         string        `mapstructure:"webhookURL"`
+		DriftThreshold     int           `mapstructure:"driftThreshold"`
+		DriftCheckInterval time.Duration `mapstructure:"driftCheckInterval"`
+	}
+
+	// Notification sends the summary of every finished run of the job
+	// whose outcome matches On to one channel: Type "email" mails it over
+	// SMTP, "pagerduty" triggers a PagerDuty incident on failure and
+	// resolves it on success (so On should be NotifyAlways), and "webhook"
+	// posts it as JSON. Each job's config lists its own notifications.
+	Notification struct {
+		Type string `mapstructure:"type"`
+		// On is NotifyFailure (the default), NotifySuccess, NotifyChanges,
+		// or NotifyAlways.
+		On        string                `mapstructure:"on"`
+		Email     EmailNotification     `mapstructure:"email"`
+		PagerDuty PagerDutyNotification `mapstructure:"pagerDuty"`
+		Webhook   WebhookNotification   `mapstructure:"webhook"`
+	}
+
+	// EmailNotification mails run summaries From an address To others
+	// through the SMTP server at Host:Port (587 by default), signing in
+	// with Username and Password if set.
+	EmailNotification struct {
+		Host     string   `mapstructure:"host"`
+		Port     int      `mapstructure:"port"`
+		Username string   `mapstructure:"username"`
+		Password string   `mapstructure:"password"`
+		From     string   `mapstructure:"from"`
+		To       []string `mapstructure:"to"`
+	}
+
+	// PagerDutyNotification sends run summaries to the PagerDuty Events API
+	// v2 service with RoutingKey, at Severity ("error" by default).
+	PagerDutyNotification struct {
+		RoutingKey string `mapstructure:"routingKey"`
+		Severity   string `mapstructure:"severity"`
+	}
+
+	// WebhookNotification posts run summaries as JSON to URL.
+	WebhookNotification struct {
+		URL string `mapstructure:"url"`
+	}
+
+	// CircuitBreaker pauses writes to the destination vault once Threshold
+	// secrets in a row (5 by default) have failed against it with
+	// transient errors, such as a sealed or unreachable vault, instead of
+	// failing every remaining secret. The vault's health is checked every
+	// CheckInterval (10s by default) and writes resume once it is unsealed.
+	CircuitBreaker struct {
+		Enabled       bool          `mapstructure:"enabled"`
+		Threshold     int           `mapstructure:"threshold"`
+		CheckInterval time.Duration `mapstructure:"checkInterval"`
+	}
+
+	// Timeouts bounds how long each stage of a sync may run. A zero value
+	// leaves the stage unbounded. When the copy stage starts on the keys
+	// as they are listed, the listing runs alongside it and is bounded by
+	// both Discovery and Copy.
+	Timeouts struct {
+		Discovery time.Duration `mapstructure:"discovery"`
+		Copy      time.Duration `mapstructure:"copy"`
+		Verify    time.Duration `mapstructure:"verify"`
+	}
+
+	// RequestTimeouts bounds the HTTP requests of each kind of operation
+	// against a vault: List for listings, Read for other GETs, and Write
+	// for requests that change data. Zero falls back to RequestTimeout. For
+	// a listing streamed to the copy stage, List bounds only the wait for
+	// the response, not reading it.
+	RequestTimeouts struct {
+		List  time.Duration `mapstructure:"list"`
+		Read  time.Duration `mapstructure:"read"`
+		Write time.Duration `mapstructure:"write"`
+	}
+
+	// MountPath is one mount and path synced by a multi-mount run.
+	// DestMount and DestPath move its secrets to another mount or folder on
+	// the destination vault; by default they keep their mount and path.
+	// Path rules do not apply to a pair with DestPath.
+	MountPath struct {
+		Mount     string `mapstructure:"mount"`
+		Path      string `mapstructure:"path"`
+		DestMount string `mapstructure:"destMount"`
+		DestPath  string `mapstructure:"destPath"`
+	}
+
+	// Vault is how to reach one vault and which mount and path to sync.
+	Vault struct {
+		// Address is the vault's URL, or unix:// and the path of a socket,
+		// such as a Vault Agent or proxy listener.
+		Address  string `mapstructure:"addr"`
+		Token    string `mapstructure:"token"`
+		TokenCmd string `mapstructure:"tokenCmd"`
+		// TokenFile is a file holding the token, such as ~/.vault-token or
+		// a Vault Agent sink. Like TokenCmd, it is read again when vault
+		// rejects the token.
+		TokenFile string `mapstructure:"tokenFile"`
+		// TokenKeyring names an entry in the OS keyring holding the token,
+		// as stored by hvm init --keyring. Like TokenFile, it is read again
+		// when vault rejects the token.
+		TokenKeyring string `mapstructure:"tokenKeyring"`
+		// WrappedToken treats the token as a response-wrapping token, which
+		// is unwrapped via sys/wrapping/unwrap for the real client token. A
+		// wrapping token can only be unwrapped once, so a reloaded TokenCmd
+		// or TokenFile must hand out a freshly wrapped one.
+		WrappedToken bool   `mapstructure:"wrappedToken"`
+		Mount        string `mapstructure:"mount"`
+		Path         string `mapstructure:"path"`
+		// Mounts makes a sync migrate several mount and path pairs in one
+		// run, one after the other, instead of Mount and Path. It is only
+		// read from srcVault, and other commands still use Mount and Path.
+		Mounts []MountPath `mapstructure:"mounts"`
+		// KVVersion pins the KV version, 1 or 2, of the vault's mounts
+		// instead of detecting it, for tokens that cannot read
+		// sys/internal/ui/mounts.
+		KVVersion int `mapstructure:"kvVersion"`
+
+		// Namespace is the vault enterprise namespace requests are made in.
+		Namespace string `mapstructure:"namespace"`
+		// CACert is a PEM file of CA certificates to trust for Address.
+		CACert string `mapstructure:"caCert"`
+		// Proxy is an http, https, or socks5 proxy URL requests to the vault
+		// are sent through, such as a bastion host. It overrides the
+		// HTTPS_PROXY, HTTP_PROXY, and NO_PROXY environment variables.
+		Proxy string `mapstructure:"proxy"`
+
+		// FallbackAddresses are tried in order when Address cannot be
+		// reached, e.g. other cluster nodes or regional endpoints. Every
+		// address is health checked each HealthCheckInterval (10s by
+		// default) and brought back into rotation once it recovers.
+		FallbackAddresses   []string      `mapstructure:"fallbackAddrs"`
+		HealthCheckInterval time.Duration `mapstructure:"healthCheckInterval"`
+
+		// RequestTimeout bounds every HTTP request to the vault, so a hung
+		// node fails the request instead of stalling its worker; timed out
+		// requests are retried like other transient errors. Zero keeps the
+		// vault client's default of 60s. RequestTimeouts overrides it for
+		// each kind of operation.
+		RequestTimeout  time.Duration   `mapstructure:"requestTimeout"`
+		RequestTimeouts RequestTimeouts `mapstructure:"requestTimeouts"`
+
+		// BatchToken exchanges the configured service token for a batch token
+		// before any requests are made.
+		BatchToken    bool   `mapstructure:"batchToken"`
+		BatchTokenTTL string `mapstructure:"batchTokenTTL"`
+
+		// Replica marks the vault as a performance secondary or read replica.
+		// hvm never writes to the source vault; marking it as a replica also
+		// rejects settings that would, such as BatchToken.
+		Replica bool `mapstructure:"replica"`
+		// Forwarding controls whether performance standbys forward requests
+		// to the active node: "none" (the default), "always", or "inconsistent".
+		Forwarding string `mapstructure:"forwarding"`
+	}
+)
+
+// NewConfig unmarshals a Config from viper and applies ApplyVaultEnv.
+//
+// Arguments:
+//
+//	v: *viper.Viper - The loaded configuration.
+//
+// Returns:
+//
+//	*Config - The sync configuration.
+//	error - An error if the configuration could not be unmarshalled.
+func NewConfig(v *viper.Viper) (*Config, error) {
+	c := new(Config)
+
+	if err := v.Unmarshal(c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	c.ApplyVaultEnv()
+
+	return c, nil
+}
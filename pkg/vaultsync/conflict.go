@@ -0,0 +1,105 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// ConflictOverwrite writes the source secret over the destination.
+	ConflictOverwrite = "overwrite"
+	// ConflictNewer keeps whichever side was written most recently.
+	ConflictNewer = "newer"
+	// ConflictSource always keeps the source vault's secret.
+	ConflictSource = "source"
+	// ConflictDestination always keeps the destination vault's secret.
+	ConflictDestination = "destination"
+	// ConflictSkip leaves the destination as it is.
+	ConflictSkip = "skip"
+	// ConflictFail fails the secret.
+	ConflictFail = "fail"
+)
+
+// compareDestination reads the destination secret before it is written.
+// A secret that already holds the same data is left alone, so re-runs do
+// not create new versions, and the OnConflict strategy is applied to one
+// that differs.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of both vaults.
+//	path: string - The source path of the secret.
+//	srcData: map[string]interface{} - The source secret data.
+//
+// Returns:
+//
+//	Action - ActionUnchanged, ActionSkipped, or ActionFailed if the secret must not be written, or "" to write it.
+//	error - An error if the destination could not be compared, or the conflict under the "fail" strategy.
+func (s *Syncer) compareDestination(ctx context.Context, mount, path string, srcData map[string]interface{}) (Action, error) {
+	destPath, expected, err := s.transformer.Transform(path, srcData)
+	if err != nil {
+		// writeDestination reports the failure.
+		return "", nil
+	}
+	s.syncedMu.Lock()
+	s.desired[destPath] = true
+	s.syncedMu.Unlock()
+
+	dst, err := s.readVersioned(ctx, s.destinationVault, s.writeLimiter, s.destMount(mount), destPath)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to get secret from destination vault")
+		return ActionFailed, fmt.Errorf("failed to read secret from destination vault: %w", err)
+	}
+	if dst == nil {
+		return "", nil
+	}
+	if dst.data, err = s.reassemble(ctx, s.writeLimiter, s.destMount(mount), destPath, dst.data); err != nil {
+		return ActionFailed, fmt.Errorf("failed to reassemble destination secret: %w", err)
+	}
+
+	srcSum, err := s.checksum(expected)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to checksum source secret: %w", err)
+	}
+	dstSum, err := s.checksum(dst.data)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to checksum destination secret: %w", err)
+	}
+	if srcSum == dstSum {
+		if err := s.recordSynced(path, destPath, expected); err != nil {
+			return ActionFailed, err
+		}
+		s.log.Debug().Str("secret", path).Msg("Destination secret is identical, not writing")
+		return ActionUnchanged, nil
+	}
+
+	strategy := s.cfg.OnConflict
+	if strategy == "" || strategy == ConflictOverwrite {
+		return "", nil
+	}
+	s.report.conflict(path, strategy)
+	s.log.Debug().Str("secret", path).Str("strategy", strategy).Msg("Destination secret differs")
+
+	switch strategy {
+	case ConflictSkip:
+		return ActionSkipped, nil
+	case ConflictFail:
+		return ActionFailed, fmt.Errorf("destination secret already exists and differs")
+	}
+
+	meta, err := s.readMetadata(ctx, mount, path)
+	if err != nil {
+		return ActionFailed, err
+	}
+	updated, err := time.Parse(time.RFC3339Nano, meta.UpdatedTime)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to parse source updated_time %q: %w", meta.UpdatedTime, err)
+	}
+	if dst.created.After(updated) {
+		s.log.Debug().Str("secret", path).Msg("Destination secret is newer, not overwriting")
+		return ActionSkipped, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,158 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// copyTransformer applies the configured transformer to secret data but
+// moves secrets from one path to another instead of rewriting their paths.
+type copyTransformer struct {
+	Transformer
+	from, to string
+}
+
+// Transform transforms data and replaces the from prefix of path with to.
+func (c copyTransformer) Transform(path string, data map[string]interface{}) (string, map[string]interface{}, error) {
+	_, data, err := c.Transformer.Transform(path, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.to + strings.TrimPrefix(path, c.from), data, nil
+}
+
+// Copy copies a single secret, or every secret directly under a folder, from
+// src on the source to dst on the destination, regardless of the configured
+// paths. A path ending in "/" is a folder. Key and value transforms, schema
+// validation, hooks, and conflict handling apply as they do in a sync, but
+// path rules do not.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	src: string - The source path, relative to the source mount.
+//	dst: string - The destination path, or empty for the same path as src.
+//
+// Returns:
+//
+//	*Report - The outcome of every secret copied.
+//	error - An error if the folder could not be listed, the copy was aborted, or any secret failed.
+func (s *Syncer) Copy(ctx context.Context, src, dst string) (*Report, error) {
+	ctx, span := s.tracer.Start(ctx, "copy")
+	defer span.End()
+
+	if s.cfg.Bidirectional.Enabled {
+		return nil, fmt.Errorf("copy cannot be used with bidirectional sync")
+	}
+	src = strings.TrimPrefix(src, "/")
+	if dst == "" {
+		dst = src
+	}
+	dst = strings.TrimPrefix(dst, "/")
+	if strings.HasSuffix(src, "/") != strings.HasSuffix(dst, "/") {
+		return nil, fmt.Errorf("%q and %q must both be folders ending in / or both be secrets", src, dst)
+	}
+
+	mount := s.cfg.SourceVault.Mount
+	s.report = newReport(mount, src)
+	s.resetSynced()
+	s.log.Info().Str("mount", mount).Str("source", src).Str("destination", dst).Msg("Starting copy")
+
+	paths := []string{src}
+	if strings.HasSuffix(src, "/") {
+		keys, err := s.listSourcePath(ctx, mount, src)
+		if err != nil {
+			return s.report, err
+		}
+		paths = paths[:0]
+		for _, k := range keys {
+			if !strings.HasSuffix(k, "/") {
+				paths = append(paths, src+k)
+			}
+		}
+	}
+
+	transformer := s.transformer
+	s.transformer = copyTransformer{Transformer: transformer, from: src, to: dst}
+	defer func() { s.transformer = transformer }()
+
+	if err := s.syncPaths(ctx, mount, paths, "copy"); err != nil {
+		return s.report, err
+	}
+
+	s.log.Info().Int("created", s.report.Created).Int("updated", s.report.Updated).Int("unchanged", s.report.Unchanged).Msg("Copy complete")
+	return s.report, nil
+}
+
+// syncPaths syncs the given source paths into s.report, verifies them, and
+// finishes the report.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of both vaults.
+//	paths: []string - The source paths of the secrets.
+//	op: string - The name of the operation, for errors.
+//
+// Returns:
+//
+//	error - An error if the operation was aborted or any secret failed.
+func (s *Syncer) syncPaths(ctx context.Context, mount string, paths []string, op string) error {
+	runPool(ctx, s.cfg.BatchSize, paths, func(ctx context.Context, path string) {
+		start := time.Now()
+		action, err := s.syncSecret(ctx, mount, path)
+		action, err = s.outcomeHooks(ctx, mount, path, action, err)
+		s.report.record(path, action, err, time.Since(start))
+	})
+	if err := ctx.Err(); err != nil {
+		s.report.finish()
+		return fmt.Errorf("%s aborted: %w", op, err)
+	}
+
+	if err := s.verify(ctx, mount); err != nil {
+		s.report.finish()
+		return fmt.Errorf("verification aborted: %w", err)
+	}
+	s.report.Verified = true
+
+	s.report.finish()
+	return s.report.err()
+}
+
+// SyncPaths syncs exactly the given source secrets, as a sync of the
+// configured path would, e.g. a selection made in the TUI. Folders are not
+// expanded; List them recursively first.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	paths: []string - The source paths of the secrets, relative to the source mount.
+//
+// Returns:
+//
+//	*Report - The outcome of every secret.
+//	error - An error if the sync was aborted or any secret failed.
+func (s *Syncer) SyncPaths(ctx context.Context, paths []string) (*Report, error) {
+	ctx, span := s.tracer.Start(ctx, "sync paths")
+	defer span.End()
+
+	if s.cfg.Bidirectional.Enabled {
+		return nil, fmt.Errorf("syncing selected paths cannot be used with bidirectional sync")
+	}
+
+	mount := s.cfg.SourceVault.Mount
+	s.report = newReport(mount, s.cfg.SourceVault.Path)
+	s.resetSynced()
+	if err := s.checkKVFeatures(ctx, mount); err != nil {
+		return s.report, err
+	}
+	s.log.Info().Str("mount", mount).Int("secrets", len(paths)).Msg("Starting sync of selected secrets")
+
+	if err := s.syncPaths(ctx, mount, paths, "sync"); err != nil {
+		return s.report, err
+	}
+	s.log.Info().Int("created", s.report.Created).Int("updated", s.report.Updated).Int("unchanged", s.report.Unchanged).Msg("Sync complete")
+	return s.report, nil
+}
@@ -0,0 +1,36 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMaxDuration is returned by Sync when the run stopped at its MaxDuration.
+var ErrMaxDuration = errors.New("sync stopped at its maximum duration")
+
+// pastDeadline reports whether the current run has passed its deadline.
+func (s *Syncer) pastDeadline() bool {
+	return !s.deadline.IsZero() && !time.Now().Before(s.deadline)
+}
+
+// withDeadline bounds ctx by the deadline of the current run, for stages
+// that only read and can be cut short. Without a deadline ctx is returned
+// with a no-op cancel function.
+func (s *Syncer) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, s.deadline)
+}
+
+// stopAtDeadline marks the report as stopped at the deadline.
+//
+// Returns:
+//
+//	error - ErrMaxDuration.
+func (s *Syncer) stopAtDeadline() error {
+	s.report.DeadlineExceeded = true
+	s.log.Warn().Str("run", s.report.RunID).Dur("maxDuration", s.cfg.MaxDuration).Msg("Maximum duration reached, sync stopped")
+	return ErrMaxDuration
+}
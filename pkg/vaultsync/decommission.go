@@ -0,0 +1,187 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// Decommission deletes the source secrets that a completed, verified run
+// copied to the destination. Only secrets the run created, updated, or
+// found unchanged are touched; skipped and failed secrets are left in
+// place, and so is any secret whose source data changed since the run
+// read it, which fails instead. By default the
+// current version of each secret is soft-deleted and can be undeleted; with
+// destroy set, the secret's metadata and every version are removed for good.
+// Deletes are issued in batches of BatchSize against the source rate limit.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	run: *Report - The report of the verified run.
+//	destroy: bool - Permanently destroy the secrets instead of soft-deleting them.
+//
+// Returns:
+//
+//	*Report - A report of the deletions, with its own run ID.
+//	error - An error if the run is not eligible or any secret could not be deleted.
+func (s *Syncer) Decommission(ctx context.Context, run *Report, destroy bool) (*Report, error) {
+	if err := s.requireVaultSource("decommission"); err != nil {
+		return nil, err
+	}
+	if err := s.checkDecommissionable(run); err != nil {
+		return nil, err
+	}
+
+	var targets []SecretResult
+	for _, res := range run.Secrets {
+		switch res.Action {
+		case ActionCreated, ActionUpdated, ActionUnchanged:
+			targets = append(targets, res)
+		}
+	}
+
+	s.report = newReport(run.Mount, run.Path)
+	s.log.Info().Str("run", run.RunID).Int("secrets", len(targets)).Bool("destroy", destroy).Msg("Starting decommission")
+
+	batchSize := s.cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	for i := 0; i < len(targets); i += batchSize {
+		if err := ctx.Err(); err != nil {
+			s.report.finish()
+			return s.report, fmt.Errorf("decommission aborted: %w", err)
+		}
+		end := i + batchSize
+		if end > len(targets) {
+			end = len(targets)
+		}
+
+		var wg sync.WaitGroup
+		for _, res := range targets[i:end] {
+			wg.Add(1)
+			go func(res SecretResult) {
+				defer wg.Done()
+				start := time.Now()
+				action, err := ActionFailed, s.checkSourceUnchanged(ctx, run.Mount, res)
+				if err == nil {
+					action, err = s.deleteSource(ctx, run.Mount, res.Path, destroy)
+				}
+				s.report.record(res.Path, action, err, time.Since(start))
+			}(res)
+		}
+		wg.Wait()
+	}
+
+	s.report.finish()
+	if err := s.report.err(); err != nil {
+		return s.report, err
+	}
+
+	s.log.Info().Int("deleted", s.report.Deleted).Int("destroyed", s.report.Destroyed).Msg("Decommission complete")
+	return s.report, nil
+}
+
+// checkDecommissionable refuses runs that did not complete verification, had
+// failures, or targeted a source mount that is not configured.
+func (s *Syncer) checkDecommissionable(run *Report) error {
+	switch {
+	case s.cfg.SourceVault.Replica:
+		return fmt.Errorf("source vault is a replica and cannot be decommissioned")
+	case !run.Verified:
+		return fmt.Errorf("run %s did not complete verification", run.RunID)
+	case run.Failed > 0:
+		return fmt.Errorf("run %s had %d failed secrets", run.RunID, run.Failed)
+	case !s.cfg.SourceVault.hasMount(run.Mount):
+		return fmt.Errorf("run %s synced mount %q, which is not a configured source mount", run.RunID, run.Mount)
+	}
+	return nil
+}
+
+// checkSourceUnchanged reads a source secret again and compares it with the
+// checksum the verified run recorded for it, so a secret written since the
+// run, whose new data never reached the destination, is not deleted.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	res: SecretResult - The secret's result in the verified run.
+//
+// Returns:
+//
+//	error - An error if the run recorded no checksum, the secret could not be read, or its data changed.
+func (s *Syncer) checkSourceUnchanged(ctx context.Context, mount string, res SecretResult) error {
+	if res.Checksum == "" {
+		return fmt.Errorf("run recorded no checksum for the secret, not deleting it")
+	}
+	data, _, err := s.readSourceVersion(ctx, mount, res.Path, 0)
+	if err != nil {
+		return err
+	}
+	sum, err := s.checksum(data)
+	if err != nil {
+		return fmt.Errorf("failed to checksum source secret: %w", err)
+	}
+	if hex.EncodeToString(sum[:]) != res.Checksum {
+		s.log.Warn().Str("secret", res.Path).Msg("Source secret changed since the run, not deleting it")
+		return fmt.Errorf("source secret changed since the run, not deleting it")
+	}
+	return nil
+}
+
+// hasMount reports whether mount is the vault's mount or one of its Mounts.
+func (v *Vault) hasMount(mount string) bool {
+	if v.Mount == mount {
+		return true
+	}
+	for _, m := range v.Mounts {
+		if m.Mount == mount {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteSource soft-deletes or destroys a single source secret.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//	destroy: bool - Remove the metadata and all versions instead of soft-deleting.
+//
+// Returns:
+//
+//	Action - ActionDeleted or ActionDestroyed.
+//	error - An error if the secret could not be deleted.
+func (s *Syncer) deleteSource(ctx context.Context, mount, path string, destroy bool) (Action, error) {
+	target, action := s.kvPath(ctx, s.sourceVault, mount, "data", path), ActionDeleted
+	// KV v1 has no soft delete, so any delete destroys the secret.
+	if destroy || s.kvVersion(ctx, s.sourceVault, mount) == 1 {
+		target, action = s.kvPath(ctx, s.sourceVault, mount, "metadata", path), ActionDestroyed
+	}
+
+	err := s.withRetry(ctx, "delete", func() error {
+		// Deletes go to the source vault, so they share its rate limit.
+		if err := s.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.sourceVault.Delete(ctx, target, vault.WithMountPath(mount))
+		return err
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to delete source secret")
+		return ActionFailed, fmt.Errorf("failed to delete source secret: %w", err)
+	}
+
+	s.audit(AuditRecord{Operation: auditOperation(action == ActionDestroyed), Target: AuditSource, Mount: mount, Path: path}, nil)
+	s.log.Debug().Str("secret", path).Str("action", string(action)).Msg("Source secret decommissioned")
+	return action, nil
+}
@@ -0,0 +1,90 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Destination stores synced secrets somewhere other than a vault, such
+	// as a cloud secret manager. Paths are destination paths, after
+	// transforms have been applied. Implementations must be safe for
+	// concurrent use.
+	Destination interface {
+		// Name describes the destination in logs and approval plans.
+		Name() string
+		// Write stores data at path and reports whether it was newly created.
+		Write(ctx context.Context, path string, data map[string]interface{}) (bool, error)
+		// Read returns the data stored at path, for verification.
+		Read(ctx context.Context, path string) (map[string]interface{}, error)
+	}
+)
+
+// WithDestination writes secrets to d instead of the destination vault. The
+// destination vault config is ignored, and features that rely on KV v2
+// (history replay, folder checksums, chunking, and diff) are unavailable.
+//
+// Arguments:
+//
+//	d: Destination - The destination to write to.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithDestination(d Destination) Option {
+	return func(s *Syncer) {
+		s.destination = d
+	}
+}
+
+// checkDestination rejects settings that need a vault destination when an
+// external Destination is used.
+func checkDestination(cfg *Config) error {
+	switch {
+	case cfg.History.Enabled:
+		return fmt.Errorf("history replay requires a vault destination")
+	case cfg.Checksums.Enabled:
+		return fmt.Errorf("folder checksums require a vault destination")
+	case cfg.OnConflict != "" && cfg.OnConflict != ConflictOverwrite:
+		return fmt.Errorf("the %s conflict strategy requires a vault destination", cfg.OnConflict)
+	}
+	return nil
+}
+
+// destinationName describes where secrets are written, for logs and plans.
+func (s *Syncer) destinationName() string {
+	if s.destination != nil {
+		return s.destination.Name()
+	}
+	return s.cfg.DestinationVault.Address
+}
+
+// writeExternal writes a transformed secret to the external destination.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	destPath: string - The destination path of the secret.
+//	destData: map[string]interface{} - The data to write.
+//
+// Returns:
+//
+//	int64 - 1 if the secret was created, otherwise 0.
+//	error - An error if the secret could not be written.
+func (s *Syncer) writeExternal(ctx context.Context, destPath string, destData map[string]interface{}) (int64, error) {
+	var created bool
+	err := s.withRetry(ctx, "write", func() (err error) {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		created, err = s.destination.Write(ctx, destPath, destData)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		return 1, nil
+	}
+	return 0, nil
+}
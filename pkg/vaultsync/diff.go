@@ -0,0 +1,382 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DiffMatch means the destination holds exactly what a sync would write.
+	DiffMatch DiffStatus = "match"
+	// DiffChanged means the destination secret differs from the source.
+	DiffChanged DiffStatus = "changed"
+	// DiffMissing means the source secret has no destination counterpart.
+	DiffMissing DiffStatus = "missing"
+	// DiffExtra means the destination secret has no source counterpart.
+	DiffExtra DiffStatus = "extra"
+	// DiffError means the secret could not be compared; see DiffResult.Error.
+	DiffError DiffStatus = "error"
+)
+
+type (
+	// DiffStatus is the outcome of comparing a single secret.
+	DiffStatus string
+
+	// DiffReport is the structured result of a Diff.
+	DiffReport struct {
+		Mount      string       `json:"mount"`
+		Path       string       `json:"path"`
+		StartedAt  time.Time    `json:"startedAt"`
+		FinishedAt time.Time    `json:"finishedAt"`
+		Duration   Duration     `json:"duration"`
+		Matched    int          `json:"matched"`
+		Changed    int          `json:"changed"`
+		Missing    int          `json:"missing"`
+		Extra      int          `json:"extra"`
+		Errors     int          `json:"errors"`
+		Secrets    []DiffResult `json:"secrets"`
+
+		mu sync.Mutex
+	}
+
+	// DiffResult is the outcome of comparing a single secret.
+	DiffResult struct {
+		Path        string     `json:"path"`
+		Destination string     `json:"destination,omitempty"`
+		Status      DiffStatus `json:"status"`
+		Error       string     `json:"error,omitempty"`
+	}
+
+	// differ holds the state of a single Diff run.
+	differ struct {
+		*Syncer
+		srcLimiter *rate.Limiter
+		dstLimiter *rate.Limiter
+		report     *DiffReport
+
+		expectedMu sync.Mutex
+		expected   map[string]bool
+	}
+)
+
+// Drifted reports whether any secret is changed, missing, or extra.
+func (r *DiffReport) Drifted() bool {
+	return r.Changed+r.Missing+r.Extra > 0
+}
+
+// record stores the outcome of comparing a secret. Safe for concurrent use.
+func (r *DiffReport) record(res DiffResult) {
+	r.mu.Lock()
+	r.Secrets = append(r.Secrets, res)
+	r.mu.Unlock()
+}
+
+// finish stamps the finish time, sorts the results, and counts them.
+func (r *DiffReport) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now().UTC()
+	r.Duration = Duration(r.FinishedAt.Sub(r.StartedAt))
+
+	sort.Slice(r.Secrets, func(i, j int) bool { return r.Secrets[i].Path < r.Secrets[j].Path })
+	r.Matched, r.Changed, r.Missing, r.Extra, r.Errors = 0, 0, 0, 0, 0
+	for _, res := range r.Secrets {
+		switch res.Status {
+		case DiffMatch:
+			r.Matched++
+		case DiffChanged:
+			r.Changed++
+		case DiffMissing:
+			r.Missing++
+		case DiffExtra:
+			r.Extra++
+		case DiffError:
+			r.Errors++
+		}
+	}
+}
+
+// Diff compares the configured source path against the destination without
+// writing anything. Each source secret is transformed exactly as a sync
+// would transform it and compared with the (reassembled) destination
+// secret; destination secrets under the path that no source secret maps to
+// are reported as extra. Comparisons run on a worker pool sized and rate
+// limited by the Diff config, independently of the sync settings.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	*DiffReport - The result of every comparison.
+//	error - An error if either vault could not be listed.
+func (s *Syncer) Diff(ctx context.Context) (*DiffReport, error) {
+	ctx, span := s.tracer.Start(ctx, "diff")
+	defer span.End()
+
+	if s.destination != nil {
+		return nil, fmt.Errorf("diff requires a vault destination")
+	}
+	if err := s.requireVaultSource("diff"); err != nil {
+		return nil, err
+	}
+
+	mount, root := s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path
+	d := &differ{
+		Syncer:     s,
+		srcLimiter: newLimiter(s.cfg.Diff.SourceQPS, s.cfg.Diff.SourceBurst),
+		dstLimiter: newLimiter(s.cfg.Diff.DestinationQPS, s.cfg.Diff.DestinationBurst),
+		report:     &DiffReport{Mount: mount, Path: root, StartedAt: time.Now().UTC()},
+		expected:   make(map[string]bool),
+	}
+
+	workers := s.cfg.Diff.Workers
+	if workers < 1 {
+		workers = s.cfg.BatchSize
+	}
+
+	s.log.Info().Str("mount", mount).Str("path", root).Int("workers", workers).Msg("Starting diff")
+
+	srcList, err := s.listPath(ctx, s.sourceVault, d.srcLimiter, mount, root)
+	if err != nil {
+		return d.report, fmt.Errorf("failed to list source path: %w", err)
+	}
+	runPool(ctx, workers, secretKeys(srcList), func(ctx context.Context, key string) {
+		d.report.record(d.compare(ctx, mount, root+key))
+	})
+	if err := ctx.Err(); err != nil {
+		d.report.finish()
+		return d.report, fmt.Errorf("diff aborted: %w", err)
+	}
+
+	dstList, err := s.listPath(ctx, s.destinationVault, d.dstLimiter, mount, root)
+	if err != nil && !vault.IsErrorStatus(err, 404) {
+		d.report.finish()
+		return d.report, fmt.Errorf("failed to list destination path: %w", err)
+	}
+	for _, key := range secretKeys(dstList) {
+		if !d.expected[root+key] {
+			d.report.record(DiffResult{Path: root + key, Destination: root + key, Status: DiffExtra})
+		}
+	}
+
+	d.report.finish()
+	s.log.Info().
+		Int("matched", d.report.Matched).
+		Int("changed", d.report.Changed).
+		Int("missing", d.report.Missing).
+		Int("extra", d.report.Extra).
+		Int("errors", d.report.Errors).
+		Msg("Diff complete")
+	return d.report, nil
+}
+
+// secretKeys filters folders and hvm's own bookkeeping entries out of a listing.
+func secretKeys(keys []string) []string {
+	retVal := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if isSecretKey(k) {
+			retVal = append(retVal, k)
+		}
+	}
+	return retVal
+}
+
+// isSecretKey reports whether a listed key is a secret rather than a folder
+// or a chunk of a chunked secret. hvm's other bookkeeping, such as folder
+// checksums, lives in folders, so a secret merely named like .hvmrc counts.
+func isSecretKey(k string) bool {
+	return !strings.HasSuffix(k, "/") && !strings.HasPrefix(k, chunkKeyPrefix)
+}
+
+// compare reads a source secret and its destination counterpart and reports
+// whether they match.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of both vaults.
+//	path: string - The source path of the secret.
+//
+// Returns:
+//
+//	DiffResult - The outcome of the comparison.
+func (d *differ) compare(ctx context.Context, mount, path string) DiffResult {
+	res := DiffResult{Path: path}
+	fail := func(err error) DiffResult {
+		d.log.Error().Err(err).Str("secret", path).Msg("Failed to compare secret")
+		res.Status, res.Error = DiffError, err.Error()
+		return res
+	}
+
+	ctx, span := d.startSpan(ctx, "diff secret", mount, path)
+	defer span.End()
+
+	srcData, err := d.read(ctx, d.sourceVault, d.srcLimiter, mount, path)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read source secret: %w", err))
+	}
+
+	destPath, expected, err := d.transformer.Transform(path, srcData)
+	if err != nil {
+		return fail(fmt.Errorf("failed to transform secret: %w", err))
+	}
+	res.Destination = destPath
+
+	d.expectedMu.Lock()
+	d.expected[destPath] = true
+	d.expectedMu.Unlock()
+
+	destData, err := d.read(ctx, d.destinationVault, d.dstLimiter, mount, destPath)
+	if vault.IsErrorStatus(err, 404) {
+		res.Status = DiffMissing
+		return res
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to read destination secret: %w", err))
+	}
+	if destData, err = d.reassemble(ctx, d.dstLimiter, mount, destPath, destData); err != nil {
+		return fail(fmt.Errorf("failed to reassemble destination secret: %w", err))
+	}
+
+	srcSum, err := d.checksum(expected)
+	if err != nil {
+		return fail(fmt.Errorf("failed to checksum source secret: %w", err))
+	}
+	destSum, err := d.checksum(destData)
+	if err != nil {
+		return fail(fmt.Errorf("failed to checksum destination secret: %w", err))
+	}
+
+	res.Status = DiffMatch
+	if srcSum != destSum {
+		d.log.Debug().Str("secret", path).Str("destination", destPath).Msg("Secret differs")
+		res.Status = DiffChanged
+	}
+	return res
+}
+
+// read reads the current version of a KV v2 secret, retrying transient errors.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to read from.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The mount path.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the secret could not be read.
+func (d *differ) read(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount, path string) (map[string]interface{}, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := d.withRetry(ctx, "diff read", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, d.kvPath(ctx, client, mount, "data", path), vault.WithMountPath(mount))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := d.kvData(ctx, client, mount, resp.Data)
+	if data == nil {
+		// Soft-deleted secrets have no data; treat them like missing ones.
+		return nil, &vault.ResponseError{StatusCode: 404}
+	}
+	d.secrets.addData(data)
+	return data, nil
+}
+
+// SecretDiff describes how a single destination secret differs from what a
+// sync would write. Only key names are reported, never values.
+type SecretDiff struct {
+	Path        string     `json:"path"`
+	Destination string     `json:"destination"`
+	Status      DiffStatus `json:"status"`
+	Added       []string   `json:"added,omitempty"`
+	Removed     []string   `json:"removed,omitempty"`
+	Changed     []string   `json:"changed,omitempty"`
+}
+
+// DiffSecret compares a single source secret, transformed as a sync would
+// transform it, with its destination counterpart, key by key.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The source path of the secret, relative to the source mount.
+//
+// Returns:
+//
+//	*SecretDiff - The keys a sync would add, remove, or change on the destination.
+//	error - An error if either secret could not be read.
+func (s *Syncer) DiffSecret(ctx context.Context, path string) (*SecretDiff, error) {
+	mount := s.cfg.SourceVault.Mount
+	srcData, err := s.readSource(ctx, mount, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	destPath, expected, err := s.transformer.Transform(path, srcData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform secret: %w", err)
+	}
+
+	res := &SecretDiff{Path: path, Destination: destPath, Status: DiffMatch}
+	destData, err := s.readDestination(ctx, mount, destPath)
+	if vault.IsErrorStatus(err, 404) {
+		res.Status = DiffMissing
+		for k := range expected {
+			res.Added = append(res.Added, k)
+		}
+		sort.Strings(res.Added)
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read destination secret: %w", err)
+	}
+
+	for k, v := range expected {
+		cur, ok := destData[k]
+		if !ok {
+			res.Added = append(res.Added, k)
+			continue
+		}
+		want, err := s.checksum(v)
+		if err != nil {
+			return nil, err
+		}
+		got, err := s.checksum(cur)
+		if err != nil {
+			return nil, err
+		}
+		if want != got {
+			res.Changed = append(res.Changed, k)
+		}
+	}
+	for k := range destData {
+		if _, ok := expected[k]; !ok {
+			res.Removed = append(res.Removed, k)
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Removed)
+	sort.Strings(res.Changed)
+	if len(res.Added)+len(res.Removed)+len(res.Changed) > 0 {
+		res.Status = DiffChanged
+	}
+	return res, nil
+}
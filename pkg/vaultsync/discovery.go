@@ -0,0 +1,213 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// KVMount is a KV secrets engine mounted on a vault.
+	KVMount struct {
+		// Path is the mount path, without slashes.
+		Path        string `json:"path"`
+		Version     int    `json:"version"`
+		Description string `json:"description,omitempty"`
+	}
+)
+
+// DiscoverKVMounts lists every KV secrets engine mounted on the source
+// vault, with its version, from sys/mounts.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	[]KVMount - The KV mounts, sorted by path.
+//	error - An error if the mounts could not be read.
+func (s *Syncer) DiscoverKVMounts(ctx context.Context) ([]KVMount, error) {
+	if err := s.requireVaultSource("mount discovery"); err != nil {
+		return nil, err
+	}
+	mounts, err := s.readKVMounts(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source mounts: %w", err)
+	}
+
+	kv := make([]KVMount, 0, len(mounts))
+	for _, m := range mounts {
+		kv = append(kv, m)
+	}
+	sort.Slice(kv, func(i, j int) bool { return kv[i].Path < kv[j].Path })
+	return kv, nil
+}
+
+// readKVMounts reads the KV mounts of a vault, keyed by path.
+func (s *Syncer) readKVMounts(ctx context.Context, client *vault.Client, limiter *rate.Limiter) (map[string]KVMount, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "list mounts", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, "sys/mounts")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := make(map[string]KVMount)
+	for p, m := range resp.Data {
+		m, ok := m.(map[string]interface{})
+		if !ok || m["type"] != "kv" {
+			continue
+		}
+		kv := KVMount{Path: strings.Trim(p, "/"), Version: 1}
+		if opts, _ := m["options"].(map[string]interface{}); opts["version"] == "2" {
+			kv.Version = 2
+		}
+		kv.Description, _ = m["description"].(string)
+		mounts[kv.Path] = kv
+	}
+	return mounts, nil
+}
+
+// syncAllMounts syncs every KV v2 mount on the source vault to the mount of
+// the same name on the destination, as a multi-mount run. Destination
+// mounts that do not exist are created if CreateMissingMounts is set. KV v1
+// mounts are not supported and are skipped with a warning.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	*Report - The combined report of every mount.
+//	error - An error if the mounts could not be discovered or prepared, or any mount failed.
+func (s *Syncer) syncAllMounts(ctx context.Context) (*Report, error) {
+	discovered, err := s.DiscoverKVMounts(ctx)
+	if err != nil {
+		return newReport("", ""), err
+	}
+	existing, err := s.readKVMounts(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		return newReport("", ""), fmt.Errorf("failed to read destination mounts: %w", err)
+	}
+
+	var pairs []MountPath
+	for _, m := range discovered {
+		if m.Version != 2 {
+			s.log.Warn().Str("mount", m.Path).Msg("Skipping KV v1 mount, only KV v2 mounts are synced")
+			continue
+		}
+		if err := s.ensureDestinationMount(ctx, m, m.Path, existing); err != nil {
+			return newReport("", ""), err
+		}
+		pairs = append(pairs, MountPath{Mount: m.Path})
+	}
+	if len(pairs) == 0 {
+		return newReport("", ""), fmt.Errorf("the source vault has no KV v2 mounts")
+	}
+	s.log.Info().Int("mounts", len(pairs)).Msg("Discovered KV mounts")
+
+	cfg := s.cfg
+	defer func() { s.cfg = cfg }()
+	all := *cfg
+	src := *cfg.SourceVault
+	src.Mounts = pairs
+	all.SourceVault, all.AllKVMounts = &src, false
+	s.cfg = &all
+	return s.syncMounts(ctx)
+}
+
+// prepareDestinationMount makes sure the destination mount that secrets on
+// mount are written to exists before they are synced, creating it like the
+// source mount if CreateMissingMounts is set, so a missing mount stops the
+// run with a clear error instead of failing every secret with a 404. If the
+// destination token may not read sys/mounts the check is skipped, unless
+// the mount is to be created.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The source mount.
+//
+// Returns:
+//
+//	error - An error if the mount is missing and may not be created, or could not be created.
+func (s *Syncer) prepareDestinationMount(ctx context.Context, mount string) error {
+	if s.destination != nil || s.destinationVault == nil {
+		return nil
+	}
+
+	existing, err := s.readKVMounts(ctx, s.destinationVault, s.writeLimiter)
+	if err != nil {
+		if s.cfg.CreateMissingMounts {
+			return fmt.Errorf("failed to read destination mounts: %w", err)
+		}
+		s.log.Debug().Err(err).Msg("Failed to read destination mounts, not checking the destination mount")
+		return nil
+	}
+
+	// Without access to the source mounts, assume the KV v2 that hvm syncs.
+	src := KVMount{Path: mount, Version: 2}
+	if s.source == nil {
+		mounts, err := s.readKVMounts(ctx, s.sourceVault, s.readLimiter)
+		if err != nil {
+			s.log.Debug().Err(err).Msg("Failed to read source mounts")
+		} else if m, ok := mounts[mount]; ok {
+			src = m
+		}
+	}
+	return s.ensureDestinationMount(ctx, src, s.destMount(mount), existing)
+}
+
+// ensureDestinationMount creates the destination mount for a source KV
+// mount if it is missing and CreateMissingMounts is set.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	m: KVMount - The source mount.
+//	dest: string - The destination mount path, without slashes.
+//	existing: map[string]KVMount - The KV mounts on the destination vault.
+//
+// Returns:
+//
+//	error - An error if the mount is missing and may not be created, is not KV v2, or could not be created.
+func (s *Syncer) ensureDestinationMount(ctx context.Context, m KVMount, dest string, existing map[string]KVMount) error {
+	if dst, ok := existing[dest]; ok {
+		if dst.Version != m.Version {
+			return fmt.Errorf("destination mount %q is KV v%d, but the source mount is KV v%d", dest, dst.Version, m.Version)
+		}
+		return nil
+	}
+	if !s.cfg.CreateMissingMounts {
+		return fmt.Errorf("destination mount %q does not exist; create it or set createMissingMounts", dest)
+	}
+
+	body := map[string]interface{}{
+		"type":        "kv",
+		"description": m.Description,
+		"options":     map[string]interface{}{"version": fmt.Sprint(m.Version)},
+	}
+	err := s.withRetry(ctx, "create mount", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.Write(ctx, "sys/mounts/"+dest, body)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create destination mount %q: %w", dest, err)
+	}
+	s.log.Info().Str("mount", dest).Str("source", m.Path).Msg("Created destination mount")
+	return nil
+}
@@ -0,0 +1,32 @@
+// Package vaultsync is the sync engine behind hvm, for programs that want
+// to migrate vault secrets without shelling out to the hvm binary.
+//
+// A Syncer is built from a Config and functional options, and every
+// operation returns a typed, JSON serialisable result:
+//
+//	cfg := &vaultsync.Config{
+//		SourceVault:      &vaultsync.Vault{Address: "https://old:8200", Token: os.Getenv("SRC_TOKEN"), Mount: "secret", Path: "app/"},
+//		DestinationVault: &vaultsync.Vault{Address: "https://new:8200", Token: os.Getenv("DST_TOKEN")},
+//	}
+//	if err := cfg.Validate(); err != nil {
+//		return err
+//	}
+//	syncer, err := vaultsync.NewSyncer(cfg, vaultsync.WithLogger(logger))
+//	if err != nil {
+//		return err
+//	}
+//	report, err := syncer.Sync(ctx)
+//
+// Options plug in other sources (WithSource), destinations
+// (WithDestination), approval gates (WithApprover), per-secret
+// hooks for auditing or vetoing writes (WithHooks), custom value
+// transformations (WithTransformer), logging (WithLogger,
+// WithSlogHandler), tracing (WithTracerProvider), and metrics (WithMetrics).
+// Besides Sync, a Syncer can Diff, list Changes, Export and Import
+// encrypted archives, Decommission the secrets of a previous run, and copy
+// policies, auth methods, identity, transit keys, PKI mounts, and TOTP keys.
+//
+// The exported API follows semantic versioning with the hvm module;
+// unexported identifiers and the behaviour of the hvm commands are not part
+// of it.
+package vaultsync
@@ -0,0 +1,149 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// vaultEnv maps Vault fields to the standard vault environment variables.
+var vaultEnv = []struct {
+	name string
+	set  func(v *Vault, value string)
+	// empty reports whether the field is unset.
+	empty func(v *Vault) bool
+}{
+	{"VAULT_ADDR", func(v *Vault, s string) { v.Address = s }, func(v *Vault) bool { return v.Address == "" }},
+	{"VAULT_TOKEN", func(v *Vault, s string) { v.Token = s }, func(v *Vault) bool {
+		return v.Token == "" && v.TokenCmd == "" && v.TokenFile == "" && v.TokenKeyring == ""
+	}},
+	{"VAULT_NAMESPACE", func(v *Vault, s string) { v.Namespace = s }, func(v *Vault) bool { return v.Namespace == "" }},
+	{"VAULT_CACERT", func(v *Vault, s string) { v.CACert = s }, func(v *Vault) bool { return v.CACert == "" }},
+	{"VAULT_PROXY_ADDR", func(v *Vault, s string) { v.Proxy = s }, func(v *Vault) bool { return v.Proxy == "" }},
+}
+
+// ApplyVaultEnv fills in the address, token, namespace, CA certificate, and
+// proxy the source and destination vaults leave unset from the standard
+// VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_CACERT, and
+// VAULT_PROXY_ADDR environment variables. SRC_ and DST_ prefixed variants, like SRC_VAULT_ADDR, apply to
+// one vault only and take precedence. A token is only taken from the
+// environment when none of token, tokenCmd, tokenFile, and tokenKeyring is
+// set.
+func (c *Config) ApplyVaultEnv() {
+	c.SourceVault = applyVaultEnv(c.SourceVault, "SRC_")
+	c.DestinationVault = applyVaultEnv(c.DestinationVault, "DST_")
+}
+
+// applyVaultEnv fills in v from the environment, allocating it if it is nil
+// and any variable is set.
+func applyVaultEnv(v *Vault, prefix string) *Vault {
+	for _, e := range vaultEnv {
+		value := os.Getenv(prefix + e.name)
+		if value == "" {
+			value = os.Getenv(e.name)
+		}
+		if value == "" {
+			continue
+		}
+		if v == nil {
+			v = new(Vault)
+		}
+		if e.empty(v) {
+			e.set(v, value)
+		}
+	}
+	return v
+}
+
+// httpClient returns the base HTTP client for the vault, trusting CACert and
+// sending requests through Proxy if set. Without a Proxy, HTTPS_PROXY,
+// HTTP_PROXY, and NO_PROXY are honored. For a unix:// Address every
+// connection is made to the socket instead.
+func (v *Vault) httpClient() (*http.Client, error) {
+	hc := vault.DefaultConfiguration().HTTPClient
+	transport := hc.Transport.(*http.Transport)
+
+	if socket, ok := v.socketPath(); ok {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return hc, nil
+	}
+
+	if v.Proxy != "" {
+		proxy, err := parseProxy(v.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if v.CACert == "" {
+		return hc, nil
+	}
+
+	pem, err := os.ReadFile(v.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", v.CACert)
+	}
+	transport.TLSClientConfig.RootCAs = pool
+	return hc, nil
+}
+
+// socketPath returns the socket of a unix:// Address, such as the listener
+// of a Vault Agent or proxy.
+//
+// Returns:
+//
+//	string - The path of the socket.
+//	bool - Whether Address is a unix:// address.
+func (v *Vault) socketPath() (string, bool) {
+	socket, ok := strings.CutPrefix(v.Address, "unix://")
+	return socket, ok
+}
+
+// clientAddress returns the address to give the vault client. Requests to a
+// socket are plain HTTP, and httpClient dials the socket whatever the host.
+func (v *Vault) clientAddress() string {
+	if _, ok := v.socketPath(); ok {
+		return "http://localhost"
+	}
+	return v.Address
+}
+
+// parseProxy parses a proxy URL, which must be an http, https, socks5, or
+// socks5h URL with a host.
+//
+// Arguments:
+//
+//	raw: string - The proxy URL, e.g. socks5://bastion:1080.
+//
+// Returns:
+//
+//	*url.URL - The parsed proxy URL.
+//	error - An error if the URL is invalid or its scheme is not supported.
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("proxy URL %q must be http, https, socks5, or socks5h", raw)
+	}
+}
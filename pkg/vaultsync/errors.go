@@ -0,0 +1,69 @@
+package vaultsync
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// SyncError is returned by Sync when one or more secrets failed to sync.
+	// It unwraps to the individual SecretErrors, so errors.Is and errors.As
+	// see through to the underlying causes.
+	SyncError struct {
+		// Total is the number of secrets the sync attempted, not counting
+		// folders.
+		Total int
+		// Errors holds one entry per failed secret or denied folder,
+		// sorted by path.
+		Errors []*SecretError
+
+		// folders is how many of Errors are denied folders.
+		folders int
+	}
+
+	// SecretError is the failure of a single secret.
+	SecretError struct {
+		Path string
+		Err  error
+	}
+)
+
+func (e *SyncError) Error() string {
+	const maxListed = 5
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d secrets failed to sync", len(e.Errors)-e.folders, e.Total)
+	if e.folders > 0 {
+		fmt.Fprintf(&b, " and %d folders were denied", e.folders)
+	}
+	for i, se := range e.Errors {
+		if i == maxListed {
+			fmt.Fprintf(&b, "; and %d more", len(e.Errors)-maxListed)
+			break
+		}
+		fmt.Fprintf(&b, "; %s", se)
+	}
+	return b.String()
+}
+
+// Unwrap returns the per-secret errors.
+func (e *SyncError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, se := range e.Errors {
+		errs[i] = se
+	}
+	return errs
+}
+
+// Partial reports whether some, but not all, secrets failed.
+func (e *SyncError) Partial() bool {
+	return len(e.Errors)-e.folders < e.Total
+}
+
+func (e *SecretError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *SecretError) Unwrap() error {
+	return e.Err
+}
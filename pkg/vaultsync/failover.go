@@ -0,0 +1,191 @@
+package vaultsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+type (
+	// failoverTransport sends each request to the current vault address and
+	// moves on to the next healthy address when a request cannot reach it.
+	// A background health check brings failed addresses back into rotation.
+	failoverTransport struct {
+		base  http.RoundTripper
+		addrs []*url.URL
+		log   zerolog.Logger
+
+		mu      sync.Mutex
+		current int
+		healthy []bool
+	}
+)
+
+// failoverClient returns an HTTP client that fails over between the primary
+// and fallback addresses of cfg, and starts health checking them until the
+// Syncer is closed.
+//
+// Arguments:
+//
+//	cfg: *Vault - The vault config.
+//	hc: *http.Client - The base HTTP client, whose transport is wrapped.
+//
+// Returns:
+//
+//	*http.Client - The HTTP client to pass to the vault client.
+//	error - An error if an address is invalid.
+func (s *Syncer) failoverClient(cfg *Vault, hc *http.Client) (*http.Client, error) {
+	t := &failoverTransport{log: s.log}
+	for _, a := range append([]string{cfg.Address}, cfg.FallbackAddresses...) {
+		u, err := url.Parse(a)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid vault address %q", a)
+		}
+		t.addrs = append(t.addrs, u)
+		t.healthy = append(t.healthy, true)
+	}
+
+	t.base = hc.Transport
+	hc.Transport = t
+
+	interval := cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopHealthChecks = append(s.stopHealthChecks, cancel)
+	go t.healthCheck(ctx, interval)
+
+	return hc, nil
+}
+
+// RoundTrip sends req to the current address, failing over to the next
+// healthy one on connection errors until every address has been tried.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.GetBody == nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < len(t.addrs); attempt++ {
+		i := t.pick()
+
+		r := req.Clone(req.Context())
+		r.URL.Scheme, r.URL.Host, r.Host = t.addrs[i].Scheme, t.addrs[i].Host, ""
+		switch {
+		case body != nil:
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		case attempt > 0 && req.GetBody != nil:
+			b, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = b
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if err == nil {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+		t.markDown(i, err)
+	}
+	return nil, lastErr
+}
+
+// pick returns the index of the address to use: the current one if it is
+// healthy, otherwise the next healthy one, otherwise the current one anyway.
+func (t *failoverTransport) pick() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for n := 0; n < len(t.addrs); n++ {
+		i := (t.current + n) % len(t.addrs)
+		if t.healthy[i] {
+			if i != t.current {
+				t.log.Warn().Str("from", t.addrs[t.current].Host).Str("to", t.addrs[i].Host).Msg("Failing over to another vault address")
+				t.current = i
+			}
+			return i
+		}
+	}
+	return t.current
+}
+
+// markDown takes an address out of rotation until a health check passes.
+func (t *failoverTransport) markDown(i int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.healthy[i] {
+		t.log.Warn().Err(err).Str("addr", t.addrs[i].Host).Msg("Vault address unreachable")
+	}
+	t.healthy[i] = false
+}
+
+// healthCheck probes sys/health on every address each interval until ctx is
+// done. Standbys and performance standbys count as healthy since they serve
+// reads.
+func (t *failoverTransport) healthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for i, u := range t.addrs {
+			up := t.probe(ctx, u, interval)
+
+			t.mu.Lock()
+			if up && !t.healthy[i] {
+				t.log.Info().Str("addr", u.Host).Msg("Vault address healthy again")
+			}
+			t.healthy[i] = up
+			t.mu.Unlock()
+		}
+	}
+}
+
+// probe reports whether the vault at u answers its health endpoint as an
+// unsealed, initialized node.
+func (t *failoverTransport) probe(ctx context.Context, u *url.URL, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	target := *u
+	target.Path = "/v1/sys/health"
+	target.RawQuery = url.Values{"standbyok": {"true"}, "perfstandbyok": {"true"}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
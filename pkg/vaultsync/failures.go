@@ -0,0 +1,148 @@
+package vaultsync
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxErrorSummary is how many distinct errors are listed when a run stops
+// after too many failures.
+const maxErrorSummary = 3
+
+var (
+	// ErrFailFast is returned by Sync, wrapping the first failure, when
+	// FailFast stopped the run.
+	ErrFailFast = errors.New("sync stopped at the first failed secret")
+
+	// ErrMaxErrors is returned by Sync when more secrets failed than
+	// MaxErrors allows.
+	ErrMaxErrors = errors.New("sync stopped after too many failed secrets")
+)
+
+// errorLimit returns how many of total secrets MaxErrors allows to fail,
+// or -1 for no limit.
+//
+// Arguments:
+//
+//	maxErrors: string - A count such as "50", a percentage such as "5%", or empty.
+//	total: int - The number of secrets in the run.
+//
+// Returns:
+//
+//	int - The highest number of failures allowed.
+//	error - An error if maxErrors is neither a count nor a percentage.
+func errorLimit(maxErrors string, total int) (int, error) {
+	if maxErrors == "" {
+		return -1, nil
+	}
+	if pct, ok := strings.CutSuffix(maxErrors, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("percentage must be between 0%% and 100%%, not %q", maxErrors)
+		}
+		return int(float64(total) * p / 100), nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(maxErrors))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a count or a percentage such as 5%%, not %q", maxErrors)
+	}
+	return n, nil
+}
+
+// recordFailure counts a failed secret and stops the current run, cancelling
+// the secrets in flight, if FailFast is set or there are now more failures
+// than MaxErrors allows. Safe for concurrent use.
+//
+// Arguments:
+//
+//	path: string - The source path of the secret that failed.
+//	err: error - Why it failed.
+//
+// Returns: nothing
+func (s *Syncer) recordFailure(path string, err error) {
+	if s.abort == nil {
+		return
+	}
+
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	s.failures++
+	if s.stopErr != nil {
+		return
+	}
+
+	switch {
+	case s.cfg.FailFast:
+		s.stopErr = fmt.Errorf("%w: %w", ErrFailFast, &SecretError{Path: path, Err: err})
+		s.log.Error().Err(err).Str("secret", path).Msg("Secret failed, stopping the sync")
+	case s.errorLimit >= 0 && s.failures > s.errorLimit:
+		s.stopErr = fmt.Errorf("%w: more than %d failed (maxErrors %s)", ErrMaxErrors, s.errorLimit, s.cfg.MaxErrors)
+		s.log.Error().Int("failed", s.failures).Int("maxErrors", s.errorLimit).Msg("Too many secrets failed, stopping the sync")
+	default:
+		return
+	}
+	s.abort()
+}
+
+// stopped reports whether too many failures have stopped the current run.
+func (s *Syncer) stopped() bool {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	return s.stopErr != nil
+}
+
+// stopOnFailure marks the report as stopped by FailFast or MaxErrors and
+// summarizes the failures, grouping identical errors.
+//
+// Returns:
+//
+//	error - ErrFailFast or ErrMaxErrors, wrapped with the summary.
+func (s *Syncer) stopOnFailure() error {
+	s.failMu.Lock()
+	err, failures := s.stopErr, s.failures
+	s.failMu.Unlock()
+
+	if errors.Is(err, ErrFailFast) {
+		s.report.FailedFast = true
+		s.log.Warn().Str("run", s.report.RunID).Msg("Sync stopped at the first failed secret")
+		return err
+	}
+
+	s.report.MaxErrorsExceeded = true
+	counts := make(map[string]int)
+	s.report.mu.Lock()
+	for _, res := range s.report.results {
+		if res.Action == ActionFailed || res.Action == ActionDenied {
+			counts[res.Error]++
+		}
+	}
+	s.report.mu.Unlock()
+	msgs := make([]string, 0, len(counts))
+	for msg := range counts {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		if counts[msgs[i]] != counts[msgs[j]] {
+			return counts[msgs[i]] > counts[msgs[j]]
+		}
+		return msgs[i] < msgs[j]
+	})
+
+	var b strings.Builder
+	for i, msg := range msgs {
+		if i == maxErrorSummary {
+			fmt.Fprintf(&b, "; and %d other errors", len(msgs)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%d x %s", counts[msg], msg)
+		s.log.Error().Int("secrets", counts[msg]).Str("error", msg).Msg("Failed secrets")
+	}
+	s.log.Warn().Str("run", s.report.RunID).Int("failed", failures).Msg("Sync stopped after too many failed secrets")
+	return fmt.Errorf("%w: %s", err, b.String())
+}
@@ -0,0 +1,319 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+// placeholderKey is the only key of a destination version written in place of
+// a deleted or destroyed source version.
+const placeholderKey = "__hvm_placeholder"
+
+type (
+	// secretMetadata is the subset of a KV v2 metadata response used to
+	// replay version history, list changes, and sync metadata.
+	secretMetadata struct {
+		CurrentVersion     int64                      `json:"current_version"`
+		OldestVersion      int64                      `json:"oldest_version"`
+		UpdatedTime        string                     `json:"updated_time"`
+		Versions           map[string]versionMetadata `json:"versions"`
+		CustomMetadata     map[string]string          `json:"custom_metadata"`
+		MaxVersions        int64                      `json:"max_versions"`
+		CASRequired        bool                       `json:"cas_required"`
+		DeleteVersionAfter string                     `json:"delete_version_after"`
+	}
+
+	// versionMetadata describes a single version of a KV v2 secret.
+	versionMetadata struct {
+		CreatedTime  string `json:"created_time"`
+		DeletionTime string `json:"deletion_time"`
+		Destroyed    bool   `json:"destroyed"`
+	}
+)
+
+// readMetadata reads the KV v2 metadata of a secret from the source vault.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	*secretMetadata - The secret's metadata.
+//	error - An error if the metadata could not be read.
+func (s *Syncer) readMetadata(ctx context.Context, mount, path string) (*secretMetadata, error) {
+	m, err := s.readMetadataFrom(ctx, s.sourceVault, s.readLimiter, mount, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret metadata from source vault: %w", err)
+	}
+	return m, nil
+}
+
+// readMetadataFrom reads the KV v2 metadata of a secret from either vault.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to read from.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The mount path.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	*secretMetadata - The secret's metadata.
+//	error - An error if the metadata could not be read.
+func (s *Syncer) readMetadataFrom(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount, path string) (*secretMetadata, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "read metadata", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, mount+"/metadata/"+path, vault.WithMountPath(mount))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through JSON to decode the loosely typed response.
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	m := new(secretMetadata)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to decode secret metadata: %w", err)
+	}
+	return m, nil
+}
+
+// syncHistory replays the versions of a secret, oldest first, so the
+// destination ends up with the same version lineage as the source. Deleted
+// and destroyed versions have no readable data, so a placeholder is written
+// in their place to keep version numbers aligned, and the matching
+// destination versions are deleted or destroyed once the replay finishes.
+// Only source versions newer than the destination's current version are
+// replayed, so a secret synced before is not replayed again on top of itself.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	Action - ActionCreated if the first replayed version created the destination secret, ActionUnchanged if the destination already has every version, otherwise ActionUpdated.
+//	error - An error if any version could not be copied.
+func (s *Syncer) syncHistory(ctx context.Context, mount, path string) (Action, error) {
+	meta, err := s.readMetadata(ctx, mount, path)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to read secret metadata")
+		return ActionFailed, err
+	}
+
+	oldest := meta.OldestVersion
+	if oldest < 1 {
+		oldest = 1
+	}
+
+	destPath, _, err := s.transformer.Transform(path, map[string]interface{}{})
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to transform secret: %w", err)
+	}
+	if err := s.awaitDestination(ctx); err != nil {
+		return ActionFailed, err
+	}
+	dst, err := s.readMetadataFrom(ctx, s.destinationVault, s.writeLimiter, s.destMount(mount), destPath)
+	s.destinationResult(err)
+	switch {
+	case vault.IsErrorStatus(err, 404):
+	case err != nil:
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to read destination secret metadata")
+		return ActionFailed, fmt.Errorf("failed to read secret metadata from destination vault: %w", err)
+	case dst.CurrentVersion >= meta.CurrentVersion:
+		s.log.Debug().Str("secret", path).Int64("version", dst.CurrentVersion).Msg("Destination already has every version")
+		// Decommissioning needs the current version's checksum even though
+		// nothing is replayed.
+		if vm, ok := meta.Versions[strconv.FormatInt(meta.CurrentVersion, 10)]; ok && !vm.Destroyed && vm.DeletionTime == "" {
+			srcData, err := s.readSource(ctx, mount, path, meta.CurrentVersion)
+			if err != nil {
+				return ActionFailed, fmt.Errorf("version %d: %w", meta.CurrentVersion, err)
+			}
+			if sum, err := s.checksum(srcData); err == nil {
+				s.report.content(path, sum)
+			}
+		}
+		s.syncedMu.Lock()
+		s.desired[destPath] = true
+		s.syncedMu.Unlock()
+		return ActionUnchanged, nil
+	case dst.CurrentVersion >= oldest:
+		oldest = dst.CurrentVersion + 1
+	}
+
+	action := ActionUpdated
+	var (
+		destData           map[string]interface{}
+		written            int
+		deleted, destroyed []int64
+	)
+	for ver := oldest; ver <= meta.CurrentVersion; ver++ {
+		vm, ok := meta.Versions[strconv.FormatInt(ver, 10)]
+		if !ok {
+			s.log.Debug().Str("secret", path).Int64("version", ver).Msg("Skipping pruned version")
+			continue
+		}
+
+		var destVersion int64
+		if vm.Destroyed || vm.DeletionTime != "" {
+			destPath, destVersion, err = s.writePlaceholder(ctx, mount, path)
+			if err != nil {
+				return ActionFailed, fmt.Errorf("version %d: %w", ver, err)
+			}
+			destData = nil
+			if vm.Destroyed {
+				destroyed = append(destroyed, destVersion)
+			} else {
+				deleted = append(deleted, destVersion)
+			}
+		} else {
+			srcData, err := s.readSource(ctx, mount, path, ver)
+			if err != nil {
+				return ActionFailed, fmt.Errorf("version %d: %w", ver, err)
+			}
+			if ver == meta.CurrentVersion {
+				if sum, err := s.checksum(srcData); err == nil {
+					s.report.content(path, sum)
+				}
+			}
+
+			destPath, destData, destVersion, err = s.writeDestination(ctx, mount, path, srcData, ver)
+			if err != nil {
+				return ActionFailed, fmt.Errorf("version %d: %w", ver, err)
+			}
+		}
+		if written == 0 && destVersion == 1 {
+			action = ActionCreated
+		}
+		written++
+	}
+
+	if written == 0 {
+		s.log.Debug().Str("secret", path).Msg("Secret has no versions")
+		return ActionSkipped, nil
+	}
+
+	if err := s.markVersions(ctx, mount, destPath, "delete", deleted); err != nil {
+		return ActionFailed, err
+	}
+	if err := s.markVersions(ctx, mount, destPath, "destroy", destroyed); err != nil {
+		return ActionFailed, err
+	}
+
+	s.log.Debug().Str("secret", path).Int("versions", written).Int("deleted", len(deleted)).Int("destroyed", len(destroyed)).Msg("Version history replayed")
+	if destData == nil {
+		// The current version is deleted or destroyed, so there is nothing to read back.
+		s.log.Debug().Str("secret", path).Msg("Current version is not readable, skipping verification")
+		s.syncedMu.Lock()
+		s.desired[destPath] = true
+		s.syncedMu.Unlock()
+		return action, nil
+	}
+	return action, s.recordSynced(path, destPath, destData)
+}
+
+// writePlaceholder writes a placeholder version standing in for a deleted or
+// destroyed source version, bypassing schema validation and chunking.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The source path of the secret.
+//
+// Returns:
+//
+//	string - The destination path the placeholder was written to.
+//	int64 - The destination version created by the write.
+//	error - An error if the placeholder could not be written.
+func (s *Syncer) writePlaceholder(ctx context.Context, mount, path string) (string, int64, error) {
+	destPath, _, err := s.transformer.Transform(path, map[string]interface{}{})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to transform secret: %w", err)
+	}
+
+	if err := s.awaitDestination(ctx); err != nil {
+		return "", 0, err
+	}
+	release, err := acquire(ctx, s.writeSlots)
+	if err != nil {
+		return "", 0, err
+	}
+	defer release()
+
+	mount = s.destMount(mount)
+	body := s.kvBody(ctx, s.destinationVault, mount, map[string]interface{}{placeholderKey: true})
+	var resp *vault.Response[map[string]interface{}]
+	writeCtx, writeSpan := s.startSpan(ctx, "write placeholder", mount, destPath)
+	err = s.withRetry(writeCtx, "write placeholder", func() (err error) {
+		if err := s.writeLimiter.Wait(writeCtx); err != nil {
+			return err
+		}
+		resp, err = s.destinationVault.Write(writeCtx, s.kvPath(writeCtx, s.destinationVault, mount, "data", destPath), body, vault.WithMountPath(mount))
+		return err
+	})
+	endSpan(writeSpan, err)
+	s.destinationResult(err)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write placeholder version: %w", err)
+	}
+	var destVersion int64
+	if resp != nil {
+		destVersion = version(resp.Data)
+	}
+	s.audit(AuditRecord{Operation: AuditWrite, Target: AuditDestination, Mount: mount, Path: destPath, SourcePath: path, DestinationVersion: destVersion}, nil)
+	return destPath, destVersion, nil
+}
+
+// markVersions soft-deletes or destroys versions of a destination secret.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	destPath: string - The destination path of the secret.
+//	op: string - Either "delete" or "destroy".
+//	versions: []int64 - The versions to mark; nothing is done if empty.
+//
+// Returns:
+//
+//	error - An error if the versions could not be marked.
+func (s *Syncer) markVersions(ctx context.Context, mount, destPath, op string, versions []int64) error {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	err := s.withRetry(ctx, op+" versions", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.Write(ctx, s.destMount(mount)+"/"+op+"/"+destPath, map[string]interface{}{"versions": versions}, vault.WithMountPath(s.destMount(mount)))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to %s destination versions %v: %w", op, versions, err)
+	}
+	for _, v := range versions {
+		s.audit(AuditRecord{Operation: op, Target: AuditDestination, Mount: s.destMount(mount), Path: destPath, DestinationVersion: v}, nil)
+	}
+	return nil
+}
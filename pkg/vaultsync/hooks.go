@@ -0,0 +1,111 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSkipSecret can be returned by a BeforeWrite hook to skip a secret
+// instead of failing it.
+var ErrSkipSecret = errors.New("secret skipped by hook")
+
+type (
+	// Hooks are called for each secret a sync or import handles. Every hook
+	// is optional, and hooks run on the worker handling the secret, so they
+	// must be safe for concurrent use and should return quickly.
+	Hooks struct {
+		// BeforeWrite is called with the transformed data before it is
+		// written. Returning ErrSkipSecret skips the secret; any other
+		// error fails it, and nothing is written either way.
+		BeforeWrite func(ctx context.Context, e SecretEvent) error
+		// AfterWrite is called after the secret was written, with the
+		// destination version.
+		AfterWrite func(ctx context.Context, e SecretEvent)
+		// OnError is called when the secret failed.
+		OnError func(ctx context.Context, e SecretEvent, err error)
+		// OnSkip is called when the secret or folder was skipped.
+		OnSkip func(ctx context.Context, e SecretEvent)
+	}
+
+	// SecretEvent describes the secret a hook is called for. Data,
+	// DestinationPath, and Version are only set for BeforeWrite and
+	// AfterWrite. Hooks must not modify Data.
+	SecretEvent struct {
+		Mount           string
+		Path            string
+		DestinationPath string
+		Data            map[string]interface{}
+		Version         int64
+	}
+)
+
+// WithHooks calls h for each secret. It can be given more than once; hooks
+// run in the order they were added, and the first BeforeWrite error wins.
+//
+// Arguments:
+//
+//	h: Hooks - The hooks to call.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithHooks(h Hooks) Option {
+	return func(s *Syncer) {
+		s.hooks = append(s.hooks, h)
+	}
+}
+
+// beforeWrite runs the BeforeWrite hooks, stopping at the first error.
+func (s *Syncer) beforeWrite(ctx context.Context, e SecretEvent) error {
+	for _, h := range s.hooks {
+		if h.BeforeWrite == nil {
+			continue
+		}
+		if err := h.BeforeWrite(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterWrite runs the AfterWrite hooks.
+func (s *Syncer) afterWrite(ctx context.Context, e SecretEvent) {
+	for _, h := range s.hooks {
+		if h.AfterWrite != nil {
+			h.AfterWrite(ctx, e)
+		}
+	}
+}
+
+// outcomeHooks runs the OnSkip or OnError hooks for a finished secret, and
+// turns a BeforeWrite veto into a skip.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount of the secret.
+//	path: string - The source path of the secret.
+//	action: Action - What happened to the secret.
+//	err: error - The error the secret failed with, if any.
+//
+// Returns:
+//
+//	Action - The action to record.
+//	error - The error to record.
+func (s *Syncer) outcomeHooks(ctx context.Context, mount, path string, action Action, err error) (Action, error) {
+	if errors.Is(err, ErrSkipSecret) {
+		s.log.Debug().Str("secret", path).Msg("Secret skipped by hook")
+		action, err = ActionSkipped, nil
+	}
+
+	e := SecretEvent{Mount: mount, Path: path}
+	for _, h := range s.hooks {
+		switch {
+		case err != nil && h.OnError != nil:
+			h.OnError(ctx, e, err)
+		case err == nil && action == ActionSkipped && h.OnSkip != nil:
+			h.OnSkip(ctx, e)
+		}
+	}
+	return action, err
+}
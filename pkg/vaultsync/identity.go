@@ -0,0 +1,304 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+type (
+	// IdentityReport is the structured result of SyncIdentity. Unmapped
+	// lists aliases whose auth mount has no counterpart on the destination,
+	// which were not copied.
+	IdentityReport struct {
+		DryRun       bool      `json:"dryRun"`
+		StartedAt    time.Time `json:"startedAt"`
+		FinishedAt   time.Time `json:"finishedAt"`
+		Entities     int       `json:"entities"`
+		Aliases      int       `json:"aliases"`
+		Groups       int       `json:"groups"`
+		GroupAliases int       `json:"groupAliases"`
+		Unmapped     []string  `json:"unmapped,omitempty"`
+		Errors       []string  `json:"errors,omitempty"`
+	}
+
+	// identitySync holds the state of a single SyncIdentity run.
+	identitySync struct {
+		*Syncer
+		dryRun bool
+		report *IdentityReport
+		// accessors maps source auth mount accessors to destination ones.
+		accessors map[string]string
+		// mountPaths maps source auth mount accessors to their paths.
+		mountPaths map[string]string
+		// entities and groups map source IDs to destination IDs.
+		entities map[string]string
+		groups   map[string]string
+	}
+)
+
+// SyncIdentity copies identity entities, entity aliases, and internal and
+// external groups with their aliases from the source vault to the
+// destination vault. Entities and groups are matched by name, and alias
+// mount accessors are remapped to the destination auth mount at the same
+// path; aliases whose mount does not exist on the destination are reported
+// instead of copied. Entity and group IDs differ between clusters, so group
+// memberships are rewritten to the destination IDs.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	dryRun: bool - Only report what would be copied instead of writing it.
+//
+// Returns:
+//
+//	*IdentityReport - What was copied.
+//	error - An error if the auth mounts could not be listed, or anything failed to copy.
+func (s *Syncer) SyncIdentity(ctx context.Context, dryRun bool) (*IdentityReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("identity sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("identity sync"); err != nil {
+		return nil, err
+	}
+
+	is := &identitySync{
+		Syncer:     s,
+		dryRun:     dryRun,
+		report:     &IdentityReport{DryRun: dryRun, StartedAt: time.Now().UTC()},
+		accessors:  make(map[string]string),
+		mountPaths: make(map[string]string),
+		entities:   make(map[string]string),
+		groups:     make(map[string]string),
+	}
+	if err := is.mapAccessors(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := is.syncEntities(ctx); err != nil {
+		return is.report, err
+	}
+	if err := is.syncGroups(ctx); err != nil {
+		return is.report, err
+	}
+	is.report.FinishedAt = time.Now().UTC()
+
+	if len(is.report.Errors) > 0 {
+		return is.report, fmt.Errorf("%d identity objects failed to sync", len(is.report.Errors))
+	}
+	return is.report, nil
+}
+
+// mapAccessors pairs each source auth mount's accessor with the accessor of
+// the destination auth mount at the same path and of the same type.
+func (is *identitySync) mapAccessors(ctx context.Context) error {
+	src, err := is.authMounts(ctx, is.sourceVault, is.readLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to list source auth methods: %w", err)
+	}
+	dst, err := is.authMounts(ctx, is.destinationVault, is.writeLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to list destination auth methods: %w", err)
+	}
+
+	for p, m := range src {
+		acc, _ := m["accessor"].(string)
+		is.mountPaths[acc] = p
+		d, ok := dst[p]
+		if !ok || d["type"] != m["type"] {
+			continue
+		}
+		if dstAcc, _ := d["accessor"].(string); dstAcc != "" {
+			is.accessors[acc] = dstAcc
+		}
+	}
+	return nil
+}
+
+// syncEntities copies every entity and its aliases.
+func (is *identitySync) syncEntities(ctx context.Context) error {
+	ids, err := is.listSourceKeys(ctx, "identity/entity/id")
+	if err != nil {
+		return fmt.Errorf("failed to list entities: %w", err)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		entity, err := is.readSourceData(ctx, "identity/entity/id/"+id)
+		if err != nil || entity == nil {
+			is.fail("entity %s: failed to read: %v", id, err)
+			continue
+		}
+		name, _ := entity["name"].(string)
+
+		dstID, err := is.upsert(ctx, "identity/entity/name/"+name, map[string]interface{}{
+			"metadata": entity["metadata"],
+			"policies": entity["policies"],
+			"disabled": entity["disabled"],
+		})
+		if err != nil {
+			is.fail("entity %s: %v", name, err)
+			continue
+		}
+		is.entities[id] = dstID
+		is.report.Entities++
+
+		aliases, _ := entity["aliases"].([]interface{})
+		for _, a := range aliases {
+			alias, _ := a.(map[string]interface{})
+			is.syncAlias(ctx, "identity/entity-alias", "entity "+name, alias, dstID)
+		}
+	}
+	return nil
+}
+
+// syncGroups copies every group, in two passes so member groups can refer
+// to groups created later, and the aliases of external groups.
+func (is *identitySync) syncGroups(ctx context.Context) error {
+	ids, err := is.listSourceKeys(ctx, "identity/group/id")
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+	sort.Strings(ids)
+
+	groups := make(map[string]map[string]interface{})
+	for _, id := range ids {
+		group, err := is.readSourceData(ctx, "identity/group/id/"+id)
+		if err != nil || group == nil {
+			is.fail("group %s: failed to read: %v", id, err)
+			continue
+		}
+		name, _ := group["name"].(string)
+
+		body := map[string]interface{}{
+			"type":     group["type"],
+			"metadata": group["metadata"],
+			"policies": group["policies"],
+		}
+		if group["type"] != "external" {
+			body["member_entity_ids"] = is.remap(is.entities, group["member_entity_ids"])
+		}
+		dstID, err := is.upsert(ctx, "identity/group/name/"+name, body)
+		if err != nil {
+			is.fail("group %s: %v", name, err)
+			continue
+		}
+		is.groups[id] = dstID
+		groups[id] = group
+		is.report.Groups++
+	}
+
+	for _, id := range ids {
+		group, ok := groups[id]
+		if !ok {
+			continue
+		}
+		name, _ := group["name"].(string)
+
+		if members, _ := group["member_group_ids"].([]interface{}); len(members) > 0 && !is.dryRun {
+			err := is.writeDestinationData(ctx, "identity/group/name/"+name, map[string]interface{}{
+				"member_group_ids": is.remap(is.groups, members),
+			})
+			if err != nil {
+				is.fail("group %s: failed to set member groups: %v", name, err)
+			}
+		}
+		if alias, _ := group["alias"].(map[string]interface{}); len(alias) > 0 && group["type"] == "external" {
+			is.syncAlias(ctx, "identity/group-alias", "group "+name, alias, is.groups[id])
+		}
+	}
+	return nil
+}
+
+// syncAlias creates an entity or group alias on the destination, under the
+// destination accessor of its auth mount.
+func (is *identitySync) syncAlias(ctx context.Context, endpoint, owner string, alias map[string]interface{}, canonicalID string) {
+	name, _ := alias["name"].(string)
+	acc, _ := alias["mount_accessor"].(string)
+
+	dstAcc, ok := is.accessors[acc]
+	if !ok {
+		mount := is.mountPaths[acc]
+		if mount == "" {
+			mount = acc
+		}
+		is.report.Unmapped = append(is.report.Unmapped, fmt.Sprintf("%s alias %s on %s", owner, name, mount))
+		return
+	}
+
+	if !is.dryRun {
+		body := map[string]interface{}{
+			"name":           name,
+			"mount_accessor": dstAcc,
+			"canonical_id":   canonicalID,
+		}
+		if cm, ok := alias["custom_metadata"]; ok {
+			body["custom_metadata"] = cm
+		}
+		err := is.writeDestinationData(ctx, endpoint, body)
+		// Aliases are keyed by mount and name; an existing one is left as is.
+		if err != nil && !strings.Contains(err.Error(), "already in use") {
+			is.fail("%s alias %s: %v", owner, name, err)
+			return
+		}
+	}
+
+	if endpoint == "identity/group-alias" {
+		is.report.GroupAliases++
+	} else {
+		is.report.Aliases++
+	}
+}
+
+// upsert writes an entity or group by name and returns its destination ID.
+// In a dry run the ID of an existing object is returned, if any.
+func (is *identitySync) upsert(ctx context.Context, p string, body map[string]interface{}) (string, error) {
+	if !is.dryRun {
+		if err := is.writeDestinationData(ctx, p, body); err != nil {
+			return "", fmt.Errorf("failed to write: %w", err)
+		}
+	}
+
+	var id string
+	err := is.withRetry(ctx, "read", func() error {
+		if err := is.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := is.destinationVault.Read(ctx, p)
+		if vault.IsErrorStatus(err, 404) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id, _ = resp.Data["id"].(string)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read back: %w", err)
+	}
+	return id, nil
+}
+
+// remap translates source IDs to destination IDs, dropping IDs that were
+// not copied.
+func (is *identitySync) remap(ids map[string]string, v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if src, ok := item.(string); ok && ids[src] != "" {
+			out = append(out, ids[src])
+		}
+	}
+	return out
+}
+
+func (is *identitySync) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	is.log.Error().Str("error", msg).Msg("Failed to sync identity")
+	is.report.Errors = append(is.report.Errors, msg)
+}
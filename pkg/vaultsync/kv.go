@@ -0,0 +1,204 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// kvMountKey identifies a mount on one of the two vaults.
+	kvMountKey struct {
+		client *vault.Client
+		mount  string
+	}
+
+	// uiMount is the part of a sys/internal/ui/mounts entry that holds the
+	// mount's KV version.
+	uiMount struct {
+		Type    string            `json:"type"`
+		Options map[string]string `json:"options"`
+	}
+)
+
+// kvVersion returns the KV version, 1 or 2, of mount on client. Unless the
+// vault's KVVersion pins it, it is detected on first use from
+// sys/internal/ui/mounts, which any token that can read the mount may
+// query, and remembered for the life of the Syncer. A mount whose version
+// cannot be detected is assumed to be KV v2.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The source or destination vault.
+//	mount: string - The mount path.
+//
+// Returns:
+//
+//	int - The KV version of the mount.
+func (s *Syncer) kvVersion(ctx context.Context, client *vault.Client, mount string) int {
+	name, cfg, limiter := "destination", s.cfg.DestinationVault, s.writeLimiter
+	if client == s.sourceVault {
+		name, cfg, limiter = "source", s.cfg.SourceVault, s.readLimiter
+	}
+	if cfg != nil && cfg.KVVersion != 0 {
+		return cfg.KVVersion
+	}
+
+	key := kvMountKey{client: client, mount: mount}
+	s.kvMu.Lock()
+	v, ok := s.kvVersions[key]
+	s.kvMu.Unlock()
+	if ok {
+		return v
+	}
+
+	v, err := s.detectKVVersion(ctx, client, mount, limiter)
+	if err != nil {
+		s.log.Warn().Err(err).Str("vault", name).Str("mount", mount).Msg("Failed to detect KV version, assuming KV v2")
+		v = 2
+	} else if v == 1 {
+		s.log.Info().Str("vault", name).Str("mount", mount).Msg("Detected KV v1 mount")
+	}
+
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	if s.kvVersions == nil {
+		s.kvVersions = make(map[kvMountKey]int)
+	}
+	s.kvVersions[key] = v
+	return v
+}
+
+// detectKVVersion reads the KV version of mount from sys/internal/ui/mounts.
+func (s *Syncer) detectKVVersion(ctx context.Context, client *vault.Client, mount string, limiter *rate.Limiter) (int, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "read mount", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, "sys/internal/ui/mounts/"+strings.Trim(mount, "/"))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read mount %q: %w", mount, err)
+	}
+
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return 0, err
+	}
+	var m uiMount
+	if err := json.Unmarshal(b, &m); err != nil {
+		return 0, fmt.Errorf("failed to decode mount %q: %w", mount, err)
+	}
+
+	switch {
+	case m.Options["version"] == "2":
+		return 2, nil
+	case m.Type == "kv" || m.Type == "generic":
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("mount %q is a %s mount, not a KV mount", mount, m.Type)
+	}
+}
+
+// kvPath returns the API path of path in mount on client: below prefix,
+// "data" or "metadata", on a KV v2 mount and directly below the mount on a
+// KV v1 mount, which has neither.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The source or destination vault.
+//	mount: string - The mount path.
+//	prefix: string - "data" or "metadata".
+//	path: string - The secret or folder path.
+//
+// Returns:
+//
+//	string - The path to request.
+func (s *Syncer) kvPath(ctx context.Context, client *vault.Client, mount, prefix, path string) string {
+	if s.kvVersion(ctx, client, mount) == 1 {
+		return mount + "/" + path
+	}
+	return mount + "/" + prefix + "/" + path
+}
+
+// kvBody returns the request body writing data to mount on client: KV v2
+// takes it below "data", KV v1 as is.
+func (s *Syncer) kvBody(ctx context.Context, client *vault.Client, mount string, data map[string]interface{}) map[string]interface{} {
+	if s.kvVersion(ctx, client, mount) == 1 {
+		return data
+	}
+	return map[string]interface{}{"data": data}
+}
+
+// kvData returns the secret data and metadata of a read from mount on
+// client. A KV v1 secret is the response data itself and has no metadata.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The source or destination vault.
+//	mount: string - The mount path.
+//	resp: map[string]interface{} - The data of the read response.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data, or nil if there is none.
+//	map[string]interface{} - The secret metadata, or nil for KV v1.
+func (s *Syncer) kvData(ctx context.Context, client *vault.Client, mount string, resp map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	if s.kvVersion(ctx, client, mount) == 1 {
+		return resp, nil
+	}
+	data, _ := resp["data"].(map[string]interface{})
+	meta, _ := resp["metadata"].(map[string]interface{})
+	return data, meta
+}
+
+// checkKVFeatures fails if a feature built on KV v2 versions and metadata,
+// metadata-only sync, history, bidirectional sync, or the "newer" conflict
+// strategy, is enabled and the mount is KV v1 on either vault, or if
+// metadataFilter is set and the source mount is KV v1.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The source mount.
+//
+// Returns:
+//
+//	error - An error if an enabled feature cannot work on the mount.
+func (s *Syncer) checkKVFeatures(ctx context.Context, mount string) error {
+	// Only the source's custom_metadata is filtered on.
+	if s.cfg.MetadataFilter.Enabled() && s.source == nil && s.kvVersion(ctx, s.sourceVault, mount) == 1 {
+		return fmt.Errorf("metadataFilter needs a KV v2 mount, but source mount %q is KV v1", mount)
+	}
+
+	var feature string
+	switch {
+	case s.cfg.MetadataOnly:
+		feature = "metadataOnly"
+	case s.cfg.History.Enabled:
+		feature = "history"
+	case s.cfg.Bidirectional.Enabled:
+		feature = "bidirectional"
+	case s.cfg.OnConflict == ConflictNewer:
+		feature = "onConflict newer"
+	default:
+		return nil
+	}
+
+	if s.source == nil && s.kvVersion(ctx, s.sourceVault, mount) == 1 {
+		return fmt.Errorf("%s needs a KV v2 mount, but source mount %q is KV v1", feature, mount)
+	}
+	if s.destination == nil && s.kvVersion(ctx, s.destinationVault, s.destMount(mount)) == 1 {
+		return fmt.Errorf("%s needs a KV v2 mount, but destination mount %q is KV v1", feature, s.destMount(mount))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package vaultsync
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// stageRead is reading a secret from the source.
+	stageRead = "read"
+	// stageWrite is comparing a secret with, and writing it to, the
+	// destination.
+	stageWrite = "write"
+	// stageVerify is reading a secret back from the destination.
+	stageVerify = "verify"
+)
+
+type (
+	// Latency summarizes how long secrets took in each stage of a run, to
+	// find pathological secrets, such as huge payloads, and slow clusters.
+	Latency struct {
+		Read   Percentiles `json:"read"`
+		Write  Percentiles `json:"write"`
+		Verify Percentiles `json:"verify"`
+		Total  Percentiles `json:"total"`
+	}
+
+	// Percentiles are the percentiles of a set of durations. Count is how
+	// many there were; the rest are zero if there were none.
+	Percentiles struct {
+		Count int      `json:"count"`
+		P50   Duration `json:"p50"`
+		P95   Duration `json:"p95"`
+		P99   Duration `json:"p99"`
+		Max   Duration `json:"max"`
+	}
+
+	// stageTimings is how long a secret spent in each stage.
+	stageTimings struct {
+		read, write, verify time.Duration
+	}
+)
+
+// timing adds d to the time the secret at path spent in stage. Safe for
+// concurrent use.
+//
+// Arguments:
+//
+//	path: string - The source path of the secret.
+//	stage: string - stageRead, stageWrite, or stageVerify.
+//	d: time.Duration - How long the stage took.
+//
+// Returns: nothing
+func (r *Report) timing(path, stage string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.timings[path]
+	if !ok {
+		t = &stageTimings{}
+		r.timings[path] = t
+	}
+	switch stage {
+	case stageRead:
+		t.read += d
+	case stageWrite:
+		t.write += d
+	case stageVerify:
+		t.verify += d
+	}
+}
+
+// newLatency computes the latency percentiles of every stage from the
+// timings of results.
+func newLatency(results []SecretResult) *Latency {
+	var read, write, verify, total []time.Duration
+	for _, res := range results {
+		for _, s := range []struct {
+			d   Duration
+			all *[]time.Duration
+		}{{res.Read, &read}, {res.Write, &write}, {res.Verify, &verify}, {res.Duration, &total}} {
+			if s.d > 0 {
+				*s.all = append(*s.all, time.Duration(s.d))
+			}
+		}
+	}
+	if len(total) == 0 {
+		return nil
+	}
+	return &Latency{
+		Read:   newPercentiles(read),
+		Write:  newPercentiles(write),
+		Verify: newPercentiles(verify),
+		Total:  newPercentiles(total),
+	}
+}
+
+// newPercentiles computes the nearest-rank percentiles of ds, sorting it.
+func newPercentiles(ds []time.Duration) Percentiles {
+	p := Percentiles{Count: len(ds)}
+	if len(ds) == 0 {
+		return p
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	rank := func(q float64) Duration {
+		return Duration(ds[int(math.Ceil(q*float64(len(ds))))-1])
+	}
+	p.P50, p.P95, p.P99, p.Max = rank(0.50), rank(0.95), rank(0.99), Duration(ds[len(ds)-1])
+	return p
+}
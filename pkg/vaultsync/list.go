@@ -0,0 +1,125 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	// ListSource lists the source vault, or the external Source.
+	ListSource = "source"
+	// ListDestination lists the destination vault.
+	ListDestination = "destination"
+)
+
+// ListedSecret is a secret or folder found by List.
+type ListedSecret struct {
+	Path   string `json:"path"`
+	Folder bool   `json:"folder,omitempty"`
+	// Denied means the token may not list the folder, so it was skipped.
+	Denied bool `json:"denied,omitempty"`
+}
+
+// List enumerates the secrets under path on one side of the sync, in the
+// source mount, which is also where secrets are written on the destination.
+// Without recursive only the keys directly under path are listed, folders
+// included; with it every secret below path is listed and folders are not,
+// listing up to Concurrency.ListWorkers folders at once. Folders the token
+// may not list are returned as Denied instead of failing the listing.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	side: string - ListSource or ListDestination.
+//	path: string - The path to list, or empty for the configured source path.
+//	recursive: bool - Whether to descend into folders.
+//
+// Returns:
+//
+//	[]ListedSecret - The secrets and folders found, sorted by path.
+//	error - An error if the side is unknown or a path could not be listed.
+func (s *Syncer) List(ctx context.Context, side, path string, recursive bool) ([]ListedSecret, error) {
+	mount := s.cfg.SourceVault.Mount
+	if path == "" {
+		path = s.cfg.SourceVault.Path
+	}
+	path = strings.TrimPrefix(path, "/")
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	var list func(ctx context.Context, p string) ([]string, error)
+	switch side {
+	case ListSource:
+		list = func(ctx context.Context, p string) ([]string, error) {
+			return s.listSourcePath(ctx, mount, p)
+		}
+	case ListDestination:
+		if s.destination != nil || s.destinationVault == nil {
+			return nil, fmt.Errorf("listing the destination requires a vault destination")
+		}
+		list = func(ctx context.Context, p string) ([]string, error) {
+			return s.listPath(ctx, s.destinationVault, s.writeLimiter, mount, p)
+		}
+	default:
+		return nil, fmt.Errorf("side must be %s or %s, not %q", ListSource, ListDestination, side)
+	}
+
+	workers := s.cfg.Concurrency.ListWorkers
+	if workers < 1 {
+		workers = s.cfg.BatchSize
+	}
+
+	// Each level of folders is listed on a pool of ListWorkers workers.
+	retVal := make([]ListedSecret, 0)
+	pending := []string{path}
+	for len(pending) > 0 {
+		var (
+			mu       sync.Mutex
+			next     []string
+			firstErr error
+		)
+		runPool(ctx, workers, pending, func(ctx context.Context, p string) {
+			keys, err := list(ctx, p)
+			mu.Lock()
+			defer mu.Unlock()
+			if vault.IsErrorStatus(err, 404) {
+				return
+			}
+			if vault.IsErrorStatus(err, 403) {
+				s.log.Warn().Str("folder", p).Str("mount", mount).Msg("Permission denied listing folder, skipping it")
+				retVal = append(retVal, ListedSecret{Path: p, Folder: true, Denied: true})
+				return
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to list %s: %w", mount+"/"+p, err)
+				}
+				return
+			}
+			for _, k := range keys {
+				folder := strings.HasSuffix(k, "/")
+				if folder && recursive {
+					next = append(next, p+k)
+					continue
+				}
+				retVal = append(retVal, ListedSecret{Path: p + k, Folder: folder})
+			}
+		})
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pending = next
+	}
+
+	sort.Slice(retVal, func(i, j int) bool { return retVal[i].Path < retVal[j].Path })
+	return retVal, nil
+}
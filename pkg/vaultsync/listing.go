@@ -0,0 +1,255 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"golang.org/x/time/rate"
+)
+
+// maxErrorBody bounds how much of an error response is read into the
+// returned error.
+const maxErrorBody = 64 << 10
+
+// streamListing reports whether the copy stage can start on the source keys
+// as they are listed. It cannot when something needs the whole listing
+// first: a bidirectional sync merges it with the destination's, an approver
+// is shown every secret of the plan, a percentage maxErrors is taken of the
+// total, and an ordered sync sorts it.
+func (s *Syncer) streamListing() bool {
+	return !s.cfg.Bidirectional.Enabled && s.approver == nil && !s.cfg.Ordered && !strings.HasSuffix(strings.TrimSpace(s.cfg.MaxErrors), "%")
+}
+
+// streamSourcePath lists the keys directly under path on the source like
+// listSourcePath, but sends each key into the returned channel as soon as
+// it is decoded, so a path with hundreds of thousands of children is never
+// held in memory as a whole. Keys of other shards are dropped. The channel
+// is closed when the listing ends or ctx is cancelled.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation; cancelling it stops the listing.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the source vault to list.
+//	buffer: int - How many keys to decode ahead of the consumer.
+//
+// Returns:
+//
+//	<-chan string - The keys under path, folders with a trailing slash.
+//	func() (time.Time, error) - Waits for the listing to end and returns when it ended and its error; call it once the channel is closed or ctx is cancelled.
+func (s *Syncer) streamSourcePath(ctx context.Context, mount, path string, buffer int) (<-chan string, func() (time.Time, error)) {
+	type result struct {
+		finished time.Time
+		err      error
+	}
+	keys := make(chan string, buffer)
+	done := make(chan result, 1)
+	send := func(key string) error {
+		if isSecretKey(key) && !s.cfg.Shard.owns(path+key) {
+			return nil
+		}
+		select {
+		case keys <- key:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(keys)
+		ctx, span := s.startSpan(ctx, "list source", mount, path)
+		s.log.Debug().Str("path", path).Str("mount", mount).Msg("Streaming source vault listing")
+
+		var err error
+		if s.source != nil {
+			// Integrations list in one call, so there is nothing to stream
+			// but the hand-off to the copy stage.
+			var list []string
+			if list, err = s.listSourcePath(ctx, mount, path); err == nil {
+				for _, key := range list {
+					if err = send(key); err != nil {
+						break
+					}
+				}
+			}
+		} else {
+			err = s.eachPathKey(ctx, s.sourceVault, s.readLimiter, mount, path, send)
+		}
+		endSpan(span, err)
+		done <- result{finished: time.Now(), err: err}
+	}()
+	return keys, func() (time.Time, error) {
+		r := <-done
+		return r.finished, r.err
+	}
+}
+
+// eachPathKey lists the keys directly under path in a KV mount like
+// listPath, calling fn for each key while the response is still being
+// read instead of decoding it whole. The List request timeout bounds only
+// the wait for the response, not reading it; ctx bounds the rest. Only the
+// request is retried: once keys have gone to fn, an error ends the listing.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to list.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The mount path.
+//	path: string - The path to list.
+//	fn: func(string) error - Called with each key, folders with a trailing slash; an error stops the listing.
+//
+// Returns:
+//
+//	error - An error if the path could not be listed, or the error of fn.
+func (s *Syncer) eachPathKey(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount, path string, fn func(string) error) error {
+	var resp *http.Response
+	err := s.withRetry(ctx, "list", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.ReadRaw(withStreamedList(ctx), s.kvPath(ctx, client, mount, "metadata", path), vault.WithQueryParameters(url.Values{"list": {"true"}}))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 399 {
+			defer resp.Body.Close()
+			return responseError(resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeListKeys(resp.Body, fn)
+}
+
+// responseError turns an error response read raw into the *vault.ResponseError
+// the client returns for it otherwise, so vault.IsErrorStatus still works.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &vault.ResponseError{StatusCode: resp.StatusCode, OriginalRequest: resp.Request}
+	var parsed struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && len(parsed.Errors) > 0 {
+		e.Errors = parsed.Errors
+	} else {
+		e.RawResponseBytes = body
+	}
+	return e
+}
+
+// decodeListKeys calls fn with each entry of data.keys of a LIST response,
+// decoding one key at a time.
+func decodeListKeys(r io.Reader, fn func(string) error) error {
+	dec := json.NewDecoder(r)
+	found := false
+	var fnErr error
+	err := eachField(dec, func(name string) error {
+		if name != "data" {
+			return skipValue(dec)
+		}
+		return eachField(dec, func(name string) error {
+			if name != "keys" {
+				return skipValue(dec)
+			}
+			found = true
+			return eachElement(dec, func() error {
+				var key string
+				if err := dec.Decode(&key); err != nil {
+					return err
+				}
+				fnErr = fn(key)
+				return fnErr
+			})
+		})
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode list response: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("vault returned an empty list")
+	}
+	return nil
+}
+
+// eachField calls fn with the name of each field of the JSON object next in
+// dec, which must consume the field's value. A null is an object without
+// fields.
+func eachField(dec *json.Decoder, fn func(string) error) error {
+	if err := openDelim(dec, '{'); err != nil {
+		if errors.Is(err, errNull) {
+			return nil
+		}
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := tok.(string)
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// eachElement calls fn for each element of the JSON array next in dec,
+// which must consume the element. A null is an empty array.
+func eachElement(dec *json.Decoder, fn func() error) error {
+	if err := openDelim(dec, '['); err != nil {
+		if errors.Is(err, errNull) {
+			return nil
+		}
+		return err
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// errNull is returned by openDelim when the next value is null.
+var errNull = errors.New("null")
+
+// openDelim consumes the opening delimiter of the object or array next in
+// dec.
+func openDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return errNull
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// skipValue consumes the JSON value next in dec.
+func skipValue(dec *json.Decoder) error {
+	var v json.RawMessage
+	return dec.Decode(&v)
+}
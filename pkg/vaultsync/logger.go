@@ -0,0 +1,101 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// Option configures optional behaviour of a Syncer.
+	Option func(*Syncer)
+
+	// slogWriter is a zerolog.LevelWriter that re-emits zerolog's JSON events
+	// as slog records, so a zerolog.Logger can write through an slog.Handler.
+	slogWriter struct {
+		handler slog.Handler
+	}
+)
+
+// WithLogger sets the logger the Syncer and all of its components write to.
+// zerolog.Logger is safe for concurrent use as long as its writer is, so the
+// same logger may be shared with the host application. Wrap its writer with
+// NewRedactWriter to keep secret values out of the logs.
+//
+// Arguments:
+//
+//	l: zerolog.Logger - The logger to use.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithLogger(l zerolog.Logger) Option {
+	return func(s *Syncer) {
+		s.log = l
+	}
+}
+
+// WithSlogHandler routes all Syncer logging through the given slog.Handler.
+// Secret values are redacted before records reach the handler.
+//
+// Arguments:
+//
+//	h: slog.Handler - The handler to write to.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithSlogHandler(h slog.Handler) Option {
+	return func(s *Syncer) {
+		s.log = zerolog.New(&slogWriter{handler: h}).With().Timestamp().Logger()
+	}
+}
+
+func (w *slogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *slogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	lvl := slogLevel(level)
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, lvl) {
+		return len(p), nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(redact(p), &fields); err != nil {
+		return 0, fmt.Errorf("failed to decode log event: %w", err)
+	}
+
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.LevelFieldName)
+	delete(fields, zerolog.TimestampFieldName)
+
+	rec := slog.NewRecord(zerolog.TimestampFunc(), lvl, msg, 0)
+	for k, v := range fields {
+		rec.AddAttrs(slog.Any(k, v))
+	}
+
+	if err := w.handler.Handle(ctx, rec); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// slogLevel maps a zerolog level onto the nearest slog level.
+func slogLevel(level zerolog.Level) slog.Level {
+	switch {
+	case level <= zerolog.DebugLevel:
+		return slog.LevelDebug
+	case level == zerolog.InfoLevel, level == zerolog.NoLevel:
+		return slog.LevelInfo
+	case level == zerolog.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,252 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manifest records the checksum of every secret in a vault subtree at a
+// point in time. Its JSON encoding is deterministic for the same contents,
+// so the file can be signed and its signature checked with standard tools.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Vault is ListSource or ListDestination.
+	Vault   string `json:"vault"`
+	Address string `json:"address"`
+	Mount   string `json:"mount"`
+	Path    string `json:"path"`
+	Secrets int    `json:"secrets"`
+	// Checksums holds the SHA-256 of the JSON encoding of each secret's
+	// data, hex encoded and keyed by path.
+	Checksums map[string]string `json:"checksums"`
+}
+
+// WriteManifest writes m to w as indented JSON.
+//
+// Arguments:
+//
+//	w: io.Writer - Where to write the manifest.
+//	m: *Manifest - The manifest to write.
+//
+// Returns:
+//
+//	error - An error if the manifest could not be written.
+func WriteManifest(w io.Writer, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// LoadManifest reads a manifest written by WriteManifest.
+//
+// Arguments:
+//
+//	path: string - The manifest file.
+//
+// Returns:
+//
+//	*Manifest - The manifest.
+//	error - An error if the file could not be read or is not a manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Manifest checksums every secret below path on one side of the sync, in
+// the source mount, listing it like a recursive List and reading secrets on
+// a worker pool of BatchSize workers. Secrets are checksummed as stored, not
+// as a sync would transform them. No manifest is returned if any secret
+// cannot be read.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	side: string - ListSource or ListDestination.
+//	path: string - The subtree to checksum, or empty for the configured source path.
+//
+// Returns:
+//
+//	*Manifest - The checksum of every secret found.
+//	error - An error if the subtree could not be listed or any secret could not be read.
+func (s *Syncer) Manifest(ctx context.Context, side, path string) (*Manifest, error) {
+	ctx, span := s.tracer.Start(ctx, "manifest")
+	defer span.End()
+
+	m, errs, err := s.manifest(ctx, side, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, &SyncError{Total: m.Secrets + len(errs), Errors: errs}
+	}
+
+	s.log.Info().Str("vault", side).Int("secrets", m.Secrets).Msg("Manifest complete")
+	return m, nil
+}
+
+// CompareManifest checksums the live secrets below the manifest's path on
+// one side of the sync and compares them with the manifest. A secret whose
+// checksum differs is changed, one only in the manifest is missing, and one
+// only in the vault is extra. The side need not be the one the manifest was
+// generated from, so a manifest of the source can prove the destination
+// held the same secrets.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	side: string - ListSource or ListDestination.
+//	m: *Manifest - The manifest to compare against.
+//
+// Returns:
+//
+//	*DiffReport - The result of every comparison.
+//	error - An error if the manifest is of another mount or the subtree could not be listed.
+func (s *Syncer) CompareManifest(ctx context.Context, side string, m *Manifest) (*DiffReport, error) {
+	ctx, span := s.tracer.Start(ctx, "compare manifest")
+	defer span.End()
+
+	if m.Mount != s.cfg.SourceVault.Mount {
+		return nil, fmt.Errorf("manifest is of mount %q, not the configured mount %q", m.Mount, s.cfg.SourceVault.Mount)
+	}
+
+	report := &DiffReport{Mount: m.Mount, Path: m.Path, StartedAt: time.Now().UTC()}
+	live, errs, err := s.manifest(ctx, side, m.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]bool, len(errs))
+	for _, e := range errs {
+		failed[e.Path] = true
+		report.record(DiffResult{Path: e.Path, Status: DiffError, Error: e.Err.Error()})
+	}
+	for p, sum := range m.Checksums {
+		switch liveSum, ok := live.Checksums[p]; {
+		case failed[p]:
+		case !ok:
+			report.record(DiffResult{Path: p, Status: DiffMissing})
+		case liveSum != sum:
+			report.record(DiffResult{Path: p, Status: DiffChanged})
+		default:
+			report.record(DiffResult{Path: p, Status: DiffMatch})
+		}
+	}
+	for p := range live.Checksums {
+		if _, ok := m.Checksums[p]; !ok {
+			report.record(DiffResult{Path: p, Status: DiffExtra})
+		}
+	}
+
+	report.finish()
+	s.log.Info().
+		Str("vault", side).
+		Int("matched", report.Matched).
+		Int("changed", report.Changed).
+		Int("missing", report.Missing).
+		Int("extra", report.Extra).
+		Int("errors", report.Errors).
+		Msg("Manifest comparison complete")
+	return report, nil
+}
+
+// manifest lists and checksums the secrets below path, returning the
+// secrets that could not be read separately.
+func (s *Syncer) manifest(ctx context.Context, side, path string) (*Manifest, []*SecretError, error) {
+	listed, err := s.List(ctx, side, path, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		read    func(ctx context.Context, p string) (map[string]interface{}, error)
+		address string
+	)
+	mount := s.cfg.SourceVault.Mount
+	switch side {
+	case ListSource:
+		read = func(ctx context.Context, p string) (map[string]interface{}, error) {
+			return s.readSource(ctx, mount, p, 0)
+		}
+		address = s.sourceName()
+	case ListDestination:
+		read = func(ctx context.Context, p string) (map[string]interface{}, error) {
+			return s.readDestination(ctx, mount, p)
+		}
+		address = s.cfg.DestinationVault.Address
+	}
+
+	var (
+		paths = make([]string, 0, len(listed))
+		errs  []*SecretError
+	)
+	for _, l := range listed {
+		if l.Denied {
+			errs = append(errs, &SecretError{Path: l.Path, Err: fmt.Errorf("permission denied listing folder")})
+			continue
+		}
+		paths = append(paths, l.Path)
+	}
+	if path == "" {
+		path = s.cfg.SourceVault.Path
+	}
+
+	s.log.Info().Str("vault", side).Str("mount", mount).Str("path", path).Int("secrets", len(paths)).Msg("Checksumming secrets")
+
+	var (
+		mu   sync.Mutex
+		sums = make(map[string]string, len(paths))
+	)
+	runPool(ctx, s.cfg.BatchSize, paths, func(ctx context.Context, p string) {
+		data, err := read(ctx, p)
+		var sum [32]byte
+		if err == nil {
+			sum, err = s.checksum(data)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, &SecretError{Path: p, Err: err})
+			return
+		}
+		sums[p] = hex.EncodeToString(sum[:])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("manifest aborted: %w", err)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+
+	return &Manifest{
+		Version:   1,
+		CreatedAt: time.Now().UTC(),
+		Vault:     side,
+		Address:   address,
+		Mount:     mount,
+		Path:      path,
+		Secrets:   len(sums),
+		Checksums: sums,
+	}, errs, nil
+}
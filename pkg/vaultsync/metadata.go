@@ -0,0 +1,183 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// syncMetadata copies the KV metadata settings of a secret, but not its
+// data, to the destination secret it maps to. A destination secret that
+// does not exist yet is skipped rather than created empty.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	Action - ActionUpdated if the metadata was written, ActionUnchanged if it already matched, or ActionSkipped if the destination secret does not exist.
+//	error - An error if the metadata could not be read or written.
+func (s *Syncer) syncMetadata(ctx context.Context, mount, path string) (Action, error) {
+	destMount := s.destMount(mount)
+	start := time.Now()
+	src, err := s.readMetadata(ctx, mount, path)
+	s.report.timing(path, stageRead, time.Since(start))
+	if err != nil {
+		return ActionFailed, err
+	}
+	// Only the path rules apply; there is no data to transform.
+	destPath, _, err := s.transformer.Transform(path, nil)
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to transform secret path: %w", err)
+	}
+
+	if err := s.awaitDestination(ctx); err != nil {
+		return ActionFailed, err
+	}
+	start = time.Now()
+	defer func() { s.report.timing(path, stageWrite, time.Since(start)) }()
+
+	dst, err := s.readMetadataFrom(ctx, s.destinationVault, s.writeLimiter, destMount, destPath)
+	s.destinationResult(err)
+	if vault.IsErrorStatus(err, 404) {
+		s.log.Debug().Str("secret", path).Str("destination", destPath).Msg("Destination secret does not exist, skipping its metadata")
+		return ActionSkipped, nil
+	}
+	if err != nil {
+		return ActionFailed, fmt.Errorf("failed to read secret metadata from destination vault: %w", err)
+	}
+	if metadataEqual(src, dst) {
+		return ActionUnchanged, nil
+	}
+
+	release, err := acquire(ctx, s.writeSlots)
+	if err != nil {
+		return ActionFailed, err
+	}
+	defer release()
+
+	body := map[string]interface{}{
+		"max_versions":         src.MaxVersions,
+		"cas_required":         src.CASRequired,
+		"delete_version_after": src.DeleteVersionAfter,
+		// Vault only replaces custom_metadata when it is given, so an
+		// empty map is sent to clear it.
+		"custom_metadata": customMetadataBody(src.CustomMetadata),
+	}
+	writeCtx, writeSpan := s.startSpan(ctx, "write metadata", destMount, destPath)
+	err = s.withRetry(writeCtx, "write metadata", func() error {
+		if err := s.writeLimiter.Wait(writeCtx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.Write(writeCtx, destMount+"/metadata/"+destPath, body, vault.WithMountPath(destMount))
+		return err
+	})
+	endSpan(writeSpan, err)
+	s.destinationResult(err)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to write secret metadata to destination vault")
+		return ActionFailed, fmt.Errorf("failed to write secret metadata to destination vault: %w", err)
+	}
+	s.audit(AuditRecord{Operation: AuditMetadata, Target: AuditDestination, Mount: destMount, Path: destPath, SourcePath: path}, nil)
+	return ActionUpdated, nil
+}
+
+// metadataEqual reports whether two secrets have the same metadata settings.
+// Vault reports delete_version_after as a duration string, so equal
+// durations written differently, such as "1h" and "1h0m0s", match.
+func metadataEqual(a, b *secretMetadata) bool {
+	return a.MaxVersions == b.MaxVersions &&
+		a.CASRequired == b.CASRequired &&
+		sameDuration(a.DeleteVersionAfter, b.DeleteVersionAfter) &&
+		(len(a.CustomMetadata) == 0 && len(b.CustomMetadata) == 0 || maps.Equal(a.CustomMetadata, b.CustomMetadata))
+}
+
+// sameDuration compares two duration strings by value, or as strings if
+// either does not parse.
+func sameDuration(a, b string) bool {
+	if a == "" {
+		a = "0s"
+	}
+	if b == "" {
+		b = "0s"
+	}
+	da, errA := time.ParseDuration(a)
+	db, errB := time.ParseDuration(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return da == db
+}
+
+// customMetadataBody returns m as a request value, never nil.
+func customMetadataBody(m map[string]string) map[string]interface{} {
+	retVal := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		retVal[k] = v
+	}
+	return retVal
+}
+
+// Enabled reports whether any filter rule is set.
+func (f MetadataFilter) Enabled() bool {
+	return len(f.Include)+len(f.Exclude) > 0
+}
+
+// wants reports whether a secret with custom_metadata m passes the filter.
+func (f MetadataFilter) wants(m map[string]string) bool {
+	for _, r := range f.Include {
+		if !r.matches(m) {
+			return false
+		}
+	}
+	for _, r := range f.Exclude {
+		if r.matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether custom_metadata m satisfies the rule.
+func (r MetadataRule) matches(m map[string]string) bool {
+	v, ok := m[r.Key]
+	return ok && (r.Value == "" || v == r.Value)
+}
+
+// filteredOut reads the custom_metadata of a source secret and reports
+// whether MetadataFilter leaves it out of the sync. A secret left out is
+// marked as desired on the destination so prune does not delete it.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//
+// Returns:
+//
+//	bool - Whether to skip the secret.
+//	error - An error if the metadata could not be read.
+func (s *Syncer) filteredOut(ctx context.Context, mount, path string) (bool, error) {
+	meta, err := s.readMetadata(ctx, mount, path)
+	if err != nil {
+		return false, err
+	}
+	if s.cfg.MetadataFilter.wants(meta.CustomMetadata) {
+		return false, nil
+	}
+
+	s.log.Debug().Str("secret", path).Str("mount", mount).Msg("Secret filtered out by its custom_metadata")
+	if destPath, _, err := s.transformer.Transform(path, nil); err == nil {
+		s.syncedMu.Lock()
+		s.desired[destPath] = true
+		s.syncedMu.Unlock()
+	}
+	return true, nil
+}
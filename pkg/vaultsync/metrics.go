@@ -0,0 +1,214 @@
+package vaultsync
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MetricLabelJob labels per-secret metrics with the configured job name.
+	MetricLabelJob = "job"
+	// MetricLabelMount labels per-secret metrics with the source mount.
+	MetricLabelMount = "mount"
+	// MetricLabelFolder labels per-secret metrics with the folder below the
+	// sync path, truncated to the configured depth.
+	MetricLabelFolder = "folder"
+
+	defaultMetricsFolderDepth = 1
+	defaultMetricsMaxFolders  = 100
+	// metricsOtherFolder replaces folders seen after the folder limit is reached.
+	metricsOtherFolder = "other"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the per-secret
+// duration histogram.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// Metrics collects per-secret sync metrics and serves them in the
+	// Prometheus text exposition format. It is safe for concurrent use.
+	Metrics struct {
+		cfg MetricsConfig
+
+		mu        sync.Mutex
+		folders   map[string]bool
+		secrets   map[string]float64
+		durations map[string]*histogram
+	}
+
+	// histogram is a cumulative Prometheus histogram.
+	histogram struct {
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+// NewMetrics returns an empty Metrics for the given configuration.
+//
+// Arguments:
+//
+//	cfg: MetricsConfig - The metrics configuration.
+//
+// Returns:
+//
+//	*Metrics - The metrics collector.
+//	error - An error if an unknown label is configured.
+func NewMetrics(cfg MetricsConfig) (*Metrics, error) {
+	for _, l := range cfg.Labels {
+		switch l {
+		case MetricLabelJob, MetricLabelMount, MetricLabelFolder:
+		default:
+			return nil, fmt.Errorf("unknown metrics label %q", l)
+		}
+	}
+	if cfg.FolderDepth < 1 {
+		cfg.FolderDepth = defaultMetricsFolderDepth
+	}
+	if cfg.MaxFolders < 1 {
+		cfg.MaxFolders = defaultMetricsMaxFolders
+	}
+
+	return &Metrics{
+		cfg:       cfg,
+		folders:   make(map[string]bool),
+		secrets:   make(map[string]float64),
+		durations: make(map[string]*histogram),
+	}, nil
+}
+
+// WithMetrics records per-secret sync metrics in m.
+//
+// Arguments:
+//
+//	m: *Metrics - The metrics collector.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithMetrics(m *Metrics) Option {
+	return func(s *Syncer) {
+		s.metrics = m
+	}
+}
+
+// observe records the outcome of syncing one secret. A nil Metrics records
+// nothing.
+//
+// Arguments:
+//
+//	mount: string - The source mount.
+//	rel: string - The path of the secret relative to the sync path.
+//	action: Action - What happened to the secret.
+//	d: time.Duration - How long the secret took to sync.
+//
+// Returns: nothing
+func (m *Metrics) observe(mount, rel string, action Action, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := m.labels(mount, rel)
+	m.secrets[labels+labelPair("action", string(action))]++
+
+	h, ok := m.durations[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[labels] = h
+	}
+	secs := d.Seconds()
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += secs
+}
+
+// labels renders the configured labels for a secret, without braces. The
+// caller must hold m.mu.
+func (m *Metrics) labels(mount, rel string) string {
+	var b strings.Builder
+	for _, l := range m.cfg.Labels {
+		switch l {
+		case MetricLabelJob:
+			b.WriteString(labelPair(l, m.cfg.Job))
+		case MetricLabelMount:
+			b.WriteString(labelPair(l, mount))
+		case MetricLabelFolder:
+			b.WriteString(labelPair(l, m.folder(rel)))
+		}
+	}
+	return b.String()
+}
+
+// folder returns the folder label for a secret, collapsing new folders into
+// "other" once MaxFolders distinct folders have been seen. The caller must
+// hold m.mu.
+func (m *Metrics) folder(rel string) string {
+	parts := strings.Split(rel, "/")
+	parts = parts[:len(parts)-1]
+	if len(parts) > m.cfg.FolderDepth {
+		parts = parts[:m.cfg.FolderDepth]
+	}
+	f := strings.Join(parts, "/")
+
+	if !m.folders[f] {
+		if len(m.folders) >= m.cfg.MaxFolders {
+			return metricsOtherFolder
+		}
+		m.folders[f] = true
+	}
+	return f
+}
+
+// labelPair renders a single label followed by a comma.
+func labelPair(name, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return name + `="` + r.Replace(value) + `",`
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP hvm_secrets_total Secrets processed, by action.")
+	fmt.Fprintln(w, "# TYPE hvm_secrets_total counter")
+	for _, labels := range sortedKeys(m.secrets) {
+		fmt.Fprintf(w, "hvm_secrets_total{%s} %g\n", strings.TrimSuffix(labels, ","), m.secrets[labels])
+	}
+
+	fmt.Fprintln(w, "# HELP hvm_secret_duration_seconds Time taken to sync a single secret.")
+	fmt.Fprintln(w, "# TYPE hvm_secret_duration_seconds histogram")
+	for _, labels := range sortedKeys(m.durations) {
+		h := m.durations[labels]
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "hvm_secret_duration_seconds_bucket{%sle=\"%s\"} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "hvm_secret_duration_seconds_bucket{%sle=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "hvm_secret_duration_seconds_sum{%s} %g\n", strings.TrimSuffix(labels, ","), h.sum)
+		fmt.Fprintf(w, "hvm_secret_duration_seconds_count{%s} %d\n", strings.TrimSuffix(labels, ","), h.count)
+	}
+}
+
+// sortedKeys returns the keys of m in order, for stable output.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,132 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// syncMounts syncs every pair in srcVault.mounts in turn, as if each were
+// the configured mount and path, and combines their reports. Every pair is
+// saved as a run of its own, so it can be resumed or decommissioned on its
+// own. Each pair starts without the written, resumed, and checksummed
+// secrets of the pairs before it, so it verifies and checksums only its own
+// under its own destination mount. A pair that fails does not stop the
+// pairs after it unless the sync is cancelled.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	*Report - The combined report, with secret paths prefixed by their mount and the report of each pair in Mounts.
+//	error - The errors of the failed pairs, combined into one *SyncError if only secrets failed.
+func (s *Syncer) syncMounts(ctx context.Context) (*Report, error) {
+	combined := newReport("", "")
+	combined.Verified = true
+	var (
+		syncErr = &SyncError{}
+		errs    []error
+	)
+	for _, m := range s.cfg.SourceVault.Mounts {
+		restore, err := s.useMount(m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", m.Mount, m.Path, err))
+			continue
+		}
+		s.log.Info().Str("mount", m.Mount).Str("path", m.Path).Msg("Syncing mount")
+		report, err := s.Sync(ctx)
+		restore()
+		combined.merge(report)
+
+		var se *SyncError
+		switch {
+		case err == nil:
+		case errors.As(err, &se) && !errors.Is(err, context.Canceled):
+			syncErr.Total += se.Total
+			for _, e := range se.Errors {
+				syncErr.Errors = append(syncErr.Errors, &SecretError{Path: m.Mount + "/" + e.Path, Err: e.Err})
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s/%s: %w", m.Mount, m.Path, err))
+		}
+		if ctx.Err() != nil || s.pastDeadline() || errors.Is(err, ErrFailFast) || errors.Is(err, ErrMaxErrors) {
+			break
+		}
+	}
+	combined.finish()
+
+	if len(syncErr.Errors) > 0 {
+		sort.Slice(syncErr.Errors, func(i, j int) bool { return syncErr.Errors[i].Path < syncErr.Errors[j].Path })
+		errs = append(errs, syncErr)
+	}
+	err := errors.Join(errs...)
+	if len(errs) == 1 {
+		err = errs[0]
+	}
+	s.logSummary(combined, err)
+	return combined, err
+}
+
+// useMount points the syncer at a single mount and path, as if they were
+// the configured ones, until the returned function restores it.
+//
+// Arguments:
+//
+//	m: MountPath - The mount and path, and where on the destination they go.
+//
+// Returns:
+//
+//	func() - Restores the configured mount and path.
+//	error - An error if the transforms could not be loaded for the mount.
+func (s *Syncer) useMount(m MountPath) (func(), error) {
+	cfg, transformer := s.cfg, s.transformer
+
+	t, err := s.buildTransformer(cfg.Transforms, m.Mount)
+	if err != nil {
+		return nil, err
+	}
+	if m.DestPath != "" {
+		t = copyTransformer{Transformer: t, from: m.Path, to: m.DestPath}
+	}
+
+	src := *cfg.SourceVault
+	src.Mount, src.Path, src.Mounts = m.Mount, m.Path, nil
+	pair := *cfg
+	pair.SourceVault, pair.AllKVMounts = &src, false
+	s.cfg, s.transformer, s.destinationMount = &pair, t, m.DestMount
+
+	return func() {
+		s.cfg, s.transformer, s.destinationMount = cfg, transformer, ""
+	}, nil
+}
+
+// merge adds the results of the sync of one mount to a combined report,
+// prefixing the secret paths with the mount.
+func (r *Report) merge(pair *Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Mounts = append(r.Mounts, pair)
+	r.Verified = r.Verified && pair.Verified
+	r.Cancelled = r.Cancelled || pair.Cancelled
+	r.FailedFast = r.FailedFast || pair.FailedFast
+	r.MaxErrorsExceeded = r.MaxErrorsExceeded || pair.MaxErrorsExceeded
+	r.Durations.Discovery += pair.Durations.Discovery
+	r.Durations.Copy += pair.Durations.Copy
+	r.Durations.Verify += pair.Durations.Verify
+	r.Discovered += pair.Discovered
+	r.Bytes += pair.Bytes
+	for _, res := range pair.Secrets {
+		res := res
+		res.Path = pair.Mount + "/" + res.Path
+		r.results[res.Path] = &res
+	}
+	for sum, paths := range pair.contents {
+		for _, p := range paths {
+			r.contents[sum] = append(r.contents[sum], pair.Mount+"/"+p)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package vaultsync
+
+const (
+	// NotifyEmail mails run summaries over SMTP.
+	NotifyEmail = "email"
+	// NotifyPagerDuty sends run summaries to the PagerDuty Events API.
+	NotifyPagerDuty = "pagerduty"
+	// NotifyWebhook posts run summaries as JSON to a URL.
+	NotifyWebhook = "webhook"
+
+	// NotifyFailure notifies of failed runs only.
+	NotifyFailure = "failure"
+	// NotifySuccess notifies of successful runs only.
+	NotifySuccess = "success"
+	// NotifyChanges notifies of failed runs and of runs that changed the
+	// destination.
+	NotifyChanges = "changes"
+	// NotifyAlways notifies of every run.
+	NotifyAlways = "always"
+)
+
+// Wants reports whether n notifies of a run with this outcome.
+//
+// Arguments:
+//
+//	r: *Report - The report of the run, which may be nil if it failed to start.
+//	failed: bool - Whether the run failed.
+//
+// Returns:
+//
+//	bool - Whether to send the notification.
+func (n Notification) Wants(r *Report, failed bool) bool {
+	switch n.On {
+	case NotifyAlways:
+		return true
+	case NotifySuccess:
+		return !failed
+	case NotifyChanges:
+		return failed || (r != nil && r.Created+r.Updated+r.Deleted+r.Destroyed+r.Pulled > 0)
+	default:
+		return failed
+	}
+}
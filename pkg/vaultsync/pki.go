@@ -0,0 +1,340 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	// PKIIssuerImported means the issuer certificate was imported on the
+	// destination.
+	PKIIssuerImported PKIIssuerAction = "imported"
+	// PKIIssuerExists means the destination already had the issuer
+	// certificate.
+	PKIIssuerExists PKIIssuerAction = "exists"
+	// PKIIssuerFailed means the issuer could not be copied; see
+	// PKIIssuerResult.Error.
+	PKIIssuerFailed PKIIssuerAction = "failed"
+)
+
+// pkiConfigs are the mount config endpoints copied as they are.
+var pkiConfigs = []string{"config/urls", "config/crl", "config/cluster", "config/auto-tidy"}
+
+type (
+	// PKIIssuerAction is what happened, or in a dry run would happen, to a
+	// single PKI issuer.
+	PKIIssuerAction string
+
+	// PKIReport is the structured result of SyncPKI. NotExported lists what
+	// vault never returns, which has to be recreated on the destination.
+	PKIReport struct {
+		Mount       string            `json:"mount"`
+		DryRun      bool              `json:"dryRun"`
+		Filter      string            `json:"filter,omitempty"`
+		StartedAt   time.Time         `json:"startedAt"`
+		FinishedAt  time.Time         `json:"finishedAt"`
+		Config      []string          `json:"config,omitempty"`
+		Issuers     []PKIIssuerResult `json:"issuers,omitempty"`
+		Roles       []string          `json:"roles,omitempty"`
+		NotExported []string          `json:"notExported,omitempty"`
+		Errors      []string          `json:"errors,omitempty"`
+	}
+
+	// PKIIssuerResult is the outcome for a single PKI issuer.
+	PKIIssuerResult struct {
+		ID            string          `json:"id"`
+		Name          string          `json:"name,omitempty"`
+		Action        PKIIssuerAction `json:"action"`
+		DestinationID string          `json:"destinationId,omitempty"`
+		Error         string          `json:"error,omitempty"`
+	}
+)
+
+// SyncPKI copies a PKI mount's URL, CRL, cluster, and auto-tidy config and
+// its roles whose names match filter to the same mount on the destination
+// vault, which must already be enabled. With includeCA, the issuer
+// certificates are imported first, with their names and default issuer,
+// and roles that refer to an issuer by ID are pointed at the imported one.
+// Issuer private keys are never returned by vault, so imported issuers can
+// only verify, not issue; the report lists them under NotExported.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The PKI mount path on both vaults.
+//	filter: string - A path.Match glob on role names, or "" for every role.
+//	includeCA: bool - Also import the issuer certificates and CA chains.
+//	dryRun: bool - Only report what would be copied instead of writing it.
+//
+// Returns:
+//
+//	*PKIReport - What was copied.
+//	error - An error if the mount could not be read, or anything failed to copy.
+func (s *Syncer) SyncPKI(ctx context.Context, mount, filter string, includeCA, dryRun bool) (*PKIReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("PKI sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("PKI sync"); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid role filter %q: %w", filter, err)
+		}
+	}
+	mount = strings.Trim(mount, "/")
+
+	report := &PKIReport{Mount: mount, DryRun: dryRun, Filter: filter, StartedAt: time.Now().UTC()}
+	failf := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		s.log.Error().Str("mount", mount).Str("error", msg).Msg("Failed to sync PKI")
+		report.Errors = append(report.Errors, msg)
+	}
+
+	for _, c := range pkiConfigs {
+		data, err := s.readSourceData(ctx, mount+"/"+c)
+		if err != nil {
+			failf("%s: failed to read: %v", c, err)
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		if !dryRun {
+			if err := s.writeDestinationData(ctx, mount+"/"+c, data); err != nil {
+				failf("%s: failed to write: %v", c, err)
+				continue
+			}
+		}
+		report.Config = append(report.Config, c)
+	}
+
+	// issuers maps source issuer IDs to destination ones.
+	issuers := make(map[string]string)
+	if includeCA {
+		if err := s.syncPKIIssuers(ctx, mount, dryRun, report, issuers); err != nil {
+			return nil, err
+		}
+	}
+
+	roles, err := s.listSourceKeys(ctx, mount+"/roles")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PKI roles: %w", err)
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		if filter != "" {
+			if ok, _ := path.Match(filter, role); !ok {
+				continue
+			}
+		}
+
+		data, err := s.readSourceData(ctx, mount+"/roles/"+role)
+		if err != nil || data == nil {
+			failf("role %s: failed to read: %v", role, err)
+			continue
+		}
+		if ref, _ := data["issuer_ref"].(string); issuers[ref] != "" {
+			data["issuer_ref"] = issuers[ref]
+		}
+		if !dryRun {
+			if err := s.writeDestinationData(ctx, mount+"/roles/"+role, data); err != nil {
+				failf("role %s: failed to write: %v", role, err)
+				continue
+			}
+		}
+		report.Roles = append(report.Roles, role)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	if !dryRun {
+		s.log.Info().Str("mount", mount).Int("roles", len(report.Roles)).Int("issuers", len(report.Issuers)).Msg("PKI mount synced")
+	}
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("%d PKI objects failed to sync", len(report.Errors))
+	}
+	return report, nil
+}
+
+// syncPKIIssuers imports the source issuer certificates that the
+// destination does not have yet, copies their names and URLs, and sets the
+// default issuer. It records source to destination issuer IDs in ids.
+func (s *Syncer) syncPKIIssuers(ctx context.Context, mount string, dryRun bool, report *PKIReport, ids map[string]string) error {
+	srcIDs, err := s.listSourceKeys(ctx, mount+"/issuers")
+	if err != nil {
+		return fmt.Errorf("failed to list source issuers: %w", err)
+	}
+	if len(srcIDs) == 0 {
+		return nil
+	}
+	sort.Strings(srcIDs)
+
+	dstIDs, err := s.listDestinationKeys(ctx, mount+"/issuers")
+	if err != nil {
+		return fmt.Errorf("failed to list destination issuers: %w", err)
+	}
+	existing := make(map[string]string, len(dstIDs))
+	for _, id := range dstIDs {
+		issuer, err := s.readDestinationData(ctx, mount+"/issuer/"+id+"/json")
+		if err != nil {
+			return fmt.Errorf("failed to read destination issuer %s: %w", id, err)
+		}
+		if cert, _ := issuer["certificate"].(string); cert != "" {
+			existing[strings.TrimSpace(cert)] = id
+		}
+	}
+
+	for _, id := range srcIDs {
+		res := s.syncPKIIssuer(ctx, mount, id, dryRun, existing)
+		if res.Action == PKIIssuerFailed {
+			s.log.Error().Str("issuer", id).Str("error", res.Error).Msg("Failed to sync PKI issuer")
+			report.Errors = append(report.Errors, fmt.Sprintf("issuer %s: %s", id, res.Error))
+		} else if res.DestinationID != "" {
+			ids[id] = res.DestinationID
+		}
+		report.Issuers = append(report.Issuers, res)
+	}
+	report.NotExported = append(report.NotExported, "issuer private keys; imported issuers cannot issue certificates")
+
+	cfg, err := s.readSourceData(ctx, mount+"/config/issuers")
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("config/issuers: failed to read: %v", err))
+		return nil
+	}
+	def, _ := cfg["default"].(string)
+	if ids[def] == "" || dryRun {
+		return nil
+	}
+	if err := s.writeDestinationData(ctx, mount+"/config/issuers", map[string]interface{}{"default": ids[def]}); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("config/issuers: failed to write: %v", err))
+		return nil
+	}
+	report.Config = append(report.Config, "config/issuers")
+	return nil
+}
+
+// syncPKIIssuer imports one issuer certificate with its CA chain, unless
+// the destination has it, and copies its name and URLs.
+func (s *Syncer) syncPKIIssuer(ctx context.Context, mount, id string, dryRun bool, existing map[string]string) PKIIssuerResult {
+	res := PKIIssuerResult{ID: id}
+	fail := func(err error) PKIIssuerResult {
+		res.Action = PKIIssuerFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	issuer, err := s.readSourceData(ctx, mount+"/issuer/"+id)
+	if err != nil || issuer == nil {
+		return fail(fmt.Errorf("failed to read: %v", err))
+	}
+	res.Name, _ = issuer["issuer_name"].(string)
+	cert, _ := issuer["certificate"].(string)
+
+	if dstID, ok := existing[strings.TrimSpace(cert)]; ok {
+		res.Action = PKIIssuerExists
+		res.DestinationID = dstID
+		return res
+	}
+	res.Action = PKIIssuerImported
+	if dryRun {
+		return res
+	}
+
+	bundle := cert
+	if chain, ok := issuer["ca_chain"].([]interface{}); ok {
+		var pems []string
+		for _, c := range chain {
+			if p, _ := c.(string); p != "" {
+				pems = append(pems, strings.TrimSpace(p))
+			}
+		}
+		if len(pems) > 0 {
+			bundle = strings.Join(pems, "\n")
+		}
+	}
+
+	var imported []string
+	err = s.withRetry(ctx, "import issuer", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.destinationVault.Write(ctx, mount+"/issuers/import/cert", map[string]interface{}{"pem_bundle": bundle})
+		if err != nil {
+			return err
+		}
+		imported = nil
+		list, _ := resp.Data["imported_issuers"].([]interface{})
+		for _, v := range list {
+			if i, ok := v.(string); ok {
+				imported = append(imported, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to import: %w", err))
+	}
+
+	// The chain may import its parents as well; the issuer is the one
+	// whose certificate matches.
+	for _, dstID := range imported {
+		data, err := s.readDestinationData(ctx, mount+"/issuer/"+dstID+"/json")
+		if err != nil {
+			return fail(fmt.Errorf("failed to read imported issuer: %w", err))
+		}
+		c, _ := data["certificate"].(string)
+		existing[strings.TrimSpace(c)] = dstID
+	}
+	res.DestinationID = existing[strings.TrimSpace(cert)]
+	if res.DestinationID == "" {
+		return fail(fmt.Errorf("imported issuer not found on the destination"))
+	}
+
+	update := make(map[string]interface{})
+	for _, k := range []string{"issuer_name", "leaf_not_after_behavior", "issuing_certificates", "crl_distribution_points", "ocsp_servers"} {
+		if v, ok := issuer[k]; ok && v != nil && v != "" {
+			update[k] = v
+		}
+	}
+	if len(update) > 0 {
+		if err := s.writeDestinationData(ctx, mount+"/issuer/"+res.DestinationID, update); err != nil {
+			return fail(fmt.Errorf("failed to configure imported issuer: %w", err))
+		}
+	}
+	s.log.Info().Str("issuer", id).Str("destination_id", res.DestinationID).Msg("PKI issuer imported")
+	return res
+}
+
+// listDestinationKeys lists a raw path on the destination vault, returning
+// nil if it does not exist.
+func (s *Syncer) listDestinationKeys(ctx context.Context, p string) ([]string, error) {
+	var keys []string
+	err := s.withRetry(ctx, "list", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.destinationVault.List(ctx, p)
+		if vault.IsErrorStatus(err, 404) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		keys = nil
+		v, _ := resp.Data["keys"].([]interface{})
+		for _, k := range v {
+			if key, ok := k.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,256 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/hashicorp/vault-client-go/schema"
+)
+
+const (
+	// PolicyCreated means the policy did not exist on the destination.
+	PolicyCreated PolicyAction = "created"
+	// PolicyUpdated means the destination policy had different rules.
+	PolicyUpdated PolicyAction = "updated"
+	// PolicyUnchanged means the destination policy already matched.
+	PolicyUnchanged PolicyAction = "unchanged"
+	// PolicySkipped means the policy cannot be migrated, like root.
+	PolicySkipped PolicyAction = "skipped"
+	// PolicyFailed means the policy could not be read or written.
+	PolicyFailed PolicyAction = "failed"
+)
+
+type (
+	// PolicyAction is what happened, or in a dry run would happen, to a
+	// single ACL policy.
+	PolicyAction string
+
+	// PolicyReport is the structured result of SyncPolicies.
+	PolicyReport struct {
+		DryRun     bool           `json:"dryRun"`
+		Filter     string         `json:"filter,omitempty"`
+		StartedAt  time.Time      `json:"startedAt"`
+		FinishedAt time.Time      `json:"finishedAt"`
+		Created    int            `json:"created"`
+		Updated    int            `json:"updated"`
+		Unchanged  int            `json:"unchanged"`
+		Skipped    int            `json:"skipped"`
+		Failed     int            `json:"failed"`
+		Policies   []PolicyResult `json:"policies"`
+	}
+
+	// PolicyResult is the outcome for a single ACL policy. Diff holds the
+	// changed rules as a line diff, destination (-) to source (+).
+	PolicyResult struct {
+		Name   string       `json:"name"`
+		Action PolicyAction `json:"action"`
+		Diff   string       `json:"diff,omitempty"`
+		Error  string       `json:"error,omitempty"`
+	}
+)
+
+// SyncPolicies copies the ACL policies of the source vault whose names match
+// filter to the destination vault. In a dry run nothing is written, and the
+// report shows what would change. The root policy cannot be written and is
+// always skipped.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	filter: string - A path.Match glob on policy names, or "" for every policy.
+//	dryRun: bool - Only compare the policies instead of writing them.
+//
+// Returns:
+//
+//	*PolicyReport - The result for every matching policy.
+//	error - An error if the policies could not be listed, or any policy failed.
+func (s *Syncer) SyncPolicies(ctx context.Context, filter string, dryRun bool) (*PolicyReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("policy sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("policy sync"); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid policy filter %q: %w", filter, err)
+		}
+	}
+
+	report := &PolicyReport{DryRun: dryRun, Filter: filter, StartedAt: time.Now().UTC()}
+
+	names, err := s.listPolicies(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source policies: %w", err)
+	}
+
+	for _, name := range names {
+		if filter != "" {
+			if ok, _ := path.Match(filter, name); !ok {
+				continue
+			}
+		}
+
+		res := s.syncPolicy(ctx, name, dryRun)
+		switch res.Action {
+		case PolicyCreated:
+			report.Created++
+		case PolicyUpdated:
+			report.Updated++
+		case PolicyUnchanged:
+			report.Unchanged++
+		case PolicySkipped:
+			report.Skipped++
+		case PolicyFailed:
+			report.Failed++
+		}
+		report.Policies = append(report.Policies, res)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d policies failed", report.Failed, len(report.Policies))
+	}
+	return report, nil
+}
+
+// syncPolicy compares one policy and writes it unless dryRun is set.
+func (s *Syncer) syncPolicy(ctx context.Context, name string, dryRun bool) PolicyResult {
+	res := PolicyResult{Name: name}
+	if name == "root" {
+		res.Action = PolicySkipped
+		return res
+	}
+
+	fail := func(err error) PolicyResult {
+		s.log.Error().Err(err).Str("policy", name).Msg("Failed to sync policy")
+		res.Action = PolicyFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	var src string
+	err := s.withRetry(ctx, "read policy", func() error {
+		if err := s.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.sourceVault.System.PoliciesReadAclPolicy(ctx, name)
+		if err != nil {
+			return err
+		}
+		src = policyRules(resp.Data)
+		return nil
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to read source policy: %w", err))
+	}
+
+	var dst string
+	exists := true
+	err = s.withRetry(ctx, "read policy", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.destinationVault.System.PoliciesReadAclPolicy(ctx, name)
+		if vault.IsErrorStatus(err, 404) {
+			exists = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dst = policyRules(resp.Data)
+		return nil
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to read destination policy: %w", err))
+	}
+
+	switch {
+	case !exists:
+		res.Action = PolicyCreated
+	case dst == src:
+		res.Action = PolicyUnchanged
+		return res
+	default:
+		res.Action = PolicyUpdated
+	}
+	res.Diff = lineDiff(dst, src)
+
+	if dryRun {
+		return res
+	}
+	err = s.withRetry(ctx, "write policy", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.System.PoliciesWriteAclPolicy(ctx, name, schema.PoliciesWriteAclPolicyRequest{Policy: src})
+		return err
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to write destination policy: %w", err))
+	}
+
+	s.log.Info().Str("policy", name).Str("action", string(res.Action)).Msg("Policy synced")
+	return res
+}
+
+// policyRules returns the rules of a policy, which older vaults return as
+// "rules" instead of "policy".
+func policyRules(p schema.PoliciesReadAclPolicyResponse) string {
+	if p.Policy != "" {
+		return p.Policy
+	}
+	return p.Rules
+}
+
+// lineDiff returns a minimal line diff from a to b, with removed lines
+// prefixed by "-", added lines by "+", and common lines by " ".
+func lineDiff(a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			sb.WriteString(" " + x[i] + "\n")
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			sb.WriteString("+" + y[j] + "\n")
+			j++
+		default:
+			sb.WriteString("-" + x[i] + "\n")
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
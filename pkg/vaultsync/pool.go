@@ -0,0 +1,83 @@
+package vaultsync
+
+import (
+	"context"
+	"sync"
+)
+
+// runPool calls fn for every item using at most workers goroutines and waits
+// for them all to return. Items not yet started when ctx is cancelled are
+// dropped.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	workers: int - The maximum number of concurrent calls to fn.
+//	items: []string - The items to process.
+//	fn: func(context.Context, string) - Called once per item.
+//
+// Returns: nothing
+func runPool(ctx context.Context, workers int, items []string, fn func(context.Context, string)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				fn(ctx, item)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			break feed
+		case work <- item:
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// newSlots returns a semaphore admitting n concurrent holders, or nil, which
+// admits any number, if n is not positive.
+func newSlots(n int) chan struct{} {
+	if n < 1 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// acquire takes a slot from slots, waiting until one is free. A nil slots
+// admits everyone at once.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	slots: chan struct{} - The semaphore, from newSlots.
+//
+// Returns:
+//
+//	func() - Releases the slot.
+//	error - The context's error if it was cancelled while waiting.
+func acquire(ctx context.Context, slots chan struct{}) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,261 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// PrunePlan compares the source and destination like Diff and returns the
+// destination secrets under the configured path that no source secret maps
+// to. A plan is refused if any secret could not be compared, since a source
+// secret that could not be read would make its destination look orphaned.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	[]string - The destination paths to prune, sorted.
+//	error - An error if the comparison failed or was incomplete.
+func (s *Syncer) PrunePlan(ctx context.Context) ([]string, error) {
+	diff, err := s.Diff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if diff.Errors > 0 {
+		return nil, fmt.Errorf("failed to compare %d secrets, not pruning", diff.Errors)
+	}
+
+	var paths []string
+	for _, res := range diff.Secrets {
+		if res.Status == DiffExtra {
+			paths = append(paths, res.Destination)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Prune deletes the given destination secrets, normally those returned by
+// PrunePlan. By default the current version of each secret is soft-deleted
+// and can be undeleted; with destroy set, the secret's metadata and every
+// version are removed for good. Deletes run on BatchSize workers against
+// the destination rate limit.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	paths: []string - The destination paths to delete.
+//	destroy: bool - Permanently destroy the secrets instead of soft-deleting them.
+//
+// Returns:
+//
+//	*Report - A report of the deletions.
+//	error - An error if the prune was aborted or any secret could not be deleted.
+func (s *Syncer) Prune(ctx context.Context, paths []string, destroy bool) (*Report, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("prune requires a vault destination")
+	}
+
+	mount := s.cfg.SourceVault.Mount
+	s.report = newReport(mount, s.cfg.SourceVault.Path)
+	s.log.Info().Str("mount", mount).Int("secrets", len(paths)).Bool("destroy", destroy).Msg("Starting prune")
+
+	runPool(ctx, s.cfg.BatchSize, paths, func(ctx context.Context, p string) {
+		start := time.Now()
+		action, err := s.deleteDestination(ctx, mount, p, destroy)
+		s.report.record(p, action, err, time.Since(start))
+	})
+	if err := ctx.Err(); err != nil {
+		s.report.finish()
+		return s.report, fmt.Errorf("prune aborted: %w", err)
+	}
+
+	s.report.finish()
+	if err := s.report.err(); err != nil {
+		return s.report, err
+	}
+
+	s.log.Info().Int("deleted", s.report.Deleted).Int("destroyed", s.report.Destroyed).Msg("Prune complete")
+	return s.report, nil
+}
+
+// deleteDestination soft-deletes or destroys a single destination secret.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	path: string - The path of the secret.
+//	destroy: bool - Remove the metadata and all versions instead of soft-deleting.
+//
+// Returns:
+//
+//	Action - ActionDeleted or ActionDestroyed.
+//	error - An error if the secret could not be deleted.
+func (s *Syncer) deleteDestination(ctx context.Context, mount, path string, destroy bool) (Action, error) {
+	target, action := s.kvPath(ctx, s.destinationVault, mount, "data", path), ActionDeleted
+	// KV v1 has no soft delete, so any delete destroys the secret.
+	if destroy || s.kvVersion(ctx, s.destinationVault, mount) == 1 {
+		target, action = s.kvPath(ctx, s.destinationVault, mount, "metadata", path), ActionDestroyed
+	}
+
+	err := s.withRetry(ctx, "delete", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := s.destinationVault.Delete(ctx, target, vault.WithMountPath(mount))
+		return err
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to delete destination secret")
+		return ActionFailed, fmt.Errorf("failed to delete destination secret: %w", err)
+	}
+
+	s.audit(AuditRecord{Operation: auditOperation(action == ActionDestroyed), Target: AuditDestination, Mount: mount, Path: path}, nil)
+	s.log.Debug().Str("secret", path).Str("action", string(action)).Msg("Destination secret pruned")
+	return action, nil
+}
+
+// pruneOrphans deletes the destination secrets that no source secret of the
+// finished copy stage maps to, recording each in the report. Only the
+// destination folders the synced secrets were written to are looked at,
+// and the folders below them that no source folder maps to, however deep;
+// paths are compared as they are on the destination, after transforms.
+// Nothing is deleted if a secret failed or was denied, since its
+// destination would look orphaned, or if the source listed no secrets,
+// which more likely means a wrong path or an empty checkout than an intent
+// to empty the destination.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The configured source path.
+//
+// Returns:
+//
+//	error - An error if the prune was refused or the destination could not be listed.
+func (s *Syncer) pruneOrphans(ctx context.Context, mount, path string) error {
+	s.report.finish()
+	if s.report.Failed+s.report.Denied > 0 {
+		s.log.Warn().Int("failed", s.report.Failed).Int("denied", s.report.Denied).Msg("Secrets failed, not pruning")
+		return nil
+	}
+	if s.report.Discovered == 0 {
+		return fmt.Errorf("source has no secrets under %q, not pruning", path)
+	}
+
+	s.syncedMu.Lock()
+	desired := make(map[string]bool, len(s.desired))
+	roots := make(map[string]bool)
+	for p := range s.desired {
+		desired[p] = true
+		if !strings.HasSuffix(p, "/") {
+			roots[p[:strings.LastIndex(p, "/")+1]] = true
+		}
+	}
+	s.syncedMu.Unlock()
+
+	destMount := s.destMount(mount)
+	orphans, err := s.listOrphans(ctx, destMount, roots, desired)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	s.log.Info().Str("mount", destMount).Int("secrets", len(orphans)).Bool("destroy", s.cfg.Prune.Destroy).Msg("Pruning destination secrets missing from the source")
+	runPool(ctx, s.cfg.BatchSize, orphans, func(ctx context.Context, p string) {
+		start := time.Now()
+		action, err := s.deleteDestination(ctx, destMount, p, s.cfg.Prune.Destroy)
+		s.report.record(p, action, err, time.Since(start))
+	})
+	return ctx.Err()
+}
+
+// listOrphans lists the destination folders roots, and every folder below
+// them that is not in desired, a level at a time on a pool of
+// Concurrency.ListWorkers workers, and returns the secrets found that are
+// not in desired. The folder checksums are never descended into.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	roots: map[string]bool - The destination folders to start from.
+//	desired: map[string]bool - The destination paths of the source secrets and folders.
+//
+// Returns:
+//
+//	[]string - The orphaned destination paths, sorted.
+//	error - An error if a folder could not be listed.
+func (s *Syncer) listOrphans(ctx context.Context, mount string, roots, desired map[string]bool) ([]string, error) {
+	checksums := s.cfg.Checksums.Path
+	if checksums == "" {
+		checksums = defaultChecksumsPath
+	}
+	checksums = strings.TrimSuffix(checksums, "/") + "/"
+
+	workers := s.cfg.Concurrency.ListWorkers
+	if workers < 1 {
+		workers = s.cfg.BatchSize
+	}
+
+	var orphans []string
+	seen := make(map[string]bool, len(roots))
+	pending := make([]string, 0, len(roots))
+	for root := range roots {
+		seen[root] = true
+		pending = append(pending, root)
+	}
+	for len(pending) > 0 {
+		var (
+			mu       sync.Mutex
+			next     []string
+			firstErr error
+		)
+		runPool(ctx, workers, pending, func(ctx context.Context, p string) {
+			keys, err := s.listPath(ctx, s.destinationVault, s.writeLimiter, mount, p)
+			mu.Lock()
+			defer mu.Unlock()
+			if vault.IsErrorStatus(err, 404) {
+				return
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to list destination path %s: %w", mount+"/"+p, err)
+				}
+				return
+			}
+			for _, k := range keys {
+				switch {
+				case desired[p+k]:
+				case isSecretKey(k):
+					orphans = append(orphans, p+k)
+				case strings.HasSuffix(k, "/") && !seen[p+k] && !strings.HasPrefix(checksums, p+k):
+					seen[p+k] = true
+					next = append(next, p+k)
+				}
+			}
+		})
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pending = next
+	}
+
+	sort.Strings(orphans)
+	return orphans, nil
+}
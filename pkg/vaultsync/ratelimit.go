@@ -0,0 +1,26 @@
+package vaultsync
+
+import (
+	"golang.org/x/time/rate"
+)
+
+// newLimiter returns a token-bucket limiter allowing qps requests per second.
+// A qps of zero or less disables limiting.
+//
+// Arguments:
+//
+//	qps: float64 - The sustained number of requests per second.
+//	burst: int - The number of requests allowed in a single burst.
+//
+// Returns:
+//
+//	*rate.Limiter - The limiter.
+func newLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
@@ -0,0 +1,359 @@
+package vaultsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// redactMinLen is the length of the shortest value that is redacted
+	// wherever it appears. Shorter values, such as "true" or port numbers,
+	// would redact unrelated parts of log lines, so they are only redacted
+	// where they make up a whole string field.
+	redactMinLen = 6
+
+	// redacted replaces every redacted value.
+	redacted = "[REDACTED]"
+)
+
+type (
+	// redactor holds secret values to redact, indexed by their first
+	// redactMinLen bytes so a log line is scanned in a single pass however
+	// many values there are. Values shorter than that are held apart and
+	// matched against whole string fields only.
+	redactor struct {
+		mu     sync.RWMutex
+		values map[string][]string
+		short  map[string]bool
+	}
+
+	// redactWriter removes secret values from log lines before they are
+	// written.
+	redactWriter struct {
+		next io.Writer
+	}
+)
+
+var (
+	// credentials holds the vault tokens and configured credentials of
+	// every Syncer in the process, which outlive any single run.
+	credentials = newRedactor()
+
+	// live holds the redactor of every Syncer that has not been closed.
+	// Secret values are registered there, so they are forgotten once the
+	// Syncer that read them is closed.
+	live = struct {
+		mu        sync.RWMutex
+		redactors map[*redactor]bool
+	}{redactors: make(map[*redactor]bool)}
+
+	// tokenPattern matches vault service, batch, and recovery tokens, which
+	// are redacted even if they were never registered.
+	tokenPattern = regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{20,}`)
+
+	// stringPattern matches a JSON string, quotes included.
+	stringPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// NewRedactWriter wraps w so that every secret value an open Syncer has read
+// or written, every vault token resolved, the credentials in every Config,
+// and anything shaped like a vault token are replaced with [REDACTED]
+// before they reach w. The hvm CLI writes all of its logs through it;
+// library users passing their own logger to WithLogger should wrap its
+// writer too. Values shorter than six characters are redacted only where
+// they make up a whole string field of a log line, not within longer text
+// such as an error message.
+//
+// Arguments:
+//
+//	w: io.Writer - The writer to protect, such as os.Stderr.
+//
+// Returns:
+//
+//	io.Writer - A writer, also a zerolog.LevelWriter, that redacts before writing to w.
+func NewRedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{next: w}
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.next.Write(redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	lw, ok := w.next.(zerolog.LevelWriter)
+	if !ok {
+		return w.Write(p)
+	}
+	if _, err := lw.WriteLevel(level, redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newRedactor returns an empty redactor.
+func newRedactor() *redactor {
+	return &redactor{values: make(map[string][]string), short: make(map[string]bool)}
+}
+
+// open registers r with every redactWriter in the process.
+func (r *redactor) open() {
+	live.mu.Lock()
+	live.redactors[r] = true
+	live.mu.Unlock()
+}
+
+// close unregisters r and forgets its values. Closing a nil redactor does
+// nothing.
+func (r *redactor) close() {
+	if r == nil {
+		return
+	}
+	live.mu.Lock()
+	delete(live.redactors, r)
+	live.mu.Unlock()
+
+	r.mu.Lock()
+	r.values, r.short = make(map[string][]string), make(map[string]bool)
+	r.mu.Unlock()
+}
+
+// redact returns p with every registered secret value and vault token
+// replaced, or p itself if there was nothing to replace.
+func redact(p []byte) []byte {
+	live.mu.RLock()
+	defer live.mu.RUnlock()
+
+	p = credentials.redact(p)
+	for r := range live.redactors {
+		p = r.redact(p)
+	}
+	p = redactFields(p)
+	return tokenPattern.ReplaceAllLiteral(p, []byte(redacted))
+}
+
+// redactString is redact for a string, such as an error message stored in
+// a report.
+func redactString(s string) string {
+	return string(redact([]byte(s)))
+}
+
+// redactFields replaces the string values of a JSON log line that equal a
+// registered short value. zerolog's own fields, such as the level, are
+// left alone. The caller must hold live.mu.
+func redactFields(p []byte) []byte {
+	if !credentials.hasShort() && !anyShort() {
+		return p
+	}
+
+	var out *bytes.Buffer
+	last, key := 0, ""
+	for _, m := range stringPattern.FindAllIndex(p, -1) {
+		str := string(p[m[0]+1 : m[1]-1])
+		if m[1] < len(p) && p[m[1]] == ':' {
+			key = str
+			continue
+		}
+		if reservedField(key) || !isShort(str) {
+			continue
+		}
+		if out == nil {
+			out = bytes.NewBuffer(make([]byte, 0, len(p)))
+		}
+		out.Write(p[last:m[0]])
+		out.WriteString(`"` + redacted + `"`)
+		last = m[1]
+	}
+	if out == nil {
+		return p
+	}
+	out.Write(p[last:])
+	return out.Bytes()
+}
+
+// reservedField reports whether key is a field zerolog writes itself.
+func reservedField(key string) bool {
+	switch key {
+	case zerolog.LevelFieldName, zerolog.TimestampFieldName, zerolog.MessageFieldName, zerolog.CallerFieldName:
+		return true
+	}
+	return false
+}
+
+// anyShort reports whether any live redactor holds a short value. The
+// caller must hold live.mu.
+func anyShort() bool {
+	for r := range live.redactors {
+		if r.hasShort() {
+			return true
+		}
+	}
+	return false
+}
+
+// isShort reports whether str, as it appears in a log line, is a
+// registered short value. The caller must hold live.mu.
+func isShort(str string) bool {
+	if credentials.isShort(str) {
+		return true
+	}
+	for r := range live.redactors {
+		if r.isShort(str) {
+			return true
+		}
+	}
+	return false
+}
+
+// addData registers every string and number in a secret's data, however
+// deeply nested, to be redacted from logs. A nil redactor registers
+// nothing.
+//
+// Arguments:
+//
+//	data: interface{} - The secret data, or any value within it.
+//
+// Returns: nothing
+func (r *redactor) addData(data interface{}) {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		for _, v := range d {
+			r.addData(v)
+		}
+	case []interface{}:
+		for _, v := range d {
+			r.addData(v)
+		}
+	case string:
+		r.add(d)
+	case json.Number:
+		r.add(d.String())
+	case float64:
+		r.add(strconv.FormatFloat(d, 'f', -1, 64))
+	case int, int64:
+		r.add(fmt.Sprint(d))
+	}
+}
+
+// redactConfig registers the vault tokens and the credentials of the
+// integrations in cfg to be redacted from logs.
+func redactConfig(cfg *Config) {
+	for _, v := range []*Vault{cfg.SourceVault, cfg.DestinationVault} {
+		if v != nil {
+			credentials.add(v.Token)
+		}
+	}
+	for _, s := range []string{
+		cfg.SlackApproval.BotToken,
+		cfg.SlackApproval.SigningSecret,
+		cfg.Alerts.SlackWebhookURL,
+		cfg.Alerts.WebhookURL,
+		cfg.AzureKeyVault.ClientSecret,
+		cfg.Consul.Token,
+		cfg.Etcd.Password,
+		cfg.OnePassword.Token,
+	} {
+		credentials.add(s)
+	}
+	for _, n := range cfg.Notifications {
+		credentials.add(n.Email.Password)
+		credentials.add(n.PagerDuty.RoutingKey)
+		credentials.add(n.Webhook.URL)
+	}
+}
+
+// add registers value, and its JSON-escaped form if that differs, as it
+// would appear inside a log line. A value shorter than redactMinLen is
+// registered as a short value. A nil redactor registers nothing.
+func (r *redactor) add(value string) {
+	if r == nil || value == "" {
+		return
+	}
+	forms := []string{value}
+	if b, err := json.Marshal(value); err == nil {
+		if escaped := string(b[1 : len(b)-1]); escaped != value {
+			forms = append(forms, escaped)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(value) < redactMinLen {
+		// Only the escaped form can be a whole string field.
+		r.short[forms[len(forms)-1]] = true
+		return
+	}
+	for _, v := range forms {
+		key := v[:redactMinLen]
+		known := false
+		for _, k := range r.values[key] {
+			if k == v {
+				known = true
+				break
+			}
+		}
+		if !known {
+			r.values[key] = append(r.values[key], v)
+		}
+	}
+}
+
+// hasShort reports whether r holds any short value.
+func (r *redactor) hasShort() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.short) > 0
+}
+
+// isShort reports whether str is one of the short values of r.
+func (r *redactor) isShort(str string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.short[str]
+}
+
+// redact replaces every registered value in p, preferring the longest value
+// where several start at the same byte.
+func (r *redactor) redact(p []byte) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.values) == 0 {
+		return p
+	}
+
+	var out *bytes.Buffer
+	last := 0
+	for i := 0; i+redactMinLen <= len(p); {
+		match := 0
+		for _, v := range r.values[string(p[i:i+redactMinLen])] {
+			if len(v) > match && bytes.HasPrefix(p[i:], []byte(v)) {
+				match = len(v)
+			}
+		}
+		if match == 0 {
+			i++
+			continue
+		}
+		if out == nil {
+			out = bytes.NewBuffer(make([]byte, 0, len(p)))
+		}
+		out.Write(p[last:i])
+		out.WriteString(redacted)
+		i += match
+		last = i
+	}
+	if out == nil {
+		return p
+	}
+	out.Write(p[last:])
+	return out.Bytes()
+}
@@ -0,0 +1,177 @@
+package vaultsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRedactLogFields(t *testing.T) {
+	r := newRedactor()
+	r.open()
+	defer r.close()
+	r.addData(map[string]interface{}{
+		"password": "hunter2-secret",
+		"quoted":   `pa"ss"word`,
+		"pin":      "4711",
+		"level":    "info",
+		"nested":   []interface{}{map[string]interface{}{"key": "nested-secret"}},
+	})
+
+	tests := []struct {
+		name    string
+		log     func(zerolog.Logger)
+		hidden  []string
+		visible []string
+	}{
+		{
+			name:   "string field",
+			log:    func(l zerolog.Logger) { l.Info().Str("value", "hunter2-secret").Msg("read") },
+			hidden: []string{"hunter2-secret"},
+		},
+		{
+			name:   "within message",
+			log:    func(l zerolog.Logger) { l.Debug().Msg("got hunter2-secret from vault") },
+			hidden: []string{"hunter2-secret"},
+		},
+		{
+			name:   "escaped value",
+			log:    func(l zerolog.Logger) { l.Info().Str("value", `pa"ss"word`).Msg("read") },
+			hidden: []string{`pa\"ss\"word`},
+		},
+		{
+			name:   "nested value",
+			log:    func(l zerolog.Logger) { l.Info().Interface("data", []string{"nested-secret"}).Msg("read") },
+			hidden: []string{"nested-secret"},
+		},
+		{
+			name:    "short value as whole field",
+			log:     func(l zerolog.Logger) { l.Info().Str("pin", "4711").Msg("read") },
+			hidden:  []string{`"4711"`},
+			visible: []string{`"pin":"[REDACTED]"`},
+		},
+		{
+			name:    "short value leaves zerolog fields alone",
+			log:     func(l zerolog.Logger) { l.Info().Msg("read") },
+			visible: []string{`"level":"info"`},
+		},
+		{
+			name:   "unregistered vault token",
+			log:    func(l zerolog.Logger) { l.Info().Str("token", "hvs.CAESIJlZ2c3ZhbHVlc2VjcmV0dG9rZW4").Msg("login") },
+			hidden: []string{"hvs.CAESIJlZ2c3ZhbHVlc2VjcmV0dG9rZW4"},
+		},
+		{
+			name:   "error field",
+			log:    func(l zerolog.Logger) { l.Error().Err(fmt.Errorf("write hunter2-secret: denied")).Msg("failed") },
+			hidden: []string{"hunter2-secret"},
+		},
+		{
+			name:    "short value within an error is kept",
+			log:     func(l zerolog.Logger) { l.Error().Err(fmt.Errorf("pin 4711 rejected")).Msg("failed") },
+			visible: []string{"pin 4711 rejected"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(zerolog.New(NewRedactWriter(&buf)).Level(zerolog.DebugLevel))
+			out := buf.String()
+			for _, h := range tt.hidden {
+				if strings.Contains(out, h) {
+					t.Errorf("log line %s contains %q", out, h)
+				}
+			}
+			if len(tt.hidden) > 0 && !strings.Contains(out, redacted) {
+				t.Errorf("log line %s has nothing redacted", out)
+			}
+			for _, v := range tt.visible {
+				if !strings.Contains(out, v) {
+					t.Errorf("log line %s does not contain %q", out, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactErrorStrings(t *testing.T) {
+	r := newRedactor()
+	r.open()
+	defer r.close()
+	r.addData(map[string]interface{}{"a": "topsecretvalue", "n": json.Number("1234567890")})
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"plain", errors.New("value topsecretvalue is invalid"), "value [REDACTED] is invalid"},
+		{"wrapped", fmt.Errorf("write: %w", errors.New("got topsecretvalue")), "write: got [REDACTED]"},
+		{"number", errors.New("port 1234567890 out of range"), "port [REDACTED] out of range"},
+		{"nothing to redact", errors.New("permission denied"), "permission denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactString(tt.err.Error()); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactReportOutput(t *testing.T) {
+	r := newRedactor()
+	r.open()
+	defer r.close()
+	r.add("report-secret-value")
+
+	tests := []struct {
+		name   string
+		record func(*Report)
+	}{
+		{"failed secret", func(rep *Report) {
+			rep.record("app/db", ActionFailed, errors.New("schema: report-secret-value is not a number"), 0)
+		}},
+		{"failed verification", func(rep *Report) {
+			rep.record("app/db", ActionUpdated, nil, 0)
+			rep.fail("app/db", errors.New("destination holds report-secret-value"))
+		}},
+		{"denied folder", func(rep *Report) {
+			rep.recordFolder("app/", ActionDenied, errors.New("report-secret-value denied"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := newReport("secret", "app/")
+			tt.record(rep)
+			rep.finish()
+			b, err := json.Marshal(rep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(b), "report-secret-value") {
+				t.Errorf("report %s contains the secret value", b)
+			}
+			if !strings.Contains(string(b), redacted) {
+				t.Errorf("report %s has nothing redacted", b)
+			}
+		})
+	}
+}
+
+func TestRedactForgetsClosedSyncer(t *testing.T) {
+	r := newRedactor()
+	r.open()
+	r.add("forgotten-secret")
+	if got := redactString("forgotten-secret"); got != redacted {
+		t.Fatalf("open redactor: got %q, want %q", got, redacted)
+	}
+	r.close()
+	if got := redactString("forgotten-secret"); got != "forgotten-secret" {
+		t.Errorf("closed redactor: got %q, want the value kept", got)
+	}
+}
@@ -0,0 +1,410 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ReplicatedWarn syncs a mount that Vault already replicates to the
+	// destination, with a warning.
+	ReplicatedWarn = "warn"
+	// ReplicatedSkip skips a mount that Vault already replicates to the
+	// destination.
+	ReplicatedSkip = "skip"
+)
+
+type (
+	// ReplicationJob is an hvm sync job equivalent to one KV v2 mount that a
+	// performance replication primary sends to one of its secondaries.
+	ReplicationJob struct {
+		Secondary string
+		Mount     string
+	}
+
+	// pathsFilter is a performance secondary's mount filter.
+	pathsFilter struct {
+		Mode  string   `json:"mode"`
+		Paths []string `json:"paths"`
+	}
+
+	// healthStatus is the subset of the sys/health response used to detect
+	// the version and replication role of a vault.
+	healthStatus struct {
+		Version                    string `json:"version"`
+		Sealed                     bool   `json:"sealed"`
+		Standby                    bool   `json:"standby"`
+		PerformanceStandby         bool   `json:"performance_standby"`
+		ReplicationPerformanceMode string `json:"replication_performance_mode"`
+		ReplicationDRMode          string `json:"replication_dr_mode"`
+	}
+
+	// replicationStatus is the subset of sys/replication/status used to
+	// tell whether two vaults belong to the same replication set.
+	replicationStatus struct {
+		Performance replicationMode `json:"performance"`
+		DR          replicationMode `json:"dr"`
+	}
+
+	// replicationMode is the state of one kind of replication on a vault.
+	replicationMode struct {
+		Mode      string `json:"mode"`
+		ClusterID string `json:"cluster_id"`
+	}
+
+	// mountEntry is the subset of a sys/mounts entry that identifies a
+	// replicated mount.
+	mountEntry struct {
+		Accessor string `json:"accessor"`
+		Local    bool   `json:"local"`
+	}
+)
+
+// forwardingMode maps a configured forwarding mode onto the vault client's
+// replication forwarding mode.
+//
+// Arguments:
+//
+//	mode: string - One of "", "none", "always", or "inconsistent".
+//
+// Returns:
+//
+//	vault.ReplicationForwardingMode - The client forwarding mode.
+//	error - An error if the mode is unknown.
+func forwardingMode(mode string) (vault.ReplicationForwardingMode, error) {
+	switch mode {
+	case "", "none":
+		return vault.ReplicationForwardNone, nil
+	case "always":
+		return vault.ReplicationForwardAlways, nil
+	case "inconsistent":
+		return vault.ReplicationForwardInconsistent, nil
+	default:
+		return vault.ReplicationForwardNone, fmt.Errorf("unknown forwarding mode %q", mode)
+	}
+}
+
+// readHealth reads sys/health from the given client. Standbys and replication
+// secondaries answer with non-200 status codes, so the raw response is parsed
+// regardless of status.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault client to query.
+//
+// Returns:
+//
+//	*healthStatus - The health status of the vault.
+//	error - An error if the health endpoint could not be read.
+func readHealth(ctx context.Context, client *vault.Client) (*healthStatus, error) {
+	resp, err := client.ReadRaw(ctx, "sys/health", vault.WithQueryParameters(url.Values{
+		"standbyok":     {"true"},
+		"perfstandbyok": {"true"},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	h := new(healthStatus)
+	if err := json.NewDecoder(resp.Body).Decode(h); err != nil {
+		return nil, fmt.Errorf("failed to decode health status: %w", err)
+	}
+	return h, nil
+}
+
+// checkSourceReplication detects the replication role of the source vault and
+// refuses to continue if it cannot serve reads. DR secondaries reject all
+// client requests, so a sync against one would fail every secret.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns:
+//
+//	error - An error if the source is a DR secondary.
+func (s *Syncer) checkSourceReplication(ctx context.Context) error {
+	h, err := readHealth(ctx, s.sourceVault)
+	if err != nil {
+		s.log.Warn().Err(err).Msg("Failed to detect source vault replication mode")
+		return nil
+	}
+
+	if h.ReplicationDRMode == "secondary" {
+		return fmt.Errorf("source vault is a DR secondary and cannot serve reads")
+	}
+
+	s.log.Info().
+		Str("performanceMode", h.ReplicationPerformanceMode).
+		Str("drMode", h.ReplicationDRMode).
+		Bool("standby", h.Standby).
+		Bool("performanceStandby", h.PerformanceStandby).
+		Msg("Detected source vault replication mode")
+
+	if s.cfg.SourceVault.Replica && h.ReplicationPerformanceMode != "secondary" && !h.PerformanceStandby {
+		s.log.Warn().Msg("Source vault is configured as a replica but is neither a performance secondary nor a performance standby")
+	}
+	return nil
+}
+
+// ReplicationJobs inspects a performance replication primary and returns one
+// job per KV v2 mount replicated to each of its secondaries, honouring each
+// secondary's allow or deny mount filter. Filtered paths that are not KV v2
+// mounts, such as namespaces, are logged and skipped.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	primary: *Vault - The connection settings of the primary.
+//
+// Returns:
+//
+//	[]ReplicationJob - The equivalent jobs, sorted by secondary and mount.
+//	error - An error if the vault is not a performance primary or could not be inspected.
+func ReplicationJobs(ctx context.Context, primary *Vault) ([]ReplicationJob, error) {
+	s := &Syncer{log: log.Logger}
+	defer s.Close()
+	client, err := s.initVault("source", primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize vault: %w", err)
+	}
+
+	status, err := client.Read(ctx, "sys/replication/performance/status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read performance replication status: %w", err)
+	}
+	if mode, _ := status.Data["mode"].(string); mode != "primary" {
+		return nil, fmt.Errorf("vault is not a performance replication primary (mode %q)", mode)
+	}
+	var secondaries []string
+	if ids, ok := status.Data["known_secondaries"].([]interface{}); ok {
+		for _, id := range ids {
+			if id, ok := id.(string); ok {
+				secondaries = append(secondaries, id)
+			}
+		}
+	}
+
+	mounts, err := kvMounts(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []ReplicationJob
+	for _, id := range secondaries {
+		filter, err := readPathsFilter(ctx, client, id)
+		if err != nil {
+			return nil, err
+		}
+
+		filtered := make(map[string]bool, len(filter.Paths))
+		for _, p := range filter.Paths {
+			p = strings.Trim(p, "/")
+			filtered[p] = true
+			if !mounts[p] {
+				s.log.Warn().Str("secondary", id).Str("path", p).Msg("Filtered path is not a KV v2 mount, skipping")
+			}
+		}
+
+		for m := range mounts {
+			if (filter.Mode == "allow") == filtered[m] {
+				jobs = append(jobs, ReplicationJob{Secondary: id, Mount: m})
+			}
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Secondary != jobs[j].Secondary {
+			return jobs[i].Secondary < jobs[j].Secondary
+		}
+		return jobs[i].Mount < jobs[j].Mount
+	})
+	return jobs, nil
+}
+
+// kvMounts returns the paths, without slashes, of every KV v2 mount.
+func kvMounts(ctx context.Context, client *vault.Client) (map[string]bool, error) {
+	resp, err := client.Read(ctx, "sys/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	mounts := make(map[string]bool)
+	for p, m := range resp.Data {
+		m, ok := m.(map[string]interface{})
+		if !ok || m["type"] != "kv" {
+			continue
+		}
+		if opts, _ := m["options"].(map[string]interface{}); opts["version"] == "2" {
+			mounts[strings.Trim(p, "/")] = true
+		}
+	}
+	return mounts, nil
+}
+
+// readPathsFilter reads the mount filter of a performance secondary. A
+// secondary without a filter receives every mount, which is treated as an
+// empty deny list.
+func readPathsFilter(ctx context.Context, client *vault.Client, id string) (*pathsFilter, error) {
+	resp, err := client.Read(ctx, "sys/replication/performance/primary/paths-filter/"+url.PathEscape(id))
+	if vault.IsErrorStatus(err, 404) {
+		return &pathsFilter{Mode: "deny"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paths filter of secondary %q: %w", id, err)
+	}
+
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	f := new(pathsFilter)
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("failed to decode paths filter of secondary %q: %w", id, err)
+	}
+	return f, nil
+}
+
+// replicatedMount reports whether Vault performance replication already
+// copies mount from the source vault to the destination, so syncing it
+// would only write every secret twice. That is the case when both vaults
+// are in the same performance replication set and the mount exists on both
+// with the same accessor and is not local. Vaults without replication, such
+// as Vault community edition, never replicate.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The source mount.
+//
+// Returns:
+//
+//	bool - Whether the mount is replicated to the destination.
+//	error - An error if the destination is a DR secondary or the mounts could not be read.
+func (s *Syncer) replicatedMount(ctx context.Context, mount string) (bool, error) {
+	if s.source != nil || s.destination != nil {
+		return false, nil
+	}
+
+	src, err := s.readReplicationStatus(ctx, s.sourceVault, s.readLimiter, "source")
+	if err != nil {
+		return false, err
+	}
+	dst, err := s.readReplicationStatus(ctx, s.destinationVault, s.writeLimiter, "destination")
+	if err != nil {
+		return false, err
+	}
+	if dst.DR.Mode == "secondary" {
+		return false, fmt.Errorf("destination vault is a DR secondary and cannot accept writes")
+	}
+	if src.Performance.ClusterID == "" || src.Performance.ClusterID != dst.Performance.ClusterID ||
+		src.Performance.Mode == "disabled" || dst.Performance.Mode == "disabled" {
+		return false, nil
+	}
+
+	srcMount, err := s.readMountEntry(ctx, s.sourceVault, s.readLimiter, mount)
+	if err != nil || srcMount == nil {
+		return false, err
+	}
+	dstMount, err := s.readMountEntry(ctx, s.destinationVault, s.writeLimiter, s.destMount(mount))
+	if err != nil || dstMount == nil {
+		return false, err
+	}
+	return !srcMount.Local && srcMount.Accessor != "" && srcMount.Accessor == dstMount.Accessor, nil
+}
+
+// readReplicationStatus reads sys/replication/status. A vault without
+// replication support is reported with replication disabled.
+func (s *Syncer) readReplicationStatus(ctx context.Context, client *vault.Client, limiter *rate.Limiter, name string) (*replicationStatus, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "read replication status", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, "sys/replication/status")
+		return err
+	})
+	if vault.IsErrorStatus(err, 404) || vault.IsErrorStatus(err, 400) {
+		return &replicationStatus{Performance: replicationMode{Mode: "disabled"}, DR: replicationMode{Mode: "disabled"}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s vault replication status: %w", name, err)
+	}
+
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	st := new(replicationStatus)
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("failed to decode %s vault replication status: %w", name, err)
+	}
+	return st, nil
+}
+
+// readMountEntry reads the sys/mounts entry of mount, or nil if there is
+// no such mount.
+func (s *Syncer) readMountEntry(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount string) (*mountEntry, error) {
+	var resp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "read mount", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err = client.Read(ctx, "sys/mounts/"+strings.Trim(mount, "/"))
+		return err
+	})
+	if vault.IsErrorStatus(err, 400) || vault.IsErrorStatus(err, 404) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount %q: %w", mount, err)
+	}
+
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	m := new(mountEntry)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to decode mount %q: %w", mount, err)
+	}
+	return m, nil
+}
+
+// checkReplicated applies OnReplicated to the mount about to be synced.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The source mount.
+//
+// Returns:
+//
+//	bool - Whether the mount should be skipped.
+//	error - An error if replication could not be detected.
+func (s *Syncer) checkReplicated(ctx context.Context, mount string) (bool, error) {
+	if s.cfg.OnReplicated == "" {
+		return false, nil
+	}
+	replicated, err := s.replicatedMount(ctx, mount)
+	if err != nil || !replicated {
+		return false, err
+	}
+
+	if s.cfg.OnReplicated == ReplicatedSkip {
+		s.log.Info().Str("mount", mount).Msg("Mount is replicated to the destination vault by Vault replication, skipping")
+		return true, nil
+	}
+	s.log.Warn().Str("mount", mount).Msg("Mount is replicated to the destination vault by Vault replication, syncing it anyway")
+	return false, nil
+}
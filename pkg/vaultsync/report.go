@@ -0,0 +1,456 @@
+package vaultsync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	// ActionCreated means the secret did not exist on the destination.
+	ActionCreated Action = "created"
+	// ActionUpdated means a new version of an existing destination secret was written.
+	ActionUpdated Action = "updated"
+	// ActionSkipped means the key was intentionally not written.
+	ActionSkipped Action = "skipped"
+	// ActionFailed means the secret could not be synced; see SecretResult.Error.
+	ActionFailed Action = "failed"
+	// ActionDeleted means the secret's current version was soft-deleted.
+	ActionDeleted Action = "deleted"
+	// ActionDestroyed means the secret and all of its versions were permanently removed.
+	ActionDestroyed Action = "destroyed"
+	// ActionUnchanged means the destination secret already held the same data and was not rewritten.
+	ActionUnchanged Action = "unchanged"
+	// ActionPulled means a bidirectional sync copied the destination secret back to the source.
+	ActionPulled Action = "pulled"
+	// ActionDenied means a vault refused the token access to the secret, or
+	// to list the folder, and it was skipped; see SecretResult.Error.
+	ActionDenied Action = "denied"
+)
+
+type (
+	// Action is the outcome of syncing a single secret.
+	Action string
+
+	// Duration is a time.Duration that is encoded as a string such as "1m30s".
+	Duration time.Duration
+
+	// Report is the structured result of a Sync.
+	Report struct {
+		RunID string `json:"runId"`
+		Mount string `json:"mount"`
+		Path  string `json:"path"`
+		// Shard is the slice of the secrets the run synced, as
+		// "index/total", if the keyspace was sharded.
+		Shard     string `json:"shard,omitempty"`
+		Verified  bool   `json:"verified"`
+		Resumed   bool   `json:"resumed,omitempty"`
+		Cancelled bool   `json:"cancelled,omitempty"`
+		// DeadlineExceeded means the run stopped at its MaxDuration.
+		DeadlineExceeded bool `json:"deadlineExceeded,omitempty"`
+		// FailedFast means the run stopped at its first failed secret.
+		FailedFast bool `json:"failedFast,omitempty"`
+		// MaxErrorsExceeded means the run stopped after more secrets failed
+		// than MaxErrors allows.
+		MaxErrorsExceeded bool `json:"maxErrorsExceeded,omitempty"`
+		// Replicated means the mount was skipped because Vault replication
+		// already copies it to the destination.
+		Replicated bool           `json:"replicated,omitempty"`
+		StartedAt  time.Time      `json:"startedAt"`
+		FinishedAt time.Time      `json:"finishedAt"`
+		Durations  StageDurations `json:"durations"`
+		Approval   *Approval      `json:"approval,omitempty"`
+		Created    int            `json:"created"`
+		Updated    int            `json:"updated"`
+		Skipped    int            `json:"skipped"`
+		Failed     int            `json:"failed"`
+		Deleted    int            `json:"deleted,omitempty"`
+		Destroyed  int            `json:"destroyed,omitempty"`
+		Unchanged  int            `json:"unchanged,omitempty"`
+		Pulled     int            `json:"pulled,omitempty"`
+		Conflicts  int            `json:"conflicts,omitempty"`
+		Denied     int            `json:"denied,omitempty"`
+		// Discovered is how many secrets were found on the source.
+		Discovered int `json:"discovered"`
+		// Bytes is the size of the JSON data written to the destination.
+		Bytes int64 `json:"bytes"`
+		// PermissionDenied lists every secret and folder that was denied,
+		// so the policies can be fixed and the run resumed.
+		PermissionDenied []string `json:"permissionDenied,omitempty"`
+		// Duplicates groups the source secrets, two or more at a time,
+		// that hold identical data, such as copy-pasted credentials that
+		// could be consolidated.
+		Duplicates [][]string `json:"duplicates,omitempty"`
+		// Latency summarizes how long secrets took in each stage.
+		Latency *Latency       `json:"latency,omitempty"`
+		Secrets []SecretResult `json:"secrets"`
+		// Mounts holds the report of each pair of a srcVault.mounts sync.
+		Mounts []*Report `json:"mounts,omitempty"`
+
+		mu        sync.Mutex
+		results   map[string]*SecretResult
+		conflicts map[string]string
+		// contents holds the paths of the source secrets read, keyed by
+		// the checksum of their data.
+		contents map[[32]byte][]string
+		// sums holds the checksum of each source secret read, keyed by
+		// path.
+		sums map[string][32]byte
+		// timings holds how long each secret spent in each stage, keyed by
+		// path.
+		timings map[string]*stageTimings
+	}
+
+	// StageDurations records how long each stage of a sync took.
+	StageDurations struct {
+		Discovery Duration `json:"discovery"`
+		Copy      Duration `json:"copy"`
+		Verify    Duration `json:"verify"`
+		Total     Duration `json:"total"`
+	}
+
+	// SecretResult is the outcome of syncing a single secret.
+	SecretResult struct {
+		Path   string `json:"path"`
+		Action Action `json:"action"`
+		Error  string `json:"error,omitempty"`
+		// Conflict is the conflict strategy applied because the
+		// destination secret already existed and differed.
+		Conflict string   `json:"conflict,omitempty"`
+		Duration Duration `json:"duration"`
+		// Read, Write, and Verify are how long each stage of the sync of
+		// the secret took.
+		Read   Duration `json:"read,omitempty"`
+		Write  Duration `json:"write,omitempty"`
+		Verify Duration `json:"verify,omitempty"`
+		// Checksum is the SHA-256 of the source data the run read, which
+		// decommission checks the source against before deleting it.
+		Checksum string `json:"checksum,omitempty"`
+
+		err error
+		// folder is set for the result of a folder rather than a secret.
+		folder bool
+	}
+)
+
+// MarshalJSON encodes the duration in time.Duration's string format.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration in time.Duration's string format.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// newReport returns an empty Report for a run starting now, with a new run ID.
+func newReport(mount, path string) *Report {
+	now := time.Now().UTC()
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return &Report{
+		RunID:     now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Mount:     mount,
+		Path:      path,
+		StartedAt: now,
+		results:   make(map[string]*SecretResult),
+		conflicts: make(map[string]string),
+		contents:  make(map[[32]byte][]string),
+		sums:      make(map[string][32]byte),
+		timings:   make(map[string]*stageTimings),
+	}
+}
+
+// record stores the outcome of syncing the secret at path. Safe for
+// concurrent use.
+//
+// Arguments:
+//
+//	path: string - The path of the secret.
+//	action: Action - What happened to the secret.
+//	err: error - The error that caused the secret to fail, if any.
+//	d: time.Duration - How long the secret took to sync.
+//
+// Returns: nothing
+func (r *Report) record(path string, action Action, err error, d time.Duration) {
+	res := &SecretResult{Path: path, Action: action, Duration: Duration(d)}
+	if err != nil {
+		res.Action = failedAction(err)
+		res.Error = redactString(err.Error())
+		res.err = err
+	}
+
+	r.mu.Lock()
+	r.results[path] = res
+	r.mu.Unlock()
+}
+
+// recordFolder stores the outcome of listing the folder at path, such as a
+// denied listing, which is not counted as a secret. Safe for concurrent use.
+//
+// Arguments:
+//
+//	path: string - The path of the folder.
+//	action: Action - The outcome of the folder.
+//	err: error - The error that caused the outcome, if any.
+//
+// Returns: nothing
+func (r *Report) recordFolder(path string, action Action, err error) {
+	res := &SecretResult{Path: path, Action: action, folder: true}
+	if err != nil {
+		res.Error = redactString(err.Error())
+		res.err = err
+	}
+
+	r.mu.Lock()
+	r.results[path] = res
+	r.mu.Unlock()
+}
+
+// conflict notes that the secret at path conflicted with the destination
+// and which strategy was applied. Safe for concurrent use.
+//
+// Arguments:
+//
+//	path: string - The path of the secret.
+//	strategy: string - The conflict strategy applied.
+//
+// Returns: nothing
+func (r *Report) conflict(path, strategy string) {
+	r.mu.Lock()
+	r.conflicts[path] = strategy
+	r.mu.Unlock()
+}
+
+// transferred adds the size of data written to the destination to Bytes.
+// Safe for concurrent use.
+//
+// Arguments:
+//
+//	data: map[string]interface{} - The data written.
+//
+// Returns: nothing
+func (r *Report) transferred(data map[string]interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.Bytes += int64(len(b))
+	r.mu.Unlock()
+}
+
+// Throughput returns how many secrets, and how many bytes of secret data,
+// the run processed per second of its total duration. It must be called
+// after the run finished.
+//
+// Returns:
+//
+//	float64 - Secrets processed per second.
+//	float64 - Bytes written per second.
+func (r *Report) Throughput() (float64, float64) {
+	elapsed := time.Duration(r.Durations.Total).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	return float64(r.secretCount()) / elapsed, float64(r.Bytes) / elapsed
+}
+
+// secretCount returns how many of Secrets are results of secrets rather
+// than of skipped or denied folders. It must be called after finish.
+func (r *Report) secretCount() int {
+	n := 0
+	for _, res := range r.Secrets {
+		if !res.isFolder() {
+			n++
+		}
+	}
+	return n
+}
+
+// isFolder reports whether the result is of a folder rather than a secret.
+func (res *SecretResult) isFolder() bool {
+	return res.folder || strings.HasSuffix(res.Path, "/")
+}
+
+// content notes the checksum of the source secret at path, to find
+// secrets holding identical data. Safe for concurrent use.
+//
+// Arguments:
+//
+//	path: string - The path of the secret.
+//	sum: [32]byte - The checksum of the secret's data.
+//
+// Returns: nothing
+func (r *Report) content(path string, sum [32]byte) {
+	r.mu.Lock()
+	r.contents[sum] = append(r.contents[sum], path)
+	r.sums[path] = sum
+	r.mu.Unlock()
+}
+
+// fail marks a previously recorded secret as failed, e.g. when verification
+// finds the destination does not match. Safe for concurrent use.
+//
+// Arguments:
+//
+//	path: string - The path of the secret.
+//	err: error - The reason the secret failed.
+//
+// Returns: nothing
+func (r *Report) fail(path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res, ok := r.results[path]
+	if !ok {
+		res = &SecretResult{Path: path}
+		r.results[path] = res
+	}
+	res.Action = failedAction(err)
+	res.Error = redactString(err.Error())
+	res.err = err
+}
+
+// failedAction returns ActionDenied if err is a vault permission denied
+// error, and ActionFailed otherwise.
+func failedAction(err error) Action {
+	if vault.IsErrorStatus(err, 403) {
+		return ActionDenied
+	}
+	return ActionFailed
+}
+
+// resume carries the run ID and every successful result of an interrupted
+// run over into r.
+//
+// Arguments:
+//
+//	prev: *Report - The report of the interrupted run.
+//
+// Returns:
+//
+//	map[string]bool - The paths of the carried over secrets.
+func (r *Report) resume(prev *Report) map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.RunID = prev.RunID
+	r.Resumed = true
+
+	done := make(map[string]bool, len(prev.Secrets))
+	for _, res := range prev.Secrets {
+		if res.Action == ActionFailed || res.Action == ActionDenied {
+			continue
+		}
+		res := res
+		r.results[res.Path] = &res
+		done[res.Path] = true
+	}
+	return done
+}
+
+// finish stamps the finish time and flattens the recorded results into the
+// sorted Secrets list and the summary counts.
+func (r *Report) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now().UTC()
+	r.Durations.Total = Duration(r.FinishedAt.Sub(r.StartedAt))
+	r.flatten()
+}
+
+// flatten fills the sorted Secrets list and the summary counts from the
+// recorded results. The caller must hold r.mu.
+func (r *Report) flatten() {
+	r.Secrets = make([]SecretResult, 0, len(r.results))
+	r.Created, r.Updated, r.Skipped, r.Failed, r.Deleted, r.Destroyed, r.Unchanged, r.Pulled, r.Conflicts, r.Denied = 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
+	r.PermissionDenied = nil
+	for path, res := range r.results {
+		if strategy, ok := r.conflicts[path]; ok {
+			res.Conflict = strategy
+		}
+		if res.Conflict != "" {
+			r.Conflicts++
+		}
+		if t, ok := r.timings[path]; ok {
+			res.Read, res.Write, res.Verify = Duration(t.read), Duration(t.write), Duration(t.verify)
+		}
+		if sum, ok := r.sums[path]; ok {
+			res.Checksum = hex.EncodeToString(sum[:])
+		}
+		r.Secrets = append(r.Secrets, *res)
+		switch res.Action {
+		case ActionCreated:
+			r.Created++
+		case ActionUpdated:
+			r.Updated++
+		case ActionSkipped:
+			r.Skipped++
+		case ActionFailed:
+			r.Failed++
+		case ActionDeleted:
+			r.Deleted++
+		case ActionDestroyed:
+			r.Destroyed++
+		case ActionUnchanged:
+			r.Unchanged++
+		case ActionPulled:
+			r.Pulled++
+		case ActionDenied:
+			r.Denied++
+			r.PermissionDenied = append(r.PermissionDenied, path)
+		}
+	}
+	sort.Slice(r.Secrets, func(i, j int) bool { return r.Secrets[i].Path < r.Secrets[j].Path })
+	sort.Strings(r.PermissionDenied)
+	r.Latency = newLatency(r.Secrets)
+
+	r.Duplicates = nil
+	for _, paths := range r.contents {
+		if len(paths) < 2 {
+			continue
+		}
+		group := append([]string(nil), paths...)
+		sort.Strings(group)
+		r.Duplicates = append(r.Duplicates, group)
+	}
+	sort.Slice(r.Duplicates, func(i, j int) bool { return r.Duplicates[i][0] < r.Duplicates[j][0] })
+}
+
+// err returns a *SyncError describing every failed or denied secret, or nil
+// if none failed. It must be called after finish.
+func (r *Report) err() error {
+	if r.Failed+r.Denied == 0 {
+		return nil
+	}
+
+	e := &SyncError{Total: r.secretCount()}
+	for _, res := range r.Secrets {
+		if res.Action == ActionFailed || res.Action == ActionDenied {
+			e.Errors = append(e.Errors, &SecretError{Path: res.Path, Err: res.err})
+			if res.isFolder() {
+				e.folders++
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,113 @@
+package vaultsync
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+const (
+	// memoryHighWatermark is the fraction of the memory limit above which the
+	// batch size is halved.
+	memoryHighWatermark = 0.8
+	// memoryLowWatermark is the fraction of the memory limit below which the
+	// batch size is allowed to grow back towards the configured size.
+	memoryLowWatermark = 0.5
+)
+
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// MemoryLimitBytes parses the configured memory limit, e.g. "512MiB" or "2GB".
+// It returns 0 when no limit is configured.
+func (r Resources) MemoryLimitBytes() (int64, error) {
+	if r.MemoryLimit == "" {
+		return 0, nil
+	}
+
+	s := strings.ToLower(strings.TrimSpace(r.MemoryLimit))
+	i := strings.IndexFunc(s, func(c rune) bool { return (c < '0' || c > '9') && c != '.' })
+	if i == -1 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q: %w", r.MemoryLimit, err)
+	}
+	unit, ok := byteSizeUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid memory limit %q: unknown unit", r.MemoryLimit)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// tuneBatchSize returns the batch size to use for the next batch, shrinking it
+// when the process is nearing its memory limit and growing it back towards the
+// configured batch size once pressure subsides. Without a memory limit the
+// configured batch size is always returned.
+//
+// Arguments:
+//
+//	current: int - The batch size used for the previous batch.
+//
+// Returns:
+//
+//	int - The batch size to use for the next batch.
+func (s *Syncer) tuneBatchSize(current int) int {
+	configured := s.cfg.BatchSize
+	if configured < 1 {
+		configured = 1
+	}
+	if current < 1 {
+		current = configured
+	}
+
+	limit := debug.SetMemoryLimit(-1)
+	if limit <= 0 || limit == math.MaxInt64 {
+		return configured
+	}
+
+	usage := float64(memoryInUse()) / float64(limit)
+	switch {
+	case usage >= memoryHighWatermark && current > 1:
+		s.log.Warn().Float64("usage", usage).Int("batchSize", current/2).Msg("Nearing memory limit, reducing batch size")
+		return current / 2
+	case usage <= memoryLowWatermark && current < configured:
+		next := current * 2
+		if next > configured {
+			next = configured
+		}
+		s.log.Debug().Float64("usage", usage).Int("batchSize", next).Msg("Memory pressure eased, increasing batch size")
+		return next
+	default:
+		return current
+	}
+}
+
+// memoryInUse returns the memory counted by the Go runtime against its soft
+// memory limit.
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+
+	if samples[0].Value.Kind() != metrics.KindUint64 || samples[1].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
@@ -0,0 +1,125 @@
+package vaultsync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	defaultRetryBaseDelay = 250 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+// withRetry calls fn until it succeeds, returns a non-transient error, or the
+// configured number of attempts is exhausted. Delays between attempts grow
+// exponentially from the base delay up to the max delay, optionally with full
+// jitter applied. A permission denied error is retried once if the token
+// command or file returns a new token. A request that hit its own timeout,
+// rather than the deadline of ctx, is transient.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	op: string - A short description of the operation, used for logging.
+//	fn: func() error - The operation to perform.
+//
+// Returns:
+//
+//	error - The last error returned by fn, classified by classify, or the context error if cancelled while waiting.
+func (s *Syncer) withRetry(ctx context.Context, op string, fn func() error) error {
+	attempts := s.cfg.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	reloaded := false
+	for attempt := 1; attempt <= attempts; attempt++ {
+		gen := s.tokenGeneration()
+		err = fn()
+		// A rejected token may have been rotated since; try once more with
+		// a new one from the token command or file.
+		if vault.IsErrorStatus(err, 403) && !reloaded && s.reloadTokens(gen) {
+			reloaded = true
+			err = fn()
+		}
+		timedOut := errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+		if err == nil || !isTransient(err) && !timedOut || attempt == attempts {
+			return s.classify(err)
+		}
+
+		delay := s.cfg.Retry.backoff(attempt)
+		s.log.Warn().Err(err).Str("op", op).Int("attempt", attempt).Dur("delay", delay).Msg("Transient error, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// backoff returns the delay to wait after the given (1-indexed) attempt.
+func (r Retry) backoff(attempt int) time.Duration {
+	base := r.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	max := r.MaxDelay
+	if max <= 0 {
+		max = defaultRetryMaxDelay
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	if r.Jitter {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+	return delay
+}
+
+// isTransient reports whether err is worth retrying: server-side (5xx) errors,
+// which include a sealed or standby vault, and dropped or timed out connections.
+// Errors from a Destination may decide for themselves by implementing
+// Transient() bool.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var t interface{ Transient() bool }
+	if errors.As(err, &t) {
+		return t.Transient()
+	}
+
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "Vault is sealed")
+}
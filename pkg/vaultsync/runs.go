@@ -0,0 +1,202 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultStateDir is where run reports are kept when no state directory is configured.
+const DefaultStateDir = ".hvm/runs"
+
+// RunDir returns the configured state directory, or DefaultStateDir.
+func (c *Config) RunDir() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	return DefaultStateDir
+}
+
+// SaveRun stores a run's report in the state directory under its run ID, so
+// later commands such as decommission can refer to the run.
+//
+// Arguments:
+//
+//	dir: string - The state directory.
+//	r: *Report - The report of the run.
+//
+// Returns:
+//
+//	error - An error if the report could not be written.
+func SaveRun(dir string, r *Report) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, r.RunID+".json"), b, 0o600)
+}
+
+// LoadRun reads the report of a previous run from the state directory.
+//
+// Arguments:
+//
+//	dir: string - The state directory.
+//	runID: string - The ID of the run.
+//
+// Returns:
+//
+//	*Report - The report of the run.
+//	error - An error if the report could not be read.
+func LoadRun(dir, runID string) (*Report, error) {
+	if runID == "" || filepath.Base(runID) != runID {
+		return nil, fmt.Errorf("invalid run ID %q", runID)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, runID+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %q: %w", runID, err)
+	}
+
+	r := new(Report)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("failed to decode run %q: %w", runID, err)
+	}
+	return r, nil
+}
+
+// RecentRuns returns the reports of the most recently started runs in the
+// state directory, newest first. Reports that cannot be read are skipped.
+//
+// Arguments:
+//
+//	dir: string - The state directory.
+//	n: int - The maximum number of reports to return, or 0 for all of them.
+//
+// Returns:
+//
+//	[]*Report - The reports.
+//	error - An error if the state directory could not be read.
+func RecentRuns(dir string, n int) ([]*Report, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var runs []*Report
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		r, err := LoadRun(dir, strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	if n > 0 && len(runs) > n {
+		runs = runs[:n]
+	}
+	return runs, nil
+}
+
+// findInterruptedRun returns the most recently started run of the given
+// mount, path, and shard that never finished, was cancelled, or stopped at
+// its maximum duration, or nil if there is none.
+//
+// Arguments:
+//
+//	dir: string - The state directory.
+//	mount: string - The mount of the run.
+//	path: string - The path of the run.
+//	shard: string - The shard of the run, or "" if it was not sharded.
+//
+// Returns:
+//
+//	*Report - The report of the interrupted run, or nil.
+//	error - An error if the state directory could not be read.
+func findInterruptedRun(dir, mount, path, shard string) (*Report, error) {
+	runs, err := RecentRuns(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range runs {
+		if (r.FinishedAt.IsZero() || r.Cancelled || r.DeadlineExceeded || r.FailedFast || r.MaxErrorsExceeded || r.Denied > 0) && r.Mount == mount && r.Path == path && r.Shard == shard {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkpoint saves the in-progress report to the state directory so an
+// interrupted run can be resumed. Failures are logged, not returned.
+func (s *Syncer) checkpoint() {
+	s.report.mu.Lock()
+	s.report.flatten()
+	s.report.mu.Unlock()
+
+	if err := SaveRun(s.cfg.RunDir(), s.report); err != nil {
+		s.log.Error().Err(err).Msg("Failed to save run state")
+	}
+}
+
+// resumeInterrupted continues the most recent interrupted run of the
+// configured path, if any, keeping its run ID and skipping the secrets it
+// already synced.
+func (s *Syncer) resumeInterrupted() {
+	prev, err := findInterruptedRun(s.cfg.RunDir(), s.report.Mount, s.report.Path, s.report.Shard)
+	if err != nil {
+		s.log.Warn().Err(err).Msg("Failed to look for an interrupted run")
+		return
+	}
+	if prev == nil {
+		return
+	}
+
+	s.resumed = s.report.resume(prev)
+	s.log.Info().Str("run", prev.RunID).Int("done", len(s.resumed)).Msg("Resuming interrupted run")
+}
+
+// rememberResumed re-reads a secret that an interrupted run already synced
+// and records it for the verification stage without writing it again. If
+// it cannot be read, it is marked failed.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret.
+//
+// Returns: nothing
+func (s *Syncer) rememberResumed(ctx context.Context, mount, path string) {
+	if strings.HasSuffix(path, "/") {
+		return
+	}
+
+	srcData, err := s.readSource(ctx, mount, path, 0)
+	if err != nil {
+		s.report.fail(path, err)
+		return
+	}
+
+	destPath, destData, err := s.transformer.Transform(path, srcData)
+	if err == nil {
+		err = s.recordSynced(path, destPath, destData)
+	}
+	if err != nil {
+		s.report.fail(path, err)
+	}
+}
@@ -0,0 +1,104 @@
+package vaultsync
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// SchemaModeWarn reports secrets that fail validation but still writes them.
+	SchemaModeWarn = "warn"
+	// SchemaModeEnforce refuses to write secrets that fail validation and
+	// fails the run.
+	SchemaModeEnforce = "enforce"
+)
+
+// compiledSchema is a SchemaRule with its schema loaded and compiled.
+type compiledSchema struct {
+	pattern string
+	schema  *jsonschema.Schema
+}
+
+// compileSchemas loads and compiles the schema of every configured rule.
+//
+// Arguments:
+//
+//	cfg: SchemaValidation - The schema validation configuration.
+//
+// Returns:
+//
+//	[]compiledSchema - The compiled schemas, in rule order.
+//	error - An error if a pattern is malformed or a schema cannot be compiled.
+func compileSchemas(cfg SchemaValidation) ([]compiledSchema, error) {
+	switch cfg.Mode {
+	case "", SchemaModeWarn, SchemaModeEnforce:
+	default:
+		return nil, fmt.Errorf("unknown schema validation mode %q", cfg.Mode)
+	}
+
+	var retVal []compiledSchema
+	for _, rule := range cfg.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid schema pattern %q: %w", rule.Pattern, err)
+		}
+
+		sch, err := jsonschema.Compile(rule.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile schema %q: %w", rule.Schema, err)
+		}
+		retVal = append(retVal, compiledSchema{pattern: rule.Pattern, schema: sch})
+	}
+	return retVal, nil
+}
+
+// validateSchema validates secret data against every schema whose pattern
+// matches the secret path.
+//
+// Arguments:
+//
+//	secretPath: string - The path of the secret, relative to its mount.
+//	data: interface{} - The secret's key/value data.
+//
+// Returns:
+//
+//	error - An error describing every schema violation, or nil if the secret is valid.
+func (s *Syncer) validateSchema(secretPath string, data interface{}) error {
+	var errs []error
+	for _, cs := range s.schemas {
+		if ok, _ := path.Match(cs.pattern, secretPath); !ok {
+			continue
+		}
+		err := cs.schema.Validate(data)
+		if err == nil {
+			continue
+		}
+		var ve *jsonschema.ValidationError
+		if !errors.As(err, &ve) {
+			errs = append(errs, fmt.Errorf("secret does not match schema for %q: %w", cs.pattern, err))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("secret does not match schema for %q: %s", cs.pattern, strings.Join(violations(ve), "; ")))
+	}
+	return errors.Join(errs...)
+}
+
+// violations returns one line per failed leaf of a validation error, as the
+// error of the schema itself only names the first.
+func violations(ve *jsonschema.ValidationError) []string {
+	if len(ve.Causes) == 0 {
+		loc := ve.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", loc, ve.Message)}
+	}
+	var retVal []string
+	for _, c := range ve.Causes {
+		retVal = append(retVal, violations(c)...)
+	}
+	return retVal
+}
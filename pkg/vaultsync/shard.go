@@ -0,0 +1,63 @@
+package vaultsync
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Enabled reports whether the keyspace is split between instances.
+func (s Shard) Enabled() bool {
+	return s.Total > 1
+}
+
+// String returns the shard as "index/total", or "" if sharding is disabled.
+func (s Shard) String() string {
+	if !s.Enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+// owns reports whether the secret at path falls in this shard. Every
+// instance hashes each path the same way, so the shards never overlap and
+// together cover every secret.
+//
+// Arguments:
+//
+//	path: string - The source path of the secret.
+//
+// Returns:
+//
+//	bool - Whether this instance syncs the secret.
+func (s Shard) owns(path string) bool {
+	if !s.Enabled() {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(path))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
+
+// shardKeys drops the keys under path that belong to other shards. Folders
+// are kept, like any other key the copy stage skips.
+//
+// Arguments:
+//
+//	path: string - The listed path.
+//	keys: []string - The keys listed under path.
+//
+// Returns:
+//
+//	[]string - The keys this instance syncs.
+func (s *Syncer) shardKeys(path string, keys []string) []string {
+	if !s.cfg.Shard.Enabled() {
+		return keys
+	}
+	retVal := keys[:0]
+	for _, k := range keys {
+		if !isSecretKey(k) || s.cfg.Shard.owns(path+k) {
+			retVal = append(retVal, k)
+		}
+	}
+	return retVal
+}
@@ -0,0 +1,245 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+type (
+	// SnapshotReport is the result of MigrateSnapshot: the pre-flight checks
+	// of both vaults and, once applied, the snapshot that was restored.
+	SnapshotReport struct {
+		Applied            bool      `json:"applied"`
+		StartedAt          time.Time `json:"startedAt"`
+		FinishedAt         time.Time `json:"finishedAt"`
+		SourceVersion      string    `json:"sourceVersion"`
+		DestinationVersion string    `json:"destinationVersion"`
+		// Problems lists every failed pre-flight check. Nothing is
+		// snapshotted or restored unless it is empty.
+		Problems []string `json:"problems,omitempty"`
+		// File is where the snapshot was kept, if it was not a temporary
+		// file.
+		File   string `json:"file,omitempty"`
+		Bytes  int64  `json:"bytes,omitempty"`
+		SHA256 string `json:"sha256,omitempty"`
+		// Restored means the snapshot was restored to the destination.
+		Restored bool `json:"restored,omitempty"`
+	}
+)
+
+// MigrateSnapshot moves a whole cluster at once: it takes a raft snapshot
+// of the source vault and force-restores it to the destination, replacing
+// everything the destination holds, instead of syncing key by key. Both
+// vaults are checked first: they must be unsealed, not DR secondaries, and
+// use integrated storage, and the destination must run the same or a newer
+// Vault version of the same edition. Without apply only the checks are run.
+// After the restore the destination is unsealed with the source's keys.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	apply: bool - Snapshot and restore instead of only running the checks.
+//	file: string - Where to keep the snapshot, or empty for a temporary file removed after the restore.
+//
+// Returns:
+//
+//	*SnapshotReport - The checks and, if applied, the restored snapshot.
+//	error - An error if a check failed or the snapshot could not be taken or restored.
+func (s *Syncer) MigrateSnapshot(ctx context.Context, apply bool, file string) (*SnapshotReport, error) {
+	ctx, span := s.tracer.Start(ctx, "migrate snapshot")
+	defer span.End()
+
+	if err := s.requireVaultSource("snapshot migration"); err != nil {
+		return nil, err
+	}
+	if s.destination != nil {
+		return nil, fmt.Errorf("snapshot migration requires a vault destination")
+	}
+
+	report := &SnapshotReport{Applied: apply, StartedAt: time.Now().UTC()}
+	defer func() { report.FinishedAt = time.Now().UTC() }()
+
+	s.preflightSnapshot(ctx, report)
+	if len(report.Problems) > 0 {
+		return report, fmt.Errorf("pre-flight checks failed: %s", strings.Join(report.Problems, "; "))
+	}
+	s.log.Info().Str("sourceVersion", report.SourceVersion).Str("destinationVersion", report.DestinationVersion).Msg("Pre-flight checks passed")
+	if !apply {
+		return report, nil
+	}
+
+	f, err := s.takeSnapshot(ctx, report, file)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		f.Close()
+		if file == "" {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err := s.restoreSnapshot(ctx, f); err != nil {
+		return report, err
+	}
+	report.Restored = true
+	s.log.Info().Int64("bytes", report.Bytes).Str("sha256", report.SHA256).Msg("Snapshot restored to destination vault; unseal it with the source vault's keys")
+	return report, nil
+}
+
+// preflightSnapshot checks that a snapshot of the source vault can be
+// restored to the destination, adding every failed check to the report's
+// Problems.
+func (s *Syncer) preflightSnapshot(ctx context.Context, report *SnapshotReport) {
+	check := func(name string, client *vault.Client) *healthStatus {
+		h, err := readHealth(ctx, client)
+		if err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("failed to read %s vault health: %v", name, err))
+			return nil
+		}
+		if h.Sealed {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s vault is sealed", name))
+		}
+		if h.ReplicationDRMode == "secondary" {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s vault is a DR secondary", name))
+		}
+		if _, err := client.Read(ctx, "sys/storage/raft/configuration"); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s vault does not use integrated storage, or the token cannot read it: %v", name, err))
+		}
+		return h
+	}
+	src := check("source", s.sourceVault)
+	dst := check("destination", s.destinationVault)
+	if src == nil || dst == nil {
+		return
+	}
+	report.SourceVersion, report.DestinationVersion = src.Version, dst.Version
+
+	srcVer, srcEnt, err := parseVaultVersion(src.Version)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("source vault: %v", err))
+		return
+	}
+	dstVer, dstEnt, err := parseVaultVersion(dst.Version)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("destination vault: %v", err))
+		return
+	}
+	for i := range srcVer {
+		if dstVer[i] != srcVer[i] {
+			if dstVer[i] < srcVer[i] {
+				report.Problems = append(report.Problems, fmt.Sprintf("destination vault %s is older than source vault %s; snapshots can only be restored to the same or a newer version", dst.Version, src.Version))
+			}
+			break
+		}
+	}
+	if srcEnt != dstEnt {
+		report.Problems = append(report.Problems, fmt.Sprintf("source vault %s and destination vault %s are different editions", src.Version, dst.Version))
+	}
+}
+
+// parseVaultVersion parses a Vault version such as "1.15.2+ent" into its
+// major, minor, and patch numbers, and whether it is an enterprise build.
+func parseVaultVersion(v string) ([3]int, bool, error) {
+	var parsed [3]int
+	ent := strings.Contains(v, "+ent")
+	core, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	core, _, _ = strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return parsed, false, fmt.Errorf("invalid vault version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return parsed, false, fmt.Errorf("invalid vault version %q", v)
+		}
+		parsed[i] = n
+	}
+	return parsed, ent, nil
+}
+
+// takeSnapshot streams a raft snapshot of the source vault to file, or to
+// a temporary file, recording its size and checksum in the report.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	report: *SnapshotReport - The report to record the snapshot in.
+//	file: string - Where to write the snapshot, or empty for a temporary file.
+//
+// Returns:
+//
+//	*os.File - The snapshot, open for reading from the start.
+//	error - An error if the snapshot could not be taken or written.
+func (s *Syncer) takeSnapshot(ctx context.Context, report *SnapshotReport, file string) (*os.File, error) {
+	var (
+		f   *os.File
+		err error
+	)
+	if file == "" {
+		f, err = os.CreateTemp("", "hvm-snapshot-*.snap")
+	} else {
+		f, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+		report.File = file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	fail := func(err error) (*os.File, error) {
+		f.Close()
+		if file == "" {
+			os.Remove(f.Name())
+		}
+		return nil, err
+	}
+
+	if err := s.readLimiter.Wait(ctx); err != nil {
+		return fail(err)
+	}
+	s.log.Info().Msg("Taking raft snapshot of source vault")
+	resp, err := s.sourceVault.ReadRaw(ctx, "sys/storage/raft/snapshot")
+	if err != nil {
+		return fail(fmt.Errorf("failed to take snapshot: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fail(fmt.Errorf("failed to take snapshot: source vault returned %s: %s", resp.Status, strings.TrimSpace(string(msg))))
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		return fail(fmt.Errorf("failed to write snapshot: %w", err))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to rewind snapshot: %w", err))
+	}
+	report.Bytes, report.SHA256 = n, hex.EncodeToString(h.Sum(nil))
+	s.log.Info().Int64("bytes", n).Str("sha256", report.SHA256).Msg("Snapshot taken")
+	return f, nil
+}
+
+// restoreSnapshot force-restores the snapshot to the destination vault, as
+// it comes from another cluster with other keys.
+func (s *Syncer) restoreSnapshot(ctx context.Context, snapshot io.Reader) error {
+	if err := s.writeLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	s.log.Info().Msg("Restoring snapshot to destination vault")
+	if _, err := s.destinationVault.WriteFromReader(ctx, "sys/storage/raft/snapshot-force", snapshot); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
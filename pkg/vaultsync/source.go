@@ -0,0 +1,99 @@
+package vaultsync
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Source reads secrets from somewhere other than a vault, such as a
+	// Consul KV store being retired. Paths are source paths, relative to the
+	// root of the source, and the configured source path and mount are used
+	// as they would be for a source vault. Implementations must be safe for
+	// concurrent use.
+	Source interface {
+		// Name describes the source in logs and approval plans.
+		Name() string
+		// List returns the keys directly under path. Folders are returned
+		// with a trailing slash and are not synced.
+		List(ctx context.Context, path string) ([]string, error)
+		// Read returns the data of the secret at path.
+		Read(ctx context.Context, path string) (map[string]interface{}, error)
+	}
+)
+
+// WithSource reads secrets from src instead of the source vault. Only the
+// mount and path of the source vault config are used, and features that rely
+// on KV v2 metadata (history replay, diff, changes, and decommission) are
+// unavailable.
+//
+// Arguments:
+//
+//	src: Source - The source to read from.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithSource(src Source) Option {
+	return func(s *Syncer) {
+		s.source = src
+	}
+}
+
+// checkSource rejects settings that need a vault source when an external
+// Source is used.
+func checkSource(cfg *Config) error {
+	if cfg.History.Enabled {
+		return fmt.Errorf("history replay requires a vault source")
+	}
+	return nil
+}
+
+// sourceName describes where secrets are read from, for logs and plans.
+func (s *Syncer) sourceName() string {
+	if s.source != nil {
+		return s.source.Name()
+	}
+	return s.cfg.SourceVault.Address
+}
+
+// requireVaultSource returns an error naming op if an external Source is
+// configured.
+func (s *Syncer) requireVaultSource(op string) error {
+	if s.source != nil {
+		return fmt.Errorf("%s requires a vault source, not %s", op, s.source.Name())
+	}
+	return nil
+}
+
+// readExternal reads a secret from the external source.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	path: string - The source path of the secret.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the secret could not be read or has no data.
+func (s *Syncer) readExternal(ctx context.Context, path string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := s.withRetry(ctx, "read", func() (err error) {
+		if err := s.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		data, err = s.source.Read(ctx, path)
+		return err
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Str("source", s.source.Name()).Msg("Failed to get secret from source")
+		return nil, fmt.Errorf("failed to read secret from source: %w", err)
+	}
+	if len(data) == 0 {
+		s.log.Error().Str("secret", path).Msg("Source secret has no data")
+		return nil, fmt.Errorf("source secret has no data")
+	}
+	s.secrets.addData(data)
+	return data, nil
+}
@@ -0,0 +1,299 @@
+package vaultsync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// TerraformExport describes the Terraform configuration written by
+	// ExportTerraform.
+	TerraformExport struct {
+		CreatedAt time.Time `json:"createdAt"`
+		Source    string    `json:"source"`
+		Mount     string    `json:"mount"`
+		Path      string    `json:"path"`
+		Secrets   int       `json:"secrets"`
+		Policies  int       `json:"policies"`
+	}
+
+	// terraformPolicy is an ACL policy to render as a vault_policy.
+	terraformPolicy struct {
+		name  string
+		rules string
+	}
+)
+
+// ExportTerraform renders every secret directly under the configured source
+// path as a vault_kv_secret_v2 resource (vault_kv_secret on a KV v1 mount),
+// and with policies every ACL policy of the source vault as a vault_policy,
+// for the Vault Terraform provider. Each resource has an import block, so
+// a terraform apply adopts the existing objects into state instead of
+// recreating them. The configuration holds the secret values in plain text.
+// Nothing is written if any secret or policy cannot be read.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	w: io.Writer - Where to write the configuration.
+//	policies: bool - Also render the ACL policies, which requires a vault source.
+//
+// Returns:
+//
+//	*TerraformExport - What was rendered.
+//	error - An error if the source could not be read or the configuration could not be written.
+func (s *Syncer) ExportTerraform(ctx context.Context, w io.Writer, policies bool) (*TerraformExport, error) {
+	ctx, span := s.tracer.Start(ctx, "export terraform")
+	defer span.End()
+
+	if policies {
+		if err := s.requireVaultSource("exporting policies"); err != nil {
+			return nil, err
+		}
+	}
+
+	mount, root := s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path
+	secrets, err := s.readSourceSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var acls []terraformPolicy
+	if policies {
+		if acls, err = s.readPolicies(ctx); err != nil {
+			return nil, err
+		}
+	}
+	kvVersion := 2
+	if s.source == nil {
+		kvVersion = s.kvVersion(ctx, s.sourceVault, mount)
+	}
+
+	export := &TerraformExport{
+		CreatedAt: time.Now().UTC(),
+		Source:    s.sourceName(),
+		Mount:     mount,
+		Path:      root,
+		Secrets:   len(secrets),
+		Policies:  len(acls),
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Generated by hvm from %s at %s.\n", export.Source, export.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintln(bw, "# This file holds secret values in plain text. Do not commit it as it is.")
+
+	names := make(map[string]bool)
+	for _, secret := range secrets {
+		data, err := hclValue(secret.Data, "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q: %w", secret.Path, err)
+		}
+		name := terraformName(mount+"_"+secret.Path, names)
+		if kvVersion == 1 {
+			writeTerraformImport(bw, "vault_kv_secret."+name, mount+"/"+secret.Path)
+			fmt.Fprintf(bw, "resource \"vault_kv_secret\" %s {\n", hclString(name))
+			fmt.Fprintf(bw, "  path      = %s\n", hclString(mount+"/"+secret.Path))
+		} else {
+			writeTerraformImport(bw, "vault_kv_secret_v2."+name, mount+"/data/"+secret.Path)
+			fmt.Fprintf(bw, "resource \"vault_kv_secret_v2\" %s {\n", hclString(name))
+			fmt.Fprintf(bw, "  mount     = %s\n", hclString(mount))
+			fmt.Fprintf(bw, "  name      = %s\n", hclString(secret.Path))
+		}
+		fmt.Fprintf(bw, "  data_json = jsonencode(%s)\n", data)
+		fmt.Fprintln(bw, "}")
+	}
+
+	for _, p := range acls {
+		name := terraformName(p.name, names)
+		writeTerraformImport(bw, "vault_policy."+name, p.name)
+		fmt.Fprintf(bw, "resource \"vault_policy\" %s {\n", hclString(name))
+		fmt.Fprintf(bw, "  name   = %s\n", hclString(p.name))
+		fmt.Fprintf(bw, "  policy = %s\n", hclHeredoc(p.rules))
+		fmt.Fprintln(bw, "}")
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write terraform configuration: %w", err)
+	}
+	s.log.Info().Int("secrets", export.Secrets).Int("policies", export.Policies).Msg("Terraform export complete")
+	return export, nil
+}
+
+// readPolicies reads the rules of every ACL policy of the source vault but
+// root, which cannot be managed.
+func (s *Syncer) readPolicies(ctx context.Context) ([]terraformPolicy, error) {
+	names, err := s.listPolicies(ctx, s.sourceVault, s.readLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source policies: %w", err)
+	}
+
+	var policies []terraformPolicy
+	for _, name := range names {
+		if name == "root" {
+			continue
+		}
+		var rules string
+		err := s.withRetry(ctx, "read policy", func() error {
+			if err := s.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			resp, err := s.sourceVault.System.PoliciesReadAclPolicy(ctx, name)
+			if err != nil {
+				return err
+			}
+			rules = policyRules(resp.Data)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy %q: %w", name, err)
+		}
+		policies = append(policies, terraformPolicy{name: name, rules: rules})
+	}
+	return policies, nil
+}
+
+// writeTerraformImport writes an import block adopting the object with id
+// into the resource at address.
+func writeTerraformImport(w io.Writer, address, id string) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "import {")
+	fmt.Fprintf(w, "  to = %s\n", address)
+	fmt.Fprintf(w, "  id = %s\n", hclString(id))
+	fmt.Fprintln(w, "}")
+}
+
+// terraformName turns s into a resource name unique among used: letters,
+// digits, underscores, and dashes, not starting with a digit or dash.
+func terraformName(s string, used map[string]bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if name == "" || name[0] >= '0' && name[0] <= '9' || name[0] == '-' {
+		name = "_" + name
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// hclValue renders a JSON-like value as an HCL expression, indenting nested
+// lines with indent.
+func hclValue(v interface{}, indent string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return hclString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int, int64:
+		return fmt.Sprint(v), nil
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "{}", nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, k := range keys {
+			val, err := hclValue(v[k], indent+"  ")
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%s  %s = %s\n", indent, hclString(k), val)
+		}
+		b.WriteString(indent + "}")
+		return b.String(), nil
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			val, err := hclValue(e, indent)
+			if err != nil {
+				return "", err
+			}
+			elems[i] = val
+		}
+		return "[" + strings.Join(elems, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", v)
+}
+
+// hclString quotes s as an HCL string literal, escaping the template
+// sequences ${ and %{ so it is taken literally.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$', '%':
+			b.WriteRune(r)
+			if strings.HasPrefix(s[i+1:], "{") {
+				b.WriteRune(r)
+			}
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// hclHeredoc renders s as an HCL heredoc, escaping template sequences and
+// choosing a delimiter that does not occur on a line of its own in s.
+func hclHeredoc(s string) string {
+	s = strings.ReplaceAll(s, "${", "$${")
+	s = strings.ReplaceAll(s, "%{", "%%{")
+	s = strings.TrimRight(s, "\n")
+
+	delim := "EOT"
+	lines := strings.Split(s, "\n")
+	for taken := true; taken; {
+		taken = false
+		for _, l := range lines {
+			if strings.TrimSpace(l) == delim {
+				delim += "_"
+				taken = true
+				break
+			}
+		}
+	}
+	return "<<" + delim + "\n" + s + "\n" + delim
+}
@@ -0,0 +1,112 @@
+package vaultsync
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultRequestTimeout is the request timeout vault-client-go applies when
+// none is configured.
+const defaultRequestTimeout = 60 * time.Second
+
+type (
+	// timeoutTransport bounds each request by the timeout of its kind of
+	// operation.
+	timeoutTransport struct {
+		base     http.RoundTripper
+		timeouts RequestTimeouts
+	}
+
+	// streamedListKey marks the context of a listing whose response body
+	// is streamed to the copy stage.
+	streamedListKey struct{}
+
+	// cancelBody cancels the context of a request once its response body
+	// is closed.
+	cancelBody struct {
+		io.ReadCloser
+		cancel context.CancelFunc
+	}
+)
+
+// clientTimeout returns the timeout to hand to the vault client, which
+// bounds every request. It is raised to the longest per-operation timeout,
+// so that RequestTimeouts may exceed RequestTimeout.
+//
+// Returns:
+//
+//	time.Duration - The client-wide request timeout, or zero for the client's default.
+func (v *Vault) clientTimeout() time.Duration {
+	timeout := v.RequestTimeout
+	if v.RequestTimeouts == (RequestTimeouts{}) {
+		return timeout
+	}
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	for _, t := range []time.Duration{v.RequestTimeouts.List, v.RequestTimeouts.Read, v.RequestTimeouts.Write} {
+		if t > timeout {
+			timeout = t
+		}
+	}
+	return timeout
+}
+
+// withStreamedList marks ctx as that of a listing whose body is streamed,
+// so the List request timeout stops at the response headers: the body is
+// read only as fast as the copy stage takes its keys, and the discovery
+// timeout bounds it instead.
+func withStreamedList(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamedListKey{}, true)
+}
+
+// RoundTrip sends req with a deadline of the timeout for its operation, if
+// one is set; the deadline also covers reading the response body, except
+// for a streamed listing.
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.timeouts.Write
+	list := false
+	switch {
+	case req.Method == http.MethodGet && req.URL.Query().Get("list") == "true", req.Method == "LIST":
+		timeout, list = t.timeouts.List, true
+	case req.Method == http.MethodGet, req.Method == http.MethodHead:
+		timeout = t.timeouts.Read
+	}
+	if timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	if streamed, _ := req.Context().Value(streamedListKey{}).(bool); list && streamed {
+		ctx, cancel := context.WithCancel(req.Context())
+		timer := time.AfterFunc(timeout, cancel)
+		resp, err := t.base.RoundTrip(req.WithContext(ctx))
+		if err != nil || !timer.Stop() {
+			cancel()
+			if err == nil {
+				resp.Body.Close()
+				err = context.DeadlineExceeded
+			}
+			return nil, err
+		}
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// Close closes the body and releases its request's context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
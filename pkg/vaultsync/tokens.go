@@ -0,0 +1,344 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/hashicorp/vault-client-go/schema"
+)
+
+const (
+	defaultTokenCheckInterval = 5 * time.Minute
+	// tokenTTLWarning is how close to expiry a token must be before each
+	// check warns about it.
+	tokenTTLWarning = 15 * time.Minute
+)
+
+// ErrTokenExpired is wrapped by errors caused by an expired or revoked vault token.
+var ErrTokenExpired = errors.New("vault token expired or revoked")
+
+type (
+	// tokenInfo is the subset of a token lookup-self response hvm reports on.
+	tokenInfo struct {
+		Accessor   string    `json:"accessor"`
+		Type       string    `json:"type"`
+		TTL        int64     `json:"ttl"`
+		ExpireTime time.Time `json:"expire_time"`
+		Policies   []string  `json:"policies"`
+		Orphan     bool      `json:"orphan"`
+		Renewable  bool      `json:"renewable"`
+	}
+)
+
+// expired reports whether the token has an expiry time that has passed.
+func (t *tokenInfo) expired() bool {
+	return !t.ExpireTime.IsZero() && time.Now().After(t.ExpireTime)
+}
+
+// checkToken looks up the token of one of the vaults, logs its TTL, policies,
+// and orphan status, and remembers it for error classification.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	name: string - Which vault the token belongs to, "source" or "destination".
+//	client: *vault.Client - The vault client holding the token.
+//
+// Returns:
+//
+//	error - ErrTokenExpired if the vault rejects the token, or the lookup error.
+func (s *Syncer) checkToken(ctx context.Context, name string, client *vault.Client) error {
+	resp, err := client.Auth.TokenLookUpSelf(ctx)
+	if vault.IsErrorStatus(err, 403) {
+		return fmt.Errorf("%s vault rejected its token: %w", name, ErrTokenExpired)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up %s vault token: %w", name, err)
+	}
+
+	// Round-trip through JSON to decode the loosely typed response.
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return err
+	}
+	info := new(tokenInfo)
+	if err := json.Unmarshal(b, info); err != nil {
+		return fmt.Errorf("failed to decode %s vault token: %w", name, err)
+	}
+
+	s.tokensMu.Lock()
+	s.tokens[name] = info
+	s.tokensMu.Unlock()
+
+	ttl := time.Duration(info.TTL) * time.Second
+	ev := s.log.Info()
+	if info.TTL > 0 && ttl < tokenTTLWarning {
+		ev = s.log.Warn()
+	}
+	ev.Str("vault", name).
+		Str("accessor", info.Accessor).
+		Str("type", info.Type).
+		Dur("ttl", ttl).
+		Strs("policies", info.Policies).
+		Bool("orphan", info.Orphan).
+		Bool("renewable", info.Renewable).
+		Msg("Vault token")
+	return nil
+}
+
+// watchTokens re-checks both vault tokens every Tokens.CheckInterval until ctx
+// is done, so an expiring or revoked token shows up in the logs before it
+// starts failing secrets, and renews tokens about to expire.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//
+// Returns: nothing
+func (s *Syncer) watchTokens(ctx context.Context) {
+	interval := s.cfg.Tokens.CheckInterval
+	if interval <= 0 {
+		interval = defaultTokenCheckInterval
+	}
+
+	s.renewTokens(ctx, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for name, client := range map[string]*vault.Client{"source": s.sourceVault, "destination": s.destinationVault} {
+			if client == nil {
+				continue
+			}
+			if err := s.checkToken(ctx, name, client); err != nil && ctx.Err() == nil {
+				s.log.Error().Err(err).Str("vault", name).Msg("Vault token check failed")
+			}
+		}
+		s.renewTokens(ctx, interval)
+	}
+}
+
+// classify wraps permission denied errors with ErrTokenExpired when one of
+// the vault tokens is known to have expired, so they can be told apart from
+// missing policy grants.
+//
+// Arguments:
+//
+//	err: error - The error to classify.
+//
+// Returns:
+//
+//	error - err, possibly wrapped.
+func (s *Syncer) classify(err error) error {
+	if !vault.IsErrorStatus(err, 403) {
+		return err
+	}
+
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	for name, info := range s.tokens {
+		if info.expired() {
+			return fmt.Errorf("%w (%s vault token expired at %s): %w", ErrTokenExpired, name, info.ExpireTime.Format(time.RFC3339), err)
+		}
+	}
+	return err
+}
+
+// resolvedToken is a token as it was configured, and the client token it
+// was unwrapped to if it is a wrapping token.
+type resolvedToken struct {
+	raw   string
+	token string
+}
+
+// unwrapToken unwraps a response-wrapping token via sys/wrapping/unwrap. The
+// wrapped response may hold a client token in its auth block, as from
+// "vault token create -wrap-ttl", or a token key in its data, as from
+// "vault write sys/wrapping/wrap token=...".
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault client to unwrap with.
+//	wrapped: string - The wrapping token.
+//
+// Returns:
+//
+//	string - The unwrapped client token.
+//	error - An error if the token could not be unwrapped or did not wrap a client token.
+func unwrapToken(ctx context.Context, client *vault.Client, wrapped string) (string, error) {
+	resp, err := client.System.Unwrap(ctx, schema.UnwrapRequest{}, vault.WithToken(wrapped))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap token: %w", err)
+	}
+	tkn, _ := resp.Data["token"].(string)
+	if resp.Auth != nil && resp.Auth.ClientToken != "" {
+		tkn = resp.Auth.ClientToken
+	}
+	if tkn == "" {
+		return "", fmt.Errorf("wrapping token did not wrap a client token")
+	}
+	credentials.add(tkn)
+	return tkn, nil
+}
+
+// tokenGeneration returns how often a token from a token command or file
+// has changed, for reloadTokens.
+func (s *Syncer) tokenGeneration() int {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	return s.tokenGen
+}
+
+// reloadTokens runs the token command or re-reads the token file of each
+// vault that has one, and sets tokens that changed on its client, so
+// rotated tokens are picked up. Nothing is reloaded if a token already
+// changed since the failed request was made.
+//
+// Arguments:
+//
+//	since: int - The token generation when the failed request was made.
+//
+// Returns:
+//
+//	bool - Whether any token changed since then, here or in another worker.
+func (s *Syncer) reloadTokens(since int) bool {
+	if s.cfg == nil {
+		return false
+	}
+
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	if s.tokenGen != since {
+		return true
+	}
+
+	for name, cfg := range map[string]*Vault{"source": s.cfg.SourceVault, "destination": s.cfg.DestinationVault} {
+		s.reloadToken(name, cfg, false)
+	}
+	return s.tokenGen != since
+}
+
+// reloadToken resolves the token of one vault again and sets it on the
+// vault's client if it changed. With refreshBatch, a new batch token is
+// created even if the token did not change. The caller must hold
+// s.tokensMu.
+func (s *Syncer) reloadToken(name string, cfg *Vault, refreshBatch bool) {
+	client := s.sourceVault
+	if name == "destination" {
+		client = s.destinationVault
+	}
+	refreshBatch = refreshBatch && cfg != nil && cfg.BatchToken
+	if cfg == nil || cfg.TokenCmd == "" && cfg.TokenFile == "" && cfg.TokenKeyring == "" && !refreshBatch || client == nil {
+		return
+	}
+
+	raw, err := cfg.ResolveToken()
+	if err != nil {
+		s.log.Error().Err(err).Str("vault", name).Msg("Failed to reload vault token")
+		return
+	}
+	prev := s.resolvedTokens[name]
+	if raw == prev.raw && !refreshBatch {
+		return
+	}
+
+	// A wrapping token can only be unwrapped once, so an unchanged one is
+	// not unwrapped again.
+	tkn := raw
+	switch {
+	case raw == prev.raw:
+		tkn = prev.token
+	case cfg.WrappedToken:
+		if tkn, err = unwrapToken(context.Background(), client, raw); err != nil {
+			s.log.Error().Err(err).Str("vault", name).Msg("Failed to unwrap reloaded token")
+			return
+		}
+	}
+
+	if err := client.SetToken(tkn); err != nil {
+		s.log.Error().Err(err).Str("vault", name).Msg("Failed to set reloaded token")
+		return
+	}
+	if cfg.BatchToken && !strings.HasPrefix(tkn, "hvb.") {
+		batch, err := s.createBatchToken(client, cfg.BatchTokenTTL)
+		if err == nil {
+			err = client.SetToken(batch)
+		}
+		if err != nil {
+			s.log.Error().Err(err).Str("vault", name).Msg("Failed to create batch token from reloaded token")
+			return
+		}
+	}
+	s.resolvedTokens[name] = resolvedToken{raw: raw, token: tkn}
+	delete(s.tokens, name)
+	s.tokenGen++
+	s.log.Info().Str("vault", name).Msg("Reloaded vault token")
+}
+
+// renewTokens renews each vault token that would expire before the check
+// after next. A token that cannot be renewed is fetched again from its
+// token command or file, or replaced with a new batch token.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	interval: time.Duration - The time between token checks.
+//
+// Returns: nothing
+func (s *Syncer) renewTokens(ctx context.Context, interval time.Duration) {
+	if s.cfg.Tokens.DisableRenewal {
+		return
+	}
+
+	for name, client := range map[string]*vault.Client{"source": s.sourceVault, "destination": s.destinationVault} {
+		if client == nil {
+			continue
+		}
+		s.tokensMu.Lock()
+		info := s.tokens[name]
+		s.tokensMu.Unlock()
+		if info == nil || info.TTL <= 0 || time.Duration(info.TTL)*time.Second > 2*interval {
+			continue
+		}
+
+		if !info.Renewable {
+			cfg := s.cfg.SourceVault
+			if name == "destination" {
+				cfg = s.cfg.DestinationVault
+			}
+			s.tokensMu.Lock()
+			s.reloadToken(name, cfg, true)
+			s.tokensMu.Unlock()
+			if err := s.checkToken(ctx, name, client); err != nil {
+				s.log.Error().Err(err).Str("vault", name).Msg("Vault token check failed after reload")
+			}
+			continue
+		}
+
+		req := schema.TokenRenewSelfRequest{}
+		if inc := s.cfg.Tokens.RenewIncrement; inc > 0 {
+			req.Increment = inc.String()
+		}
+		if _, err := client.Auth.TokenRenewSelf(ctx, req); err != nil {
+			s.log.Error().Err(err).Str("vault", name).Msg("Failed to renew vault token")
+			continue
+		}
+		if err := s.checkToken(ctx, name, client); err != nil {
+			s.log.Error().Err(err).Str("vault", name).Msg("Vault token check failed after renewal")
+			continue
+		}
+		s.log.Info().Str("vault", name).Msg("Renewed vault token")
+	}
+}
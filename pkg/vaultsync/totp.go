@@ -0,0 +1,200 @@
+package vaultsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPImported means the key was created on the destination from its
+	// seed.
+	TOTPImported TOTPAction = "imported"
+	// TOTPExists means a key of the same name exists on the destination and
+	// was left alone.
+	TOTPExists TOTPAction = "exists"
+	// TOTPNotExportable means vault does not return the key's seed and none
+	// was given; see SyncTOTP.
+	TOTPNotExportable TOTPAction = "not exportable"
+	// TOTPFailed means the key could not be copied; see TOTPKeyResult.Error.
+	TOTPFailed TOTPAction = "failed"
+)
+
+type (
+	// TOTPAction is what happened, or in a dry run would happen, to a
+	// single TOTP key.
+	TOTPAction string
+
+	// TOTPReport is the structured result of SyncTOTP.
+	TOTPReport struct {
+		Mount         string          `json:"mount"`
+		DryRun        bool            `json:"dryRun"`
+		Filter        string          `json:"filter,omitempty"`
+		StartedAt     time.Time       `json:"startedAt"`
+		FinishedAt    time.Time       `json:"finishedAt"`
+		Imported      int             `json:"imported"`
+		Exists        int             `json:"exists"`
+		NotExportable int             `json:"notExportable"`
+		Failed        int             `json:"failed"`
+		Keys          []TOTPKeyResult `json:"keys"`
+	}
+
+	// TOTPKeyResult is the outcome for a single TOTP key.
+	TOTPKeyResult struct {
+		Name   string     `json:"name"`
+		Issuer string     `json:"issuer,omitempty"`
+		Action TOTPAction `json:"action"`
+		Error  string     `json:"error,omitempty"`
+	}
+)
+
+// LoadTOTPSeeds reads a JSON object of TOTP key names to their seeds, each
+// either an otpauth:// URL or a base32 encoded key.
+//
+// Arguments:
+//
+//	file: string - The path to the seeds file.
+//
+// Returns:
+//
+//	map[string]string - The seeds by key name.
+//	error - An error if the file could not be read or parsed.
+func LoadTOTPSeeds(file string) (map[string]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOTP seeds file: %w", err)
+	}
+	var seeds map[string]string
+	if err := json.Unmarshal(b, &seeds); err != nil {
+		return nil, fmt.Errorf("failed to parse TOTP seeds file: %w", err)
+	}
+	return seeds, nil
+}
+
+// SyncTOTP copies the keys of a TOTP mount whose names match filter to the
+// same mount on the destination vault, which must already be enabled.
+// Vault never returns a TOTP key's seed after it is created, so seeds come
+// from the seeds map, usually the otpauth URLs kept from when the keys
+// were generated with exported=true. Keys without a seed are reported as
+// not exportable. Existing destination keys are never overwritten.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The TOTP mount path on both vaults.
+//	filter: string - A path.Match glob on key names, or "" for every key.
+//	seeds: map[string]string - The otpauth URL or base32 key of each key by name.
+//	dryRun: bool - Only report what would be copied instead of writing it.
+//
+// Returns:
+//
+//	*TOTPReport - The result for every matching key.
+//	error - An error if the keys could not be listed, or any key failed.
+func (s *Syncer) SyncTOTP(ctx context.Context, mount, filter string, seeds map[string]string, dryRun bool) (*TOTPReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("TOTP sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("TOTP sync"); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid TOTP filter %q: %w", filter, err)
+		}
+	}
+	mount = strings.Trim(mount, "/")
+
+	report := &TOTPReport{Mount: mount, DryRun: dryRun, Filter: filter, StartedAt: time.Now().UTC()}
+
+	names, err := s.listSourceKeys(ctx, mount+"/keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TOTP keys: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if filter != "" {
+			if ok, _ := path.Match(filter, name); !ok {
+				continue
+			}
+		}
+
+		res := s.syncTOTPKey(ctx, mount, name, seeds[name], dryRun)
+		switch res.Action {
+		case TOTPImported:
+			report.Imported++
+		case TOTPExists:
+			report.Exists++
+		case TOTPNotExportable:
+			s.log.Warn().Str("key", name).Msg("TOTP key seed is not retrievable")
+			report.NotExportable++
+		case TOTPFailed:
+			s.log.Error().Str("key", name).Str("error", res.Error).Msg("Failed to sync TOTP key")
+			report.Failed++
+		}
+		report.Keys = append(report.Keys, res)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d TOTP keys failed", report.Failed, len(report.Keys))
+	}
+	return report, nil
+}
+
+// syncTOTPKey creates one key on the destination from its seed.
+func (s *Syncer) syncTOTPKey(ctx context.Context, mount, name, seed string, dryRun bool) TOTPKeyResult {
+	res := TOTPKeyResult{Name: name}
+	fail := func(err error) TOTPKeyResult {
+		res.Action = TOTPFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	key, err := s.readSourceData(ctx, mount+"/keys/"+name)
+	if err != nil || key == nil {
+		return fail(fmt.Errorf("failed to read key: %v", err))
+	}
+	res.Issuer, _ = key["issuer"].(string)
+
+	existing, err := s.readDestinationData(ctx, mount+"/keys/"+name)
+	if err != nil {
+		return fail(fmt.Errorf("failed to check destination key: %w", err))
+	}
+	if existing != nil {
+		res.Action = TOTPExists
+		return res
+	}
+	if seed == "" {
+		res.Action = TOTPNotExportable
+		return res
+	}
+
+	res.Action = TOTPImported
+	if dryRun {
+		return res
+	}
+
+	// A URL carries its own parameters; a bare key takes the source's.
+	body := map[string]interface{}{"generate": false}
+	if strings.HasPrefix(seed, "otpauth://") {
+		body["url"] = seed
+	} else {
+		body["key"] = strings.ToUpper(strings.ReplaceAll(seed, " ", ""))
+		for _, k := range []string{"issuer", "account_name", "algorithm", "digits", "period"} {
+			if v, ok := key[k]; ok {
+				body[k] = v
+			}
+		}
+	}
+	if err := s.writeDestinationData(ctx, mount+"/keys/"+name, body); err != nil {
+		return fail(fmt.Errorf("failed to import key: %w", err))
+	}
+	s.log.Info().Str("key", name).Msg("TOTP key imported")
+	return res
+}
@@ -0,0 +1,63 @@
+package vaultsync
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/j4ng5y/hvm/pkg/vaultsync"
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used to trace
+// listing, reads, and writes. By default the global provider is used, which
+// is a no-op unless the host application configures one.
+//
+// Arguments:
+//
+//	tp: trace.TracerProvider - The tracer provider to use.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Syncer) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// defaultTracer returns a tracer from the global tracer provider.
+func defaultTracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// startSpan starts a span for a vault operation on the given mount and path.
+//
+// Arguments:
+//
+//	ctx: context.Context - The parent context.
+//	name: string - The span name.
+//	mount: string - The mount the operation targets.
+//	path: string - The path the operation targets.
+//
+// Returns:
+//
+//	context.Context - The context carrying the new span.
+//	trace.Span - The new span; callers must end it.
+func (s *Syncer) startSpan(ctx context.Context, name, mount, path string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("vault.mount", mount),
+		attribute.String("vault.path", path),
+	))
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
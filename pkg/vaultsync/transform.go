@@ -0,0 +1,303 @@
+package vaultsync
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// KeyCaseUpper converts secret keys to upper case.
+	KeyCaseUpper = "upper"
+	// KeyCaseLower converts secret keys to lower case.
+	KeyCaseLower = "lower"
+)
+
+type (
+	// Transformer rewrites a secret's path and data between the read from the
+	// source vault and the write to the destination vault.
+	Transformer interface {
+		// Transform returns the destination path and data for the secret read
+		// from the source at path. Implementations must not modify data.
+		Transform(path string, data map[string]interface{}) (string, map[string]interface{}, error)
+	}
+
+	// ruleTransformer is a Transformer built from Transforms rules.
+	ruleTransformer struct {
+		// mount is the source mount, exposed to path templates.
+		mount     string
+		paths     []compiledPathRule
+		templates []compiledPathTemplate
+		keys      []compiledKeyRule
+		values    []compiledValueRule
+		// keyCase converts keys after the key rules, if set.
+		keyCase func(string) string
+		inject  []InjectRule
+	}
+
+	// chainTransformer applies Transformers in order, each to the output of
+	// the one before.
+	chainTransformer []Transformer
+
+	compiledPathRule struct {
+		match   *regexp.Regexp
+		replace string
+	}
+
+	compiledPathTemplate struct {
+		match    *regexp.Regexp
+		template *template.Template
+	}
+
+	compiledKeyRule struct {
+		match  *regexp.Regexp
+		rename string
+		drop   bool
+	}
+
+	compiledValueRule struct {
+		key     *regexp.Regexp
+		match   *regexp.Regexp
+		replace string
+	}
+)
+
+// NewTransformer compiles the given rules into a Transformer.
+//
+// Arguments:
+//
+//	t: Transforms - The path, key, and value rules.
+//
+// Returns:
+//
+//	Transformer - The compiled transformer.
+//	error - An error if any rule's regular expression is invalid.
+func NewTransformer(t Transforms) (Transformer, error) {
+	return newRuleTransformer(t, "")
+}
+
+// pathTemplateFuncs are the functions available to path templates.
+var pathTemplateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    strings.ReplaceAll,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"join":       strings.Join,
+}
+
+// newRuleTransformer compiles the given rules, with path templates seeing
+// mount as the source mount.
+func newRuleTransformer(t Transforms, mount string) (*ruleTransformer, error) {
+	rt := &ruleTransformer{mount: mount}
+
+	for _, r := range t.Paths {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path rule %q: %w", r.Match, err)
+		}
+		rt.paths = append(rt.paths, compiledPathRule{match: re, replace: r.Replace})
+	}
+
+	for _, r := range t.PathTemplates {
+		var re *regexp.Regexp
+		if r.Match != "" {
+			var err error
+			if re, err = regexp.Compile(r.Match); err != nil {
+				return nil, fmt.Errorf("invalid path template match %q: %w", r.Match, err)
+			}
+		}
+		tmpl, err := template.New("path").Funcs(pathTemplateFuncs).Option("missingkey=error").Parse(r.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path template %q: %w", r.Template, err)
+		}
+		rt.templates = append(rt.templates, compiledPathTemplate{match: re, template: tmpl})
+	}
+
+	for _, r := range t.Keys {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key rule %q: %w", r.Match, err)
+		}
+		rt.keys = append(rt.keys, compiledKeyRule{match: re, rename: r.Rename, drop: r.Drop})
+	}
+
+	for _, r := range t.Values {
+		key, err := regexp.Compile(r.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value rule key %q: %w", r.Key, err)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value rule %q: %w", r.Match, err)
+		}
+		rt.values = append(rt.values, compiledValueRule{key: key, match: re, replace: r.Replace})
+	}
+
+	switch t.KeyCase {
+	case "":
+	case KeyCaseUpper:
+		rt.keyCase = strings.ToUpper
+	case KeyCaseLower:
+		rt.keyCase = strings.ToLower
+	default:
+		return nil, fmt.Errorf("keyCase must be %s or %s, not %q", KeyCaseUpper, KeyCaseLower, t.KeyCase)
+	}
+
+	for _, r := range t.Inject {
+		if r.Key == "" {
+			return nil, fmt.Errorf("inject rule with value %q has no key", r.Value)
+		}
+	}
+	rt.inject = t.Inject
+
+	return rt, nil
+}
+
+// WithTransformer applies t to every secret after the transforms in the
+// config, for rewrites the rules cannot express. It can be given more than
+// once; transformers run in the order they were added.
+//
+// Arguments:
+//
+//	t: Transformer - The transformer to apply.
+//
+// Returns:
+//
+//	Option - The option to pass to NewSyncer.
+func WithTransformer(t Transformer) Option {
+	return func(s *Syncer) {
+		s.transformers = append(s.transformers, t)
+	}
+}
+
+// buildTransformer returns the transforms in t for secrets on mount,
+// followed by any Transformers added with WithTransformer.
+func (s *Syncer) buildTransformer(t Transforms, mount string) (Transformer, error) {
+	transformer, err := newRuleTransformer(t, mount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transforms: %w", err)
+	}
+	if len(s.transformers) > 0 {
+		return append(chainTransformer{transformer}, s.transformers...), nil
+	}
+	return transformer, nil
+}
+
+// Transform applies each transformer in order.
+func (c chainTransformer) Transform(path string, data map[string]interface{}) (string, map[string]interface{}, error) {
+	for _, t := range c {
+		var err error
+		path, data, err = t.Transform(path, data)
+		if err != nil {
+			return "", nil, err
+		}
+		if path == "" {
+			return "", nil, fmt.Errorf("transformer produced an empty path")
+		}
+	}
+	return path, data, nil
+}
+
+// Transform applies the path rules and path templates in order to the path,
+// then the key rules,
+// key case, and value rules in order to every top-level key of data, and
+// finally adds the injected fields. Value rules only apply to string values.
+func (rt *ruleTransformer) Transform(path string, data map[string]interface{}) (string, map[string]interface{}, error) {
+	for _, r := range rt.paths {
+		path = r.match.ReplaceAllString(path, r.replace)
+	}
+	for _, t := range rt.templates {
+		var err error
+		if path, err = rt.executeTemplate(t, path); err != nil {
+			return "", nil, err
+		}
+	}
+	if path == "" {
+		return "", nil, fmt.Errorf("path rules produced an empty path")
+	}
+
+	retVal := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		key, keep := rt.transformKey(k)
+		if !keep {
+			continue
+		}
+		if _, dup := retVal[key]; dup {
+			return "", nil, fmt.Errorf("key rules produced duplicate key %q", key)
+		}
+		retVal[key] = rt.transformValue(key, v)
+	}
+	for _, r := range rt.inject {
+		retVal[r.Key] = r.Value
+	}
+	return path, retVal, nil
+}
+
+func (rt *ruleTransformer) transformKey(key string) (string, bool) {
+	for _, r := range rt.keys {
+		if !r.match.MatchString(key) {
+			continue
+		}
+		if r.drop {
+			return "", false
+		}
+		key = r.match.ReplaceAllString(key, r.rename)
+	}
+	if rt.keyCase != nil {
+		key = rt.keyCase(key)
+	}
+	return key, true
+}
+
+func (rt *ruleTransformer) transformValue(key string, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	for _, r := range rt.values {
+		if r.key.MatchString(key) {
+			s = r.match.ReplaceAllString(s, r.replace)
+		}
+	}
+	return s
+}
+
+// executeTemplate rewrites p with a path template, if its Match matches.
+func (rt *ruleTransformer) executeTemplate(t compiledPathTemplate, p string) (string, error) {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	data := map[string]interface{}{
+		"Mount":    rt.mount,
+		"Path":     p,
+		"Dir":      path.Dir(p),
+		"Base":     path.Base(p),
+		"Segments": segments,
+	}
+	if t.match != nil {
+		m := t.match.FindStringSubmatch(p)
+		if m == nil {
+			return p, nil
+		}
+		for i, name := range t.match.SubexpNames() {
+			if name != "" {
+				data[name] = m[i]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	if err := t.template.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("path template failed for %q: %w", p, err)
+	}
+
+	// Drop the empty segments an empty variable leaves behind.
+	var out []string
+	for _, seg := range strings.Split(sb.String(), "/") {
+		if seg = strings.TrimSpace(seg); seg != "" {
+			out = append(out, seg)
+		}
+	}
+	return strings.Join(out, "/"), nil
+}
@@ -0,0 +1,439 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	// TransitRestored means the key was moved with backup and restore,
+	// keeping every version, its HMAC key, and its config.
+	TransitRestored TransitAction = "restored"
+	// TransitImported means the key versions were exported and imported
+	// with BYOK. The HMAC key is not carried over.
+	TransitImported TransitAction = "imported"
+	// TransitExists means a key of the same name exists on the destination
+	// and was left alone.
+	TransitExists TransitAction = "exists"
+	// TransitUnmovable means vault does not allow the key material out;
+	// see TransitKeyResult.Reason.
+	TransitUnmovable TransitAction = "unmovable"
+	// TransitFailed means moving the key failed; see TransitKeyResult.Error.
+	TransitFailed TransitAction = "failed"
+)
+
+type (
+	// TransitAction is what happened, or in a dry run would happen, to a
+	// single transit key.
+	TransitAction string
+
+	// TransitReport is the structured result of SyncTransit.
+	TransitReport struct {
+		Mount      string             `json:"mount"`
+		DryRun     bool               `json:"dryRun"`
+		Filter     string             `json:"filter,omitempty"`
+		StartedAt  time.Time          `json:"startedAt"`
+		FinishedAt time.Time          `json:"finishedAt"`
+		Moved      int                `json:"moved"`
+		Exists     int                `json:"exists"`
+		Unmovable  int                `json:"unmovable"`
+		Failed     int                `json:"failed"`
+		Keys       []TransitKeyResult `json:"keys"`
+	}
+
+	// TransitKeyResult is the outcome for a single transit key.
+	TransitKeyResult struct {
+		Name     string        `json:"name"`
+		Type     string        `json:"type"`
+		Action   TransitAction `json:"action"`
+		Versions int           `json:"versions,omitempty"`
+		Reason   string        `json:"reason,omitempty"`
+		Error    string        `json:"error,omitempty"`
+	}
+)
+
+// SyncTransit moves the keys of a transit mount to the same mount on the
+// destination vault, which must already be enabled. Exportable keys that
+// allow plaintext backup are backed up and restored, which keeps every version
+// and the key config. Other exportable keys have each version exported and
+// imported with BYOK, wrapped with the destination's wrapping key; their
+// HMAC keys cannot be imported, so HMACs change. Keys that are neither are
+// reported as unmovable. Existing destination keys are never overwritten.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The transit mount path on both vaults.
+//	filter: string - A path.Match glob on key names, or "" for every key.
+//	dryRun: bool - Only report what would be moved instead of moving it.
+//
+// Returns:
+//
+//	*TransitReport - The result for every matching key.
+//	error - An error if the keys could not be listed, or any key failed.
+func (s *Syncer) SyncTransit(ctx context.Context, mount, filter string, dryRun bool) (*TransitReport, error) {
+	if s.destination != nil {
+		return nil, fmt.Errorf("transit sync requires a vault destination")
+	}
+	if err := s.requireVaultSource("transit sync"); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid transit filter %q: %w", filter, err)
+		}
+	}
+	mount = strings.Trim(mount, "/")
+
+	report := &TransitReport{Mount: mount, DryRun: dryRun, Filter: filter, StartedAt: time.Now().UTC()}
+
+	names, err := s.listSourceKeys(ctx, mount+"/keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transit keys: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if filter != "" {
+			if ok, _ := path.Match(filter, name); !ok {
+				continue
+			}
+		}
+
+		res := s.syncTransitKey(ctx, mount, name, dryRun)
+		switch res.Action {
+		case TransitRestored, TransitImported:
+			report.Moved++
+		case TransitExists:
+			report.Exists++
+		case TransitUnmovable:
+			s.log.Warn().Str("key", name).Str("reason", res.Reason).Msg("Transit key cannot be moved")
+			report.Unmovable++
+		case TransitFailed:
+			s.log.Error().Str("key", name).Str("error", res.Error).Msg("Failed to move transit key")
+			report.Failed++
+		}
+		report.Keys = append(report.Keys, res)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d transit keys failed", report.Failed, len(report.Keys))
+	}
+	return report, nil
+}
+
+// syncTransitKey moves a single key, preferring backup and restore.
+func (s *Syncer) syncTransitKey(ctx context.Context, mount, name string, dryRun bool) TransitKeyResult {
+	res := TransitKeyResult{Name: name}
+	fail := func(err error) TransitKeyResult {
+		res.Action = TransitFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	key, err := s.readSourceData(ctx, mount+"/keys/"+name)
+	if err != nil || key == nil {
+		return fail(fmt.Errorf("failed to read key: %v", err))
+	}
+	res.Type, _ = key["type"].(string)
+	exportable, _ := key["exportable"].(bool)
+	backup, _ := key["allow_plaintext_backup"].(bool)
+	if versions, ok := key["keys"].(map[string]interface{}); ok {
+		res.Versions = len(versions)
+	}
+
+	existing, err := s.readDestinationData(ctx, mount+"/keys/"+name)
+	if err != nil {
+		return fail(fmt.Errorf("failed to check destination key: %w", err))
+	}
+	if existing != nil {
+		res.Action = TransitExists
+		return res
+	}
+
+	switch {
+	case backup && exportable:
+		res.Action = TransitRestored
+	case exportable:
+		res.Action = TransitImported
+	case backup:
+		// Vault refuses plaintext backups of keys that are not exportable,
+		// and exportable cannot be turned on without exposing the key.
+		res.Action = TransitUnmovable
+		res.Reason = "allow_plaintext_backup is set, but vault only backs up exportable keys"
+		return res
+	default:
+		res.Action = TransitUnmovable
+		res.Reason = "key is not exportable and does not allow plaintext backup"
+		return res
+	}
+	if dryRun {
+		return res
+	}
+
+	if res.Action == TransitRestored {
+		b, err := s.readSourceData(ctx, mount+"/backup/"+name)
+		if err != nil || b == nil {
+			return fail(fmt.Errorf("failed to back up key: %v", err))
+		}
+		if err := s.writeDestinationData(ctx, mount+"/restore/"+name, map[string]interface{}{"backup": b["backup"]}); err != nil {
+			return fail(fmt.Errorf("failed to restore key: %w", err))
+		}
+		s.log.Info().Str("key", name).Msg("Transit key restored")
+		return res
+	}
+
+	if err := s.importTransitKey(ctx, mount, name, res.Type, key); err != nil {
+		if u, ok := err.(unmovableError); ok {
+			res.Action = TransitUnmovable
+			res.Reason = string(u)
+			return res
+		}
+		return fail(err)
+	}
+	s.log.Info().Str("key", name).Int("versions", res.Versions).Msg("Transit key imported")
+	return res
+}
+
+// unmovableError explains why exported key material cannot be imported.
+type unmovableError string
+
+func (e unmovableError) Error() string { return string(e) }
+
+// importTransitKey exports every version of an exportable key and imports
+// them in order on the destination with BYOK, then copies the key config.
+func (s *Syncer) importTransitKey(ctx context.Context, mount, name, typ string, key map[string]interface{}) error {
+	exportType := "encryption-key"
+	switch typ {
+	case "ed25519", "ecdsa-p256", "ecdsa-p384", "ecdsa-p521":
+		exportType = "signing-key"
+	case "hmac":
+		exportType = "hmac-key"
+	}
+
+	exported, err := s.readSourceData(ctx, mount+"/export/"+exportType+"/"+name)
+	if err != nil || exported == nil {
+		return fmt.Errorf("failed to export key: %v", err)
+	}
+	material, _ := exported["keys"].(map[string]interface{})
+
+	// Imported versions are numbered from 1, so versions below the minimum
+	// decryption version, which export leaves out, would shift every
+	// ciphertext's version.
+	versions := make([]int, 0, len(material))
+	for v := range material {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("unexpected key version %q", v)
+		}
+		versions = append(versions, n)
+	}
+	sort.Ints(versions)
+	for i, v := range versions {
+		if v != i+1 {
+			return unmovableError("versions before the minimum decryption version cannot be exported")
+		}
+	}
+
+	wrapping, err := s.readDestinationData(ctx, mount+"/wrapping_key")
+	if err != nil || wrapping == nil {
+		return fmt.Errorf("failed to read destination wrapping key: %v", err)
+	}
+	pub, err := parseWrappingKey(wrapping["public_key"])
+	if err != nil {
+		return err
+	}
+
+	for i, v := range versions {
+		raw, err := transitKeyMaterial(typ, material[strconv.Itoa(v)])
+		if err != nil {
+			return unmovableError(fmt.Sprintf("version %d: %v", v, err))
+		}
+		ciphertext, err := wrapForImport(pub, raw)
+		if err != nil {
+			return fmt.Errorf("failed to wrap version %d: %w", v, err)
+		}
+
+		body := map[string]interface{}{"ciphertext": ciphertext, "hash_function": "SHA256"}
+		endpoint := mount + "/keys/" + name + "/import_version"
+		if i == 0 {
+			endpoint = mount + "/keys/" + name + "/import"
+			body["type"] = typ
+			body["exportable"] = true
+			body["allow_rotation"] = true
+			for _, k := range []string{"derived", "allow_plaintext_backup", "auto_rotate_period"} {
+				if val, ok := key[k]; ok {
+					body[k] = val
+				}
+			}
+		}
+		if err := s.writeDestinationData(ctx, endpoint, body); err != nil {
+			return fmt.Errorf("failed to import version %d: %w", v, err)
+		}
+	}
+
+	cfg := make(map[string]interface{})
+	for _, k := range []string{"min_decryption_version", "min_encryption_version", "deletion_allowed"} {
+		if val, ok := key[k]; ok {
+			cfg[k] = val
+		}
+	}
+	if err := s.writeDestinationData(ctx, mount+"/keys/"+name+"/config", cfg); err != nil {
+		return fmt.Errorf("failed to configure imported key: %w", err)
+	}
+	return nil
+}
+
+// transitKeyMaterial converts an exported key version into the format
+// BYOK import expects: raw bytes for symmetric keys, PKCS #8 DER otherwise.
+func transitKeyMaterial(typ string, v interface{}) ([]byte, error) {
+	s, _ := v.(string)
+	switch {
+	case strings.HasPrefix(typ, "aes"), typ == "chacha20-poly1305", typ == "hmac":
+		return base64.StdEncoding.DecodeString(s)
+	case typ == "ed25519":
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("unexpected ed25519 key length %d", len(b))
+		}
+		return x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(b))
+	case strings.HasPrefix(typ, "rsa"), strings.HasPrefix(typ, "ecdsa"):
+		block, _ := pem.Decode([]byte(s))
+		if block == nil {
+			return nil, fmt.Errorf("exported key is not PEM encoded")
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return x509.MarshalPKCS8PrivateKey(key)
+	}
+	return nil, fmt.Errorf("%s keys cannot be imported", typ)
+}
+
+// parseWrappingKey parses the destination's PEM encoded RSA wrapping key.
+func parseWrappingKey(v interface{}) (*rsa.PublicKey, error) {
+	s, _ := v.(string)
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("destination wrapping key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse destination wrapping key: %w", err)
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("destination wrapping key is not an RSA key")
+	}
+	return pub, nil
+}
+
+// wrapForImport wraps key material the way transit's BYOK import expects:
+// a fresh AES-256 key encrypted with RSA-OAEP (SHA-256) under the wrapping
+// key, followed by the material wrapped with that AES key (RFC 5649).
+func wrapForImport(pub *rsa.PublicKey, material []byte) (string, error) {
+	ephemeral := make([]byte, 32)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, ephemeral, nil)
+	if err != nil {
+		return "", err
+	}
+	wrappedMaterial, err := aesKeyWrapPad(ephemeral, material)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(append(wrappedKey, wrappedMaterial...)), nil
+}
+
+// aesKeyWrapPad implements AES key wrap with padding (RFC 5649).
+func aesKeyWrapPad(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	aiv := make([]byte, 8)
+	copy(aiv, []byte{0xa6, 0x59, 0x59, 0xa6})
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(plaintext)))
+
+	padded := make([]byte, (len(plaintext)+7)/8*8)
+	copy(padded, plaintext)
+
+	if len(padded) == 8 {
+		out := make([]byte, 16)
+		block.Encrypt(out, append(aiv, padded...))
+		return out, nil
+	}
+
+	// RFC 3394 wrapping with the alternative initial value.
+	n := len(padded) / 8
+	a := aiv
+	r := padded
+	buf := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[i*8:(i+1)*8])
+			block.Encrypt(buf, buf)
+
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^t)
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// readDestinationData reads a raw path from the destination vault,
+// returning nil if it does not exist.
+func (s *Syncer) readDestinationData(ctx context.Context, p string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := s.withRetry(ctx, "read", func() error {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp, err := s.destinationVault.Read(ctx, p)
+		if vault.IsErrorStatus(err, 404) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = resp.Data
+		return nil
+	})
+	return data, err
+}
@@ -0,0 +1,418 @@
+package vaultsync
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type (
+	// ConfigError lists every problem found in a Config.
+	ConfigError struct {
+		Problems []string
+	}
+)
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the config for missing settings, mutually exclusive
+// settings, and values that cannot work together, without contacting any
+// vault. Every problem is reported at once.
+//
+// Returns:
+//
+//	error - A *ConfigError listing every problem, or nil.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.BatchSize < 1 {
+		add("batchSize must be at least 1")
+	}
+
+	if sources := c.enabledSources(); len(sources) > 1 {
+		add("%s are mutually exclusive", strings.Join(sources, ", "))
+	}
+	if len(c.enabledSources()) > 0 {
+		// Only the mount and path of the source vault are used.
+		if c.SourceVault == nil || c.SourceVault.Mount == "" {
+			add("srcVault.mount is required")
+		}
+		if err := checkSource(c); err != nil {
+			add("%v", err)
+		}
+		for name, mode := range map[string]string{"consul": c.Consul.Mode, "etcd": c.Etcd.Mode} {
+			switch mode {
+			case "", "folder", "key":
+			default:
+				add("%s.mode must be folder or key, not %q", name, mode)
+			}
+		}
+		if (c.Etcd.CertFile == "") != (c.Etcd.KeyFile == "") {
+			add("etcd.certFile and etcd.keyFile must be set together")
+		}
+		if c.OnePassword.Enabled && (c.OnePassword.ConnectHost == "" && os.Getenv("OP_CONNECT_HOST") == "" || c.OnePassword.Token == "" && os.Getenv("OP_CONNECT_TOKEN") == "") {
+			add("onePassword requires connectHost and token, or OP_CONNECT_HOST and OP_CONNECT_TOKEN")
+		}
+		if c.GitOps.Enabled && c.GitOps.Dir == "" {
+			add("gitOps.dir is required")
+		}
+	} else {
+		c.SourceVault.validate("srcVault", !c.AllKVMounts, add)
+	}
+	if c.SourceVault != nil && c.SourceVault.Replica && c.SourceVault.BatchToken {
+		add("srcVault: replica and batchToken are mutually exclusive, replicas cannot create batch tokens")
+	}
+
+	external := c.AzureKeyVault.Enabled || c.Kubernetes.Enabled
+	if c.AzureKeyVault.Enabled && c.Kubernetes.Enabled {
+		add("azureKeyVault and kubernetes are mutually exclusive")
+	}
+	if external {
+		if err := checkDestination(c); err != nil {
+			add("%v", err)
+		}
+	} else {
+		c.DestinationVault.validate("destVault", !c.AllKVMounts, add)
+	}
+	if c.AzureKeyVault.Enabled {
+		if c.AzureKeyVault.VaultURL == "" {
+			add("azureKeyVault.vaultURL is required")
+		}
+		switch c.AzureKeyVault.Mode {
+		case "", "blob", "field":
+		default:
+			add("azureKeyVault.mode must be blob or field, not %q", c.AzureKeyVault.Mode)
+		}
+	}
+
+	if c.SourceVault != nil {
+		for i, m := range c.SourceVault.Mounts {
+			if m.Mount == "" {
+				add("srcVault.mounts[%d].mount is required", i)
+			}
+			if m.DestPath != "" && (!strings.HasSuffix(m.DestPath, "/") || m.Path != "" && !strings.HasSuffix(m.Path, "/")) {
+				add("srcVault.mounts[%d]: path and destPath must be folders ending in /", i)
+			}
+			if (m.DestMount != "" || m.DestPath != "") && (external || c.Bidirectional.Enabled) {
+				add("srcVault.mounts[%d]: destMount and destPath require a vault destination and cannot be combined with bidirectional", i)
+			}
+		}
+		if len(c.SourceVault.Mounts) > 0 && len(c.enabledSources()) > 0 {
+			add("srcVault.mounts requires a vault source")
+		}
+	}
+	if c.AllKVMounts {
+		if len(c.enabledSources()) > 0 || external {
+			add("allKVMounts requires vaults on both sides")
+		}
+		if c.SourceVault != nil && len(c.SourceVault.Mounts) > 0 {
+			add("allKVMounts and srcVault.mounts are mutually exclusive")
+		}
+	}
+	if c.DestinationVault != nil && len(c.DestinationVault.Mounts) > 0 {
+		add("destVault.mounts is not supported, set destMount in srcVault.mounts instead")
+	}
+
+	if c.Retry.MaxAttempts < 0 {
+		add("retry.maxAttempts must not be negative")
+	}
+	if c.Retry.BaseDelay > 0 && c.Retry.MaxDelay > 0 && c.Retry.BaseDelay > c.Retry.MaxDelay {
+		add("retry.baseDelay (%s) is greater than retry.maxDelay (%s)", c.Retry.BaseDelay, c.Retry.MaxDelay)
+	}
+
+	for name, rl := range map[string]struct {
+		qps   float64
+		burst int
+	}{
+		"rateLimit.read":   {c.RateLimit.ReadQPS, c.RateLimit.ReadBurst},
+		"rateLimit.write":  {c.RateLimit.WriteQPS, c.RateLimit.WriteBurst},
+		"diff.source":      {c.Diff.SourceQPS, c.Diff.SourceBurst},
+		"diff.destination": {c.Diff.DestinationQPS, c.Diff.DestinationBurst},
+	} {
+		if rl.qps < 0 || rl.burst < 0 {
+			add("%s QPS and burst must not be negative", name)
+		}
+	}
+	for name, workers := range map[string]int{
+		"concurrency.listWorkers":  c.Concurrency.ListWorkers,
+		"concurrency.readWorkers":  c.Concurrency.ReadWorkers,
+		"concurrency.writeWorkers": c.Concurrency.WriteWorkers,
+	} {
+		switch {
+		case workers < 0:
+			add("%s must not be negative", name)
+		case workers > c.BatchSize && c.BatchSize > 0 && name != "concurrency.listWorkers":
+			// Only BatchSize secrets are in flight at once.
+			add("%s (%d) exceeds batchSize (%d), the number of secrets in flight; raise batchSize", name, workers, c.BatchSize)
+		}
+	}
+	if c.Diff.Workers < 0 {
+		add("diff.workers must not be negative")
+	}
+
+	if c.Timeouts.Discovery < 0 || c.Timeouts.Copy < 0 || c.Timeouts.Verify < 0 {
+		add("timeouts must not be negative")
+	}
+	if c.MaxDuration < 0 {
+		add("maxDuration must not be negative")
+	}
+	if _, err := errorLimit(c.MaxErrors, 0); err != nil {
+		add("maxErrors %v", err)
+	}
+	if c.Resources.MaxProcs < 0 {
+		add("resources.maxProcs must not be negative")
+	}
+	if _, err := c.Resources.MemoryLimitBytes(); err != nil {
+		add("resources.memoryLimit: %v", err)
+	}
+
+	switch c.SchemaValidation.Mode {
+	case "", SchemaModeWarn, SchemaModeEnforce:
+	default:
+		add("schemaValidation.mode must be %s or %s, not %q", SchemaModeWarn, SchemaModeEnforce, c.SchemaValidation.Mode)
+	}
+	if _, err := NewTransformer(c.Transforms); err != nil {
+		add("transforms: %v", err)
+	}
+	if c.Chunking.MaxBytes < 0 {
+		add("chunking.maxBytes must not be negative")
+	}
+
+	switch c.OnConflict {
+	case "", ConflictOverwrite, ConflictSkip, ConflictFail, ConflictNewer:
+	default:
+		add("onConflict must be %s, %s, %s, or %s, not %q", ConflictOverwrite, ConflictSkip, ConflictFail, ConflictNewer, c.OnConflict)
+	}
+	if c.OnConflict == ConflictNewer && len(c.enabledSources()) > 0 {
+		add("the newer conflict strategy requires a vault source")
+	}
+
+	if c.Alerts.DriftThreshold < 0 {
+		add("alerts.driftThreshold must not be negative")
+	}
+	if c.Alerts.DriftCheckInterval < 0 {
+		add("alerts.driftCheckInterval must not be negative")
+	}
+	if c.Alerts.DriftCheckInterval > 0 && c.Alerts.SlackWebhookURL == "" && c.Alerts.WebhookURL == "" {
+		add("alerts.driftCheckInterval requires slackWebhookURL or webhookURL")
+	}
+
+	for i, n := range c.Notifications {
+		switch n.On {
+		case "", NotifyFailure, NotifySuccess, NotifyChanges, NotifyAlways:
+		default:
+			add("notifications[%d].on must be %s, %s, %s, or %s, not %q", i, NotifyFailure, NotifySuccess, NotifyChanges, NotifyAlways, n.On)
+		}
+		switch n.Type {
+		case NotifyEmail:
+			if n.Email.Host == "" || n.Email.From == "" || len(n.Email.To) == 0 {
+				add("notifications[%d] requires email.host, email.from, and email.to", i)
+			}
+			if n.Email.Port < 0 || n.Email.Port > 65535 {
+				add("notifications[%d].email.port must be between 1 and 65535", i)
+			}
+		case NotifyPagerDuty:
+			if n.PagerDuty.RoutingKey == "" {
+				add("notifications[%d] requires pagerDuty.routingKey", i)
+			}
+			switch n.PagerDuty.Severity {
+			case "", "critical", "error", "warning", "info":
+			default:
+				add("notifications[%d].pagerDuty.severity must be critical, error, warning, or info, not %q", i, n.PagerDuty.Severity)
+			}
+		case NotifyWebhook:
+			if n.Webhook.URL == "" {
+				add("notifications[%d] requires webhook.url", i)
+			}
+		default:
+			add("notifications[%d].type must be %s, %s, or %s, not %q", i, NotifyEmail, NotifyPagerDuty, NotifyWebhook, n.Type)
+		}
+	}
+
+	if c.Prune.Enabled && (c.Bidirectional.Enabled || c.History.Enabled) {
+		add("prune cannot be combined with bidirectional or history")
+	}
+	if c.Prune.Enabled && (c.AzureKeyVault.Enabled || c.Kubernetes.Enabled) {
+		add("prune requires a vault destination")
+	}
+
+	if c.MetadataFilter.Enabled() {
+		for kind, rules := range map[string][]MetadataRule{"include": c.MetadataFilter.Include, "exclude": c.MetadataFilter.Exclude} {
+			for i, r := range rules {
+				if r.Key == "" {
+					add("metadataFilter.%s[%d].key is required", kind, i)
+				}
+			}
+		}
+		if len(c.enabledSources()) > 0 {
+			add("metadataFilter requires a vault source")
+		}
+	}
+	if c.MetadataOnly {
+		if c.Bidirectional.Enabled || c.History.Enabled || c.Prune.Enabled {
+			add("metadataOnly cannot be combined with bidirectional, history, or prune")
+		}
+		if len(c.enabledSources()) > 0 {
+			add("metadataOnly requires a vault source")
+		}
+		if c.AzureKeyVault.Enabled || c.Kubernetes.Enabled {
+			add("metadataOnly requires a vault destination")
+		}
+	}
+
+	if c.Shard.Total < 0 {
+		add("shard.total must not be negative")
+	}
+	if c.Shard.Enabled() {
+		if c.Shard.Index < 0 || c.Shard.Index >= c.Shard.Total {
+			add("shard.index must be between 0 and %d", c.Shard.Total-1)
+		}
+		// Each shard sees only its own secrets, so it would prune the
+		// others' and roll up partial folders.
+		if c.Prune.Enabled {
+			add("shard cannot be combined with prune")
+		}
+		if c.Checksums.Enabled {
+			add("shard cannot be combined with checksums")
+		}
+	}
+
+	if c.CircuitBreaker.Threshold < 0 {
+		add("circuitBreaker.threshold must not be negative")
+	}
+	if c.CircuitBreaker.CheckInterval < 0 {
+		add("circuitBreaker.checkInterval must not be negative")
+	}
+
+	switch c.OnReplicated {
+	case "", ReplicatedWarn, ReplicatedSkip:
+	default:
+		add("onReplicated must be %s or %s, not %q", ReplicatedWarn, ReplicatedSkip, c.OnReplicated)
+	}
+
+	if c.Bidirectional.Enabled {
+		switch c.Bidirectional.Conflict {
+		case "", ConflictNewer, ConflictSource, ConflictDestination, ConflictSkip, ConflictFail:
+		default:
+			add("bidirectional.conflict must be %s, %s, %s, %s, or %s, not %q", ConflictNewer, ConflictSource, ConflictDestination, ConflictSkip, ConflictFail, c.Bidirectional.Conflict)
+		}
+		if len(c.enabledSources()) > 0 || external {
+			add("bidirectional requires vaults on both sides")
+		}
+		if c.SourceVault != nil && c.SourceVault.Replica {
+			add("bidirectional writes to the source vault, so srcVault cannot be a replica")
+		}
+		if c.History.Enabled || c.Chunking.Enabled {
+			add("bidirectional cannot be combined with history or chunking")
+		}
+		// Secrets are copied back to the source unchanged, so rewriting them
+		// on the way out would make the vaults diverge.
+		t := c.Transforms
+		if len(t.Paths)+len(t.PathTemplates)+len(t.Keys)+len(t.Values)+len(t.Inject) > 0 || t.KeyCase != "" {
+			add("bidirectional cannot be combined with transforms")
+		}
+	}
+
+	if c.SlackApproval.Enabled {
+		a := c.SlackApproval
+		if a.BotToken == "" || a.Channel == "" || a.SigningSecret == "" || a.ListenAddr == "" {
+			add("slackApproval requires botToken, channel, signingSecret, and listenAddr")
+		}
+	}
+	if _, err := NewMetrics(c.Metrics); err != nil {
+		add("metrics: %v", err)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: problems}
+}
+
+// validate checks the connection settings of one vault, and that it has a
+// mount unless requireMount is false.
+func (v *Vault) validate(name string, requireMount bool, add func(string, ...interface{})) {
+	if v == nil {
+		add("%s is required", name)
+		return
+	}
+
+	env := "SRC_"
+	if name == "destVault" {
+		env = "DST_"
+	}
+	if v.Address == "" {
+		add("%s.addr is required, or set %sVAULT_ADDR or VAULT_ADDR", name, env)
+	}
+	var tokens []string
+	for setting, value := range map[string]string{"token": v.Token, "tokenCmd": v.TokenCmd, "tokenFile": v.TokenFile, "tokenKeyring": v.TokenKeyring} {
+		if value != "" {
+			tokens = append(tokens, setting)
+		}
+	}
+	sort.Strings(tokens)
+	switch {
+	case len(tokens) > 1:
+		add("%s: %s are mutually exclusive", name, strings.Join(tokens, " and "))
+	case len(tokens) == 0:
+		add("%s: one of token, tokenCmd, tokenFile, or tokenKeyring is required, or set %sVAULT_TOKEN or VAULT_TOKEN", name, env)
+	}
+	switch {
+	case v.Mount != "" || len(v.Mounts) > 0 || !requireMount:
+	case name == "srcVault":
+		add("srcVault.mount or srcVault.mounts is required")
+	default:
+		add("%s.mount is required", name)
+	}
+	switch v.KVVersion {
+	case 0, 1, 2:
+	default:
+		add("%s.kvVersion must be 1 or 2, not %d", name, v.KVVersion)
+	}
+	if socket, ok := v.socketPath(); ok {
+		switch {
+		case socket == "":
+			add("%s.addr: unix:// addresses need a socket path", name)
+		case len(v.FallbackAddresses) > 0 || v.Proxy != "":
+			add("%s: a unix:// address cannot be combined with fallbackAddrs or proxy", name)
+		}
+	}
+	if v.Proxy != "" {
+		if _, err := parseProxy(v.Proxy); err != nil {
+			add("%s.proxy: %v", name, err)
+		}
+	}
+	if _, err := forwardingMode(v.Forwarding); err != nil {
+		add("%s.forwarding: %v", name, err)
+	}
+	if t := v.RequestTimeouts; v.RequestTimeout < 0 || t.List < 0 || t.Read < 0 || t.Write < 0 {
+		add("%s: request timeouts must not be negative", name)
+	}
+	if v.BatchTokenTTL != "" && !v.BatchToken {
+		add("%s: batchTokenTTL is set but batchToken is not", name)
+	}
+}
+
+// enabledSources returns the names of the enabled non-vault sources.
+func (c *Config) enabledSources() []string {
+	var names []string
+	for name, enabled := range map[string]bool{
+		"consul":      c.Consul.Enabled,
+		"etcd":        c.Etcd.Enabled,
+		"onePassword": c.OnePassword.Enabled,
+		"bitwarden":   c.Bitwarden.Enabled,
+		"gitOps":      c.GitOps.Enabled,
+	} {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,1285 @@
+package vaultsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+	"github.com/hashicorp/vault-client-go/schema"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// Syncer is a struct that facilitates the syncing of secrets between two vaults.
+	Syncer struct {
+		cfg              *Config
+		sourceVault      *vault.Client
+		destinationVault *vault.Client
+		log              zerolog.Logger
+		readLimiter      *rate.Limiter
+		writeLimiter     *rate.Limiter
+		readSlots        chan struct{}
+		writeSlots       chan struct{}
+		schemas          []compiledSchema
+		transformer      Transformer
+		transformers     []Transformer
+		approver         Approver
+		hooks            []Hooks
+		report           *Report
+		tracer           trace.Tracer
+		destinationOnly  bool
+		metrics          *Metrics
+		destination      Destination
+		source           Source
+
+		// destinationMount, if set, is the destination vault mount secrets
+		// are written to instead of their source mount, while a
+		// srcVault.mounts pair with a DestMount is synced.
+		destinationMount string
+
+		// kvVersions caches the KV version of each mount on each vault.
+		kvMu       sync.Mutex
+		kvVersions map[kvMountKey]int
+
+		// auditMu serializes appends to the audit log.
+		auditMu sync.Mutex
+
+		// deadline is when the current run must stop, if MaxDuration is set.
+		deadline time.Time
+
+		// abort cancels the current run when FailFast or MaxErrors stops it.
+		abort context.CancelFunc
+		// failMu guards failures and stopErr.
+		failMu sync.Mutex
+		// failures counts the secrets of the current run that failed.
+		failures int
+		// errorLimit is how many failures MaxErrors allows before the run
+		// stops, or -1 for no limit.
+		errorLimit int
+		// stopErr says why the run was stopped, once it was.
+		stopErr error
+
+		// breaker pauses destination writes while the destination vault
+		// is failing.
+		breaker circuitBreaker
+
+		// resumed holds the paths an interrupted run already synced.
+		resumed map[string]bool
+
+		// tokens holds the last lookup of each vault's token, keyed by
+		// "source" or "destination".
+		tokensMu sync.Mutex
+		tokens   map[string]*tokenInfo
+		// resolvedTokens holds the token last resolved for each vault, keyed
+		// like tokens, and tokenGen counts how often one changed.
+		resolvedTokens map[string]resolvedToken
+		tokenGen       int
+
+		// secrets holds the secret values the Syncer has read or written,
+		// redacted from logs until it is closed.
+		secrets *redactor
+
+		// stopHealthChecks stops the failover health check of each vault
+		// with fallback addresses; Close calls them.
+		stopHealthChecks []context.CancelFunc
+
+		// synced holds every secret written during the copy stage, keyed by
+		// destination path, so the verification stage can compare against it.
+		syncedMu sync.Mutex
+		synced   map[string]syncedSecret
+		// desired holds the destination path of every source secret and
+		// folder seen during the copy stage, so Prune can tell which are
+		// orphaned.
+		desired map[string]bool
+
+		// bidiState holds the versions of each secret, keyed by mount and
+		// path, when both vaults last held the same data.
+		bidiMu    sync.Mutex
+		bidiState map[string]syncedVersions
+	}
+
+	// syncedSecret records where a written secret came from and the checksum
+	// of the data written.
+	syncedSecret struct {
+		source string
+		sum    [32]byte
+	}
+)
+
+// NewSyncer returns a new Syncer.
+// Arguments:
+//
+//	config: *Config - The sync configuration.
+//	opts: ...Option - Optional settings such as WithLogger.
+//
+// Returns:
+//
+//	*Syncer - A new Syncer instance, to be closed with Close once no longer used.
+func NewSyncer(config *Config, opts ...Option) (retVal *Syncer, err error) {
+	if config == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+
+	s := new(Syncer)
+	// A Syncer that is not returned must not leave health checks behind.
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+	s.log = log.Logger
+	s.tracer = defaultTracer()
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	schemas, err := compileSchemas(config.SchemaValidation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schemas: %w", err)
+	}
+	s.schemas = schemas
+
+	mount := ""
+	if config.SourceVault != nil {
+		mount = config.SourceVault.Mount
+	}
+	if s.transformer, err = s.buildTransformer(config.Transforms, mount); err != nil {
+		return nil, err
+	}
+
+	if config.SourceVault != nil && config.SourceVault.Replica && config.SourceVault.BatchToken {
+		return nil, fmt.Errorf("source vault is a replica and cannot create batch tokens")
+	}
+
+	s.cfg = config
+	redactConfig(config)
+	s.tokens = make(map[string]*tokenInfo)
+	if s.destination != nil {
+		if err := checkDestination(config); err != nil {
+			return nil, err
+		}
+	} else {
+		dst, err := s.initVault("destination", config.DestinationVault)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize destination vault: %w", err)
+		}
+		if err := s.checkToken(context.Background(), "destination", dst); err != nil {
+			if errors.Is(err, ErrTokenExpired) {
+				return nil, err
+			}
+			s.log.Warn().Err(err).Msg("Failed to validate destination vault token")
+		}
+		s.destinationVault = dst
+	}
+	if s.source != nil {
+		if err := checkSource(config); err != nil {
+			return nil, err
+		}
+	} else if !s.destinationOnly {
+		src, err := s.initVault("source", config.SourceVault)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize source vault: %w", err)
+		}
+		s.sourceVault = src
+		if err := s.checkToken(context.Background(), "source", src); err != nil {
+			if errors.Is(err, ErrTokenExpired) {
+				return nil, err
+			}
+			s.log.Warn().Err(err).Msg("Failed to validate source vault token")
+		}
+		if err := s.checkSourceReplication(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	s.resetSynced()
+	s.readLimiter = newLimiter(config.RateLimit.ReadQPS, config.RateLimit.ReadBurst)
+	s.writeLimiter = newLimiter(config.RateLimit.WriteQPS, config.RateLimit.WriteBurst)
+	s.readSlots = newSlots(config.Concurrency.ReadWorkers)
+	s.writeSlots = newSlots(config.Concurrency.WriteWorkers)
+	s.secrets = newRedactor()
+	s.secrets.open()
+	return s, nil
+}
+
+// Close releases the Syncer once it is no longer used: the failover health
+// checks of its vaults stop, and the secret values it read stop being
+// redacted from logs and are forgotten. Vault tokens and the credentials of
+// its Config stay redacted.
+//
+// Returns: nothing
+func (s *Syncer) Close() {
+	for _, stop := range s.stopHealthChecks {
+		stop()
+	}
+	s.stopHealthChecks = nil
+	s.secrets.close()
+}
+
+func (s *Syncer) initVault(name string, cfg *Vault) (*vault.Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("vault config is nil")
+	}
+
+	raw, err := cfg.ResolveToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := cfg.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RequestTimeouts != (RequestTimeouts{}) {
+		hc.Transport = &timeoutTransport{base: hc.Transport, timeouts: cfg.RequestTimeouts}
+	}
+	if len(cfg.FallbackAddresses) > 0 {
+		if hc, err = s.failoverClient(cfg, hc); err != nil {
+			return nil, err
+		}
+	}
+	opts := []vault.ClientOption{vault.WithAddress(cfg.clientAddress()), vault.WithHTTPClient(hc)}
+	if timeout := cfg.clientTimeout(); timeout > 0 {
+		opts = append(opts, vault.WithRequestTimeout(timeout))
+	}
+
+	src, err := vault.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	if cfg.Namespace != "" {
+		if err := src.SetNamespace(cfg.Namespace); err != nil {
+			return nil, fmt.Errorf("failed to set vault namespace: %w", err)
+		}
+	}
+	tkn := raw
+	if cfg.WrappedToken {
+		if tkn, err = unwrapToken(context.Background(), src, raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := src.SetToken(tkn); err != nil {
+		return nil, fmt.Errorf("failed to set vault token: %w", err)
+	}
+	s.tokensMu.Lock()
+	if s.resolvedTokens == nil {
+		s.resolvedTokens = make(map[string]resolvedToken)
+	}
+	s.resolvedTokens[name] = resolvedToken{raw: raw, token: tkn}
+	s.tokensMu.Unlock()
+
+	mode, err := forwardingMode(cfg.Forwarding)
+	if err != nil {
+		return nil, err
+	}
+	src.SetReplicationForwardingMode(mode)
+
+	if cfg.BatchToken && !strings.HasPrefix(tkn, "hvb.") {
+		batch, err := s.createBatchToken(src, cfg.BatchTokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create batch token: %w", err)
+		}
+		if err := src.SetToken(batch); err != nil {
+			return nil, fmt.Errorf("failed to set vault batch token: %w", err)
+		}
+	}
+	return src, nil
+}
+
+// createBatchToken uses the client's current (service) token to mint a batch
+// token with the same policies. Batch tokens are not persisted to the token
+// store, which keeps high-throughput runs from putting pressure on it.
+//
+// Arguments:
+//
+//	client: *vault.Client - The vault client authenticated with a service token.
+//	ttl: string - The TTL of the batch token, or empty for the role default.
+//
+// Returns:
+//
+//	string - The batch token.
+//	error - An error if the token could not be created.
+func (s *Syncer) createBatchToken(client *vault.Client, ttl string) (string, error) {
+	resp, err := client.Auth.TokenCreate(context.Background(), schema.TokenCreateRequest{
+		Type: "batch",
+		Ttl:  ttl,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault did not return a client token")
+	}
+
+	credentials.add(resp.Auth.ClientToken)
+	s.log.Debug().Str("accessor", resp.Auth.Accessor).Msg("Created batch token")
+	return resp.Auth.ClientToken, nil
+}
+
+// listSourcePath returns a list of all the secret keys in the given path/mount.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the source vault to list.
+//
+// Returns:
+//
+//	[]string - A list of secret keys in the given path/mount.
+//	error - An error if there was a problem listing the path.
+func (s *Syncer) listSourcePath(ctx context.Context, mount, path string) (retVal []string, err error) {
+	ctx, span := s.startSpan(ctx, "list source", mount, path)
+	defer func() { endSpan(span, err) }()
+
+	s.log.Debug().Str("path", path).Str("mount", mount).Msg("Listing source vault")
+
+	if s.source != nil {
+		err = s.withRetry(ctx, "list", func() (err error) {
+			if err := s.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			retVal, err = s.source.List(ctx, path)
+			return err
+		})
+	} else {
+		retVal, err = s.listPath(ctx, s.sourceVault, s.readLimiter, mount, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source path: %w", err)
+	}
+	return retVal, nil
+}
+
+// listPath lists the keys directly under path in a KV mount. Folders are
+// returned with a trailing slash. Transient errors are retried.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	client: *vault.Client - The vault to list.
+//	limiter: *rate.Limiter - The rate limiter for requests against client.
+//	mount: string - The mount path.
+//	path: string - The path to list.
+//
+// Returns:
+//
+//	[]string - The keys under path.
+//	error - An error if the path could not be listed.
+func (s *Syncer) listPath(ctx context.Context, client *vault.Client, limiter *rate.Limiter, mount, path string) ([]string, error) {
+	// Unfortunately, there is no good way to batch out this initial indexing, so we just have to be careful on how we do it.
+	var l *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "list", func() (err error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		l, err = client.List(ctx, s.kvPath(ctx, client, mount, "metadata", path), vault.WithMountPath(mount))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := l.Data["keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("vault returned an empty list")
+	}
+
+	keys := make([]string, 0, len(v))
+	for _, vv := range v {
+		keys = append(keys, vv.(string))
+	}
+	return keys, nil
+}
+
+// batchSync performs a batch sync of the given batch of secrets keys.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the source vault to sync.
+//	batch: []string - The batch of secret keys to sync.
+//
+// Returns: nothing
+func (s *Syncer) batchSync(ctx context.Context, mount, path string, batch []string) {
+	workers := len(batch)
+	if s.cfg.Ordered {
+		workers = 1
+	}
+	runPool(ctx, workers, batch, func(ctx context.Context, item string) {
+		s.doSync(ctx, mount, path+item)
+	})
+}
+
+// copyKeys syncs the keys received from keys in batches of the configured
+// batch size, tuned to the memory limit, saving a checkpoint after each,
+// until keys is closed or the run stops on failures or at its deadline.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the copy stage.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the source vault to sync.
+//	keys: <-chan string - The keys listed under path.
+//
+// Returns:
+//
+//	int - How many of the keys received were secrets.
+//	error - The error of ctx if the copy stage was aborted.
+func (s *Syncer) copyKeys(ctx context.Context, mount, path string, keys <-chan string) (int, error) {
+	discovered := 0
+	batchSize := s.cfg.BatchSize
+	var batch []string
+	for open := true; open; {
+		if s.stopped() {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return discovered, err
+		}
+		if s.pastDeadline() {
+			break
+		}
+		batchSize = s.tuneBatchSize(batchSize)
+		batch = batch[:0]
+		for len(batch) < batchSize {
+			var key string
+			select {
+			case <-ctx.Done():
+				return discovered, ctx.Err()
+			case key, open = <-keys:
+			}
+			if !open {
+				break
+			}
+			if isSecretKey(key) {
+				discovered++
+			}
+			batch = append(batch, key)
+		}
+		if len(batch) > 0 {
+			s.batchSync(ctx, mount, path, batch)
+			s.checkpoint()
+		}
+	}
+	return discovered, nil
+}
+
+// sendKeys sends list into the returned channel, which is closed once every
+// key was taken or ctx is cancelled.
+func sendKeys(ctx context.Context, list []string) <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		for _, key := range list {
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+// doSync performs a sync of the given secret key and records the outcome in
+// the report.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the source vault to sync.
+//
+// Returns: nothing
+func (s *Syncer) doSync(ctx context.Context, mount, path string) {
+	if s.resumed[path] {
+		s.rememberResumed(ctx, mount, path)
+		return
+	}
+	// Past the deadline the secret is left for the next run.
+	if s.pastDeadline() {
+		s.report.mu.Lock()
+		s.report.DeadlineExceeded = true
+		s.report.mu.Unlock()
+		return
+	}
+
+	ctx, span := s.startSpan(ctx, "sync secret", mount, path)
+	start := time.Now()
+	action, err := s.syncSecret(ctx, mount, path)
+	action, err = s.outcomeHooks(ctx, mount, path, action, err)
+	d := time.Since(start)
+	// Secrets cut short by stopping the run are left for the next run.
+	if err != nil && s.stopped() && errors.Is(err, context.Canceled) {
+		endSpan(span, err)
+		return
+	}
+	s.report.record(path, action, err, d)
+	if err != nil {
+		action = failedAction(err)
+		s.recordFailure(path, err)
+	}
+	s.metrics.observe(mount, strings.TrimPrefix(path, s.cfg.SourceVault.Path), action, d)
+	span.SetAttributes(attribute.String("hvm.action", string(action)))
+	endSpan(span, err)
+}
+
+// syncSecret copies a single secret from the source to the destination vault.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret to sync.
+//
+// Returns:
+//
+//	Action - Whether the secret was created, updated, or skipped.
+//	error - An error if the secret could not be synced.
+func (s *Syncer) syncSecret(ctx context.Context, mount, path string) (Action, error) {
+	if strings.HasSuffix(path, "/") {
+		s.log.Debug().Str("folder", path).Str("mount", mount).Msg("Skipping folder")
+		// The folder exists on the source, so prune must not descend
+		// into where it maps on the destination.
+		if destPath, _, err := s.transformer.Transform(path, nil); err == nil {
+			s.syncedMu.Lock()
+			s.desired[destPath] = true
+			s.syncedMu.Unlock()
+		}
+		return ActionSkipped, nil
+	}
+
+	s.log.Debug().Str("secret", path).Str("mount", mount).Msg("Syncing secret")
+
+	if s.cfg.MetadataFilter.Enabled() {
+		skip, err := s.filteredOut(ctx, mount, path)
+		if err != nil {
+			return ActionFailed, err
+		}
+		if skip {
+			return ActionSkipped, nil
+		}
+	}
+
+	if s.cfg.MetadataOnly {
+		return s.syncMetadata(ctx, mount, path)
+	}
+	if s.cfg.History.Enabled {
+		return s.syncHistory(ctx, mount, path)
+	}
+	if s.cfg.Bidirectional.Enabled {
+		return s.syncBidirectional(ctx, mount, path)
+	}
+
+	start := time.Now()
+	srcData, srcVersion, err := s.readSourceVersion(ctx, mount, path, 0)
+	s.report.timing(path, stageRead, time.Since(start))
+	if err != nil {
+		return ActionFailed, err
+	}
+	if len(srcData) > 0 {
+		if sum, err := s.checksum(srcData); err == nil {
+			s.report.content(path, sum)
+		}
+	}
+
+	if err := s.awaitDestination(ctx); err != nil {
+		return ActionFailed, err
+	}
+	start = time.Now()
+	defer func() { s.report.timing(path, stageWrite, time.Since(start)) }()
+	if s.destination == nil && (!s.cfg.ForceWrite || s.cfg.OnConflict != "" && s.cfg.OnConflict != ConflictOverwrite) {
+		action, err := s.compareDestination(ctx, mount, path, srcData)
+		s.destinationResult(err)
+		if action != "" {
+			return action, err
+		}
+	}
+
+	destPath, destData, destVersion, err := s.writeDestination(ctx, mount, path, srcData, srcVersion)
+	s.destinationResult(err)
+	if err != nil {
+		return ActionFailed, err
+	}
+
+	if err := s.recordSynced(path, destPath, destData); err != nil {
+		return ActionFailed, err
+	}
+
+	if destVersion == 1 {
+		return ActionCreated, nil
+	}
+	return ActionUpdated, nil
+}
+
+// readSource reads a version of a secret from the source vault, or the current
+// data from an external Source.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret to read.
+//	ver: int64 - The version to read, or 0 for the current version.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the secret could not be read or has no data.
+func (s *Syncer) readSource(ctx context.Context, mount, path string, ver int64) (map[string]interface{}, error) {
+	data, _, err := s.readSourceVersion(ctx, mount, path, ver)
+	return data, err
+}
+
+// readSourceVersion is readSource, also returning the version that was read.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the source vault.
+//	path: string - The path of the secret to read.
+//	ver: int64 - The version to read, or 0 for the current version.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	int64 - The version read, or 0 for an external Source.
+//	error - An error if the secret could not be read or has no data.
+func (s *Syncer) readSourceVersion(ctx context.Context, mount, path string, ver int64) (map[string]interface{}, int64, error) {
+	release, err := acquire(ctx, s.readSlots)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	if s.source != nil {
+		data, err := s.readExternal(ctx, path)
+		return data, 0, err
+	}
+
+	opts := []vault.RequestOption{vault.WithMountPath(mount)}
+	if ver > 0 && s.kvVersion(ctx, s.sourceVault, mount) == 1 {
+		return nil, 0, fmt.Errorf("source mount %q is KV v1, which keeps no versions", mount)
+	}
+	if ver > 0 {
+		opts = append(opts, vault.WithQueryParameters(url.Values{"version": {strconv.FormatInt(ver, 10)}}))
+	}
+
+	var srcResp *vault.Response[map[string]interface{}]
+	readCtx, readSpan := s.startSpan(ctx, "read source", mount, path)
+	err = s.withRetry(readCtx, "read", func() (err error) {
+		if err := s.readLimiter.Wait(readCtx); err != nil {
+			return err
+		}
+		srcResp, err = s.sourceVault.Read(readCtx, s.kvPath(readCtx, s.sourceVault, mount, "data", path), opts...)
+		return err
+	})
+	endSpan(readSpan, err)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to get secret from source vault")
+		return nil, 0, fmt.Errorf("failed to read secret from source vault: %w", err)
+	}
+
+	srcData, meta := s.kvData(ctx, s.sourceVault, mount, srcResp.Data)
+	if srcData == nil {
+		s.log.Error().Str("secret", path).Msg("Source secret has no data")
+		return nil, 0, fmt.Errorf("source secret has no data")
+	}
+	s.secrets.addData(srcData)
+	return srcData, version(meta), nil
+}
+
+// writeDestination transforms, validates, and writes source secret data to
+// the destination vault, splitting it into chunks if needed.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	path: string - The source path of the secret.
+//	srcData: map[string]interface{} - The source secret data.
+//	srcVersion: int64 - The source version of srcData, or 0 if unknown, for the audit log.
+//
+// Returns:
+//
+//	string - The destination path the secret was written to.
+//	map[string]interface{} - The (transformed) data that was written.
+//	int64 - The destination version created by the write.
+//	error - An error if the secret could not be written.
+func (s *Syncer) writeDestination(ctx context.Context, mount, path string, srcData map[string]interface{}, srcVersion int64) (string, map[string]interface{}, int64, error) {
+	destPath, destData, err := s.transformer.Transform(path, srcData)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to transform secret")
+		return "", nil, 0, fmt.Errorf("failed to transform secret: %w", err)
+	}
+	s.secrets.addData(destData)
+
+	if err := s.validateSchema(destPath, destData); err != nil {
+		if s.cfg.SchemaValidation.Mode == SchemaModeEnforce {
+			s.log.Error().Err(err).Str("secret", path).Msg("Secret failed schema validation, not writing")
+			return "", nil, 0, err
+		}
+		s.log.Warn().Err(err).Str("secret", path).Msg("Secret failed schema validation")
+	}
+
+	event := SecretEvent{Mount: mount, Path: path, DestinationPath: destPath, Data: destData}
+	if err := s.beforeWrite(ctx, event); err != nil {
+		if !errors.Is(err, ErrSkipSecret) {
+			s.log.Error().Err(err).Str("secret", path).Msg("Write vetoed by hook")
+		}
+		return "", nil, 0, fmt.Errorf("write vetoed by hook: %w", err)
+	}
+
+	release, err := acquire(ctx, s.writeSlots)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	defer release()
+
+	if s.destination != nil {
+		writeCtx, writeSpan := s.startSpan(ctx, "write destination", mount, destPath)
+		destVersion, err := s.writeExternal(writeCtx, destPath, destData)
+		endSpan(writeSpan, err)
+		if err != nil {
+			s.log.Error().Err(err).Str("secret", path).Str("destination", s.destination.Name()).Msg("Failed to write secret to destination")
+			return "", nil, 0, fmt.Errorf("failed to write secret to destination: %w", err)
+		}
+		event.Version = destVersion
+		s.audit(AuditRecord{Operation: AuditWrite, Target: s.destination.Name(), Mount: mount, Path: destPath, SourcePath: path, SourceVersion: srcVersion, DestinationVersion: destVersion}, destData)
+		s.report.transferred(destData)
+		s.afterWrite(ctx, event)
+		return destPath, destData, destVersion, nil
+	}
+
+	mount = s.destMount(mount)
+	body := s.kvBody(ctx, s.destinationVault, mount, destData)
+	manifest, chunks, err := s.splitChunks(destData)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to chunk secret")
+		return "", nil, 0, fmt.Errorf("failed to chunk secret: %w", err)
+	}
+
+	var destResp *vault.Response[map[string]interface{}]
+	writeCtx, writeSpan := s.startSpan(ctx, "write destination", mount, destPath)
+	if manifest != nil {
+		s.log.Debug().Str("secret", path).Int("chunks", len(chunks)).Msg("Secret exceeds maximum size, writing in chunks")
+		err = s.writeChunks(writeCtx, mount, destPath, chunks)
+		body = s.kvBody(ctx, s.destinationVault, mount, manifest)
+	}
+	if err == nil {
+		err = s.withRetry(writeCtx, "write", func() (err error) {
+			if err := s.writeLimiter.Wait(writeCtx); err != nil {
+				return err
+			}
+			destResp, err = s.destinationVault.Write(writeCtx, s.kvPath(writeCtx, s.destinationVault, mount, "data", destPath), body, vault.WithMountPath(mount))
+			return err
+		})
+	}
+	endSpan(writeSpan, err)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to write secret to destination vault")
+		return "", nil, 0, fmt.Errorf("failed to write secret to destination vault: %w", err)
+	}
+	// A secret that shrank leaves chunks the manifest no longer counts.
+	if s.cfg.Chunking.Enabled {
+		if err := s.pruneChunks(ctx, mount, destPath, len(chunks)); err != nil {
+			s.log.Warn().Err(err).Str("secret", path).Msg("Failed to remove stale chunks")
+		}
+	}
+
+	// KV v1 writes return no response, nor a version.
+	if destResp != nil {
+		event.Version = version(destResp.Data)
+	}
+	s.audit(AuditRecord{Operation: AuditWrite, Target: AuditDestination, Mount: mount, Path: destPath, SourcePath: path, SourceVersion: srcVersion, DestinationVersion: event.Version}, destData)
+	s.report.transferred(destData)
+	s.afterWrite(ctx, event)
+	return destPath, destData, event.Version, nil
+}
+
+// recordSynced remembers a written secret for the verification stage.
+//
+// Arguments:
+//
+//	path: string - The source path of the secret.
+//	destPath: string - The destination path of the secret.
+//	destData: map[string]interface{} - The data written to the destination.
+//
+// Returns:
+//
+//	error - An error if the data could not be checksummed.
+func (s *Syncer) recordSynced(path, destPath string, destData map[string]interface{}) error {
+	sum, err := s.checksum(destData)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to checksum source secret")
+		return fmt.Errorf("failed to checksum source secret: %w", err)
+	}
+
+	s.syncedMu.Lock()
+	s.synced[destPath] = syncedSecret{source: path, sum: sum}
+	s.desired[destPath] = true
+	s.syncedMu.Unlock()
+
+	s.log.Debug().Str("secret", path).Str("destination", destPath).Msg("Secret copied")
+	return nil
+}
+
+// version extracts the KV v2 version number from a write response, or 0 if
+// it is missing.
+func version(data map[string]interface{}) int64 {
+	switch v := data["version"].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// resetSynced forgets the secrets written and seen by the previous run, so
+// each run verifies, checksums, and prunes against its own secrets only.
+func (s *Syncer) resetSynced() {
+	s.syncedMu.Lock()
+	s.synced = make(map[string]syncedSecret)
+	s.desired = make(map[string]bool)
+	s.syncedMu.Unlock()
+}
+
+// verify reads back every secret written during the copy stage from the
+// destination vault, BatchSize at a time, and compares it against the
+// source checksum.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//
+// Returns:
+//
+//	error - An error if the verification stage ran out of time.
+func (s *Syncer) verify(ctx context.Context, mount string) error {
+	s.syncedMu.Lock()
+	synced := make(map[string]syncedSecret, len(s.synced))
+	paths := make([]string, 0, len(s.synced))
+	for path, secret := range s.synced {
+		synced[path] = secret
+		paths = append(paths, path)
+	}
+	s.syncedMu.Unlock()
+
+	runPool(ctx, s.cfg.BatchSize, paths, func(ctx context.Context, path string) {
+		s.verifySecret(ctx, mount, path, synced[path])
+	})
+	return ctx.Err()
+}
+
+// verifySecret reads back one written secret from the destination vault and
+// fails it in the report if it does not match the source checksum.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	path: string - The destination path of the secret.
+//	synced: syncedSecret - Where the secret came from and the checksum written.
+//
+// Returns: nothing
+func (s *Syncer) verifySecret(ctx context.Context, mount, path string, synced syncedSecret) {
+	readCtx, span := s.startSpan(ctx, "verify secret", mount, path)
+	start := time.Now()
+	destData, err := s.readDestination(readCtx, mount, path)
+	s.report.timing(synced.source, stageVerify, time.Since(start))
+	endSpan(span, err)
+	if err != nil {
+		// Secrets cut short by the end of the stage are not failures.
+		if ctx.Err() != nil {
+			return
+		}
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to get secret from destination")
+		s.report.fail(synced.source, fmt.Errorf("failed to read secret back from destination: %w", err))
+		s.recordFailure(synced.source, err)
+		return
+	}
+
+	destSum, err := s.checksum(destData)
+	if err != nil {
+		s.log.Error().Err(err).Str("secret", path).Msg("Failed to checksum destination secret")
+		s.report.fail(synced.source, fmt.Errorf("failed to checksum destination secret: %w", err))
+		s.recordFailure(synced.source, err)
+		return
+	}
+
+	if synced.sum == destSum {
+		s.log.Debug().Str("secret", path).Str("mount", mount).Msg("Secret synced")
+		return
+	}
+	s.log.Error().Str("secret", path).Str("mount", mount).Msg("Secrets do not match")
+	err = fmt.Errorf("destination secret does not match source")
+	s.report.fail(synced.source, err)
+	s.recordFailure(synced.source, err)
+}
+
+// destMount returns the destination vault mount that secrets on mount are
+// written to, which is the same mount unless destinationMount is set.
+func (s *Syncer) destMount(mount string) string {
+	if s.destinationMount != "" {
+		return s.destinationMount
+	}
+	return mount
+}
+
+// readDestination reads a written secret back from the destination,
+// reassembling it if it was chunked.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the operation.
+//	mount: string - The mount path of the destination vault.
+//	path: string - The destination path of the secret.
+//
+// Returns:
+//
+//	map[string]interface{} - The secret data.
+//	error - An error if the secret could not be read.
+func (s *Syncer) readDestination(ctx context.Context, mount, path string) (map[string]interface{}, error) {
+	if s.destination != nil {
+		var data map[string]interface{}
+		err := s.withRetry(ctx, "verify", func() (err error) {
+			if err := s.writeLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			data, err = s.destination.Read(ctx, path)
+			return err
+		})
+		s.secrets.addData(data)
+		return data, err
+	}
+
+	var destResp *vault.Response[map[string]interface{}]
+	err := s.withRetry(ctx, "verify", func() (err error) {
+		if err := s.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		destResp, err = s.destinationVault.Read(ctx, s.kvPath(ctx, s.destinationVault, s.destMount(mount), "data", path), vault.WithMountPath(s.destMount(mount)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	destData, _ := s.kvData(ctx, s.destinationVault, s.destMount(mount), destResp.Data)
+	destData, err = s.reassemble(ctx, s.writeLimiter, s.destMount(mount), path, destData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reassemble destination secret: %w", err)
+	}
+	s.secrets.addData(destData)
+	return destData, nil
+}
+
+// checksum returns the SHA-256 of the JSON encoding of the given secret data.
+func (s *Syncer) checksum(data interface{}) ([32]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return sha256.Sum256(b), nil
+}
+
+// withStageTimeout derives a context for a single sync stage, bounded by the
+// given timeout. A zero or negative timeout leaves the stage unbounded.
+func withStageTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Sync performs a sync of the configured source path/mount. Cancelling ctx
+// stops in-flight reads and writes and any further batches; the report is
+// still saved, marked as cancelled, so the run can be resumed. Likewise,
+// once MaxDuration has passed, secrets in flight are finished and the run
+// stops with ErrMaxDuration, saved so it can be resumed.
+//
+// Arguments:
+//
+//	ctx: context.Context - The context for the sync.
+//
+// Returns:
+//
+//	*Report - A structured report of what happened. It is never nil, even on error.
+//	error - An error if there was a problem syncing the path. It wraps context.Canceled if ctx was cancelled.
+func (s *Syncer) Sync(ctx context.Context) (_ *Report, err error) {
+	// A multi-mount run shares one deadline between its mounts.
+	if s.cfg.MaxDuration > 0 && s.deadline.IsZero() {
+		s.deadline = time.Now().Add(s.cfg.MaxDuration)
+		defer func() { s.deadline = time.Time{} }()
+	}
+	if s.cfg.AllKVMounts {
+		return s.syncAllMounts(ctx)
+	}
+	if s.cfg.SourceVault != nil && len(s.cfg.SourceVault.Mounts) > 0 {
+		return s.syncMounts(ctx)
+	}
+
+	syncContext, span := s.tracer.Start(ctx, "sync")
+	defer span.End()
+
+	syncContext, syncCancel := context.WithCancel(syncContext)
+	defer syncCancel()
+	s.abort, s.failures, s.errorLimit, s.stopErr = syncCancel, 0, -1, nil
+	defer func() { s.abort = nil }()
+
+	s.report = newReport(s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path)
+	s.report.Shard = s.cfg.Shard.String()
+	s.resetSynced()
+	s.resumed = nil
+	if s.cfg.Resume {
+		s.resumeInterrupted()
+	}
+	s.checkpoint()
+	defer func() {
+		s.report.finish()
+		if err := SaveRun(s.cfg.RunDir(), s.report); err != nil {
+			s.log.Error().Err(err).Msg("Failed to save run state")
+		}
+		s.logSummary(s.report, err)
+	}()
+
+	defer func() {
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		s.report.Cancelled = true
+		if !errors.Is(err, context.Canceled) {
+			err = fmt.Errorf("sync cancelled: %w", ctx.Err())
+		}
+		s.log.Warn().Str("run", s.report.RunID).Msg("Sync cancelled")
+	}()
+
+	if s.cfg.Bidirectional.Enabled {
+		if err := s.loadBidirectionalState(); err != nil {
+			return s.report, err
+		}
+		defer func() {
+			if err := s.saveBidirectionalState(); err != nil {
+				s.log.Error().Err(err).Msg("Failed to save bidirectional state")
+			}
+		}()
+	}
+
+	go s.watchTokens(syncContext)
+
+	skip, err := s.checkReplicated(syncContext, s.cfg.SourceVault.Mount)
+	if err != nil {
+		return s.report, fmt.Errorf("failed to detect replication: %w", err)
+	}
+	if skip {
+		s.report.Replicated = true
+		return s.report, nil
+	}
+	if err := s.prepareDestinationMount(syncContext, s.cfg.SourceVault.Mount); err != nil {
+		return s.report, err
+	}
+	if err := s.checkKVFeatures(syncContext, s.cfg.SourceVault.Mount); err != nil {
+		return s.report, err
+	}
+
+	s.log.Info().Msg("Starting sync")
+
+	stageStart := time.Now()
+	discoveryCtx, discoveryCancel := withStageTimeout(syncContext, s.cfg.Timeouts.Discovery)
+	defer discoveryCancel()
+	discoveryCtx, discoveryDeadline := s.withDeadline(discoveryCtx)
+	defer discoveryDeadline()
+	discoveryCtx, discoverySpan := s.tracer.Start(discoveryCtx, "discovery")
+
+	var (
+		srcList []string
+		keys    <-chan string
+		listed  func() (time.Time, error)
+	)
+	feedCtx, feedCancel := context.WithCancel(syncContext)
+	defer feedCancel()
+	streaming := s.streamListing()
+	if streaming {
+		if s.errorLimit, err = errorLimit(s.cfg.MaxErrors, 0); err != nil {
+			endSpan(discoverySpan, err)
+			return s.report, fmt.Errorf("invalid maxErrors: %w", err)
+		}
+		// The listing is read only as fast as the copy stage takes its
+		// keys, so it is bounded by the copy timeout as well as the
+		// discovery one.
+		listCtx, listCancel := withStageTimeout(feedCtx, s.cfg.Timeouts.Discovery)
+		defer listCancel()
+		listCtx, copyTimeoutCancel := withStageTimeout(listCtx, s.cfg.Timeouts.Copy)
+		defer copyTimeoutCancel()
+		keys, listed = s.streamSourcePath(listCtx, s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path, s.cfg.BatchSize)
+	} else {
+		srcList, err = s.listSourcePath(discoveryCtx, s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path)
+		if err == nil && s.cfg.Bidirectional.Enabled {
+			srcList, err = s.listBothPaths(discoveryCtx, s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path, srcList)
+		}
+		s.report.Durations.Discovery = Duration(time.Since(stageStart))
+		endSpan(discoverySpan, err)
+		if err != nil && s.pastDeadline() {
+			return s.report, s.stopAtDeadline()
+		}
+		if vault.IsErrorStatus(err, 403) {
+			s.report.recordFolder(s.cfg.SourceVault.Path, ActionDenied, err)
+		}
+		if err != nil {
+			return s.report, fmt.Errorf("failed to list source path: %w", err)
+		}
+		srcList = s.shardKeys(s.cfg.SourceVault.Path, srcList)
+		if s.cfg.Ordered {
+			sort.Strings(srcList)
+		}
+		s.report.Discovered = len(secretKeys(srcList))
+		if s.errorLimit, err = errorLimit(s.cfg.MaxErrors, len(srcList)); err != nil {
+			return s.report, fmt.Errorf("invalid maxErrors: %w", err)
+		}
+
+		if err := s.awaitApproval(syncContext, srcList); err != nil {
+			return s.report, fmt.Errorf("sync not approved: %w", err)
+		}
+		keys = sendKeys(feedCtx, srcList)
+	}
+
+	if !streaming {
+		stageStart = time.Now()
+	}
+	copyCtx, copyCancel := withStageTimeout(syncContext, s.cfg.Timeouts.Copy)
+	defer copyCancel()
+	copyCtx, copySpan := s.tracer.Start(copyCtx, "copy")
+
+	discovered, copyErr := s.copyKeys(copyCtx, s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path, keys)
+	feedCancel()
+	var listErr error
+	if streaming {
+		var finished time.Time
+		finished, listErr = listed()
+		s.report.Durations.Discovery = Duration(finished.Sub(stageStart))
+		s.report.Discovered = discovered
+		endSpan(discoverySpan, listErr)
+	}
+	s.report.Durations.Copy = Duration(time.Since(stageStart))
+	if copyErr != nil {
+		endSpan(copySpan, copyErr)
+		return s.report, fmt.Errorf("copy stage aborted: %w", copyErr)
+	}
+	if s.stopped() {
+		err := s.stopOnFailure()
+		endSpan(copySpan, err)
+		return s.report, err
+	}
+	if s.report.DeadlineExceeded || s.pastDeadline() {
+		endSpan(copySpan, ErrMaxDuration)
+		return s.report, s.stopAtDeadline()
+	}
+	if listErr != nil {
+		endSpan(copySpan, listErr)
+		if vault.IsErrorStatus(listErr, 403) {
+			s.report.recordFolder(s.cfg.SourceVault.Path, ActionDenied, listErr)
+		}
+		return s.report, fmt.Errorf("failed to list source path: %w", listErr)
+	}
+	copySpan.End()
+
+	stageStart = time.Now()
+	verifyCtx, verifyCancel := withStageTimeout(syncContext, s.cfg.Timeouts.Verify)
+	defer verifyCancel()
+	verifyCtx, verifyDeadline := s.withDeadline(verifyCtx)
+	defer verifyDeadline()
+	verifyCtx, verifySpan := s.tracer.Start(verifyCtx, "verify")
+
+	err = s.verify(verifyCtx, s.cfg.SourceVault.Mount)
+	s.report.Durations.Verify = Duration(time.Since(stageStart))
+	endSpan(verifySpan, err)
+	if s.stopped() {
+		return s.report, s.stopOnFailure()
+	}
+	if err != nil && s.pastDeadline() {
+		return s.report, s.stopAtDeadline()
+	}
+	if err != nil {
+		return s.report, fmt.Errorf("verification stage aborted: %w", err)
+	}
+	s.report.Verified = true
+
+	if s.cfg.Checksums.Enabled && !s.pastDeadline() {
+		if err := s.writeFolderChecksums(syncContext, s.cfg.SourceVault.Mount); err != nil {
+			return s.report, fmt.Errorf("failed to write folder checksums: %w", err)
+		}
+	}
+	if s.cfg.Prune.Enabled && !s.pastDeadline() {
+		if err := s.pruneOrphans(syncContext, s.cfg.SourceVault.Mount, s.cfg.SourceVault.Path); err != nil {
+			return s.report, fmt.Errorf("failed to prune destination: %w", err)
+		}
+	}
+
+	s.report.finish()
+	if len(s.report.Duplicates) > 0 {
+		s.log.Warn().Int("groups", len(s.report.Duplicates)).Msg("Found source secrets with identical data; see the report's duplicates")
+	}
+	if s.report.Denied > 0 {
+		s.log.Warn().Strs("paths", s.report.PermissionDenied).Msg("Permission denied; fix the token's policies and resume the run to sync them")
+	}
+	if err := s.report.err(); err != nil {
+		return s.report, err
+	}
+	return s.report, nil
+}
+
+// logSummary logs the totals of a finished run: at info level if it
+// succeeded, and at error level with err if it did not.
+//
+// Arguments:
+//
+//	r: *Report - The finished report of the run.
+//	err: error - The error the run ended with, if any.
+//
+// Returns: nothing
+func (s *Syncer) logSummary(r *Report, err error) {
+	secretsPerSecond, bytesPerSecond := r.Throughput()
+
+	ev, msg := s.log.Info(), "Sync complete"
+	var syncErr *SyncError
+	switch {
+	case errors.As(err, &syncErr):
+		ev, msg = s.log.Error(), "Sync complete with failures"
+	case err != nil:
+		ev, msg = s.log.Error().Err(err), "Sync failed"
+	}
+	ev.Str("run", r.RunID).
+		Int("discovered", r.Discovered).
+		Int("created", r.Created).
+		Int("updated", r.Updated).
+		Int("unchanged", r.Unchanged).
+		Int("skipped", r.Skipped).
+		Int("failed", r.Failed).
+		Int("denied", r.Denied).
+		Int("pruned", r.Deleted+r.Destroyed).
+		Int64("bytes", r.Bytes).
+		Dur("elapsed", time.Duration(r.Durations.Total)).
+		Float64("secretsPerSecond", secretsPerSecond).
+		Float64("bytesPerSecond", bytesPerSecond).
+		Msg(msg)
+}